@@ -0,0 +1,45 @@
+// Command grant-role adds roles to a registered user, to create the first
+// administrators without exposing a bootstrap through the API
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/clementeaf/bike-tracker/internal/user"
+	"github.com/clementeaf/bike-tracker/pkg/config"
+	"github.com/clementeaf/bike-tracker/pkg/database"
+)
+
+func main() {
+	email := flag.String("email", "", "email del usuario registrado")
+	roles := flag.String("roles", "fleet-admin", "roles a agregar, separados por coma")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email es requerido")
+	}
+
+	// Cargar variables de entorno
+	config.LoadEnv()
+
+	database.ConnectMongo()
+	defer database.DisconnectMongo()
+
+	user.SetStore(user.NewMongoStore(database.GetCollection("users")))
+
+	granted := []string{}
+	for _, role := range strings.Split(*roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			granted = append(granted, role)
+		}
+	}
+
+	updated, err := user.GrantRoles(*email, granted)
+	if err != nil {
+		log.Fatalf("No se pudieron asignar los roles a %s: %v", *email, err)
+	}
+	fmt.Printf("Roles de %s: %s\n", updated.Email, strings.Join(updated.RoleList(), ", "))
+}
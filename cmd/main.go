@@ -5,11 +5,24 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/clementeaf/bike-tracker/internal/api"
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/command"
+	"github.com/clementeaf/bike-tracker/internal/issue"
+	"github.com/clementeaf/bike-tracker/internal/maintenance"
+	"github.com/clementeaf/bike-tracker/internal/reservation"
+	"github.com/clementeaf/bike-tracker/internal/ride"
+	"github.com/clementeaf/bike-tracker/internal/user"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
 	"github.com/clementeaf/bike-tracker/pkg/config"
 	"github.com/clementeaf/bike-tracker/pkg/database"
 	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"github.com/clementeaf/bike-tracker/pkg/mqtt"
+	"github.com/clementeaf/bike-tracker/pkg/password"
 	"github.com/joho/godotenv"
 )
 
@@ -22,8 +35,103 @@ func main() {
 	// Cargar variables de entorno
 	config.LoadEnv()
 
-	// Conectar a MongoDB
-	database.ConnectMongo()
+	// Moneda por defecto de los montos (ISO 4217)
+	if currency := os.Getenv("CURRENCY"); currency != "" {
+		money.DefaultCurrency = currency
+	}
+
+	// Conectar a MongoDB (salvo que se use el backend en memoria)
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend != api.StorageMemory {
+		database.ConnectMongo()
+	}
+
+	// Inyectar repositorios en los servicios
+	api.ConfigureStores(backend)
+
+	// No arrancar si los saldos guardados están en otra moneda que CURRENCY
+	if err := wallet.CheckCurrency(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Claves con las que se firman y verifican los tokens
+	if err := auth.ConfigureKeysFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Duración de los tokens de acceso y de las sesiones sin renovar
+	if err := auth.ConfigureTokensFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Roles que solo tienen sus permisos en sesiones con segundo factor
+	if err := auth.ConfigureMFAFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Costo del hash de contraseñas
+	if err := password.ConfigureFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Enlaces de los correos, verificación de email obligatoria y emisor MFA
+	user.ConfigureFromEnv()
+
+	// Duración y cargo por no uso de las reservas de bicicletas
+	if err := reservation.ConfigureFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Límites para finalizar viajes abandonados
+	if err := ride.ConfigureStaleRidesFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Espera máxima de la confirmación del candado al iniciar un viaje
+	if err := command.ConfigureFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Severidad de los reportes de problemas y desde cuál se retira la bicicleta
+	if err := issue.ConfigureFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Candados simulados que confirman los comandos, para probar sin hardware
+	if os.Getenv("DEVICE_SIMULATOR") == "true" {
+		command.StartSimulator(500 * time.Millisecond)
+	}
+
+	// Revertir o completar sagas de viajes interrumpidas
+	ride.StartSagaRecovery(time.Minute)
+
+	// Liberar retenciones de saldo vencidas (viajes abandonados)
+	wallet.StartHoldExpiry(time.Minute)
+
+	// Liberar bicicletas de reservas vencidas y cobrar el cargo por no uso
+	reservation.StartReservationExpiry(30 * time.Second)
+
+	// Vencer comandos que ningún candado confirmó
+	command.StartCommandExpiry(time.Minute)
+
+	// Abrir órdenes de trabajo para las bicicletas que deben ir a servicio
+	maintenance.StartMaintenanceScheduler(10 * time.Minute)
+
+	// Finalizar viajes sin actividad o que exceden la duración máxima
+	ride.StartStaleRideDetection(time.Minute)
+
+	// Agregar las posiciones de los candados al recorrido del viaje en curso
+	bike.SetPositionListener(ride.RecordDevicePositions)
+
+	// Telemetría de los candados por MQTT, si hay un broker configurado
+	if broker := os.Getenv("MQTT_BROKER"); broker != "" {
+		bike.StartTelemetrySubscriber(mqtt.Options{
+			Broker:   broker,
+			ClientID: "bike-tracker",
+			Username: os.Getenv("MQTT_USERNAME"),
+			Password: os.Getenv("MQTT_PASSWORD"),
+		})
+	}
 
 	// Inicializar logger
 	logger.InitLogger()
@@ -0,0 +1,78 @@
+// Command migrate-ledger opens in the ledger the wallets that predate it,
+// folding in the balance kept in users.wallet_balance. Run it with the API
+// stopped; running it twice has no effect
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/config"
+	"github.com/clementeaf/bike-tracker/pkg/database"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Balance users kept before wallets existed
+type legacyUser struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	WalletBalance money.Money        `bson:"wallet_balance"`
+}
+
+func main() {
+	// Cargar variables de entorno
+	config.LoadEnv()
+
+	database.ConnectMongo()
+	defer database.DisconnectMongo()
+
+	users := database.GetCollection("users")
+	wallet.SetStore(wallet.NewMongoStore(database.GetCollection("wallets"), database.GetCollection("journal_entries"), database.GetCollection("wallet_holds")))
+
+	legacy, err := legacyBalances(users)
+	if err != nil {
+		log.Fatalf("Error al leer los saldos de users.wallet_balance: %v", err)
+	}
+
+	opened, err := wallet.OpenLedger(legacy)
+	if err != nil {
+		log.Fatalf("Migración interrumpida tras %d wallets: %v", opened, err)
+	}
+	fmt.Printf("Wallets abiertas en el libro contable: %d\n", opened)
+
+	// Los saldos ya están en el libro contable
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := users.UpdateMany(ctx, bson.M{"wallet_balance": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"wallet_balance": ""}}); err != nil {
+		log.Fatalf("Error al limpiar users.wallet_balance: %v", err)
+	}
+}
+
+func legacyBalances(users *mongo.Collection) (map[primitive.ObjectID]money.Money, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	filter := bson.M{"wallet_balance": bson.M{"$exists": true}}
+	cursor, err := users.Find(ctx, filter, options.Find().SetProjection(bson.M{"wallet_balance": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []legacyUser
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	balances := make(map[primitive.ObjectID]money.Money, len(found))
+	for _, user := range found {
+		balances[user.ID] = user.WalletBalance
+	}
+	return balances, nil
+}
@@ -0,0 +1,34 @@
+// Command migrate-passwords hashes the user passwords still stored in
+// plaintext. It is safe to run while the API is serving and to run twice
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/clementeaf/bike-tracker/internal/user"
+	"github.com/clementeaf/bike-tracker/pkg/config"
+	"github.com/clementeaf/bike-tracker/pkg/database"
+	"github.com/clementeaf/bike-tracker/pkg/password"
+)
+
+func main() {
+	// Cargar variables de entorno
+	config.LoadEnv()
+
+	// Mismo costo de hash que la API
+	if err := password.ConfigureFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	database.ConnectMongo()
+	defer database.DisconnectMongo()
+
+	user.SetStore(user.NewMongoStore(database.GetCollection("users")))
+
+	migrated, err := user.MigratePlaintextPasswords()
+	if err != nil {
+		log.Fatalf("Migración interrumpida tras %d contraseñas: %v", migrated, err)
+	}
+	fmt.Printf("Contraseñas migradas: %d\n", migrated)
+}
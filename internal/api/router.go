@@ -4,9 +4,16 @@ import (
 	"net/http"
 
 	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/command"
+	"github.com/clementeaf/bike-tracker/internal/geofence"
+	"github.com/clementeaf/bike-tracker/internal/issue"
+	"github.com/clementeaf/bike-tracker/internal/maintenance"
+	"github.com/clementeaf/bike-tracker/internal/pricing"
+	"github.com/clementeaf/bike-tracker/internal/reservation"
 	"github.com/clementeaf/bike-tracker/internal/ride"
 	"github.com/clementeaf/bike-tracker/internal/user"
 	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
 	"github.com/clementeaf/bike-tracker/pkg/middleware"
 )
 
@@ -26,6 +33,27 @@ func NewRouter() http.Handler {
 	// Registrar rutas de bicicletas
 	bike.RegisterRoutes(mux)
 
+	// Registrar rutas de comandos a los candados
+	command.RegisterRoutes(mux)
+
+	// Registrar rutas de reservas
+	reservation.RegisterRoutes(mux)
+
+	// Registrar rutas de tarifas
+	pricing.RegisterRoutes(mux)
+
+	// Registrar rutas de zonas de operación
+	geofence.RegisterRoutes(mux)
+
+	// Registrar rutas de mantenimiento
+	maintenance.RegisterRoutes(mux)
+
+	// Registrar rutas de reportes de problemas
+	issue.RegisterRoutes(mux)
+
+	// Claves públicas para que otros servicios verifiquen los tokens
+	mux.Handle("/.well-known/jwks.json", middleware.Public(http.HandlerFunc(auth.HandleJWKS)))
+
 	// Ruta raíz (para manejar rutas no encontradas)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error": "Ruta no encontrada"}`, http.StatusNotFound)
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/command"
+	"github.com/clementeaf/bike-tracker/internal/geofence"
+	"github.com/clementeaf/bike-tracker/internal/issue"
+	"github.com/clementeaf/bike-tracker/internal/maintenance"
+	"github.com/clementeaf/bike-tracker/internal/pricing"
+	"github.com/clementeaf/bike-tracker/internal/reservation"
+	"github.com/clementeaf/bike-tracker/internal/ride"
+	"github.com/clementeaf/bike-tracker/internal/user"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/blob"
+	"github.com/clementeaf/bike-tracker/pkg/database"
+	"github.com/clementeaf/bike-tracker/pkg/idempotency"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/mail"
+)
+
+// Storage backends
+const (
+	StorageMongo  = "mongo"
+	StorageMemory = "memory"
+)
+
+// ConfigureStores inyecta en cada dominio la implementación de persistencia elegida
+func ConfigureStores(backend string) {
+	configureTariffs(backend)
+	configurePhotos()
+	configureMail()
+
+	if backend == StorageMemory {
+		bike.SetStore(bike.NewMemoryStore())
+		command.SetStore(command.NewMemoryStore())
+		geofence.SetStore(geofence.NewMemoryStore())
+		issue.SetStore(issue.NewMemoryStore())
+		maintenance.SetRuleStore(maintenance.NewMemoryRuleStore())
+		maintenance.SetWorkOrderStore(maintenance.NewMemoryWorkOrderStore())
+		reservation.SetStore(reservation.NewMemoryStore())
+		ride.SetStore(ride.NewMemoryStore())
+		ride.SetSagaStore(ride.NewMemorySagaStore())
+		ride.SetTrackStore(ride.NewMemoryTrackStore())
+		wallet.SetStore(wallet.NewMemoryStore())
+		user.SetStore(user.NewMemoryStore())
+		idempotency.SetStore(idempotency.NewMemoryStore())
+		auth.SetStore(auth.NewMemoryStore())
+		return
+	}
+
+	bikeStore := bike.NewMongoStore(database.GetCollection("bikes"))
+	ensureIndexes("bikes", bikeStore.EnsureIndexes)
+	bike.SetStore(bikeStore)
+	commandStore := command.NewMongoStore(database.GetCollection("bike_commands"))
+	ensureIndexes("bike_commands", commandStore.EnsureIndexes)
+	command.SetStore(commandStore)
+	geofenceStore := geofence.NewMongoStore(database.GetCollection("geofences"))
+	ensureIndexes("geofences", geofenceStore.EnsureIndexes)
+	geofence.SetStore(geofenceStore)
+	issueStore := issue.NewMongoStore(database.GetCollection("issues"))
+	ensureIndexes("issues", issueStore.EnsureIndexes)
+	issue.SetStore(issueStore)
+	maintenance.SetRuleStore(maintenance.NewMongoRuleStore(database.GetCollection("maintenance_rules")))
+	workOrderStore := maintenance.NewMongoWorkOrderStore(database.GetCollection("work_orders"))
+	ensureIndexes("work_orders", workOrderStore.EnsureIndexes)
+	maintenance.SetWorkOrderStore(workOrderStore)
+	reservationStore := reservation.NewMongoStore(database.GetCollection("reservations"))
+	ensureIndexes("reservations", reservationStore.EnsureIndexes)
+	reservation.SetStore(reservationStore)
+	ride.SetStore(ride.NewMongoStore(database.GetCollection("rides")))
+	ride.SetSagaStore(ride.NewMongoSagaStore(database.GetCollection("ride_sagas")))
+	trackStore := ride.NewMongoTrackStore(database.GetCollection("ride_tracks"))
+	ensureIndexes("ride_tracks", trackStore.EnsureIndexes)
+	ride.SetTrackStore(trackStore)
+	walletStore := wallet.NewMongoStore(database.GetCollection("wallets"), database.GetCollection("journal_entries"), database.GetCollection("wallet_holds"))
+	ensureIndexes("wallet_holds", walletStore.EnsureIndexes)
+	wallet.SetStore(walletStore)
+	user.SetStore(user.NewMongoStore(database.GetCollection("users")))
+
+	idempotencyStore := idempotency.NewMongoStore(database.GetCollection("idempotency_keys"))
+	ensureIndexes("idempotency_keys", idempotencyStore.EnsureIndexes)
+	idempotency.SetStore(idempotencyStore)
+
+	sessionStore := auth.NewMongoStore(database.GetCollection("sessions"), database.GetCollection("refresh_tokens"), database.GetCollection("revoked_sessions"), database.GetCollection("used_action_tokens"))
+	ensureIndexes("sessions", sessionStore.EnsureIndexes)
+	auth.SetStore(sessionStore)
+}
+
+// Photos of issue reports go to local disk or S3-compatible storage, per BLOB_BACKEND
+func configurePhotos() {
+	photoStore, err := blob.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Error al configurar el almacenamiento de fotos: %v", err)
+	}
+	issue.SetPhotoStore(photoStore)
+}
+
+// Verification and password reset emails go to an SMTP server or to files, per MAIL_BACKEND
+func configureMail() {
+	sender, err := mail.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Error al configurar el envío de correos: %v", err)
+	}
+	user.SetMailer(sender)
+}
+
+// Tariffs come from PRICING_FILE when set, otherwise from the storage backend
+func configureTariffs(backend string) {
+	if path := os.Getenv("PRICING_FILE"); path != "" {
+		fileStore, err := pricing.NewFileStore(path)
+		if err != nil {
+			log.Fatalf("Error al cargar tarifas desde %s: %v", path, err)
+		}
+		pricing.SetStore(fileStore)
+		return
+	}
+
+	if backend == StorageMemory {
+		pricing.SetStore(pricing.NewMemoryStore())
+		return
+	}
+	pricing.SetStore(pricing.NewMongoStore(database.GetCollection("tariffs")))
+}
+
+// Create the indexes a store relies on, logging failures without aborting
+func ensureIndexes(collection string, ensure func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := ensure(ctx); err != nil {
+		logger.Error("ConfigureStores - Error al crear índices", map[string]interface{}{
+			"collection": collection,
+			"error":      err.Error(),
+		})
+	}
+}
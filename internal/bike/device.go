@@ -0,0 +1,95 @@
+package bike
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrDeviceUnauthorized = errors.New("dispositivo no autorizado")
+
+// Issue a new secret key for the device of a bike, replacing the previous one.
+// Only its hash is stored, so the key is returned just this once
+func IssueDeviceKey(bikeID string) (string, error) {
+	bikeObjectID, err := primitive.ObjectIDFromHex(bikeID)
+	if err != nil {
+		return "", ErrBikeNotFound
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(secret)
+
+	err = updateBike(bikeObjectID, func(bike *Bike) {
+		bike.DeviceKeyHash = hashDeviceKey(key)
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Record the lock state confirmed by the device of a bike
+func SetLocked(bikeID primitive.ObjectID, locked bool) error {
+	return updateBike(bikeID, func(bike *Bike) {
+		bike.Locked = locked
+	})
+}
+
+// Check the key presented by the device of a bike
+func AuthenticateDevice(bikeID, key string) (Bike, error) {
+	bikeObjectID, err := primitive.ObjectIDFromHex(bikeID)
+	if err != nil || key == "" {
+		return Bike{}, ErrDeviceUnauthorized
+	}
+
+	bike, err := GetBikeByID(bikeObjectID)
+	if err != nil {
+		return bike, ErrDeviceUnauthorized
+	}
+
+	expected := []byte(bike.DeviceKeyHash)
+	if len(expected) == 0 || subtle.ConstantTimeCompare(expected, []byte(hashDeviceKey(key))) != 1 {
+		return bike, ErrDeviceUnauthorized
+	}
+	return bike, nil
+}
+
+// Check a payload signed by the device of a bike, for transports where the
+// device is not authenticated by itself (MQTT). The payload starts with the
+// HMAC-SHA256 of the rest, keyed with the SHA-256 of the device key. Returns
+// the rest
+func VerifyDevicePayload(bikeID primitive.ObjectID, payload []byte) ([]byte, error) {
+	if len(payload) < sha256.Size {
+		return nil, ErrDeviceUnauthorized
+	}
+
+	bike, err := GetBikeByID(bikeID)
+	if err != nil {
+		return nil, ErrDeviceUnauthorized
+	}
+	key, err := hex.DecodeString(bike.DeviceKeyHash)
+	if err != nil || len(key) == 0 {
+		return nil, ErrDeviceUnauthorized
+	}
+
+	signature, body := payload[:sha256.Size], payload[sha256.Size:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrDeviceUnauthorized
+	}
+	return body, nil
+}
+
+func hashDeviceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
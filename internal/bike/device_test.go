@@ -0,0 +1,66 @@
+package bike
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestVerifyDevicePayload(t *testing.T) {
+	SetStore(NewMemoryStore())
+	bike, err := RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := IssueDeviceKey(bike.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"bat":80,"ts":1700000000}`)
+	signed := sign(key, body)
+	tampered := append([]byte{}, signed...)
+	tampered[len(tampered)-2] = '1'
+
+	tests := []struct {
+		name    string
+		bike    Bike
+		payload []byte
+		wantErr bool
+	}{
+		{name: "signed", bike: *bike, payload: signed},
+		{name: "unsigned", bike: *bike, payload: body, wantErr: true},
+		{name: "tampered", bike: *bike, payload: tampered, wantErr: true},
+		{name: "wrong key", bike: *bike, payload: sign("otra", body), wantErr: true},
+		{name: "other bike", bike: *other, payload: signed, wantErr: true},
+		{name: "too short", bike: *bike, payload: signed[:10], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyDevicePayload(tt.bike.ID, tt.payload)
+			if tt.wantErr {
+				if !errors.Is(err, ErrDeviceUnauthorized) {
+					t.Errorf("err = %v, want ErrDeviceUnauthorized", err)
+				}
+				return
+			}
+			if err != nil || string(got) != string(body) {
+				t.Errorf("VerifyDevicePayload() = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+// Payload as a device signs it: HMAC-SHA256 keyed with SHA-256(key), then the body
+func sign(key string, body []byte) []byte {
+	hashed := sha256.Sum256([]byte(key))
+	mac := hmac.New(sha256.New, hashed[:])
+	mac.Write(body)
+	return append(mac.Sum(nil), body...)
+}
@@ -2,19 +2,28 @@ package bike
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/geo"
 	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
 	"github.com/clementeaf/bike-tracker/pkg/logger"
 )
 
 // Header & content types
 const (
-	ContentType  = "application/json"
-	UserIDHeader = "Authenticated-User-ID"
+	ContentType     = "application/json"
+	UserIDHeader    = "Authenticated-User-ID"
+	BikeIDHeader    = "X-Bike-ID"
+	DeviceKeyHeader = "X-Device-Key"
 )
 
+const maxTelemetryBody = 64 << 10
+
 // POST New Bike
 func HandleRegisterBike(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -79,6 +88,69 @@ func HandleGetAvailableBikes(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GET Free bikes near a point (?lat=&lon=&radius=) or inside a box (?bbox=minLon,minLat,maxLon,maxLat)
+func HandleGetNearbyBikes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	params := r.URL.Query()
+	var query NearQuery
+	var err error
+
+	if bbox := params.Get("bbox"); bbox != "" {
+		var box geo.BoundingBox
+		box, err = geo.ParseBoundingBox(bbox)
+		query.Box = &box
+	} else {
+		query.Latitude, err = strconv.ParseFloat(params.Get("lat"), 64)
+		if err == nil {
+			query.Longitude, err = strconv.ParseFloat(params.Get("lon"), 64)
+		}
+		if err == nil && params.Get("radius") != "" {
+			query.Radius, err = strconv.ParseFloat(params.Get("radius"), 64)
+		}
+	}
+	if err == nil && params.Get("limit") != "" {
+		query.Limit, err = strconv.Atoi(params.Get("limit"))
+	}
+
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Parámetros inválidos: use lat, lon y radius, o bbox",
+		})
+		logger.Error("GET /bikes/near - Parámetros inválidos", map[string]interface{}{
+			"query": r.URL.RawQuery,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	bikes, err := FindBikesNear(query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidCoords) {
+			status = http.StatusBadRequest
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("GET /bikes/near - Error al buscar bicicletas", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, bikes)
+	logger.Info("GET /bikes/near - Bicicletas cercanas devueltas", map[string]interface{}{
+		"bikes_count": len(bikes),
+	})
+}
+
 // PUT Bike status
 func HandleUpdateBikeStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
@@ -123,10 +195,18 @@ func HandleUpdateBikeStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = UpdateBikeStatus(input.BikeID, userID, input.Status)
+	err = UpdateBikeStatus(input.BikeID, input.Status)
 	if err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
-			"error": "No se pudo actualizar el estado de la bicicleta",
+		status, message := http.StatusInternalServerError, "No se pudo actualizar el estado de la bicicleta"
+		switch {
+		case errors.Is(err, ErrBikeNotFound):
+			status, message = http.StatusNotFound, err.Error()
+		case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrBikeChanged):
+			status, message = http.StatusConflict, err.Error()
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": message,
 		})
 		logger.Error("PUT /bikes/status - Error al actualizar bicicleta", map[string]interface{}{
 			"error": err.Error(),
@@ -176,3 +256,106 @@ func HandleGetAllBikes(w http.ResponseWriter, r *http.Request) {
 		"total_bikes": len(bikes),
 	})
 }
+
+// POST Telemetry of a bike device, authenticated with X-Bike-ID and X-Device-Key
+func HandleTelemetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	bike, err := AuthenticateDevice(r.Header.Get(BikeIDHeader), r.Header.Get(DeviceKeyHeader))
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /telemetry - Dispositivo no autorizado", map[string]interface{}{
+			"bike_id": r.Header.Get(BikeIDHeader),
+		})
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTelemetryBody))
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusRequestEntityTooLarge, map[string]string{
+			"error": "Cuerpo demasiado grande",
+		})
+		return
+	}
+
+	reports, err := DecodeTelemetry(r.Header.Get("Content-Type"), payload)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /telemetry - Payload inválido", map[string]interface{}{
+			"bike_id":      bike.ID.Hex(),
+			"content_type": r.Header.Get("Content-Type"),
+		})
+		return
+	}
+
+	result, err := ApplyTelemetry(bike.ID, reports)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrTelemetryBatchLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /telemetry - Error al aplicar telemetría", map[string]interface{}{
+			"bike_id": bike.ID.Hex(),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusAccepted, result)
+}
+
+// POST Issue a new device key for a bike (/bikes/{id}/device-key)
+func HandleIssueDeviceKey(w http.ResponseWriter, r *http.Request) {
+	bikeID, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bikes/"), "/")
+	if resource != "device-key" {
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Recurso no encontrado",
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	key, err := IssueDeviceKey(bikeID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrBikeNotFound) {
+			status = http.StatusNotFound
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /bikes/{id}/device-key - Error al generar la clave", map[string]interface{}{
+			"bike_id": bikeID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusCreated, map[string]string{
+		"bike_id":    bikeID,
+		"device_key": key,
+	})
+	logger.Info("POST /bikes/{id}/device-key - Clave de dispositivo generada", map[string]interface{}{
+		"bike_id": bikeID,
+	})
+}
@@ -3,27 +3,71 @@ package bike
 import (
 	"time"
 
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"github.com/clementeaf/bike-tracker/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Bike struct {
-	ID                primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	BatteryLevel      float64              `bson:"battery_level" json:"battery_level"`
-	Latitude          float64              `bson:"latitude" json:"latitude"`
-	Longitude         float64              `bson:"longitude" json:"longitude"`
-	Status            int                  `bson:"status" json:"status"`
-	LastUsedAt        time.Time            `bson:"last_used_at" json:"last_used_at"`
-	UserHistory       []primitive.ObjectID `bson:"user_history,omitempty" json:"user_history"`
-	TotalUsageMinutes float64              `bson:"total_usage_minutes" json:"total_usage_minutes"`
-	TotalEarnings     float64              `bson:"total_earnings" json:"total_earnings"`
-	LastMaintenance   time.Time            `bson:"last_maintenance" json:"last_maintenance"`
-	NextMaintenance   time.Time            `bson:"next_maintenance" json:"next_maintenance"`
-	OperationalSince  time.Time            `bson:"operational_since" json:"operational_since"`
+	ID                 primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	BatteryLevel       float64              `bson:"battery_level" json:"battery_level"`
+	Latitude           float64              `bson:"latitude" json:"latitude"`
+	Longitude          float64              `bson:"longitude" json:"longitude"`
+	Location           *geo.GeoJSONPoint    `bson:"location,omitempty" json:"location,omitempty"`
+	Status             int                  `bson:"status" json:"status"`
+	LastUsedAt         time.Time            `bson:"last_used_at" json:"last_used_at"`
+	UserHistory        []primitive.ObjectID `bson:"user_history,omitempty" json:"user_history"`
+	TotalUsageMinutes  float64              `bson:"total_usage_minutes" json:"total_usage_minutes"`
+	TotalEarnings      money.Money          `bson:"total_earnings" json:"total_earnings"`
+	LastMaintenance    time.Time            `bson:"last_maintenance" json:"last_maintenance"`
+	NextMaintenance    time.Time            `bson:"next_maintenance" json:"next_maintenance"`
+	RideCount          int                  `bson:"ride_count" json:"ride_count"`
+	UsageAtMaintenance float64              `bson:"usage_at_maintenance" json:"usage_at_maintenance"` // Minutos de uso al último servicio
+	RidesAtMaintenance int                  `bson:"rides_at_maintenance" json:"rides_at_maintenance"`
+	OperationalSince   time.Time            `bson:"operational_since" json:"operational_since"`
+	Locked             bool                 `bson:"locked" json:"locked"`
+	LastSeenAt         *time.Time           `bson:"last_seen_at,omitempty" json:"last_seen_at,omitempty"` // Último reporte de telemetría
+	PositionAt         *time.Time           `bson:"position_at,omitempty" json:"position_at,omitempty"`   // Última posición informada por el candado
+	DeviceKeyHash      string               `bson:"device_key_hash,omitempty" json:"-"`
+	RideID             *primitive.ObjectID  `bson:"ride_id,omitempty" json:"ride_id,omitempty"` // Viaje que la tiene tomada
+	Version            int64                `bson:"version" json:"-"`                           // Aumenta con cada escritura
+}
+
+// Move the bike, keeping the flat coordinates and the GeoJSON location in sync
+func (b *Bike) SetPosition(latitude, longitude float64) {
+	b.Latitude = latitude
+	b.Longitude = longitude
+	b.Location = geo.NewGeoJSONPoint(latitude, longitude)
+}
+
+// Position last reported by the device, if it reported one after since and
+// no longer than maxAge ago
+func (b Bike) DevicePosition(since time.Time, maxAge time.Duration) ([]float64, bool) {
+	if b.PositionAt == nil || !b.PositionAt.After(since) || time.Since(*b.PositionAt) > maxAge {
+		return nil, false
+	}
+	return []float64{b.Latitude, b.Longitude}, true
+}
+
+// NearbyBike is a bike found by a geospatial search
+type NearbyBike struct {
+	Bike           `bson:",inline"`
+	DistanceMeters float64 `bson:"distance_meters" json:"distance_meters"`
+}
+
+// NearQuery selects free bikes within Radius meters of a point, or inside Box
+type NearQuery struct {
+	Latitude   float64
+	Longitude  float64
+	Radius     float64
+	Box        *geo.BoundingBox
+	MinBattery float64
+	Limit      int
 }
 
 type TripCost struct {
-	DistanceMeters float64 `json:"distance_meters"`
-	TotalCost      float64 `json:"total_cost"`
+	DistanceMeters float64     `json:"distance_meters"`
+	TotalCost      money.Money `json:"total_cost"`
 }
 
 type BikeRequest struct {
@@ -39,3 +83,32 @@ const (
 	StatusNoBattery   = 4 // Batery 0
 	StatusReserved    = 5 // Reserved
 )
+
+// Bikes below this battery level cannot be rented
+const MinBatteryLevel = 20
+
+// A bike out of battery is rentable again once charged over this level
+const RecoveredBatteryLevel = MinBatteryLevel + 5
+
+// Telemetry is a report of the bike hardware. Values the device did not send
+// are nil
+type Telemetry struct {
+	Battery   *float64 `json:"bat,omitempty"`
+	Latitude  *float64 `json:"lat,omitempty"`
+	Longitude *float64 `json:"lon,omitempty"`
+	Locked    *bool    `json:"lock,omitempty"`
+	Timestamp int64    `json:"ts"` // Segundos Unix
+}
+
+// Position reported by a bike device
+type ReportedPosition struct {
+	Latitude  float64
+	Longitude float64
+	At        time.Time
+}
+
+type TelemetryResult struct {
+	Received int `json:"received"`
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
@@ -0,0 +1,77 @@
+package bike
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/mqtt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Devices publish to bikes/{bike_id}/telemetry. The topic alone proves
+// nothing, so every payload is signed with the device key (VerifyDevicePayload)
+const telemetryTopic = "bikes/+/telemetry"
+
+// Consume telemetry from an MQTT broker in background, reconnecting when the
+// connection drops
+func StartTelemetrySubscriber(opts mqtt.Options) {
+	go func() {
+		backoff := time.Second
+		for {
+			connectedAt := time.Now()
+			err := mqtt.Subscribe(context.Background(), opts, telemetryTopic, handleTelemetryMessage)
+			logger.Error("StartTelemetrySubscriber - Conexión MQTT perdida", map[string]interface{}{
+				"broker": opts.Broker,
+				"error":  err.Error(),
+				"retry":  backoff.String(),
+			})
+
+			// Una conexión que duró tiene su propio error; se reintenta enseguida
+			if time.Since(connectedAt) > time.Minute {
+				backoff = time.Second
+			}
+			time.Sleep(backoff)
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+		}
+	}()
+}
+
+func handleTelemetryMessage(message mqtt.Message) {
+	parts := strings.Split(message.Topic, "/")
+	if len(parts) != 3 {
+		return
+	}
+	bikeID, err := primitive.ObjectIDFromHex(parts[1])
+	if err != nil {
+		return
+	}
+
+	payload, err := VerifyDevicePayload(bikeID, message.Payload)
+	if err != nil {
+		logger.Error("handleTelemetryMessage - Telemetría MQTT sin firma válida", map[string]interface{}{
+			"topic": message.Topic,
+		})
+		return
+	}
+
+	// Los dispositivos que envían JSON lo empiezan con { o [; el resto es binario
+	contentType := "application/octet-stream"
+	if trimmed := strings.TrimSpace(string(payload)); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		contentType = ContentType
+	}
+
+	reports, err := DecodeTelemetry(contentType, payload)
+	if err == nil {
+		_, err = ApplyTelemetry(bikeID, reports)
+	}
+	if err != nil {
+		logger.Error("handleTelemetryMessage - Telemetría MQTT descartada", map[string]interface{}{
+			"topic": message.Topic,
+			"error": err.Error(),
+		})
+	}
+}
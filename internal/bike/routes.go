@@ -2,20 +2,28 @@ package bike
 
 import (
 	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
 )
 
 func RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/bikes", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			HandleGetAllBikes(w, r)
+			middleware.RequirePermission(auth.PermFleetRead, http.HandlerFunc(HandleGetAllBikes)).ServeHTTP(w, r)
 		case http.MethodPost:
-			HandleRegisterBike(w, r)
+			middleware.RequirePermission(auth.PermFleetManage, http.HandlerFunc(HandleRegisterBike)).ServeHTTP(w, r)
 		default:
 			http.Error(w, `{"error": "Método no permitido"}`, http.StatusMethodNotAllowed)
 		}
 	})
 
-	mux.HandleFunc("/bikes/available", HandleGetAvailableBikes)
-	mux.HandleFunc("/bikes/status", HandleUpdateBikeStatus)
+	mux.Handle("/bikes/available", middleware.Public(http.HandlerFunc(HandleGetAvailableBikes)))
+	mux.Handle("/bikes/near", middleware.Public(http.HandlerFunc(HandleGetNearbyBikes)))
+	mux.Handle("/bikes/status", middleware.RequirePermission(auth.PermFleetOperate, http.HandlerFunc(HandleUpdateBikeStatus)))
+	mux.Handle("/bikes/", middleware.RequirePermission(auth.PermFleetManage, http.HandlerFunc(HandleIssueDeviceKey)))
+
+	// Los candados se autentican con su clave de dispositivo
+	mux.Handle("/telemetry", middleware.Public(http.HandlerFunc(HandleTelemetry)))
 }
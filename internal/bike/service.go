@@ -5,11 +5,15 @@ import (
 	"errors"
 	"time"
 
-	"github.com/clementeaf/bike-tracker/pkg/database"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/clementeaf/bike-tracker/internal/pricing"
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"github.com/clementeaf/bike-tracker/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Attempts of a write that keeps losing the compare-and-set to other writers
+const maxWriteAttempts = 3
+
 // Create a new bike in the database
 func RegisterBike() (*Bike, error) {
 	bike := &Bike{
@@ -17,22 +21,21 @@ func RegisterBike() (*Bike, error) {
 		BatteryLevel:      100,
 		Latitude:          0,
 		Longitude:         0,
+		Location:          geo.NewGeoJSONPoint(0, 0),
 		Status:            StatusFree, // Siempre un entero (1)
 		LastUsedAt:        time.Time{},
 		UserHistory:       []primitive.ObjectID{},
 		TotalUsageMinutes: 0,
-		TotalEarnings:     0,
+		TotalEarnings:     money.FromMinor(0),
 		LastMaintenance:   time.Time{},
 		NextMaintenance:   time.Time{},
 		OperationalSince:  time.Now(),
 	}
 
-	collection := database.GetCollection("bikes")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := collection.InsertOne(ctx, bike)
-	if err != nil {
+	if err := store.Insert(ctx, *bike); err != nil {
 		return nil, err
 	}
 
@@ -41,96 +44,358 @@ func RegisterBike() (*Bike, error) {
 
 // Get all bikes if state = 1
 func GetAvailableBikes() ([]Bike, error) {
-	var bikes []Bike
-
 	// Contexto con timeout para la consulta
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Consulta para buscar bicicletas con estado "Libre" (StatusFree)
-	cursor, err := database.GetCollection("bikes").Find(ctx, bson.M{"status": StatusFree})
+	bikes, err := store.FindByStatus(ctx, StatusFree)
 	if err != nil {
 		return nil, errors.New("error al consultar bicicletas disponibles: " + err.Error())
 	}
-	defer cursor.Close(ctx)
 
-	// Decodificar bicicletas en el slice
-	if err := cursor.All(ctx, &bikes); err != nil {
-		return nil, errors.New("error al procesar bicicletas disponibles: " + err.Error())
+	return bikes, nil
+}
+
+// Get the bikes held by a reservation
+func GetReservedBikes() ([]Bike, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bikes, err := store.FindByStatus(ctx, StatusReserved)
+	if err != nil {
+		return nil, errors.New("error al consultar bicicletas reservadas: " + err.Error())
+	}
+	return bikes, nil
+}
+
+// Get bike by ID
+func GetBikeByID(bikeID primitive.ObjectID) (Bike, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByID(ctx, bikeID)
+}
+
+// Search radius limits, in meters
+const (
+	defaultNearRadius = 500
+	maxNearRadius     = 5000
+	defaultNearLimit  = 50
+	maxNearLimit      = 200
+)
+
+var ErrInvalidCoords = errors.New("coordenadas inválidas")
+
+// Free bikes with enough battery near a point (or inside a box), nearest first
+func FindBikesNear(query NearQuery) ([]NearbyBike, error) {
+	if query.Box != nil {
+		query.Latitude, query.Longitude = query.Box.Center()
+	}
+	if !geo.ValidCoords(query.Latitude, query.Longitude) {
+		return nil, ErrInvalidCoords
+	}
+
+	switch {
+	case query.Radius <= 0:
+		query.Radius = defaultNearRadius
+	case query.Radius > maxNearRadius:
+		query.Radius = maxNearRadius
+	}
+	switch {
+	case query.Limit <= 0:
+		query.Limit = defaultNearLimit
+	case query.Limit > maxNearLimit:
+		query.Limit = maxNearLimit
 	}
+	query.MinBattery = MinBatteryLevel
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	bikes, err := store.FindNear(ctx, query)
+	if err != nil {
+		return nil, errors.New("error al buscar bicicletas cercanas: " + err.Error())
+	}
 	return bikes, nil
 }
 
-// Update bike status
-func UpdateBikeStatus(bikeID string, userID string, status int) error {
+// Update bike status on behalf of an operator, enforcing the status state
+// machine. Rides move bikes in and out of use with ClaimBike and FinishTrip
+func UpdateBikeStatus(bikeID string, status int) error {
 	if status < StatusFree || status > StatusReserved {
 		return errors.New("estado inválido")
 	}
 
-	bikeCollection := database.GetCollection("bikes")
+	bikeObjectID, err := primitive.ObjectIDFromHex(bikeID)
+	if err != nil {
+		return errors.New("ID de bicicleta inválido")
+	}
+
+	_, err = changeBike(bikeObjectID, func(bike *Bike) error {
+		if err := validateTransition(bike.Status, status); err != nil {
+			return err
+		}
+		bike.Status = status
+		bike.LastUsedAt = time.Now()
+		return nil
+	})
+	return err
+}
+
+// Claim a free bike for a ride. Only one of several concurrent claims wins,
+// the others get ErrBikeUnavailable
+func ClaimBike(bikeID, userID, rideID primitive.ObjectID) (Bike, error) {
+	return moveBike(bikeID, StatusFree, StatusInUse, claimFor(userID, rideID))
+}
+
+// Claim a bike reserved for the rider when the ride starts
+func ClaimReservedBike(bikeID, userID, rideID primitive.ObjectID) (Bike, error) {
+	return moveBike(bikeID, StatusReserved, StatusInUse, claimFor(userID, rideID))
+}
+
+func claimFor(userID, rideID primitive.ObjectID) func(bike *Bike) error {
+	return func(bike *Bike) error {
+		bike.UserHistory = append(bike.UserHistory, userID)
+		bike.RideID = &rideID
+		return nil
+	}
+}
+
+// Reserve a free bike with enough battery. Competes with claims and other
+// reservations like ClaimBike
+func ReserveBike(bikeID primitive.ObjectID) (Bike, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	bikeObjectID, err := primitive.ObjectIDFromHex(bikeID)
+	bike, err := store.FindByID(ctx, bikeID)
 	if err != nil {
-		return errors.New("ID de bicicleta inválido")
+		return bike, err
+	}
+	if bike.BatteryLevel < MinBatteryLevel {
+		return bike, ErrLowBattery
 	}
 
-	var bike Bike
-	err = bikeCollection.FindOne(ctx, bson.M{"_id": bikeObjectID}).Decode(&bike)
+	return moveBike(bikeID, StatusFree, StatusReserved, nil)
+}
+
+// Free a reserved bike when its reservation ends unused
+func ReleaseReservedBike(bikeID primitive.ObjectID) error {
+	_, err := moveBike(bikeID, StatusReserved, StatusFree, nil)
+	return err
+}
+
+// Put a bike claimed by the ride back as reserved (undoes ClaimReservedBike)
+func RestoreReservedBike(bikeID, rideID primitive.ObjectID) error {
+	_, err := moveBike(bikeID, StatusInUse, StatusReserved, releaseFrom(rideID))
+	return err
+}
+
+// Free a bike claimed by the ride without a trip: undoes ClaimBike and ends a
+// cancelled ride. A bike claimed by another ride fails with ErrBikeUnavailable
+func ReleaseClaimedBike(bikeID, rideID primitive.ObjectID) error {
+	_, err := moveBike(bikeID, StatusInUse, StatusFree, releaseFrom(rideID))
+	return err
+}
+
+// Claim back for the ride the bike freed when it was cancelled (undoes
+// ReleaseClaimedBike). Nothing to do if the ride still has it
+func ReclaimBike(bikeID, rideID primitive.ObjectID) error {
+	return reclaimBike(bikeID, rideID, nil)
+}
+
+// Claim back for the ride the bike freed at the end of its trip, taking the
+// trip off its usage and earnings (undoes FinishTrip). Nothing to do if the
+// ride still has it
+func UndoFinishTrip(bikeID, rideID primitive.ObjectID, usageMinutes float64, earnings money.Money) error {
+	return reclaimBike(bikeID, rideID, func(bike *Bike) {
+		bike.TotalUsageMinutes -= usageMinutes
+		bike.TotalEarnings = bike.TotalEarnings.Sub(earnings)
+		bike.RideCount--
+	})
+}
+
+func reclaimBike(bikeID, rideID primitive.ObjectID, undo func(bike *Bike)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bike, err := store.FindByID(ctx, bikeID)
 	if err != nil {
-		return errors.New("bicicleta no encontrada")
+		return err
+	}
+	if bike.Status == StatusInUse && bike.RideID != nil && *bike.RideID == rideID {
+		return nil
 	}
+	// Al terminar el viaje queda libre o sin batería; otro estado es de alguien más
+	if bike.Status != StatusFree && bike.Status != StatusNoBattery {
+		return ErrBikeUnavailable
+	}
+
+	_, err = moveBike(bikeID, bike.Status, StatusInUse, func(bike *Bike) error {
+		bike.RideID = &rideID
+		if undo != nil {
+			undo(bike)
+		}
+		return nil
+	})
+	return err
+}
 
-	updateFields := bson.M{
-		"status":       status,
-		"last_used_at": time.Now(),
+// Clear the ride of a bike it claimed. Bikes claimed before rides were
+// recorded on them have none and are taken as the ride's
+func releaseFrom(rideID primitive.ObjectID) func(bike *Bike) error {
+	return func(bike *Bike) error {
+		if bike.RideID != nil && *bike.RideID != rideID {
+			return ErrBikeUnavailable
+		}
+		bike.RideID = nil
+		return nil
 	}
+}
+
+// Move a bike between statuses, failing with ErrBikeUnavailable if it is not
+// (or no longer) in the from status. update may change other fields or refuse
+// the move
+func moveBike(bikeID primitive.ObjectID, from, to int, update func(bike *Bike) error) (Bike, error) {
+	return changeBike(bikeID, func(bike *Bike) error {
+		if bike.Status != from {
+			return ErrBikeUnavailable
+		}
 
-	if status == StatusInUse {
-		userObjectID, _ := primitive.ObjectIDFromHex(userID)
-		updateFields["user_history"] = append(bike.UserHistory, userObjectID)
+		bike.Status = to
+		bike.LastUsedAt = time.Now()
+		if update != nil {
+			return update(bike)
+		}
+		return nil
+	})
+}
+
+// Take a free or discharged bike out of service for maintenance. Bikes in
+// use or reserved fail with ErrBikeUnavailable
+func StartMaintenance(bikeID primitive.ObjectID) (Bike, error) {
+	bike, err := moveBike(bikeID, StatusFree, StatusMaintenance, nil)
+	if errors.Is(err, ErrBikeUnavailable) {
+		return moveBike(bikeID, StatusNoBattery, StatusMaintenance, nil)
 	}
+	return bike, err
+}
 
-	_, err = bikeCollection.UpdateOne(ctx, bson.M{"_id": bikeObjectID}, bson.M{"$set": updateFields})
-	if err != nil {
-		return errors.New("no se pudo actualizar el estado de la bicicleta")
+// Stamp a completed service on a bike, keeping its usage at that moment to
+// schedule the next one. With release a bike in maintenance returns to service
+func CompleteMaintenance(bikeID primitive.ObjectID, next time.Time, release bool) (Bike, error) {
+	return changeBike(bikeID, func(bike *Bike) error {
+		bike.LastMaintenance = time.Now()
+		bike.NextMaintenance = next
+		bike.UsageAtMaintenance = bike.TotalUsageMinutes
+		bike.RidesAtMaintenance = bike.RideCount
+		if release && bike.Status == StatusMaintenance {
+			bike.Status = StatusFree
+			bike.Status = batteryStatus(*bike)
+		}
+		return nil
+	})
+}
+
+// Return a bike in maintenance to service without stamping a service
+func ReleaseMaintenance(bikeID primitive.ObjectID) error {
+	_, err := moveBike(bikeID, StatusMaintenance, StatusFree, func(bike *Bike) error {
+		bike.Status = batteryStatus(*bike)
+		return nil
+	})
+	return err
+}
+
+// Change fields of a bike that cannot be refused
+func updateBike(bikeID primitive.ObjectID, apply func(*Bike)) error {
+	_, err := changeBike(bikeID, func(bike *Bike) error {
+		apply(bike)
+		return nil
+	})
+	return err
+}
+
+// Read a bike, apply a change and save it with compare-and-set on its
+// version. If anything else wrote the bike meanwhile the change is applied
+// again on a fresh read, so concurrent writers never overwrite each other.
+// apply may refuse the change with an error
+func changeBike(bikeID primitive.ObjectID, apply func(*Bike) error) (Bike, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		bike, err := store.FindByID(ctx, bikeID)
+		if err != nil {
+			return bike, err
+		}
+
+		if err := apply(&bike); err != nil {
+			return bike, err
+		}
+		err = store.UpdateIfVersion(ctx, bike)
+		if errors.Is(err, ErrBikeChanged) && attempt < maxWriteAttempts-1 {
+			continue
+		} else if err != nil {
+			return bike, err
+		}
+
+		bike.Version++
+		return bike, nil
 	}
+}
+
+// Release the bike claimed by the ride at the end of its trip, adding the trip
+// to its usage and earnings
+func FinishTrip(bikeID, rideID primitive.ObjectID, batteryLeft float64, latitude, longitude float64, usageMinutes float64, earnings money.Money) error {
+	_, err := changeBike(bikeID, func(bike *Bike) error {
+		if err := validateRideTransition(bike.Status, StatusFree); err != nil {
+			return err
+		}
+		if err := releaseFrom(rideID)(bike); err != nil {
+			return err
+		}
 
-	return nil
+		bike.Status = StatusFree
+		bike.BatteryLevel = batteryLeft
+		bike.SetPosition(latitude, longitude)
+		bike.LastUsedAt = time.Now()
+		bike.TotalUsageMinutes += usageMinutes
+		bike.TotalEarnings = bike.TotalEarnings.Add(earnings)
+		bike.RideCount++
+		bike.Status = batteryStatus(*bike)
+		return nil
+	})
+	return err
 }
 
-// Trip cost by time
-func CalculateTripCost(durationMinutes float64) TripCost {
-	const ratePerMinute = 0.50 // Tarifa en USD por minuto
-	totalCost := durationMinutes * ratePerMinute
+// Trip cost with the tariff in force
+func CalculateTripCost(durationMinutes, distanceMeters float64) (TripCost, error) {
+	fare, err := pricing.Price("", pricing.Trip{
+		StartedAt:      time.Now(),
+		Minutes:        durationMinutes,
+		DistanceMeters: distanceMeters,
+	})
+	if err != nil {
+		return TripCost{}, err
+	}
 
 	return TripCost{
-		DistanceMeters: durationMinutes * 100, // Suponiendo 100 metros por minuto
-		TotalCost:      totalCost,
-	}
+		DistanceMeters: distanceMeters,
+		TotalCost:      fare.Total,
+	}, nil
 }
 
 // Get all bikes
 func GetAllBikes() ([]Bike, error) {
-	var bikes []Bike
-
 	// Crear un contexto con timeout para la consulta
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Obtener todas las bicicletas (sin filtro)
-	cursor, err := database.GetCollection("bikes").Find(ctx, bson.M{})
+	bikes, err := store.FindAll(ctx)
 	if err != nil {
 		return nil, errors.New("error al consultar bicicletas: " + err.Error())
 	}
-	defer cursor.Close(ctx)
-
-	// Decodificar los resultados en la slice de bicicletas
-	if err := cursor.All(ctx, &bikes); err != nil {
-		return nil, errors.New("error al procesar bicicletas: " + err.Error())
-	}
 
 	return bikes, nil
 }
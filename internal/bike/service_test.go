@@ -0,0 +1,173 @@
+package bike
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store that runs a competing write right before the first compare-and-set,
+// as if another request saved the bike between the read and the write
+type racingStore struct {
+	*MemoryStore
+	race func()
+}
+
+func (s *racingStore) UpdateIfVersion(ctx context.Context, bike Bike) error {
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return s.MemoryStore.UpdateIfVersion(ctx, bike)
+}
+
+func TestConcurrentWritesKeepEachOther(t *testing.T) {
+	battery := 80.0
+	telemetry := func(t *testing.T, bikeID primitive.ObjectID) {
+		t.Helper()
+		report := Telemetry{Battery: &battery, Timestamp: time.Now().Unix()}
+		if result, err := ApplyTelemetry(bikeID, []Telemetry{report}); err != nil || result.Accepted != 1 {
+			t.Fatalf("ApplyTelemetry() = %+v, %v", result, err)
+		}
+	}
+	next := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, bikeID primitive.ObjectID)
+		race  func(t *testing.T, bikeID primitive.ObjectID)
+		check func(t *testing.T, bike Bike)
+	}{
+		{
+			name:  "telemetry and a new device key",
+			write: telemetry,
+			race: func(t *testing.T, bikeID primitive.ObjectID) {
+				if _, err := IssueDeviceKey(bikeID.Hex()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, bike Bike) {
+				if bike.DeviceKeyHash == "" || bike.BatteryLevel != battery {
+					t.Errorf("key hash = %q, battery = %v", bike.DeviceKeyHash, bike.BatteryLevel)
+				}
+			},
+		},
+		{
+			name:  "telemetry and a completed service",
+			write: telemetry,
+			race: func(t *testing.T, bikeID primitive.ObjectID) {
+				if _, err := CompleteMaintenance(bikeID, next, false); err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, bike Bike) {
+				if !bike.NextMaintenance.Equal(next) || bike.BatteryLevel != battery {
+					t.Errorf("next maintenance = %v, battery = %v", bike.NextMaintenance, bike.BatteryLevel)
+				}
+			},
+		},
+		{
+			name: "two telemetry batches",
+			write: func(t *testing.T, bikeID primitive.ObjectID) {
+				latitude, longitude := -33.45, -70.66
+				report := Telemetry{Latitude: &latitude, Longitude: &longitude, Timestamp: time.Now().Add(-time.Minute).Unix()}
+				if _, err := ApplyTelemetry(bikeID, []Telemetry{report}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			race: telemetry,
+			check: func(t *testing.T, bike Bike) {
+				// El lote más nuevo gana; el antiguo no lo pisa
+				if bike.BatteryLevel != battery || bike.Latitude != 0 {
+					t.Errorf("battery = %v, latitude = %v", bike.BatteryLevel, bike.Latitude)
+				}
+			},
+		},
+		{
+			name: "claim and a new device key",
+			write: func(t *testing.T, bikeID primitive.ObjectID) {
+				if _, err := ClaimBike(bikeID, primitive.NewObjectID(), primitive.NewObjectID()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			race: func(t *testing.T, bikeID primitive.ObjectID) {
+				if _, err := IssueDeviceKey(bikeID.Hex()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, bike Bike) {
+				if bike.DeviceKeyHash == "" || bike.Status != StatusInUse {
+					t.Errorf("key hash = %q, status = %d", bike.DeviceKeyHash, bike.Status)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			racing := &racingStore{MemoryStore: NewMemoryStore()}
+			SetStore(racing)
+			bike, err := RegisterBike()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			racing.race = func() { tt.race(t, bike.ID) }
+			tt.write(t, bike.ID)
+
+			stored, err := racing.FindByID(context.Background(), bike.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, stored)
+		})
+	}
+}
+
+func TestUpdateBikeStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    int
+		to      int
+		wantErr bool
+	}{
+		{name: "free to maintenance", from: StatusFree, to: StatusMaintenance},
+		{name: "maintenance to free", from: StatusMaintenance, to: StatusFree},
+		{name: "discharged to maintenance", from: StatusNoBattery, to: StatusMaintenance},
+		{name: "free to in use", from: StatusFree, to: StatusInUse, wantErr: true},
+		// Solo las reservas apartan y liberan una bicicleta
+		{name: "free to reserved", from: StatusFree, to: StatusReserved, wantErr: true},
+		{name: "reserved to free", from: StatusReserved, to: StatusFree, wantErr: true},
+		{name: "reserved to maintenance", from: StatusReserved, to: StatusMaintenance, wantErr: true},
+		{name: "unknown status", from: StatusFree, to: 9, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := NewMemoryStore()
+			SetStore(memory)
+			bike, err := RegisterBike()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bike.Status = tt.from
+			if err := memory.UpdateIfVersion(context.Background(), *bike); err != nil {
+				t.Fatal(err)
+			}
+
+			err = UpdateBikeStatus(bike.ID.Hex(), tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateBikeStatus() = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := tt.to
+			if tt.wantErr {
+				want = tt.from
+			}
+			if stored, _ := GetBikeByID(bike.ID); stored.Status != want {
+				t.Errorf("status = %d, want %d", stored.Status, want)
+			}
+		})
+	}
+}
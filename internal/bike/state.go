@@ -0,0 +1,60 @@
+package bike
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidTransition = errors.New("transición de estado no permitida")
+	ErrBikeChanged       = errors.New("la bicicleta cambió, intente nuevamente")
+	ErrBikeUnavailable   = errors.New("bicicleta no está disponible (no está libre)")
+	ErrLowBattery        = errors.New("bicicleta inactiva por nivel de batería bajo")
+	ErrInMaintenance     = errors.New("la bicicleta está en mantenimiento")
+)
+
+// Status transitions an operator may request (PUT /bikes/status). A bike
+// only enters or leaves in use through rides, and reserved through reservations
+var transitions = map[int][]int{
+	StatusFree:        {StatusMaintenance, StatusNoBattery},
+	StatusMaintenance: {StatusFree, StatusNoBattery},
+	StatusNoBattery:   {StatusFree, StatusMaintenance},
+}
+
+// Status transitions of rides: the claim, the end of the trip and the saga
+// rollbacks, which return a claimed bike to free or to its reservation
+var rideTransitions = map[int][]int{
+	StatusFree:     {StatusInUse},
+	StatusReserved: {StatusInUse},
+	StatusInUse:    {StatusFree, StatusReserved},
+}
+
+// Check if an operator can move a bike from one status to another
+func CanTransition(from, to int) bool {
+	return allowed(transitions, from, to)
+}
+
+func allowed(table map[int][]int, from, to int) bool {
+	for _, next := range table[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate a status transition requested by an operator, describing the rejected one
+func validateTransition(from, to int) error {
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %d -> %d", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
+
+// Validate a status transition made by a ride or its rollback
+func validateRideTransition(from, to int) error {
+	if !allowed(rideTransitions, from, to) {
+		return fmt.Errorf("%w: %d -> %d", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
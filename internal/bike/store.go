@@ -0,0 +1,31 @@
+package bike
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrBikeNotFound = errors.New("bicicleta no encontrada")
+
+// BikeStore abstracts the persistence of bikes
+type BikeStore interface {
+	Insert(ctx context.Context, bike Bike) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (Bike, error)
+	FindByStatus(ctx context.Context, status int) ([]Bike, error)
+	FindAll(ctx context.Context) ([]Bike, error)
+	// FindNear returns free bikes matching the query, nearest first
+	FindNear(ctx context.Context, query NearQuery) ([]NearbyBike, error)
+	// UpdateIfVersion replaces the bike only while its stored version is still
+	// bike.Version (compare-and-set), saving it with the next version. Fails with
+	// ErrBikeChanged if anything wrote the bike since it was read
+	UpdateIfVersion(ctx context.Context, bike Bike) error
+}
+
+var store BikeStore
+
+// Inject the store used by the bike services
+func SetStore(s BikeStore) {
+	store = s
+}
@@ -0,0 +1,110 @@
+package bike
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps bikes in memory, for tests and local demos
+type MemoryStore struct {
+	mu    sync.RWMutex
+	bikes map[primitive.ObjectID]Bike
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{bikes: make(map[primitive.ObjectID]Bike)}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, bike Bike) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bikes[bike.ID] = cloneBike(bike)
+	return nil
+}
+
+func (s *MemoryStore) FindByID(ctx context.Context, id primitive.ObjectID) (Bike, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bike, ok := s.bikes[id]
+	if !ok {
+		return Bike{}, ErrBikeNotFound
+	}
+	return cloneBike(bike), nil
+}
+
+func (s *MemoryStore) FindByStatus(ctx context.Context, status int) ([]Bike, error) {
+	return s.filter(func(b Bike) bool { return b.Status == status }), nil
+}
+
+func (s *MemoryStore) FindAll(ctx context.Context) ([]Bike, error) {
+	return s.filter(func(Bike) bool { return true }), nil
+}
+
+func (s *MemoryStore) FindNear(ctx context.Context, query NearQuery) ([]NearbyBike, error) {
+	nearby := []NearbyBike{}
+	for _, bike := range s.filter(func(b Bike) bool { return b.Status == StatusFree && b.BatteryLevel >= query.MinBattery }) {
+		if query.Box != nil && !query.Box.Contains(bike.Latitude, bike.Longitude) {
+			continue
+		}
+
+		distance := geo.Haversine(query.Latitude, query.Longitude, bike.Latitude, bike.Longitude)
+		if query.Box == nil && distance > query.Radius {
+			continue
+		}
+		nearby = append(nearby, NearbyBike{Bike: bike, DistanceMeters: distance})
+	}
+
+	sort.SliceStable(nearby, func(i, j int) bool { return nearby[i].DistanceMeters < nearby[j].DistanceMeters })
+	if len(nearby) > query.Limit {
+		nearby = nearby[:query.Limit]
+	}
+	return nearby, nil
+}
+
+func (s *MemoryStore) UpdateIfVersion(ctx context.Context, bike Bike) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.bikes[bike.ID]
+	if !ok {
+		return ErrBikeNotFound
+	}
+	if current.Version != bike.Version {
+		return ErrBikeChanged
+	}
+	bike.Version++
+	s.bikes[bike.ID] = cloneBike(bike)
+	return nil
+}
+
+func (s *MemoryStore) filter(match func(Bike) bool) []Bike {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bikes := []Bike{}
+	for _, bike := range s.bikes {
+		if match(bike) {
+			bikes = append(bikes, cloneBike(bike))
+		}
+	}
+	// Orden estable por ID (equivalente al orden de inserción en Mongo)
+	sort.Slice(bikes, func(i, j int) bool { return bikes[i].ID.Hex() < bikes[j].ID.Hex() })
+	return bikes
+}
+
+func cloneBike(bike Bike) Bike {
+	if bike.UserHistory != nil {
+		bike.UserHistory = append([]primitive.ObjectID{}, bike.UserHistory...)
+	}
+	if bike.RideID != nil {
+		rideID := *bike.RideID
+		bike.RideID = &rideID
+	}
+	return bike
+}
@@ -0,0 +1,125 @@
+package bike
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryStoreCopies(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	bike := Bike{ID: primitive.NewObjectID(), Status: StatusFree, UserHistory: []primitive.ObjectID{primitive.NewObjectID()}}
+	if err := s.Insert(ctx, bike); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modificar lo insertado o lo leído no cambia lo guardado
+	bike.UserHistory[0] = primitive.NilObjectID
+	found, err := s.FindByID(ctx, bike.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.UserHistory[0].IsZero() {
+		t.Error("the store shares the inserted slice")
+	}
+	found.UserHistory[0] = primitive.NilObjectID
+	if again, _ := s.FindByID(ctx, bike.ID); again.UserHistory[0].IsZero() {
+		t.Error("the store shares the returned slice")
+	}
+
+	if _, err := s.FindByID(ctx, primitive.NewObjectID()); !errors.Is(err, ErrBikeNotFound) {
+		t.Errorf("FindByID(unknown) = %v, want ErrBikeNotFound", err)
+	}
+	if err := s.UpdateIfVersion(ctx, Bike{ID: primitive.NewObjectID()}); !errors.Is(err, ErrBikeNotFound) {
+		t.Errorf("UpdateIfVersion(unknown) = %v, want ErrBikeNotFound", err)
+	}
+}
+
+func TestMemoryStoreUpdateIfVersion(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	bike := Bike{ID: primitive.NewObjectID(), Status: StatusFree}
+	if err := s.Insert(ctx, bike); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		version     int64 // Versión leída
+		status      int
+		wantErr     error
+		wantStatus  int
+		wantVersion int64
+	}{
+		{name: "current version", version: 0, status: StatusInUse, wantStatus: StatusInUse, wantVersion: 1},
+		{name: "stale version", version: 0, status: StatusReserved, wantErr: ErrBikeChanged, wantStatus: StatusInUse, wantVersion: 1},
+		{name: "same status, stale version", version: 0, status: StatusInUse, wantErr: ErrBikeChanged, wantStatus: StatusInUse, wantVersion: 1},
+		{name: "next version", version: 1, status: StatusFree, wantStatus: StatusFree, wantVersion: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := bike
+			update.Version = tt.version
+			update.Status = tt.status
+			if err := s.UpdateIfVersion(ctx, update); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateIfVersion() = %v, want %v", err, tt.wantErr)
+			}
+			if found, _ := s.FindByID(ctx, bike.ID); found.Status != tt.wantStatus || found.Version != tt.wantVersion {
+				t.Errorf("status = %d, version = %d; want %d, %d", found.Status, found.Version, tt.wantStatus, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreFindNear(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	place := func(lat, lon, battery float64, status int) primitive.ObjectID {
+		bike := Bike{ID: primitive.NewObjectID(), Status: status, BatteryLevel: battery}
+		bike.SetPosition(lat, lon)
+		if err := s.Insert(ctx, bike); err != nil {
+			t.Fatal(err)
+		}
+		return bike.ID
+	}
+	near := place(-33.4501, -70.6601, 90, StatusFree)
+	farther := place(-33.452, -70.662, 90, StatusFree)
+	place(-33.4502, -70.6602, 10, StatusFree)  // Poca batería
+	place(-33.4502, -70.6602, 90, StatusInUse) // Ocupada
+	place(-33.50, -70.70, 90, StatusFree)      // Fuera del radio
+	place(-33.4503, -70.6603, 90, StatusNoBattery)
+
+	tests := []struct {
+		name  string
+		query NearQuery
+		want  []primitive.ObjectID
+	}{
+		{name: "radius", query: NearQuery{Latitude: -33.45, Longitude: -70.66, Radius: 1000, MinBattery: 20, Limit: 10}, want: []primitive.ObjectID{near, farther}},
+		{name: "limit", query: NearQuery{Latitude: -33.45, Longitude: -70.66, Radius: 1000, MinBattery: 20, Limit: 1}, want: []primitive.ObjectID{near}},
+		{name: "box", query: NearQuery{Latitude: -33.45, Longitude: -70.66, MinBattery: 20, Limit: 10,
+			Box: &geo.BoundingBox{MinLat: -33.451, MinLon: -70.661, MaxLat: -33.449, MaxLon: -70.659}}, want: []primitive.ObjectID{near}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := s.FindNear(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != len(tt.want) {
+				t.Fatalf("FindNear() returned %d bikes, want %d", len(found), len(tt.want))
+			}
+			for i := range found {
+				if found[i].ID != tt.want[i] {
+					t.Errorf("bike %d = %s, want %s", i, found[i].ID.Hex(), tt.want[i].Hex())
+				}
+			}
+		})
+	}
+}
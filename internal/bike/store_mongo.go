@@ -0,0 +1,132 @@
+package bike
+
+import (
+	"context"
+	"errors"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoStore persists bikes in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, bike Bike) error {
+	_, err := s.collection.InsertOne(ctx, bike)
+	return err
+}
+
+func (s *MongoStore) FindByID(ctx context.Context, id primitive.ObjectID) (Bike, error) {
+	var bike Bike
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&bike)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return bike, ErrBikeNotFound
+	}
+	return bike, err
+}
+
+func (s *MongoStore) FindByStatus(ctx context.Context, status int) ([]Bike, error) {
+	return s.find(ctx, bson.M{"status": status})
+}
+
+func (s *MongoStore) FindAll(ctx context.Context) ([]Bike, error) {
+	return s.find(ctx, bson.M{})
+}
+
+func (s *MongoStore) FindNear(ctx context.Context, query NearQuery) ([]NearbyBike, error) {
+	filter := bson.M{"status": StatusFree, "battery_level": bson.M{"$gte": query.MinBattery}}
+	if query.Box != nil {
+		filter["location"] = bson.M{"$geoWithin": bson.M{"$geometry": bson.M{
+			"type":        "Polygon",
+			"coordinates": [][][]float64{query.Box.Ring()},
+		}}}
+	}
+
+	geoNear := bson.M{
+		"near":          geo.NewGeoJSONPoint(query.Latitude, query.Longitude),
+		"distanceField": "distance_meters",
+		"spherical":     true,
+		"query":         filter,
+	}
+	if query.Box == nil {
+		geoNear["maxDistance"] = query.Radius
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$geoNear", Value: geoNear}},
+		{{Key: "$limit", Value: query.Limit}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	nearby := []NearbyBike{}
+	if err := cursor.All(ctx, &nearby); err != nil {
+		return nil, err
+	}
+	return nearby, nil
+}
+
+// Create the 2dsphere index used by FindNear, first filling the location of
+// bikes saved before it existed from their flat coordinates
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.UpdateMany(ctx,
+		bson.M{"location": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"location": bson.M{
+			"type":        "Point",
+			"coordinates": bson.A{"$longitude", "$latitude"},
+		}}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+	})
+	return err
+}
+
+func (s *MongoStore) UpdateIfVersion(ctx context.Context, bike Bike) error {
+	filter := bson.M{"_id": bike.ID, "version": bike.Version}
+	if bike.Version == 0 {
+		// Las bicicletas guardadas antes de versionarlas no tienen el campo
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	bike.Version++
+	result, err := s.collection.ReplaceOne(ctx, filter, bike)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.FindByID(ctx, bike.ID); err != nil {
+			return err
+		}
+		return ErrBikeChanged
+	}
+	return nil
+}
+
+func (s *MongoStore) find(ctx context.Context, filter bson.M) ([]Bike, error) {
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var bikes []Bike
+	if err := cursor.All(ctx, &bikes); err != nil {
+		return nil, err
+	}
+	return bikes, nil
+}
@@ -0,0 +1,215 @@
+package bike
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxTelemetryBatch   = 500
+	telemetryClockSkew  = 5 * time.Minute // Tolerancia con el reloj del dispositivo
+	maxTelemetryAge     = 24 * time.Hour  // Reportes más antiguos se descartan
+	binaryRecordSize    = 16
+	binaryRecordVersion = 1
+)
+
+// Flags of a binary telemetry record
+const (
+	flagBattery  = 1 << 0
+	flagPosition = 1 << 1
+	flagLock     = 1 << 2
+	flagLocked   = 1 << 3
+)
+
+var (
+	ErrInvalidTelemetry    = errors.New("telemetría inválida")
+	ErrTelemetryBatchLarge = errors.New("demasiados reportes en el lote")
+)
+
+// Told of the positions applied from device telemetry
+var positionListener func(bikeID primitive.ObjectID, positions []ReportedPosition)
+
+// Inject the function told of the positions reported by the devices, which
+// the ride package uses to extend the track of the ongoing ride
+func SetPositionListener(listener func(bikeID primitive.ObjectID, positions []ReportedPosition)) {
+	positionListener = listener
+}
+
+// Decode a telemetry payload: a JSON object or array, or binary records when
+// the content type is application/octet-stream.
+//
+// Each binary record has 16 bytes, big endian: version (1), flags (battery,
+// position, lock present, locked), battery in tenths of percent (uint16),
+// latitude and longitude in 1e-7 degrees (int32) and Unix seconds (uint32)
+func DecodeTelemetry(contentType string, payload []byte) ([]Telemetry, error) {
+	if strings.HasPrefix(contentType, "application/octet-stream") {
+		return decodeBinaryTelemetry(payload)
+	}
+
+	payload = bytes.TrimSpace(payload)
+	if len(payload) > 0 && payload[0] == '[' {
+		var reports []Telemetry
+		if err := json.Unmarshal(payload, &reports); err != nil {
+			return nil, ErrInvalidTelemetry
+		}
+		return reports, nil
+	}
+
+	var report Telemetry
+	if err := json.Unmarshal(payload, &report); err != nil {
+		return nil, ErrInvalidTelemetry
+	}
+	return []Telemetry{report}, nil
+}
+
+func decodeBinaryTelemetry(payload []byte) ([]Telemetry, error) {
+	if len(payload) == 0 || len(payload)%binaryRecordSize != 0 {
+		return nil, ErrInvalidTelemetry
+	}
+
+	reports := make([]Telemetry, 0, len(payload)/binaryRecordSize)
+	for offset := 0; offset < len(payload); offset += binaryRecordSize {
+		record := payload[offset : offset+binaryRecordSize]
+		if record[0] != binaryRecordVersion {
+			return nil, ErrInvalidTelemetry
+		}
+
+		flags := record[1]
+		report := Telemetry{Timestamp: int64(binary.BigEndian.Uint32(record[12:16]))}
+		if flags&flagBattery != 0 {
+			battery := float64(binary.BigEndian.Uint16(record[2:4])) / 10
+			report.Battery = &battery
+		}
+		if flags&flagPosition != 0 {
+			lat := float64(int32(binary.BigEndian.Uint32(record[4:8]))) / 1e7
+			lon := float64(int32(binary.BigEndian.Uint32(record[8:12]))) / 1e7
+			report.Latitude, report.Longitude = &lat, &lon
+		}
+		if flags&flagLock != 0 {
+			locked := flags&flagLocked != 0
+			report.Locked = &locked
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Apply the reports of a bike device: battery, position, lock state and last
+// seen time. Reports older than the last one applied are ignored. Free bikes
+// that run low on battery move to StatusNoBattery, and back once charged. The
+// positions applied are passed on to the position listener
+func ApplyTelemetry(bikeID primitive.ObjectID, reports []Telemetry) (TelemetryResult, error) {
+	result := TelemetryResult{Received: len(reports)}
+	if len(reports) > maxTelemetryBatch {
+		return result, ErrTelemetryBatchLarge
+	}
+
+	now := time.Now()
+	valid := make([]Telemetry, 0, len(reports))
+	for _, report := range reports {
+		if validTelemetry(report, now) {
+			valid = append(valid, report)
+		}
+	}
+	sort.SliceStable(valid, func(i, j int) bool { return valid[i].Timestamp < valid[j].Timestamp })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Reintentar si otra escritura cambia la bicicleta mientras tanto
+	for attempt := 0; ; attempt++ {
+		bike, err := store.FindByID(ctx, bikeID)
+		if err != nil {
+			return result, err
+		}
+
+		accepted := 0
+		positions := []ReportedPosition{}
+		for _, report := range valid {
+			reportedAt := time.Unix(report.Timestamp, 0).UTC()
+			if bike.LastSeenAt != nil && !reportedAt.After(*bike.LastSeenAt) {
+				continue
+			}
+			applyReport(&bike, report, reportedAt)
+			accepted++
+			if report.Latitude != nil {
+				positions = append(positions, ReportedPosition{Latitude: *report.Latitude, Longitude: *report.Longitude, At: reportedAt})
+			}
+		}
+
+		if accepted == 0 {
+			result.Rejected = result.Received
+			return result, nil
+		}
+
+		bike.Status = batteryStatus(bike)
+
+		err = store.UpdateIfVersion(ctx, bike)
+		if errors.Is(err, ErrBikeChanged) && attempt < maxWriteAttempts-1 {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		if positionListener != nil && len(positions) > 0 {
+			positionListener(bikeID, positions)
+		}
+
+		result.Accepted = accepted
+		result.Rejected = result.Received - accepted
+		return result, nil
+	}
+}
+
+func validTelemetry(report Telemetry, now time.Time) bool {
+	reportedAt := time.Unix(report.Timestamp, 0)
+	if report.Timestamp <= 0 || reportedAt.After(now.Add(telemetryClockSkew)) || reportedAt.Before(now.Add(-maxTelemetryAge)) {
+		return false
+	}
+	if report.Battery != nil && (math.IsNaN(*report.Battery) || *report.Battery < 0 || *report.Battery > 100) {
+		return false
+	}
+	if (report.Latitude == nil) != (report.Longitude == nil) {
+		return false
+	}
+	if report.Latitude != nil && !geo.ValidCoords(*report.Latitude, *report.Longitude) {
+		return false
+	}
+	return true
+}
+
+func applyReport(bike *Bike, report Telemetry, reportedAt time.Time) {
+	if report.Battery != nil {
+		bike.BatteryLevel = *report.Battery
+	}
+	if report.Latitude != nil {
+		bike.SetPosition(*report.Latitude, *report.Longitude)
+		bike.PositionAt = &reportedAt
+	}
+	if report.Locked != nil {
+		bike.Locked = *report.Locked
+	}
+	bike.LastSeenAt = &reportedAt
+}
+
+// Status a bike should have given its battery: a free bike that cannot be
+// rented goes out of service until it is charged
+func batteryStatus(bike Bike) int {
+	switch {
+	case bike.Status == StatusFree && bike.BatteryLevel < MinBatteryLevel:
+		return StatusNoBattery
+	case bike.Status == StatusNoBattery && bike.BatteryLevel >= RecoveredBatteryLevel:
+		return StatusFree
+	}
+	return bike.Status
+}
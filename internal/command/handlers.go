@@ -0,0 +1,219 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GET Commands for the device of a bike, held up to ?wait= seconds until one
+// arrives. Authenticated with X-Bike-ID and X-Device-Key
+func HandleDevicePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	bicycle, ok := authenticateDevice(w, r, "GET /devices/commands")
+	if !ok {
+		return
+	}
+
+	var wait time.Duration
+	if value := r.URL.Query().Get("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "wait debe ser un número de segundos",
+			})
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	commands, err := Poll(r.Context(), bicycle.ID, wait)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al obtener comandos",
+		})
+		logger.Error("GET /devices/commands - Error al entregar comandos", map[string]interface{}{
+			"bike_id": bicycle.ID.Hex(),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, commands)
+}
+
+// POST Acknowledgement of a command by the device (/devices/commands/{id}/ack)
+func HandleDeviceAck(w http.ResponseWriter, r *http.Request) {
+	commandID, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/devices/commands/"), "/")
+	if resource != "ack" {
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Ruta no encontrada",
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	bicycle, ok := authenticateDevice(w, r, "POST /devices/commands/{id}/ack")
+	if !ok {
+		return
+	}
+
+	var ack AckRequest
+	if err := json.NewDecoder(r.Body).Decode(&ack); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Error en el formato del JSON",
+		})
+		return
+	}
+
+	command, err := Acknowledge(bicycle.ID, commandID, ack)
+	if err != nil {
+		sendCommandError(w, "POST /devices/commands/{id}/ack", err)
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, command)
+	logger.Info("POST /devices/commands/{id}/ack - Comando confirmado", map[string]interface{}{
+		"command_id": command.ID.Hex(),
+		"bike_id":    bicycle.ID.Hex(),
+		"type":       command.Type,
+		"status":     command.Status,
+	})
+}
+
+// GET Latest commands of a bike (?bike_id=) or POST a new command for it
+func HandleCommands(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		commands, err := GetBikeCommands(r.URL.Query().Get("bike_id"))
+		if err != nil {
+			sendCommandError(w, "GET /commands", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, commands)
+
+	case http.MethodPost:
+		handleSendCommand(w, r)
+
+	default:
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+	}
+}
+
+func handleSendCommand(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		return
+	}
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		return
+	}
+
+	var req CommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Error en el formato del JSON",
+		})
+		return
+	}
+
+	bikeID, err := primitive.ObjectIDFromHex(req.BikeID)
+	if err != nil {
+		sendCommandError(w, "POST /commands", bike.ErrBikeNotFound)
+		return
+	}
+
+	command, err := Enqueue(bikeID, req.Type, Origin{Source: SourceAdmin, IssuedBy: &userObjectID})
+	if err != nil {
+		sendCommandError(w, "POST /commands", err)
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusAccepted, command)
+	logger.Info("POST /commands - Comando encolado", map[string]interface{}{
+		"command_id": command.ID.Hex(),
+		"bike_id":    req.BikeID,
+		"type":       command.Type,
+		"user_id":    userID,
+	})
+}
+
+// GET A command by ID
+func HandleGetCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	command, err := GetCommand(strings.TrimPrefix(r.URL.Path, "/commands/"))
+	if err != nil {
+		sendCommandError(w, "GET /commands/{id}", err)
+		return
+	}
+	httpresponse.SendJSONResponse(w, http.StatusOK, command)
+}
+
+func authenticateDevice(w http.ResponseWriter, r *http.Request, route string) (bike.Bike, bool) {
+	bicycle, err := bike.AuthenticateDevice(r.Header.Get(bike.BikeIDHeader), r.Header.Get(bike.DeviceKeyHeader))
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error(route+" - Dispositivo no autorizado", map[string]interface{}{
+			"bike_id": r.Header.Get(bike.BikeIDHeader),
+		})
+		return bicycle, false
+	}
+	return bicycle, true
+}
+
+func sendCommandError(w http.ResponseWriter, route string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrCommandNotFound), errors.Is(err, bike.ErrBikeNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvalidCommand), errors.Is(err, ErrInvalidAck):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrNoDevice), errors.Is(err, ErrCommandExpired), errors.Is(err, ErrCommandConflict):
+		status = http.StatusConflict
+	}
+
+	httpresponse.SendJSONResponse(w, status, map[string]string{
+		"error": err.Error(),
+	})
+	logger.Error(route+" - Error al procesar comando", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
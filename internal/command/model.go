@@ -0,0 +1,88 @@
+package command
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Command is an instruction for the lock of a bike. Devices receive pending
+// commands by polling and acknowledge each one once executed
+type Command struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	BikeID      primitive.ObjectID  `bson:"bike_id" json:"bike_id"`
+	Type        string              `bson:"type" json:"type"`
+	Status      string              `bson:"status" json:"status"`
+	Source      string              `bson:"source" json:"source"`
+	RideID      *primitive.ObjectID `bson:"ride_id,omitempty" json:"ride_id,omitempty"`
+	IssuedBy    *primitive.ObjectID `bson:"issued_by,omitempty" json:"issued_by,omitempty"`
+	Message     string              `bson:"message,omitempty" json:"message,omitempty"` // Respuesta del dispositivo
+	ExpiresAt   time.Time           `bson:"expires_at" json:"expires_at"`
+	DeliveredAt *time.Time          `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	AckedAt     *time.Time          `bson:"acked_at,omitempty" json:"acked_at,omitempty"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// Command types
+const (
+	TypeLock   = "lock"
+	TypeUnlock = "unlock"
+	TypeLocate = "locate" // Pide al candado un reporte de telemetría inmediato
+	TypeAlarm  = "alarm"
+)
+
+// Command states
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered" // Entregado al dispositivo, sin confirmar
+	StatusAcked     = "acked"
+	StatusFailed    = "failed" // El dispositivo informó un error
+	StatusExpired   = "expired"
+)
+
+// Who issued a command
+const (
+	SourceRideStart = "ride_start"
+	SourceRideEnd   = "ride_end"
+	SourceRollback  = "rollback" // Vuelve a bloquear tras revertir el inicio de un viaje
+	SourceAdmin     = "admin"
+)
+
+// Origin identifies who issued a command and for which ride
+type Origin struct {
+	Source   string
+	RideID   *primitive.ObjectID
+	IssuedBy *primitive.ObjectID
+}
+
+type CommandRequest struct {
+	BikeID string `json:"bike_id"`
+	Type   string `json:"type"`
+}
+
+// AckRequest is sent by a device after executing a command. Locked reports
+// the lock state that resulted from it
+type AckRequest struct {
+	Status  string `json:"status"` // ok o error
+	Message string `json:"message,omitempty"`
+	Locked  *bool  `json:"locked,omitempty"`
+}
+
+// Acknowledgement results
+const (
+	AckOK    = "ok"
+	AckError = "error"
+)
+
+func validType(commandType string) bool {
+	switch commandType {
+	case TypeLock, TypeUnlock, TypeLocate, TypeAlarm:
+		return true
+	}
+	return false
+}
+
+func (c Command) open() bool {
+	return c.Status == StatusPending || c.Status == StatusDelivered
+}
@@ -0,0 +1,50 @@
+package command
+
+import "sync"
+
+// notifier wakes up the requests waiting for news on a key: a device long
+// polling for its bike or a ride waiting for an acknowledgement. It only
+// reaches waiters in this process, so they also re-check the store
+type notifier struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+var hub = &notifier{waiters: make(map[string]map[chan struct{}]struct{})}
+
+// Keys of the notifier
+const allBikesKey = "*"
+
+func (n *notifier) wait(key string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	if n.waiters[key] == nil {
+		n.waiters[key] = make(map[chan struct{}]struct{})
+	}
+	n.waiters[key][ch] = struct{}{}
+	n.mu.Unlock()
+
+	return ch, func() {
+		n.mu.Lock()
+		delete(n.waiters[key], ch)
+		if len(n.waiters[key]) == 0 {
+			delete(n.waiters, key)
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *notifier) notify(keys ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, key := range keys {
+		for ch := range n.waiters[key] {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package command
+
+import (
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
+)
+
+func RegisterRoutes(mux *http.ServeMux) {
+	// Rutas de los candados, autenticados con su clave de dispositivo
+	mux.Handle("/devices/commands", middleware.Public(http.HandlerFunc(HandleDevicePoll)))
+	mux.Handle("/devices/commands/", middleware.Public(http.HandlerFunc(HandleDeviceAck)))
+
+	mux.Handle("/commands", middleware.RequirePermission(auth.PermFleetOperate, http.HandlerFunc(HandleCommands)))
+	mux.Handle("/commands/", middleware.RequirePermission(auth.PermFleetOperate, http.HandlerFunc(HandleGetCommand)))
+}
@@ -0,0 +1,383 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	commandTTL   = 10 * time.Minute // Vigencia de los comandos que nadie espera
+	MaxPollWait  = 60 * time.Second
+	recheckEvery = time.Second // Otra instancia pudo encolar o confirmar el comando
+	historyLimit = 50
+)
+
+var (
+	ErrInvalidCommand  = errors.New("tipo de comando inválido")
+	ErrInvalidAck      = errors.New("confirmación inválida: status debe ser ok o error")
+	ErrNoDevice        = errors.New("la bicicleta no tiene un candado conectado")
+	ErrAckTimeout      = errors.New("el candado no confirmó el comando a tiempo")
+	ErrCommandRejected = errors.New("el candado no pudo ejecutar el comando")
+	ErrCommandExpired  = errors.New("el comando expiró")
+)
+
+var (
+	ackTimeout = 30 * time.Second
+	simulated  bool // Con el simulador todas las bicicletas tienen candado
+)
+
+// Set how long a ride start waits for the lock to confirm the unlock
+func Configure(timeout time.Duration) {
+	ackTimeout = timeout
+}
+
+// Configure the acknowledgement timeout from COMMAND_ACK_TIMEOUT_SECONDS,
+// keeping the default when unset
+func ConfigureFromEnv() error {
+	if value := os.Getenv("COMMAND_ACK_TIMEOUT_SECONDS"); value != "" {
+		// La recuperación revierte las sagas de viajes pendientes por más de un minuto
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 || seconds > 45 {
+			return errors.New("COMMAND_ACK_TIMEOUT_SECONDS debe ser un número de segundos entre 1 y 45")
+		}
+		Configure(time.Duration(seconds) * time.Second)
+	}
+	return nil
+}
+
+// Queue a command for the lock of a bike without waiting for it
+func Enqueue(bikeID primitive.ObjectID, commandType string, origin Origin) (Command, error) {
+	return enqueue(bikeID, commandType, origin, commandTTL)
+}
+
+// Queue a command and wait for the lock to acknowledge it. If it does not
+// within the timeout the command expires, so a late device won't execute it
+func Execute(bikeID primitive.ObjectID, commandType string, origin Origin) (Command, error) {
+	command, err := enqueue(bikeID, commandType, origin, ackTimeout)
+	if err != nil {
+		return command, err
+	}
+	return awaitAck(command, ackTimeout)
+}
+
+func enqueue(bikeID primitive.ObjectID, commandType string, origin Origin, ttl time.Duration) (Command, error) {
+	if !validType(commandType) {
+		return Command{}, ErrInvalidCommand
+	}
+
+	bicycle, err := bike.GetBikeByID(bikeID)
+	if err != nil {
+		return Command{}, err
+	}
+	if bicycle.DeviceKeyHash == "" && !simulated {
+		return Command{}, ErrNoDevice
+	}
+
+	now := time.Now()
+	command := Command{
+		ID:        primitive.NewObjectID(),
+		BikeID:    bikeID,
+		Type:      commandType,
+		Status:    StatusPending,
+		Source:    origin.Source,
+		RideID:    origin.RideID,
+		IssuedBy:  origin.IssuedBy,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.Insert(ctx, command); err != nil {
+		return Command{}, errors.New("error al guardar el comando: " + err.Error())
+	}
+
+	hub.notify(bikeID.Hex(), allBikesKey)
+	return command, nil
+}
+
+// Wait until the command is acknowledged, failed or the timeout passes
+func awaitAck(command Command, timeout time.Duration) (Command, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		wake, stop := hub.wait(command.ID.Hex())
+		current, err := getCommand(command.ID)
+		if err != nil {
+			stop()
+			return command, err
+		}
+		if !current.open() {
+			stop()
+			return commandResult(current)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			stop()
+			return expireCommand(current)
+		}
+
+		timer := time.NewTimer(min(recheckEvery, remaining))
+		select {
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+		stop()
+	}
+}
+
+// Deliver the open commands of a bike to its device. With a wait the request
+// is held until a command arrives or the wait passes (long polling)
+func Poll(ctx context.Context, bikeID primitive.ObjectID, wait time.Duration) ([]Command, error) {
+	deadline := time.Now().Add(min(wait, MaxPollWait))
+
+	for {
+		wake, stop := hub.wait(bikeID.Hex())
+		commands, err := deliver(ctx, bikeID)
+
+		remaining := time.Until(deadline)
+		if err != nil || len(commands) > 0 || remaining <= 0 {
+			stop()
+			return commands, err
+		}
+
+		timer := time.NewTimer(min(recheckEvery, remaining))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			stop()
+			return commands, nil
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+		stop()
+	}
+}
+
+// Mark the pending commands of a bike as delivered. Delivered commands not yet
+// acknowledged are returned again, so devices must skip the IDs they executed
+func deliver(ctx context.Context, bikeID primitive.ObjectID) ([]Command, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	open, err := store.FindOpen(ctx, bikeID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]Command, 0, len(open))
+	for _, command := range open {
+		if command.Status == StatusPending {
+			delivered := command
+			delivered.Status = StatusDelivered
+			delivered.DeliveredAt = &now
+			delivered.UpdatedAt = now
+			if err := store.UpdateIfStatus(ctx, delivered, StatusPending); err != nil {
+				// Se confirmó o expiró entre la consulta y la entrega
+				continue
+			}
+			command = delivered
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// Record the acknowledgement of a command by the device of its bike. Repeated
+// acknowledgements return the command as it was first recorded. An unlock
+// executed after it expired is followed by a lock
+func Acknowledge(bikeID primitive.ObjectID, commandID string, ack AckRequest) (Command, error) {
+	commandObjectID, err := primitive.ObjectIDFromHex(commandID)
+	if err != nil {
+		return Command{}, ErrCommandNotFound
+	}
+	if ack.Status != AckOK && ack.Status != AckError {
+		return Command{}, ErrInvalidAck
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		command, err := store.FindByID(ctx, commandObjectID)
+		if err != nil {
+			return command, err
+		}
+		if command.BikeID != bikeID {
+			return Command{}, ErrCommandNotFound
+		}
+		switch command.Status {
+		case StatusAcked, StatusFailed:
+			return command, nil
+		case StatusExpired:
+			if command.Type == TypeUnlock && ack.Status == AckOK {
+				relock(command)
+			}
+			return command, ErrCommandExpired
+		}
+
+		now := time.Now()
+		acked := command
+		acked.Status = StatusAcked
+		if ack.Status == AckError {
+			acked.Status = StatusFailed
+		}
+		acked.Message = ack.Message
+		acked.AckedAt = &now
+		acked.UpdatedAt = now
+
+		err = store.UpdateIfStatus(ctx, acked, command.Status)
+		if errors.Is(err, ErrCommandConflict) && attempt < 2 {
+			continue
+		} else if err != nil {
+			return command, err
+		}
+
+		if ack.Locked != nil {
+			if err := bike.SetLocked(bikeID, *ack.Locked); err != nil {
+				logger.Error("Acknowledge - Error al registrar el estado del candado", map[string]interface{}{
+					"bike_id": bikeID.Hex(),
+					"error":   err.Error(),
+				})
+			}
+		}
+
+		hub.notify(acked.ID.Hex())
+		return acked, nil
+	}
+}
+
+// Lock a bike again after its device executed an unlock that had already
+// expired, unless another ride has claimed the bike since
+func relock(unlock Command) {
+	bicycle, err := bike.GetBikeByID(unlock.BikeID)
+	if err == nil && bicycle.RideID != nil && (unlock.RideID == nil || *bicycle.RideID != *unlock.RideID) {
+		return
+	}
+
+	if _, err := Enqueue(unlock.BikeID, TypeLock, Origin{Source: SourceRollback, RideID: unlock.RideID}); err != nil {
+		logger.Error("relock - Error al volver a bloquear la bicicleta", map[string]interface{}{
+			"command_id": unlock.ID.Hex(),
+			"bike_id":    unlock.BikeID.Hex(),
+			"error":      err.Error(),
+		})
+	}
+}
+
+// Get a command by ID
+func GetCommand(commandID string) (Command, error) {
+	commandObjectID, err := primitive.ObjectIDFromHex(commandID)
+	if err != nil {
+		return Command{}, ErrCommandNotFound
+	}
+	return getCommand(commandObjectID)
+}
+
+// Get the latest commands of a bike
+func GetBikeCommands(bikeID string) ([]Command, error) {
+	bikeObjectID, err := primitive.ObjectIDFromHex(bikeID)
+	if err != nil {
+		return nil, bike.ErrBikeNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByBike(ctx, bikeObjectID, historyLimit)
+}
+
+// Expire the commands no device acknowledged in time. Returns how many expired
+func ExpireCommands() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	commands, err := store.FindExpired(ctx, time.Now())
+	if err != nil {
+		return 0, errors.New("error al consultar comandos vencidos: " + err.Error())
+	}
+
+	expired := 0
+	for _, command := range commands {
+		if current, err := expireCommand(command); errors.Is(err, ErrAckTimeout) && current.Status == StatusExpired {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// Periodically expire unacknowledged commands in background
+func StartCommandExpiry(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := ExpireCommands(); err != nil {
+				logger.Error("StartCommandExpiry - Error al vencer comandos", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+}
+
+func getCommand(commandID primitive.ObjectID) (Command, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByID(ctx, commandID)
+}
+
+// Expire an open command. If the device answered meanwhile, its answer wins
+func expireCommand(command Command) (Command, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for attempt := 0; attempt < 3; attempt++ {
+		if !command.open() {
+			return commandResult(command)
+		}
+
+		expired := command
+		expired.Status = StatusExpired
+		expired.UpdatedAt = time.Now()
+		err := store.UpdateIfStatus(ctx, expired, command.Status)
+		if err == nil {
+			hub.notify(expired.ID.Hex())
+			return expired, ErrAckTimeout
+		}
+		if !errors.Is(err, ErrCommandConflict) {
+			return command, err
+		}
+
+		if command, err = store.FindByID(ctx, command.ID); err != nil {
+			return command, err
+		}
+	}
+	return command, ErrCommandConflict
+}
+
+func commandResult(command Command) (Command, error) {
+	switch command.Status {
+	case StatusAcked:
+		return command, nil
+	case StatusFailed:
+		return command, ErrCommandRejected
+	case StatusExpired:
+		return command, ErrAckTimeout
+	}
+	return command, ErrCommandConflict
+}
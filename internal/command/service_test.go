@@ -0,0 +1,169 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fresh stores with a bike whose lock is connected, and a short ack timeout
+func setupBike(t *testing.T) primitive.ObjectID {
+	t.Helper()
+	bike.SetStore(bike.NewMemoryStore())
+	SetStore(NewMemoryStore())
+
+	previous := ackTimeout
+	Configure(100 * time.Millisecond)
+	t.Cleanup(func() { Configure(previous) })
+
+	bicycle, err := bike.RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bike.IssueDeviceKey(bicycle.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	return bicycle.ID
+}
+
+// Act as the lock of a bike: take its next command and answer it with status,
+// or leave it unanswered when status is empty
+func device(t *testing.T, bikeID primitive.ObjectID, status string) {
+	t.Helper()
+	go func() {
+		commands, err := Poll(context.Background(), bikeID, time.Second)
+		if err != nil || len(commands) == 0 || status == "" {
+			return
+		}
+		Acknowledge(bikeID, commands[0].ID.Hex(), AckRequest{Status: status})
+	}()
+}
+
+// Lock commands queued for a bike
+func locks(t *testing.T, bikeID primitive.ObjectID) []Command {
+	t.Helper()
+	commands, err := GetBikeCommands(bikeID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []Command
+	for _, command := range commands {
+		if command.Type == TypeLock {
+			found = append(found, command)
+		}
+	}
+	return found
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name       string
+		ack        string
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "acknowledged", ack: AckOK, wantStatus: StatusAcked},
+		{name: "rejected", ack: AckError, wantErr: ErrCommandRejected, wantStatus: StatusFailed},
+		{name: "not acknowledged", wantErr: ErrAckTimeout, wantStatus: StatusExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bikeID := setupBike(t)
+			device(t, bikeID, tt.ack)
+
+			command, err := Execute(bikeID, TypeUnlock, Origin{Source: SourceAdmin})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() = %v, want %v", err, tt.wantErr)
+			}
+			if command.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", command.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestExecuteWithoutDevice(t *testing.T) {
+	setupBike(t)
+	bicycle, err := bike.RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Execute(bicycle.ID, TypeUnlock, Origin{Source: SourceAdmin}); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Execute() = %v, want ErrNoDevice", err)
+	}
+}
+
+func TestAcknowledgeTwice(t *testing.T) {
+	bikeID := setupBike(t)
+	command, err := Enqueue(bikeID, TypeLock, Origin{Source: SourceAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := Acknowledge(bikeID, command.ID.Hex(), AckRequest{Status: AckOK, Message: "cerrado"})
+	if err != nil || first.Status != StatusAcked {
+		t.Fatalf("Acknowledge() = %+v, %v", first, err)
+	}
+
+	// Una confirmación repetida devuelve la primera
+	second, err := Acknowledge(bikeID, command.ID.Hex(), AckRequest{Status: AckError, Message: "otra"})
+	if err != nil || second.Status != StatusAcked || second.Message != "cerrado" {
+		t.Errorf("second Acknowledge() = %+v, %v", second, err)
+	}
+
+	if _, err := Acknowledge(primitive.NewObjectID(), command.ID.Hex(), AckRequest{Status: AckOK}); !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("Acknowledge(other bike) = %v, want ErrCommandNotFound", err)
+	}
+}
+
+func TestLateAcknowledgement(t *testing.T) {
+	rideID := primitive.NewObjectID()
+
+	tests := []struct {
+		name      string
+		command   string
+		ack       string
+		otherRide bool // Otro viaje tomó la bicicleta antes de la confirmación
+		wantLock  bool
+	}{
+		{name: "unlock executed", command: TypeUnlock, ack: AckOK, wantLock: true},
+		{name: "unlock failed", command: TypeUnlock, ack: AckError},
+		{name: "other command", command: TypeAlarm, ack: AckOK},
+		{name: "bike taken by another ride", command: TypeUnlock, ack: AckOK, otherRide: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bikeID := setupBike(t)
+			device(t, bikeID, "")
+
+			command, err := Execute(bikeID, tt.command, Origin{Source: SourceRideStart, RideID: &rideID})
+			if !errors.Is(err, ErrAckTimeout) {
+				t.Fatalf("Execute() = %v, want ErrAckTimeout", err)
+			}
+			if tt.otherRide {
+				if _, err := bike.ClaimBike(bikeID, primitive.NewObjectID(), primitive.NewObjectID()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := Acknowledge(bikeID, command.ID.Hex(), AckRequest{Status: tt.ack}); !errors.Is(err, ErrCommandExpired) {
+				t.Fatalf("Acknowledge() = %v, want ErrCommandExpired", err)
+			}
+
+			queued := locks(t, bikeID)
+			if len(queued) > 0 != tt.wantLock {
+				t.Fatalf("locks = %+v, want lock %v", queued, tt.wantLock)
+			}
+			if tt.wantLock && (queued[0].Source != SourceRollback || queued[0].RideID == nil || *queued[0].RideID != rideID) {
+				t.Errorf("lock = %+v", queued[0])
+			}
+		})
+	}
+}
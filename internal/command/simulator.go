@@ -0,0 +1,83 @@
+package command
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Answer the commands of every bike as its lock would, after some latency, so
+// rides can be tried without hardware. Bikes without a device key are
+// treated as connected while it runs
+func StartSimulator(latency time.Duration) {
+	simulated = true
+
+	go func() {
+		var inFlight sync.Map // Comandos ya en ejecución, que Poll vuelve a entregar
+
+		for {
+			wake, stop := hub.wait(allBikesKey)
+			simulateOpenCommands(&inFlight, latency)
+
+			select {
+			case <-wake:
+			case <-time.After(recheckEvery):
+			}
+			stop()
+		}
+	}()
+}
+
+func simulateOpenCommands(inFlight *sync.Map, latency time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	open, err := store.FindOpen(ctx, primitive.NilObjectID, time.Now())
+	if err != nil {
+		logger.Error("StartSimulator - Error al consultar comandos", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	bikes := map[primitive.ObjectID]bool{}
+	for _, command := range open {
+		bikes[command.BikeID] = true
+	}
+
+	for bikeID := range bikes {
+		commands, err := Poll(ctx, bikeID, 0)
+		if err != nil {
+			continue
+		}
+		for _, command := range commands {
+			if _, running := inFlight.LoadOrStore(command.ID, true); running {
+				continue
+			}
+			go func(command Command) {
+				defer inFlight.Delete(command.ID)
+
+				time.Sleep(latency)
+				if _, err := Acknowledge(command.BikeID, command.ID.Hex(), simulatedAck(command)); err != nil {
+					logger.Error("StartSimulator - Error al confirmar comando", map[string]interface{}{
+						"command_id": command.ID.Hex(),
+						"error":      err.Error(),
+					})
+				}
+			}(command)
+		}
+	}
+}
+
+func simulatedAck(command Command) AckRequest {
+	ack := AckRequest{Status: AckOK, Message: "simulado"}
+	switch command.Type {
+	case TypeLock, TypeUnlock:
+		locked := command.Type == TypeLock
+		ack.Locked = &locked
+	}
+	return ack
+}
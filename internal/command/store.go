@@ -0,0 +1,37 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrCommandNotFound = errors.New("comando no encontrado")
+	ErrCommandConflict = errors.New("el comando cambió de estado, intente nuevamente")
+)
+
+// CommandStore abstracts the persistence of bike commands
+type CommandStore interface {
+	Insert(ctx context.Context, command Command) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (Command, error)
+	// FindByBike returns the commands of a bike, newest first
+	FindByBike(ctx context.Context, bikeID primitive.ObjectID, limit int) ([]Command, error)
+	// FindOpen returns the pending or delivered commands not yet expired,
+	// oldest first. A zero bikeID returns those of every bike
+	FindOpen(ctx context.Context, bikeID primitive.ObjectID, now time.Time) ([]Command, error)
+	// FindExpired returns the pending or delivered commands expired before now
+	FindExpired(ctx context.Context, now time.Time) ([]Command, error)
+	// UpdateIfStatus replaces the command only while its stored status is
+	// still expected, failing with ErrCommandConflict otherwise
+	UpdateIfStatus(ctx context.Context, command Command, expected string) error
+}
+
+var store CommandStore
+
+// Inject the store used by the command services
+func SetStore(s CommandStore) {
+	store = s
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps commands in memory, for tests and local demos
+type MemoryStore struct {
+	mu       sync.RWMutex
+	commands map[primitive.ObjectID]Command
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{commands: make(map[primitive.ObjectID]Command)}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, command Command) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands[command.ID] = command
+	return nil
+}
+
+func (s *MemoryStore) FindByID(ctx context.Context, id primitive.ObjectID) (Command, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	command, ok := s.commands[id]
+	if !ok {
+		return Command{}, ErrCommandNotFound
+	}
+	return command, nil
+}
+
+func (s *MemoryStore) FindByBike(ctx context.Context, bikeID primitive.ObjectID, limit int) ([]Command, error) {
+	commands := s.filter(func(c Command) bool { return c.BikeID == bikeID })
+	sort.Slice(commands, func(i, j int) bool { return commands[i].CreatedAt.After(commands[j].CreatedAt) })
+	if limit > 0 && len(commands) > limit {
+		commands = commands[:limit]
+	}
+	return commands, nil
+}
+
+func (s *MemoryStore) FindOpen(ctx context.Context, bikeID primitive.ObjectID, now time.Time) ([]Command, error) {
+	commands := s.filter(func(c Command) bool {
+		return c.open() && c.ExpiresAt.After(now) && (bikeID.IsZero() || c.BikeID == bikeID)
+	})
+	sort.Slice(commands, func(i, j int) bool { return commands[i].CreatedAt.Before(commands[j].CreatedAt) })
+	return commands, nil
+}
+
+func (s *MemoryStore) FindExpired(ctx context.Context, now time.Time) ([]Command, error) {
+	return s.filter(func(c Command) bool { return c.open() && !c.ExpiresAt.After(now) }), nil
+}
+
+func (s *MemoryStore) UpdateIfStatus(ctx context.Context, command Command, expected string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.commands[command.ID]
+	if !ok {
+		return ErrCommandNotFound
+	}
+	if current.Status != expected {
+		return ErrCommandConflict
+	}
+	s.commands[command.ID] = command
+	return nil
+}
+
+func (s *MemoryStore) filter(match func(Command) bool) []Command {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	commands := []Command{}
+	for _, command := range s.commands {
+		if match(command) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var openStatuses = bson.M{"$in": []string{StatusPending, StatusDelivered}}
+
+// MongoStore persists commands in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, command Command) error {
+	_, err := s.collection.InsertOne(ctx, command)
+	return err
+}
+
+func (s *MongoStore) FindByID(ctx context.Context, id primitive.ObjectID) (Command, error) {
+	var command Command
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&command)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return command, ErrCommandNotFound
+	}
+	return command, err
+}
+
+func (s *MongoStore) FindByBike(ctx context.Context, bikeID primitive.ObjectID, limit int) ([]Command, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return s.find(ctx, bson.M{"bike_id": bikeID}, opts)
+}
+
+func (s *MongoStore) FindOpen(ctx context.Context, bikeID primitive.ObjectID, now time.Time) ([]Command, error) {
+	filter := bson.M{"status": openStatuses, "expires_at": bson.M{"$gt": now}}
+	if !bikeID.IsZero() {
+		filter["bike_id"] = bikeID
+	}
+	return s.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+}
+
+func (s *MongoStore) FindExpired(ctx context.Context, now time.Time) ([]Command, error) {
+	return s.find(ctx, bson.M{"status": openStatuses, "expires_at": bson.M{"$lte": now}}, options.Find())
+}
+
+func (s *MongoStore) UpdateIfStatus(ctx context.Context, command Command, expected string) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": command.ID, "status": expected}, command)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if err := s.collection.FindOne(ctx, bson.M{"_id": command.ID}).Err(); errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrCommandNotFound
+		}
+		return ErrCommandConflict
+	}
+	return nil
+}
+
+// Create the indexes used by device polling, by the command history of a
+// bike and by the expiry sweeper
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "bike_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+	})
+	return err
+}
+
+func (s *MongoStore) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]Command, error) {
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	commands := []Command{}
+	if err := cursor.All(ctx, &commands); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
@@ -0,0 +1,181 @@
+package geofence
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+)
+
+// GET All zones as a GeoJSON FeatureCollection
+func HandleGetZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := GetAllZones()
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al obtener zonas",
+		})
+		logger.Error("GET /geofences - Error al consultar zonas", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	collection := FeatureCollection{Type: "FeatureCollection", Features: make([]Feature, 0, len(zones))}
+	for _, zone := range zones {
+		collection.Features = append(collection.Features, zone.Feature())
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, collection)
+	logger.Info("GET /geofences - Zonas devueltas", map[string]interface{}{
+		"total_zones": len(zones),
+	})
+}
+
+// POST New zone from a GeoJSON Feature
+func HandleCreateZone(w http.ResponseWriter, r *http.Request) {
+	var feature Feature
+	if err := json.NewDecoder(r.Body).Decode(&feature); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Error en el formato del JSON",
+		})
+		logger.Error("POST /geofences - JSON inválido", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	zone, err := CreateZone(feature)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /geofences - Error al crear zona", map[string]interface{}{
+			"name":  feature.Properties.Name,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusCreated, zone.Feature())
+	logger.Info("POST /geofences - Zona creada", map[string]interface{}{
+		"zone_id": zone.ID.Hex(),
+		"kind":    zone.Kind,
+	})
+}
+
+// GET, PUT or DELETE a zone by ID
+func HandleZoneByID(w http.ResponseWriter, r *http.Request) {
+	zoneID := strings.TrimPrefix(r.URL.Path, "/geofences/")
+	if zoneID == "" || strings.Contains(zoneID, "/") {
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Ruta no encontrada",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		zone, err := GetZone(zoneID)
+		if err != nil {
+			sendZoneError(w, "GET /geofences/{id}", zoneID, err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, zone.Feature())
+
+	case http.MethodPut:
+		var feature Feature
+		if err := json.NewDecoder(r.Body).Decode(&feature); err != nil {
+			httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "Error en el formato del JSON",
+			})
+			logger.Error("PUT /geofences/{id} - JSON inválido", map[string]interface{}{
+				"zone_id": zoneID,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		zone, err := UpdateZone(zoneID, feature)
+		if err != nil {
+			sendZoneError(w, "PUT /geofences/{id}", zoneID, err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, zone.Feature())
+		logger.Info("PUT /geofences/{id} - Zona actualizada", map[string]interface{}{
+			"zone_id": zoneID,
+		})
+
+	case http.MethodDelete:
+		if err := DeleteZone(zoneID); err != nil {
+			sendZoneError(w, "DELETE /geofences/{id}", zoneID, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		logger.Info("DELETE /geofences/{id} - Zona eliminada", map[string]interface{}{
+			"zone_id": zoneID,
+		})
+
+	default:
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+	}
+}
+
+// GET Whether a ride may end at lat/lon
+func HandleCheckParking(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	var lon float64
+	if err == nil {
+		lon, err = strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+	}
+	if err != nil || !geo.ValidCoords(lat, lon) {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Parámetros inválidos: use lat y lon",
+		})
+		logger.Error("GET /geofences/check - Parámetros inválidos", map[string]interface{}{
+			"query": r.URL.RawQuery,
+		})
+		return
+	}
+
+	check, err := CheckParking(lat, lon)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al comprobar las zonas",
+		})
+		logger.Error("GET /geofences/check - Error al comprobar zonas", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, check)
+}
+
+func sendZoneError(w http.ResponseWriter, route, zoneID string, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, ErrZoneNotFound) {
+		status = http.StatusNotFound
+	}
+
+	httpresponse.SendJSONResponse(w, status, map[string]string{
+		"error": err.Error(),
+	})
+	logger.Error(route+" - Error al procesar zona", map[string]interface{}{
+		"zone_id": zoneID,
+		"error":   err.Error(),
+	})
+}
@@ -0,0 +1,95 @@
+package geofence
+
+import (
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Zone kinds
+const (
+	KindServiceArea = "service_area" // Fuera de estas áreas no se puede terminar un viaje
+	KindParking     = "parking"      // Si existen, estacionar fuera de ellas se rechaza o tiene recargo
+	KindNoParking   = "no_parking"
+	KindSlow        = "slow" // Velocidad máxima reducida
+)
+
+// Zone is a polygon of the operating area with the rules that apply inside it.
+// Surcharge is charged instead of rejecting the parking: on a service area,
+// for parking outside the parking zones; on a no-parking zone, for parking in it
+type Zone struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name          string             `bson:"name" json:"name"`
+	Kind          string             `bson:"kind" json:"kind"`
+	Geometry      geo.GeoJSONPolygon `bson:"geometry" json:"geometry"`
+	Surcharge     money.Money        `bson:"surcharge" json:"surcharge"`
+	SpeedLimitKmh float64            `bson:"speed_limit_kmh,omitempty" json:"speed_limit_kmh,omitempty"`
+	Active        bool               `bson:"active" json:"active"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Feature is the GeoJSON representation of a zone used by the API
+type Feature struct {
+	Type       string             `json:"type"`
+	ID         string             `json:"id,omitempty"`
+	Geometry   geo.GeoJSONPolygon `json:"geometry"`
+	Properties ZoneProperties     `json:"properties"`
+}
+
+type ZoneProperties struct {
+	Name          string      `json:"name"`
+	Kind          string      `json:"kind"`
+	Surcharge     money.Money `json:"surcharge"`
+	SpeedLimitKmh float64     `json:"speed_limit_kmh,omitempty"`
+	Active        *bool       `json:"active,omitempty"`
+	CreatedAt     *time.Time  `json:"created_at,omitempty"`
+	UpdatedAt     *time.Time  `json:"updated_at,omitempty"`
+}
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// ZoneRef identifies a zone in a check result
+type ZoneRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// ParkingCheck is the result of checking where a ride ends
+type ParkingCheck struct {
+	Allowed       bool        `json:"allowed"`
+	Reason        string      `json:"reason,omitempty"`
+	Surcharge     money.Money `json:"surcharge"`
+	SpeedLimitKmh float64     `json:"speed_limit_kmh,omitempty"`
+	Zones         []ZoneRef   `json:"zones"`
+}
+
+// GeoJSON Feature of the zone
+func (z Zone) Feature() Feature {
+	active := z.Active
+	createdAt, updatedAt := z.CreatedAt, z.UpdatedAt
+	return Feature{
+		Type:     "Feature",
+		ID:       z.ID.Hex(),
+		Geometry: z.Geometry,
+		Properties: ZoneProperties{
+			Name:          z.Name,
+			Kind:          z.Kind,
+			Surcharge:     z.Surcharge,
+			SpeedLimitKmh: z.SpeedLimitKmh,
+			Active:        &active,
+			CreatedAt:     &createdAt,
+			UpdatedAt:     &updatedAt,
+		},
+	}
+}
+
+func (z Zone) ref() ZoneRef {
+	return ZoneRef{ID: z.ID.Hex(), Name: z.Name, Kind: z.Kind}
+}
@@ -0,0 +1,24 @@
+package geofence
+
+import (
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
+)
+
+func RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/geofences", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			middleware.Public(http.HandlerFunc(HandleGetZones)).ServeHTTP(w, r)
+		case http.MethodPost:
+			middleware.RequirePermission(auth.PermFleetManage, http.HandlerFunc(HandleCreateZone)).ServeHTTP(w, r)
+		default:
+			http.Error(w, `{"error": "Método no permitido"}`, http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.Handle("/geofences/check", middleware.Public(http.HandlerFunc(HandleCheckParking)))
+	mux.Handle("/geofences/", middleware.RequirePermission(auth.PermFleetManage, http.HandlerFunc(HandleZoneByID)))
+}
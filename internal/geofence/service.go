@@ -0,0 +1,219 @@
+package geofence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var validKinds = map[string]bool{
+	KindServiceArea: true,
+	KindParking:     true,
+	KindNoParking:   true,
+	KindSlow:        true,
+}
+
+// Create a zone from a GeoJSON Feature
+func CreateZone(feature Feature) (Zone, error) {
+	now := time.Now()
+	zone := Zone{
+		ID:        primitive.NewObjectID(),
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	applyFeature(&zone, feature)
+
+	if err := validateZone(zone); err != nil {
+		return zone, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.Insert(ctx, zone); err != nil {
+		return zone, errors.New("error al guardar la zona: " + err.Error())
+	}
+	return zone, nil
+}
+
+// Get zone by ID
+func GetZone(zoneID string) (Zone, error) {
+	id, err := primitive.ObjectIDFromHex(zoneID)
+	if err != nil {
+		return Zone{}, ErrZoneNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByID(ctx, id)
+}
+
+// Get all zones
+func GetAllZones() ([]Zone, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindAll(ctx)
+}
+
+// Replace geometry and properties of a zone
+func UpdateZone(zoneID string, feature Feature) (Zone, error) {
+	zone, err := GetZone(zoneID)
+	if err != nil {
+		return zone, err
+	}
+
+	applyFeature(&zone, feature)
+	zone.UpdatedAt = time.Now()
+	if err := validateZone(zone); err != nil {
+		return zone, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return zone, store.Update(ctx, zone)
+}
+
+// Delete zone by ID
+func DeleteZone(zoneID string) error {
+	id, err := primitive.ObjectIDFromHex(zoneID)
+	if err != nil {
+		return ErrZoneNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.Delete(ctx, id)
+}
+
+// Active zones containing the point
+func ZonesAt(lat, lon float64) ([]Zone, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	zones, err := store.FindActive(ctx)
+	if err != nil {
+		return nil, errors.New("error al consultar zonas: " + err.Error())
+	}
+
+	containing := []Zone{}
+	for _, zone := range zones {
+		if zone.Geometry.Contains(lat, lon) {
+			containing = append(containing, zone)
+		}
+	}
+	return containing, nil
+}
+
+// Check whether a ride may end at the point and the surcharge it carries.
+// Outside every service area it is rejected; in a no-parking zone, or outside
+// the parking zones when there are any, it is surcharged if the zone (or the
+// service area) defines a surcharge and rejected otherwise
+func CheckParking(lat, lon float64) (ParkingCheck, error) {
+	check := ParkingCheck{Allowed: true, Surcharge: money.FromMinor(0), Zones: []ZoneRef{}}
+	if !geo.ValidCoords(lat, lon) {
+		return check, errors.New("coordenadas inválidas")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	zones, err := store.FindActive(ctx)
+	if err != nil {
+		return check, errors.New("error al consultar zonas: " + err.Error())
+	}
+
+	hasServiceAreas, hasParkingZones := false, false
+	inServiceArea, inParkingZone := false, false
+	areaSurcharge := money.FromMinor(0)
+	var noParking []Zone
+
+	for _, zone := range zones {
+		inside := zone.Geometry.Contains(lat, lon)
+		if inside {
+			check.Zones = append(check.Zones, zone.ref())
+		}
+
+		switch zone.Kind {
+		case KindServiceArea:
+			hasServiceAreas = true
+			if inside {
+				inServiceArea = true
+				areaSurcharge = money.Max(areaSurcharge, zone.Surcharge)
+			}
+		case KindParking:
+			hasParkingZones = true
+			inParkingZone = inParkingZone || inside
+		case KindNoParking:
+			if inside {
+				noParking = append(noParking, zone)
+			}
+		case KindSlow:
+			if inside && (check.SpeedLimitKmh == 0 || zone.SpeedLimitKmh < check.SpeedLimitKmh) {
+				check.SpeedLimitKmh = zone.SpeedLimitKmh
+			}
+		}
+	}
+
+	if hasServiceAreas && !inServiceArea {
+		return reject(check, "el viaje no puede terminar fuera del área de servicio"), nil
+	}
+
+	for _, zone := range noParking {
+		if !zone.Surcharge.IsPositive() {
+			return reject(check, "no se permite estacionar en la zona "+zone.Name), nil
+		}
+		check.Surcharge = check.Surcharge.Add(zone.Surcharge)
+	}
+
+	if hasParkingZones && !inParkingZone {
+		if !areaSurcharge.IsPositive() {
+			return reject(check, "el viaje debe terminar dentro de una zona de estacionamiento"), nil
+		}
+		check.Surcharge = check.Surcharge.Add(areaSurcharge)
+	}
+
+	return check, nil
+}
+
+func reject(check ParkingCheck, reason string) ParkingCheck {
+	check.Allowed = false
+	check.Reason = reason
+	check.Surcharge = money.FromMinor(0)
+	return check
+}
+
+func applyFeature(zone *Zone, feature Feature) {
+	zone.Name = feature.Properties.Name
+	zone.Kind = feature.Properties.Kind
+	zone.Geometry = feature.Geometry
+	zone.Surcharge = feature.Properties.Surcharge
+	zone.SpeedLimitKmh = feature.Properties.SpeedLimitKmh
+	if feature.Properties.Active != nil {
+		zone.Active = *feature.Properties.Active
+	}
+}
+
+func validateZone(zone Zone) error {
+	if zone.Name == "" {
+		return errors.New("la zona requiere un nombre")
+	}
+	if !validKinds[zone.Kind] {
+		return errors.New("tipo de zona inválido (service_area, parking, no_parking o slow)")
+	}
+	if zone.Surcharge.IsNegative() {
+		return errors.New("el recargo no puede ser negativo")
+	}
+	if zone.Kind == KindSlow && zone.SpeedLimitKmh <= 0 {
+		return errors.New("una zona lenta requiere speed_limit_kmh")
+	}
+	return zone.Geometry.Validate()
+}
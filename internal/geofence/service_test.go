@@ -0,0 +1,137 @@
+package geofence
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+)
+
+// Rectangle between two corners, in GeoJSON [lon, lat] order
+func box(minLon, minLat, maxLon, maxLat float64) geo.GeoJSONPolygon {
+	return geo.GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{{
+		{minLon, minLat}, {maxLon, minLat}, {maxLon, maxLat}, {minLon, maxLat}, {minLon, minLat},
+	}}}
+}
+
+func createZone(t *testing.T, properties ZoneProperties, polygon geo.GeoJSONPolygon) Zone {
+	t.Helper()
+	zone, err := CreateZone(Feature{Type: "Feature", Geometry: polygon, Properties: properties})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zone
+}
+
+func TestCreateZone(t *testing.T) {
+	open := box(0, 0, 1, 1)
+	open.Coordinates[0] = open.Coordinates[0][:4]
+
+	tests := []struct {
+		name       string
+		properties ZoneProperties
+		polygon    geo.GeoJSONPolygon
+		wantErr    bool
+	}{
+		{name: "valid", properties: ZoneProperties{Name: "Centro", Kind: KindParking}, polygon: box(0, 0, 1, 1)},
+		{name: "without name", properties: ZoneProperties{Kind: KindParking}, polygon: box(0, 0, 1, 1), wantErr: true},
+		{name: "unknown kind", properties: ZoneProperties{Name: "Centro", Kind: "lake"}, polygon: box(0, 0, 1, 1), wantErr: true},
+		{name: "negative surcharge", properties: ZoneProperties{Name: "Centro", Kind: KindNoParking, Surcharge: money.FromMinor(-1)}, polygon: box(0, 0, 1, 1), wantErr: true},
+		{name: "slow without limit", properties: ZoneProperties{Name: "Parque", Kind: KindSlow}, polygon: box(0, 0, 1, 1), wantErr: true},
+		{name: "open ring", properties: ZoneProperties{Name: "Centro", Kind: KindParking}, polygon: open, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStore(NewMemoryStore())
+			_, err := CreateZone(Feature{Type: "Feature", Geometry: tt.polygon, Properties: tt.properties})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateZone() = %v, want error %v", err, tt.wantErr)
+			}
+			// Una zona inválida no se guarda
+			if zones, _ := GetAllZones(); len(zones) > 0 == tt.wantErr {
+				t.Errorf("stored zones = %d", len(zones))
+			}
+		})
+	}
+}
+
+func TestCheckParking(t *testing.T) {
+	SetStore(NewMemoryStore())
+	inactive := false
+	createZone(t, ZoneProperties{Name: "Ciudad", Kind: KindServiceArea, Surcharge: money.FromMinor(200)}, box(0, 0, 10, 10))
+	createZone(t, ZoneProperties{Name: "Plaza", Kind: KindParking}, box(0, 0, 2, 2))
+	createZone(t, ZoneProperties{Name: "Hospital", Kind: KindNoParking}, box(5, 5, 6, 6))
+	createZone(t, ZoneProperties{Name: "Feria", Kind: KindNoParking, Surcharge: money.FromMinor(100)}, box(7, 7, 8, 8))
+	createZone(t, ZoneProperties{Name: "Parque", Kind: KindSlow, SpeedLimitKmh: 10}, box(0, 0, 3, 3))
+	createZone(t, ZoneProperties{Name: "Obras", Kind: KindNoParking, Active: &inactive}, box(1, 1, 2, 2))
+
+	tests := []struct {
+		name          string
+		lat, lon      float64
+		wantAllowed   bool
+		wantSurcharge int64
+		wantSpeed     float64
+		wantZones     int
+	}{
+		{name: "parking zone", lat: 1.5, lon: 1.5, wantAllowed: true, wantSpeed: 10, wantZones: 3},
+		{name: "outside the parking zones", lat: 4, lon: 4, wantAllowed: true, wantSurcharge: 200, wantZones: 1},
+		{name: "no-parking zone", lat: 5.5, lon: 5.5, wantZones: 2},
+		{name: "paid no-parking zone", lat: 7.5, lon: 7.5, wantAllowed: true, wantSurcharge: 300, wantZones: 2},
+		{name: "outside the service area", lat: 20, lon: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, err := CheckParking(tt.lat, tt.lon)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if check.Allowed != tt.wantAllowed || check.Surcharge != money.FromMinor(tt.wantSurcharge) ||
+				check.SpeedLimitKmh != tt.wantSpeed || len(check.Zones) != tt.wantZones {
+				t.Errorf("CheckParking(%v, %v) = %+v", tt.lat, tt.lon, check)
+			}
+			// Un rechazo explica el motivo
+			if !check.Allowed && check.Reason == "" {
+				t.Error("rejected without a reason")
+			}
+		})
+	}
+
+	if _, err := CheckParking(100, 0); err == nil {
+		t.Error("CheckParking() accepted invalid coordinates")
+	}
+}
+
+func TestCheckParkingWithoutZones(t *testing.T) {
+	SetStore(NewMemoryStore())
+
+	check, err := CheckParking(-33.45, -70.66)
+	if err != nil || !check.Allowed || !check.Surcharge.IsZero() {
+		t.Errorf("CheckParking() = %+v, %v; want allowed without surcharge", check, err)
+	}
+}
+
+func TestUpdateZone(t *testing.T) {
+	SetStore(NewMemoryStore())
+	zone := createZone(t, ZoneProperties{Name: "Plaza", Kind: KindParking}, box(0, 0, 2, 2))
+
+	inactive := false
+	updated, err := UpdateZone(zone.ID.Hex(), Feature{Geometry: box(0, 0, 4, 4), Properties: ZoneProperties{Name: "Plaza grande", Kind: KindParking, Active: &inactive}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Plaza grande" || updated.Active {
+		t.Errorf("UpdateZone() = %+v", updated)
+	}
+
+	// Las zonas inactivas no cuentan
+	if zones, err := ZonesAt(3, 3); err != nil || len(zones) != 0 {
+		t.Errorf("ZonesAt() = %+v, %v; want none", zones, err)
+	}
+
+	if _, err := UpdateZone("bad", Feature{}); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("UpdateZone(bad id) = %v, want ErrZoneNotFound", err)
+	}
+}
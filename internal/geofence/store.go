@@ -0,0 +1,27 @@
+package geofence
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrZoneNotFound = errors.New("zona no encontrada")
+
+// ZoneStore abstracts the persistence of geofence zones
+type ZoneStore interface {
+	Insert(ctx context.Context, zone Zone) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (Zone, error)
+	FindAll(ctx context.Context) ([]Zone, error)
+	FindActive(ctx context.Context) ([]Zone, error)
+	Update(ctx context.Context, zone Zone) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+var store ZoneStore
+
+// Inject the store used by the geofence services
+func SetStore(s ZoneStore) {
+	store = s
+}
@@ -0,0 +1,82 @@
+package geofence
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps zones in memory, for tests and local demos
+type MemoryStore struct {
+	mu    sync.RWMutex
+	zones map[primitive.ObjectID]Zone
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{zones: make(map[primitive.ObjectID]Zone)}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, zone Zone) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.zones[zone.ID] = zone
+	return nil
+}
+
+func (s *MemoryStore) FindByID(ctx context.Context, id primitive.ObjectID) (Zone, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	zone, ok := s.zones[id]
+	if !ok {
+		return Zone{}, ErrZoneNotFound
+	}
+	return zone, nil
+}
+
+func (s *MemoryStore) FindAll(ctx context.Context) ([]Zone, error) {
+	return s.filter(func(Zone) bool { return true }), nil
+}
+
+func (s *MemoryStore) FindActive(ctx context.Context) ([]Zone, error) {
+	return s.filter(func(z Zone) bool { return z.Active }), nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, zone Zone) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.zones[zone.ID]; !ok {
+		return ErrZoneNotFound
+	}
+	s.zones[zone.ID] = zone
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.zones[id]; !ok {
+		return ErrZoneNotFound
+	}
+	delete(s.zones, id)
+	return nil
+}
+
+func (s *MemoryStore) filter(match func(Zone) bool) []Zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	zones := []Zone{}
+	for _, zone := range s.zones {
+		if match(zone) {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].CreatedAt.Before(zones[j].CreatedAt) })
+	return zones
+}
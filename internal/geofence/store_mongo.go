@@ -0,0 +1,87 @@
+package geofence
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists zones in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, zone Zone) error {
+	_, err := s.collection.InsertOne(ctx, zone)
+	return err
+}
+
+func (s *MongoStore) FindByID(ctx context.Context, id primitive.ObjectID) (Zone, error) {
+	var zone Zone
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&zone)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return zone, ErrZoneNotFound
+	}
+	return zone, err
+}
+
+func (s *MongoStore) FindAll(ctx context.Context) ([]Zone, error) {
+	return s.find(ctx, bson.M{})
+}
+
+func (s *MongoStore) FindActive(ctx context.Context) ([]Zone, error) {
+	return s.find(ctx, bson.M{"active": true})
+}
+
+func (s *MongoStore) Update(ctx context.Context, zone Zone) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": zone.ID}, zone)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrZoneNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrZoneNotFound
+	}
+	return nil
+}
+
+// Create the 2dsphere index on the zone geometry, which also makes MongoDB
+// reject malformed polygons
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "geometry", Value: "2dsphere"}},
+	})
+	return err
+}
+
+func (s *MongoStore) find(ctx context.Context, filter bson.M) ([]Zone, error) {
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	zones := []Zone{}
+	if err := cursor.All(ctx, &zones); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
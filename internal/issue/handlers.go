@@ -0,0 +1,300 @@
+package issue
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/maintenance"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/blob"
+	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxReportBody = MaxPhotoBytes + 1<<20 // La foto más los campos del formulario
+
+var errInvalidForm = errors.New("formulario inválido")
+
+// POST a new issue as JSON or multipart/form-data with a "photo" file, or GET
+// the issues (?status=&bike_id=)
+func HandleIssues(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		handleReport(w, r)
+
+	case http.MethodGet:
+		filter := IssueFilter{}
+		if status := r.URL.Query().Get("status"); status != "" {
+			filter.Statuses = strings.Split(status, ",")
+		}
+		if bikeID := r.URL.Query().Get("bike_id"); bikeID != "" {
+			id, err := primitive.ObjectIDFromHex(bikeID)
+			if err != nil {
+				sendIssueError(w, "GET /issues", bike.ErrBikeNotFound)
+				return
+			}
+			filter.BikeID = id
+		}
+
+		issues, err := GetIssues(filter)
+		if err != nil {
+			sendIssueError(w, "GET /issues", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, issues)
+
+	default:
+		sendMethodNotAllowed(w)
+	}
+}
+
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReportBody)
+
+	var req IssueRequest
+	var photo *blob.Object
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		req, photo, err = readReportForm(r)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&req)
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		httpresponse.SendJSONResponse(w, http.StatusRequestEntityTooLarge, map[string]string{
+			"error": ErrInvalidPhoto.Error(),
+		})
+		return
+	} else if errors.Is(err, errInvalidForm) {
+		sendIssueError(w, "POST /issues", err)
+		return
+	} else if err != nil {
+		sendInvalidJSON(w)
+		return
+	}
+
+	issue, err := Report(userID, req, photo)
+	if err != nil {
+		sendIssueError(w, "POST /issues", err)
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusCreated, issue)
+	logger.Info("POST /issues - Problema reportado", map[string]interface{}{
+		"issue_id":            issue.ID.Hex(),
+		"bike_id":             issue.BikeID.Hex(),
+		"user_id":             userID,
+		"category":            issue.Category,
+		"severity":            issue.Severity,
+		"pulled_from_service": issue.PulledFromService,
+	})
+}
+
+// Read a report sent as a multipart form
+func readReportForm(r *http.Request) (IssueRequest, *blob.Object, error) {
+	if err := r.ParseMultipartForm(maxReportBody); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return IssueRequest{}, nil, err
+		}
+		return IssueRequest{}, nil, errInvalidForm
+	}
+
+	req := IssueRequest{
+		BikeID:      r.FormValue("bike_id"),
+		RideID:      r.FormValue("ride_id"),
+		Category:    r.FormValue("category"),
+		Description: r.FormValue("description"),
+	}
+	for name, target := range map[string]**float64{"latitude": &req.Latitude, "longitude": &req.Longitude} {
+		if value := r.FormValue(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return req, nil, errInvalidForm
+			}
+			*target = &parsed
+		}
+	}
+
+	file, _, err := r.FormFile("photo")
+	if errors.Is(err, http.ErrMissingFile) {
+		return req, nil, nil
+	} else if err != nil {
+		return req, nil, errInvalidForm
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxPhotoBytes+1))
+	if err != nil {
+		return req, nil, errInvalidForm
+	}
+	return req, &blob.Object{Data: data}, nil
+}
+
+// GET The issues reported by the authenticated rider
+func HandleMyIssues(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendMethodNotAllowed(w)
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		return
+	}
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+	issues, err := GetIssues(IssueFilter{UserID: userObjectID})
+	if err != nil {
+		sendIssueError(w, "GET /issues/mine", err)
+		return
+	}
+	httpresponse.SendJSONResponse(w, http.StatusOK, issues)
+}
+
+// GET an issue or its photo by ID, or POST /triage, /link and /close on it
+func HandleIssueByID(w http.ResponseWriter, r *http.Request) {
+	issueID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/issues/"), "/")
+
+	operatorID := primitive.NilObjectID
+	if userID, err := auth.GetAuthenticatedUserID(r); err == nil {
+		operatorID, _ = primitive.ObjectIDFromHex(userID)
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		issue, err := GetIssue(issueID)
+		if err != nil {
+			sendIssueError(w, "GET /issues/{id}", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, issue)
+
+	case action == "photo" && r.Method == http.MethodGet:
+		issue, err := GetIssue(issueID)
+		if err != nil {
+			sendIssueError(w, "GET /issues/{id}/photo", err)
+			return
+		}
+		photo, err := GetPhoto(issue)
+		if err != nil {
+			sendIssueError(w, "GET /issues/{id}/photo", err)
+			return
+		}
+		w.Header().Set("Content-Type", photo.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(photo.Data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(photo.Data)
+
+	case action == "triage" && r.Method == http.MethodPost:
+		var req TriageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			sendInvalidJSON(w)
+			return
+		}
+
+		issue, err := Triage(issueID, req, operatorID)
+		if err != nil {
+			sendIssueError(w, "POST /issues/{id}/triage", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, issue)
+		logger.Info("POST /issues/{id}/triage - Reporte revisado", map[string]interface{}{
+			"issue_id": issue.ID.Hex(),
+			"severity": issue.Severity,
+		})
+
+	case action == "link" && r.Method == http.MethodPost:
+		var req LinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			sendInvalidJSON(w)
+			return
+		}
+
+		issue, err := Link(issueID, req, operatorID)
+		if err != nil {
+			sendIssueError(w, "POST /issues/{id}/link", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, issue)
+		logger.Info("POST /issues/{id}/link - Reporte vinculado a una orden de trabajo", map[string]interface{}{
+			"issue_id":      issue.ID.Hex(),
+			"work_order_id": issue.WorkOrderID.Hex(),
+		})
+
+	case action == "close" && r.Method == http.MethodPost:
+		var req CloseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendInvalidJSON(w)
+			return
+		}
+
+		issue, err := Close(issueID, req, operatorID)
+		if err != nil {
+			sendIssueError(w, "POST /issues/{id}/close", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, issue)
+		logger.Info("POST /issues/{id}/close - Reporte cerrado", map[string]interface{}{
+			"issue_id": issue.ID.Hex(),
+		})
+
+	case action == "" || action == "photo" || action == "triage" || action == "link" || action == "close":
+		sendMethodNotAllowed(w)
+
+	default:
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Ruta no encontrada",
+		})
+	}
+}
+
+func sendIssueError(w http.ResponseWriter, route string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrIssueNotFound), errors.Is(err, ErrNoPhoto), errors.Is(err, blob.ErrNotFound),
+		errors.Is(err, bike.ErrBikeNotFound), errors.Is(err, maintenance.ErrWorkOrderNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvalidCategory), errors.Is(err, ErrInvalidSeverity), errors.Is(err, ErrInvalidPhoto),
+		errors.Is(err, ErrDescriptionLength), errors.Is(err, ErrResolutionNeeded), errors.Is(err, errInvalidForm):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrIssueClosed), errors.Is(err, ErrOtherBike), errors.Is(err, maintenance.ErrWorkOrderClosed):
+		status = http.StatusConflict
+	}
+
+	httpresponse.SendJSONResponse(w, status, map[string]string{
+		"error": err.Error(),
+	})
+	logger.Error(route+" - Error en el reporte de problema", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func sendInvalidJSON(w http.ResponseWriter) {
+	httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+		"error": "Error en el formato del JSON",
+	})
+}
+
+func sendMethodNotAllowed(w http.ResponseWriter) {
+	httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+		"error": "Método no permitido",
+	})
+}
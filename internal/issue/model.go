@@ -0,0 +1,99 @@
+package issue
+
+import (
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Issue is a problem with a bike reported by a rider
+type Issue struct {
+	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID            primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	BikeID            primitive.ObjectID  `bson:"bike_id" json:"bike_id"`
+	RideID            *primitive.ObjectID `bson:"ride_id,omitempty" json:"ride_id,omitempty"`
+	Category          string              `bson:"category" json:"category"`
+	Description       string              `bson:"description,omitempty" json:"description,omitempty"`
+	Severity          string              `bson:"severity" json:"severity"`
+	Location          *geo.GeoJSONPoint   `bson:"location,omitempty" json:"location,omitempty"`
+	PhotoKey          string              `bson:"photo_key,omitempty" json:"-"`
+	HasPhoto          bool                `bson:"has_photo" json:"has_photo"`
+	Status            string              `bson:"status" json:"status"`
+	WorkOrderID       *primitive.ObjectID `bson:"work_order_id,omitempty" json:"work_order_id,omitempty"`
+	TriageNote        string              `bson:"triage_note,omitempty" json:"triage_note,omitempty"`
+	Resolution        string              `bson:"resolution,omitempty" json:"resolution,omitempty"`
+	HandledBy         *primitive.ObjectID `bson:"handled_by,omitempty" json:"handled_by,omitempty"` // Último operador que lo gestionó
+	PulledFromService bool                `bson:"pulled_from_service" json:"pulled_from_service"`
+	ClosedAt          *time.Time          `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	CreatedAt         time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// IssueRequest is the report of a rider, as JSON or as the fields of a
+// multipart form with an optional photo
+type IssueRequest struct {
+	BikeID      string   `json:"bike_id"`
+	RideID      string   `json:"ride_id,omitempty"`
+	Category    string   `json:"category"`
+	Description string   `json:"description,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+}
+
+type TriageRequest struct {
+	Severity string `json:"severity,omitempty"` // Vacío mantiene la calculada
+	Note     string `json:"note,omitempty"`
+}
+
+// LinkRequest links an issue to an existing work order, or to a new one when
+// WorkOrderID is empty
+type LinkRequest struct {
+	WorkOrderID string `json:"work_order_id,omitempty"`
+}
+
+type CloseRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+// Issue categories
+const (
+	CategoryBrakes  = "brakes"
+	CategoryTire    = "tire"
+	CategoryChain   = "chain"
+	CategoryLights  = "lights"
+	CategoryBattery = "battery"
+	CategoryLock    = "lock"
+	CategoryFrame   = "frame"
+	CategoryOther   = "other"
+)
+
+// Severities, from least to most serious
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// Issue states
+const (
+	StatusOpen    = "open"
+	StatusTriaged = "triaged"
+	StatusLinked  = "linked" // Asociado a una orden de trabajo
+	StatusClosed  = "closed"
+)
+
+// IssueFilter selects issues; empty fields match everything
+type IssueFilter struct {
+	UserID   primitive.ObjectID
+	BikeID   primitive.ObjectID
+	Statuses []string
+}
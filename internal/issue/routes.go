@@ -0,0 +1,24 @@
+package issue
+
+import (
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
+)
+
+func RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/issues", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			middleware.RequirePermission(auth.PermRide, http.HandlerFunc(HandleIssues)).ServeHTTP(w, r)
+		case http.MethodGet:
+			middleware.RequirePermission(auth.PermIssuesManage, http.HandlerFunc(HandleIssues)).ServeHTTP(w, r)
+		default:
+			http.Error(w, `{"error": "Método no permitido"}`, http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.Handle("/issues/mine", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(HandleMyIssues)))
+	mux.Handle("/issues/", middleware.RequirePermission(auth.PermIssuesManage, http.HandlerFunc(HandleIssueByID)))
+}
@@ -0,0 +1,394 @@
+package issue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/maintenance"
+	"github.com/clementeaf/bike-tracker/pkg/blob"
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MaxPhotoBytes        = 5 << 20
+	maxDescriptionLength = 1000
+	escalationWindow     = 24 * time.Hour // Reportes de otros usuarios en este plazo elevan la severidad
+)
+
+var (
+	ErrInvalidCategory   = errors.New("categoría inválida")
+	ErrInvalidSeverity   = errors.New("severidad inválida: use low, medium, high o critical")
+	ErrInvalidPhoto      = errors.New("la foto debe ser JPEG, PNG o WebP de hasta 5 MB")
+	ErrDescriptionLength = errors.New("la descripción no puede superar los 1000 caracteres")
+	ErrIssueClosed       = errors.New("el reporte ya está cerrado")
+	ErrResolutionNeeded  = errors.New("la resolución es requerida para cerrar el reporte")
+	ErrOtherBike         = errors.New("la orden de trabajo es de otra bicicleta")
+	ErrNoPhoto           = errors.New("el reporte no tiene foto")
+)
+
+// Severity of each category before escalation
+var severityRules = map[string]string{
+	CategoryBrakes:  SeverityCritical,
+	CategoryFrame:   SeverityCritical,
+	CategoryTire:    SeverityHigh,
+	CategoryChain:   SeverityHigh,
+	CategoryLock:    SeverityHigh,
+	CategoryBattery: SeverityMedium,
+	CategoryLights:  SeverityMedium,
+	CategoryOther:   SeverityLow,
+}
+
+var (
+	pullSeverity = SeverityHigh // Desde esta severidad la bicicleta sale de servicio
+	photoStore   blob.Store
+)
+
+var photoExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Inject the store for the photos of the reports
+func SetPhotoStore(s blob.Store) {
+	photoStore = s
+}
+
+// Override the severity of some categories and set the severity from which a
+// report takes the bike out of service
+func Configure(rules map[string]string, pullFrom string) error {
+	for category, severity := range rules {
+		if _, ok := severityRules[category]; !ok {
+			return errors.New("categoría inválida en las reglas de severidad: " + category)
+		}
+		if _, ok := severityRank[severity]; !ok {
+			return ErrInvalidSeverity
+		}
+	}
+	if _, ok := severityRank[pullFrom]; !ok {
+		return ErrInvalidSeverity
+	}
+
+	for category, severity := range rules {
+		severityRules[category] = severity
+	}
+	pullSeverity = pullFrom
+	return nil
+}
+
+// Configure severities from ISSUE_SEVERITY_RULES (e.g. "lights=high,other=medium")
+// and ISSUE_PULL_SEVERITY, keeping the defaults for the unset ones
+func ConfigureFromEnv() error {
+	rules := map[string]string{}
+	if value := os.Getenv("ISSUE_SEVERITY_RULES"); value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			category, severity, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				return errors.New("ISSUE_SEVERITY_RULES debe tener el formato categoría=severidad,...")
+			}
+			rules[category] = severity
+		}
+	}
+
+	pullFrom := pullSeverity
+	if value := os.Getenv("ISSUE_PULL_SEVERITY"); value != "" {
+		pullFrom = value
+	}
+	return Configure(rules, pullFrom)
+}
+
+// Report a problem with a bike. Reports at or above the pull severity open (or
+// join) a work order, which takes the bike out of service
+func Report(userID string, req IssueRequest, photo *blob.Object) (Issue, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return Issue{}, errors.New("ID de usuario inválido")
+	}
+	bikeID, err := primitive.ObjectIDFromHex(req.BikeID)
+	if err != nil {
+		return Issue{}, bike.ErrBikeNotFound
+	}
+	if _, ok := severityRules[req.Category]; !ok {
+		return Issue{}, ErrInvalidCategory
+	}
+
+	description := strings.TrimSpace(req.Description)
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		return Issue{}, ErrDescriptionLength
+	}
+
+	if _, err := bike.GetBikeByID(bikeID); err != nil {
+		return Issue{}, err
+	}
+
+	now := time.Now()
+	issue := Issue{
+		ID:          primitive.NewObjectID(),
+		UserID:      userObjectID,
+		BikeID:      bikeID,
+		Category:    req.Category,
+		Description: description,
+		Status:      StatusOpen,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if req.RideID != "" {
+		rideID, err := primitive.ObjectIDFromHex(req.RideID)
+		if err != nil {
+			return Issue{}, errors.New("ID de viaje inválido")
+		}
+		issue.RideID = &rideID
+	}
+
+	if req.Latitude != nil || req.Longitude != nil {
+		if req.Latitude == nil || req.Longitude == nil || !geo.ValidCoords(*req.Latitude, *req.Longitude) {
+			return Issue{}, errors.New("ubicación inválida")
+		}
+		issue.Location = geo.NewGeoJSONPoint(*req.Latitude, *req.Longitude)
+	}
+
+	issue.Severity, err = assessSeverity(issue)
+	if err != nil {
+		return Issue{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if photo != nil {
+		if err := savePhoto(ctx, &issue, *photo); err != nil {
+			return Issue{}, err
+		}
+	}
+
+	if err := store.Insert(ctx, issue); err != nil {
+		return Issue{}, errors.New("error al guardar el reporte: " + err.Error())
+	}
+
+	if severityRank[issue.Severity] >= severityRank[pullSeverity] {
+		if err := linkWorkOrder(ctx, &issue, nil, nil); err != nil {
+			logger.Error("Report - Error al sacar la bicicleta de servicio", map[string]interface{}{
+				"issue_id": issue.ID.Hex(),
+				"bike_id":  issue.BikeID.Hex(),
+				"error":    err.Error(),
+			})
+		}
+	}
+
+	return issue, nil
+}
+
+// Get issue by ID
+func GetIssue(issueID string) (Issue, error) {
+	id, err := primitive.ObjectIDFromHex(issueID)
+	if err != nil {
+		return Issue{}, ErrIssueNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByID(ctx, id)
+}
+
+// Get the issues matching a filter
+func GetIssues(filter IssueFilter) ([]Issue, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.Find(ctx, filter)
+}
+
+// Get the photo of an issue
+func GetPhoto(issue Issue) (blob.Object, error) {
+	if issue.PhotoKey == "" {
+		return blob.Object{}, ErrNoPhoto
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return photoStore.Get(ctx, issue.PhotoKey)
+}
+
+// Review an issue, optionally correcting its severity. Raising it to the pull
+// severity takes the bike out of service
+func Triage(issueID string, req TriageRequest, operatorID primitive.ObjectID) (Issue, error) {
+	if req.Severity != "" {
+		if _, ok := severityRank[req.Severity]; !ok {
+			return Issue{}, ErrInvalidSeverity
+		}
+	}
+
+	return changeIssue(issueID, operatorID, func(ctx context.Context, issue *Issue) error {
+		if req.Severity != "" {
+			issue.Severity = req.Severity
+		}
+		issue.TriageNote = req.Note
+		if issue.Status == StatusOpen {
+			issue.Status = StatusTriaged
+		}
+
+		if issue.WorkOrderID == nil && severityRank[issue.Severity] >= severityRank[pullSeverity] {
+			return linkWorkOrder(ctx, issue, &operatorID, nil)
+		}
+		return nil
+	})
+}
+
+// Link an issue to an open work order of its bike, or to a new one
+func Link(issueID string, req LinkRequest, operatorID primitive.ObjectID) (Issue, error) {
+	return changeIssue(issueID, operatorID, func(ctx context.Context, issue *Issue) error {
+		if req.WorkOrderID == "" {
+			return linkWorkOrder(ctx, issue, &operatorID, nil)
+		}
+
+		order, err := maintenance.GetWorkOrder(req.WorkOrderID)
+		if err != nil {
+			return err
+		}
+		if order.BikeID != issue.BikeID {
+			return ErrOtherBike
+		}
+		if order.Status != maintenance.StatusOpen && order.Status != maintenance.StatusAssigned {
+			return maintenance.ErrWorkOrderClosed
+		}
+		return linkWorkOrder(ctx, issue, &operatorID, &order)
+	})
+}
+
+// Close an issue with its resolution
+func Close(issueID string, req CloseRequest, operatorID primitive.ObjectID) (Issue, error) {
+	resolution := strings.TrimSpace(req.Resolution)
+	if resolution == "" {
+		return Issue{}, ErrResolutionNeeded
+	}
+
+	return changeIssue(issueID, operatorID, func(ctx context.Context, issue *Issue) error {
+		now := time.Now()
+		issue.Status = StatusClosed
+		issue.Resolution = resolution
+		issue.ClosedAt = &now
+		return nil
+	})
+}
+
+// Apply an operator change to an issue that is not closed and save it
+func changeIssue(issueID string, operatorID primitive.ObjectID, change func(ctx context.Context, issue *Issue) error) (Issue, error) {
+	issue, err := GetIssue(issueID)
+	if err != nil {
+		return issue, err
+	}
+	if issue.Status == StatusClosed {
+		return issue, ErrIssueClosed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	updated := issue
+	if err := change(ctx, &updated); err != nil {
+		return issue, err
+	}
+	updated.HandledBy = &operatorID
+	updated.UpdatedAt = time.Now()
+
+	if err := store.Update(ctx, updated); err != nil {
+		return issue, err
+	}
+	return updated, nil
+}
+
+// Link an issue to the given work order or, without one, to the open work
+// order opened by reports on the same bike, opening it if there is none. The
+// work order takes the bike out of service
+func linkWorkOrder(ctx context.Context, issue *Issue, operatorID *primitive.ObjectID, order *maintenance.WorkOrder) error {
+	if order == nil {
+		orders, err := maintenance.GetWorkOrders(maintenance.OrderFilter{
+			BikeID:   issue.BikeID,
+			Statuses: []string{maintenance.StatusOpen, maintenance.StatusAssigned},
+		})
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			if orders[i].Source == maintenance.SourceIssue {
+				order = &orders[i]
+				break
+			}
+		}
+	}
+
+	if order == nil {
+		opened, err := maintenance.OpenWorkOrder(issue.BikeID, maintenance.SourceIssue, workOrderReason(*issue), operatorID)
+		if err != nil {
+			return err
+		}
+		order = &opened
+	}
+
+	issue.WorkOrderID = &order.ID
+	issue.Status = StatusLinked
+	issue.PulledFromService = true
+	issue.UpdatedAt = time.Now()
+	return store.Update(ctx, *issue)
+}
+
+// Severity of a new report: the one of its category, one level higher when
+// another rider reported the same bike recently
+func assessSeverity(issue Issue) (string, error) {
+	severity := severityRules[issue.Category]
+
+	recent, err := GetIssues(IssueFilter{BikeID: issue.BikeID, Statuses: []string{StatusOpen, StatusTriaged, StatusLinked}})
+	if err != nil {
+		return severity, err
+	}
+	for _, other := range recent {
+		if other.UserID != issue.UserID && issue.CreatedAt.Sub(other.CreatedAt) < escalationWindow {
+			return escalate(severity), nil
+		}
+	}
+	return severity, nil
+}
+
+func escalate(severity string) string {
+	for name, rank := range severityRank {
+		if rank == severityRank[severity]+1 {
+			return name
+		}
+	}
+	return severity
+}
+
+func savePhoto(ctx context.Context, issue *Issue, photo blob.Object) error {
+	contentType := http.DetectContentType(photo.Data)
+	extension, ok := photoExtensions[contentType]
+	if !ok || len(photo.Data) > MaxPhotoBytes {
+		return ErrInvalidPhoto
+	}
+
+	key := "issues/" + issue.ID.Hex() + extension
+	if err := photoStore.Put(ctx, key, blob.Object{Data: photo.Data, ContentType: contentType}); err != nil {
+		return errors.New("error al guardar la foto: " + err.Error())
+	}
+	issue.PhotoKey = key
+	issue.HasPhoto = true
+	return nil
+}
+
+func workOrderReason(issue Issue) string {
+	reason := "Reporte de usuario: " + issue.Category
+	if issue.Description != "" {
+		reason += " - " + issue.Description
+	}
+	return reason
+}
@@ -0,0 +1,253 @@
+package issue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/maintenance"
+	"github.com/clementeaf/bike-tracker/pkg/blob"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Smallest valid PNG header, enough for content sniffing
+var pngPhoto = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+// Fresh stores with a free bike, photos in a temporary directory and the
+// default severity rules
+func setupIssues(t *testing.T) primitive.ObjectID {
+	t.Helper()
+	bike.SetStore(bike.NewMemoryStore())
+	maintenance.SetRuleStore(maintenance.NewMemoryRuleStore())
+	maintenance.SetWorkOrderStore(maintenance.NewMemoryWorkOrderStore())
+	SetStore(NewMemoryStore())
+	SetPhotoStore(blob.NewLocalStore(t.TempDir()))
+
+	rules := map[string]string{}
+	for category, severity := range severityRules {
+		rules[category] = severity
+	}
+	previous := pullSeverity
+	t.Cleanup(func() { Configure(rules, previous) })
+
+	bicycle, err := bike.RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bicycle.ID
+}
+
+func bikeStatus(t *testing.T, bikeID primitive.ObjectID) int {
+	t.Helper()
+	bicycle, err := bike.GetBikeByID(bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bicycle.Status
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          IssueRequest
+		wantErr      error
+		wantSeverity string
+		wantPulled   bool
+	}{
+		{name: "critical", req: IssueRequest{Category: CategoryBrakes, Description: "no frena"}, wantSeverity: SeverityCritical, wantPulled: true},
+		{name: "high", req: IssueRequest{Category: CategoryTire}, wantSeverity: SeverityHigh, wantPulled: true},
+		{name: "medium", req: IssueRequest{Category: CategoryLights}, wantSeverity: SeverityMedium},
+		{name: "unknown category", req: IssueRequest{Category: "wings"}, wantErr: ErrInvalidCategory},
+		{name: "long description", req: IssueRequest{Category: CategoryOther, Description: strings.Repeat("á", maxDescriptionLength+1)}, wantErr: ErrDescriptionLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bikeID := setupIssues(t)
+			tt.req.BikeID = bikeID.Hex()
+
+			issue, err := Report(primitive.NewObjectID().Hex(), tt.req, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Report() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if issue.Severity != tt.wantSeverity || issue.PulledFromService != tt.wantPulled || (issue.WorkOrderID != nil) != tt.wantPulled {
+				t.Errorf("issue = %+v", issue)
+			}
+
+			wantStatus := bike.StatusFree
+			if tt.wantPulled {
+				wantStatus = bike.StatusMaintenance
+			}
+			if status := bikeStatus(t, bikeID); status != wantStatus {
+				t.Errorf("bike status = %d, want %d", status, wantStatus)
+			}
+		})
+	}
+}
+
+func TestReportEscalation(t *testing.T) {
+	tests := []struct {
+		name         string
+		sameUser     bool
+		wantSeverity string
+	}{
+		{name: "another rider", wantSeverity: SeverityHigh},
+		{name: "same rider", sameUser: true, wantSeverity: SeverityMedium},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bikeID := setupIssues(t)
+			first := primitive.NewObjectID().Hex()
+			if _, err := Report(first, IssueRequest{BikeID: bikeID.Hex(), Category: CategoryLights}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			second := primitive.NewObjectID().Hex()
+			if tt.sameUser {
+				second = first
+			}
+			issue, err := Report(second, IssueRequest{BikeID: bikeID.Hex(), Category: CategoryLights}, nil)
+			if err != nil || issue.Severity != tt.wantSeverity {
+				t.Errorf("second Report() = %+v, %v; want severity %s", issue, err, tt.wantSeverity)
+			}
+		})
+	}
+}
+
+func TestReportsShareWorkOrder(t *testing.T) {
+	bikeID := setupIssues(t)
+
+	first, err := Report(primitive.NewObjectID().Hex(), IssueRequest{BikeID: bikeID.Hex(), Category: CategoryBrakes}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Report(primitive.NewObjectID().Hex(), IssueRequest{BikeID: bikeID.Hex(), Category: CategoryFrame}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.WorkOrderID == nil || second.WorkOrderID == nil || *first.WorkOrderID != *second.WorkOrderID {
+		t.Errorf("work orders = %v and %v, want the same one", first.WorkOrderID, second.WorkOrderID)
+	}
+}
+
+func TestReportPhoto(t *testing.T) {
+	bikeID := setupIssues(t)
+	req := IssueRequest{BikeID: bikeID.Hex(), Category: CategoryOther}
+
+	issue, err := Report(primitive.NewObjectID().Hex(), req, &blob.Object{Data: pngPhoto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo, err := GetPhoto(issue)
+	if err != nil || photo.ContentType != "image/png" || string(photo.Data) != string(pngPhoto) {
+		t.Errorf("GetPhoto() = %q, %v", photo.ContentType, err)
+	}
+
+	// Un archivo que no es imagen no se guarda
+	if _, err := Report(primitive.NewObjectID().Hex(), req, &blob.Object{Data: []byte("hola")}); !errors.Is(err, ErrInvalidPhoto) {
+		t.Errorf("Report(text photo) = %v, want ErrInvalidPhoto", err)
+	}
+	if _, err := GetPhoto(Issue{}); !errors.Is(err, ErrNoPhoto) {
+		t.Errorf("GetPhoto(no photo) = %v, want ErrNoPhoto", err)
+	}
+}
+
+func TestTriageAndClose(t *testing.T) {
+	bikeID := setupIssues(t)
+	operatorID := primitive.NewObjectID()
+	issue, err := Report(primitive.NewObjectID().Hex(), IssueRequest{BikeID: bikeID.Hex(), Category: CategoryLights}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Triage(issue.ID.Hex(), TriageRequest{Severity: "urgent"}, operatorID); !errors.Is(err, ErrInvalidSeverity) {
+		t.Errorf("Triage(unknown severity) = %v, want ErrInvalidSeverity", err)
+	}
+
+	// Subir la severidad saca la bicicleta de servicio
+	triaged, err := Triage(issue.ID.Hex(), TriageRequest{Severity: SeverityHigh, Note: "sin luz trasera"}, operatorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if triaged.Status != StatusLinked || triaged.WorkOrderID == nil || triaged.HandledBy == nil || *triaged.HandledBy != operatorID {
+		t.Errorf("triaged = %+v", triaged)
+	}
+	if status := bikeStatus(t, bikeID); status != bike.StatusMaintenance {
+		t.Errorf("bike status = %d, want maintenance", status)
+	}
+
+	if _, err := Close(issue.ID.Hex(), CloseRequest{Resolution: " "}, operatorID); !errors.Is(err, ErrResolutionNeeded) {
+		t.Errorf("Close(no resolution) = %v, want ErrResolutionNeeded", err)
+	}
+	closed, err := Close(issue.ID.Hex(), CloseRequest{Resolution: "luz cambiada"}, operatorID)
+	if err != nil || closed.Status != StatusClosed || closed.ClosedAt == nil {
+		t.Fatalf("Close() = %+v, %v", closed, err)
+	}
+	if _, err := Triage(issue.ID.Hex(), TriageRequest{}, operatorID); !errors.Is(err, ErrIssueClosed) {
+		t.Errorf("Triage(closed) = %v, want ErrIssueClosed", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	bikeID := setupIssues(t)
+	operatorID := primitive.NewObjectID()
+	issue, err := Report(primitive.NewObjectID().Hex(), IssueRequest{BikeID: bikeID.Hex(), Category: CategoryOther}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := bike.RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherOrder, err := maintenance.OpenWorkOrder(other.ID, maintenance.SourceManual, "revisión", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Link(issue.ID.Hex(), LinkRequest{WorkOrderID: otherOrder.ID.Hex()}, operatorID); !errors.Is(err, ErrOtherBike) {
+		t.Errorf("Link(other bike) = %v, want ErrOtherBike", err)
+	}
+
+	order, err := maintenance.OpenWorkOrder(bikeID, maintenance.SourceManual, "revisión", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := Link(issue.ID.Hex(), LinkRequest{WorkOrderID: order.ID.Hex()}, operatorID)
+	if err != nil || linked.WorkOrderID == nil || *linked.WorkOrderID != order.ID || linked.Status != StatusLinked {
+		t.Errorf("Link() = %+v, %v", linked, err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	setupIssues(t)
+
+	tests := []struct {
+		name     string
+		rules    map[string]string
+		pullFrom string
+		wantErr  bool
+	}{
+		{name: "valid", rules: map[string]string{CategoryLights: SeverityHigh}, pullFrom: SeverityCritical},
+		{name: "unknown category", rules: map[string]string{"wings": SeverityHigh}, pullFrom: SeverityHigh, wantErr: true},
+		{name: "unknown severity", rules: map[string]string{CategoryLights: "urgent"}, pullFrom: SeverityHigh, wantErr: true},
+		{name: "unknown pull severity", pullFrom: "urgent", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Configure(tt.rules, tt.pullFrom); (err != nil) != tt.wantErr {
+				t.Errorf("Configure() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// La configuración válida queda aplicada
+	if severityRules[CategoryLights] != SeverityHigh || pullSeverity != SeverityCritical {
+		t.Errorf("rules = %v, pull from %s", severityRules, pullSeverity)
+	}
+}
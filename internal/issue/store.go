@@ -0,0 +1,26 @@
+package issue
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrIssueNotFound = errors.New("reporte no encontrado")
+
+// IssueStore abstracts the persistence of issue reports
+type IssueStore interface {
+	Insert(ctx context.Context, issue Issue) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (Issue, error)
+	// Find returns the issues matching the filter, newest first
+	Find(ctx context.Context, filter IssueFilter) ([]Issue, error)
+	Update(ctx context.Context, issue Issue) error
+}
+
+var store IssueStore
+
+// Inject the store used by the issue services
+func SetStore(s IssueStore) {
+	store = s
+}
@@ -0,0 +1,79 @@
+package issue
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps issues in memory, for tests and local demos
+type MemoryStore struct {
+	mu     sync.RWMutex
+	issues map[primitive.ObjectID]Issue
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{issues: make(map[primitive.ObjectID]Issue)}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, issue Issue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.issues[issue.ID] = issue
+	return nil
+}
+
+func (s *MemoryStore) FindByID(ctx context.Context, id primitive.ObjectID) (Issue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	issue, ok := s.issues[id]
+	if !ok {
+		return Issue{}, ErrIssueNotFound
+	}
+	return issue, nil
+}
+
+func (s *MemoryStore) Find(ctx context.Context, filter IssueFilter) ([]Issue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	issues := []Issue{}
+	for _, issue := range s.issues {
+		if !filter.UserID.IsZero() && issue.UserID != filter.UserID {
+			continue
+		}
+		if !filter.BikeID.IsZero() && issue.BikeID != filter.BikeID {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !contains(filter.Statuses, issue.Status) {
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].CreatedAt.After(issues[j].CreatedAt) })
+	return issues, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, issue Issue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.issues[issue.ID]; !ok {
+		return ErrIssueNotFound
+	}
+	s.issues[issue.ID] = issue
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
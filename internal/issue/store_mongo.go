@@ -0,0 +1,80 @@
+package issue
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists issues in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, issue Issue) error {
+	_, err := s.collection.InsertOne(ctx, issue)
+	return err
+}
+
+func (s *MongoStore) FindByID(ctx context.Context, id primitive.ObjectID) (Issue, error) {
+	var issue Issue
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&issue)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return issue, ErrIssueNotFound
+	}
+	return issue, err
+}
+
+func (s *MongoStore) Find(ctx context.Context, filter IssueFilter) ([]Issue, error) {
+	query := bson.M{}
+	if !filter.UserID.IsZero() {
+		query["user_id"] = filter.UserID
+	}
+	if !filter.BikeID.IsZero() {
+		query["bike_id"] = filter.BikeID
+	}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	issues := []Issue{}
+	if err := cursor.All(ctx, &issues); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+func (s *MongoStore) Update(ctx context.Context, issue Issue) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": issue.ID}, issue)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrIssueNotFound
+	}
+	return nil
+}
+
+// Create the indexes used to list issues by bike, by rider and by status
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "bike_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
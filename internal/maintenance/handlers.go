@@ -0,0 +1,252 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GET All maintenance rules or POST a new one
+func HandleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := GetRules()
+		if err != nil {
+			sendMaintenanceError(w, "GET /maintenance/rules", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, rules)
+
+	case http.MethodPost:
+		var req RuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendInvalidJSON(w)
+			return
+		}
+
+		rule, err := CreateRule(req)
+		if err != nil {
+			sendMaintenanceError(w, "POST /maintenance/rules", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusCreated, rule)
+		logger.Info("POST /maintenance/rules - Regla creada", map[string]interface{}{
+			"rule_id": rule.ID.Hex(),
+			"name":    rule.Name,
+		})
+
+	default:
+		sendMethodNotAllowed(w)
+	}
+}
+
+// PUT or DELETE a maintenance rule by ID
+func HandleRuleByID(w http.ResponseWriter, r *http.Request) {
+	ruleID := strings.TrimPrefix(r.URL.Path, "/maintenance/rules/")
+
+	switch r.Method {
+	case http.MethodPut:
+		var req RuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendInvalidJSON(w)
+			return
+		}
+
+		rule, err := UpdateRule(ruleID, req)
+		if err != nil {
+			sendMaintenanceError(w, "PUT /maintenance/rules/{id}", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, rule)
+
+	case http.MethodDelete:
+		if err := DeleteRule(ruleID); err != nil {
+			sendMaintenanceError(w, "DELETE /maintenance/rules/{id}", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		logger.Info("DELETE /maintenance/rules/{id} - Regla eliminada", map[string]interface{}{
+			"rule_id": ruleID,
+		})
+
+	default:
+		sendMethodNotAllowed(w)
+	}
+}
+
+// GET Work orders (?status=&bike_id=) or POST a new one
+func HandleWorkOrders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		filter := OrderFilter{}
+		if status := r.URL.Query().Get("status"); status != "" {
+			filter.Statuses = strings.Split(status, ",")
+		}
+		if bikeID := r.URL.Query().Get("bike_id"); bikeID != "" {
+			id, err := primitive.ObjectIDFromHex(bikeID)
+			if err != nil {
+				sendMaintenanceError(w, "GET /maintenance/orders", bike.ErrBikeNotFound)
+				return
+			}
+			filter.BikeID = id
+		}
+
+		orders, err := GetWorkOrders(filter)
+		if err != nil {
+			sendMaintenanceError(w, "GET /maintenance/orders", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, orders)
+
+	case http.MethodPost:
+		userID, err := auth.GetAuthenticatedUserID(r)
+		if err != nil {
+			httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+				"error": "No autorizado",
+			})
+			return
+		}
+		userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+		var req WorkOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendInvalidJSON(w)
+			return
+		}
+
+		order, err := CreateWorkOrder(req, userObjectID)
+		if err != nil {
+			sendMaintenanceError(w, "POST /maintenance/orders", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusCreated, order)
+		logger.Info("POST /maintenance/orders - Orden de trabajo abierta", map[string]interface{}{
+			"work_order_id": order.ID.Hex(),
+			"bike_id":       order.BikeID.Hex(),
+			"user_id":       userID,
+		})
+
+	default:
+		sendMethodNotAllowed(w)
+	}
+}
+
+// GET or PUT a work order by ID, or POST /complete and /cancel on it
+func HandleWorkOrderByID(w http.ResponseWriter, r *http.Request) {
+	orderID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/maintenance/orders/"), "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		order, err := GetWorkOrder(orderID)
+		if err != nil {
+			sendMaintenanceError(w, "GET /maintenance/orders/{id}", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, order)
+
+	case action == "" && r.Method == http.MethodPut:
+		var req UpdateWorkOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendInvalidJSON(w)
+			return
+		}
+
+		order, err := UpdateWorkOrder(orderID, req)
+		if err != nil {
+			sendMaintenanceError(w, "PUT /maintenance/orders/{id}", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, order)
+
+	case action == "complete" && r.Method == http.MethodPost:
+		var req CompleteWorkOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			sendInvalidJSON(w)
+			return
+		}
+
+		order, err := CompleteWorkOrder(orderID, req)
+		if err != nil {
+			sendMaintenanceError(w, "POST /maintenance/orders/{id}/complete", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, order)
+		logger.Info("POST /maintenance/orders/{id}/complete - Orden de trabajo completada", map[string]interface{}{
+			"work_order_id": order.ID.Hex(),
+			"bike_id":       order.BikeID.Hex(),
+			"technician":    order.Technician,
+		})
+
+	case action == "cancel" && r.Method == http.MethodPost:
+		order, err := CancelWorkOrder(orderID)
+		if err != nil {
+			sendMaintenanceError(w, "POST /maintenance/orders/{id}/cancel", err)
+			return
+		}
+		httpresponse.SendJSONResponse(w, http.StatusOK, order)
+
+	case action == "" || action == "complete" || action == "cancel":
+		sendMethodNotAllowed(w)
+
+	default:
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Ruta no encontrada",
+		})
+	}
+}
+
+// POST Check now which bikes are due for service
+func HandleCheckDue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendMethodNotAllowed(w)
+		return
+	}
+
+	opened, err := CheckDueBikes()
+	if err != nil {
+		sendMaintenanceError(w, "POST /maintenance/check", err)
+		return
+	}
+	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]int{
+		"opened": opened,
+	})
+}
+
+func sendMaintenanceError(w http.ResponseWriter, route string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrRuleNotFound), errors.Is(err, ErrWorkOrderNotFound), errors.Is(err, bike.ErrBikeNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvalidRule), errors.Is(err, ErrReasonRequired):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrWorkOrderClosed), errors.Is(err, ErrWorkOrderConflict), errors.Is(err, ErrTechnicianNeeded):
+		status = http.StatusConflict
+	}
+
+	httpresponse.SendJSONResponse(w, status, map[string]string{
+		"error": err.Error(),
+	})
+	logger.Error(route+" - Error de mantenimiento", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func sendInvalidJSON(w http.ResponseWriter) {
+	httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+		"error": "Error en el formato del JSON",
+	})
+}
+
+func sendMethodNotAllowed(w http.ResponseWriter) {
+	httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+		"error": "Método no permitido",
+	})
+}
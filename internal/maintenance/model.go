@@ -0,0 +1,95 @@
+package maintenance
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rule schedules a service for every bike after some usage minutes, rides or
+// days since its last service. Whichever interval is reached first applies
+type Rule struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	UsageMinutes float64            `bson:"usage_minutes,omitempty" json:"usage_minutes,omitempty"`
+	Rides        int                `bson:"rides,omitempty" json:"rides,omitempty"`
+	Days         int                `bson:"days,omitempty" json:"days,omitempty"`
+	Active       bool               `bson:"active" json:"active"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type RuleRequest struct {
+	Name         string  `json:"name"`
+	UsageMinutes float64 `json:"usage_minutes"`
+	Rides        int     `json:"rides"`
+	Days         int     `json:"days"`
+	Active       *bool   `json:"active,omitempty"` // Por defecto activa
+}
+
+// WorkOrder is a service job on a bike. While it is open the bike stays in
+// StatusMaintenance
+type WorkOrder struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	BikeID      primitive.ObjectID  `bson:"bike_id" json:"bike_id"`
+	Source      string              `bson:"source" json:"source"`
+	RuleID      *primitive.ObjectID `bson:"rule_id,omitempty" json:"rule_id,omitempty"`
+	Reason      string              `bson:"reason" json:"reason"`
+	Status      string              `bson:"status" json:"status"`
+	Technician  string              `bson:"technician,omitempty" json:"technician,omitempty"`
+	PartsNotes  string              `bson:"parts_notes,omitempty" json:"parts_notes,omitempty"`
+	Notes       string              `bson:"notes,omitempty" json:"notes,omitempty"`
+	CreatedBy   *primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	DueKey      string              `bson:"due_key,omitempty" json:"-"` // Una orden abierta por regla y bicicleta
+	AssignedAt  *time.Time          `bson:"assigned_at,omitempty" json:"assigned_at,omitempty"`
+	CompletedAt *time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+type WorkOrderRequest struct {
+	BikeID     string `json:"bike_id"`
+	Reason     string `json:"reason"`
+	Technician string `json:"technician,omitempty"`
+}
+
+// UpdateWorkOrderRequest changes the fields sent, leaving the rest as they are
+type UpdateWorkOrderRequest struct {
+	Technician *string `json:"technician,omitempty"`
+	PartsNotes *string `json:"parts_notes,omitempty"`
+	Notes      *string `json:"notes,omitempty"`
+}
+
+type CompleteWorkOrderRequest struct {
+	PartsNotes string `json:"parts_notes,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+}
+
+// Work order states
+const (
+	StatusOpen      = "open"
+	StatusAssigned  = "assigned" // Con técnico asignado
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+)
+
+// Why a work order was opened
+const (
+	SourceRule   = "rule"
+	SourceManual = "manual"
+	SourceIssue  = "issue" // Reporte de un usuario
+)
+
+// OrderFilter selects work orders; empty fields match everything
+type OrderFilter struct {
+	BikeID   primitive.ObjectID
+	Statuses []string
+}
+
+func (o WorkOrder) open() bool {
+	return o.Status == StatusOpen || o.Status == StatusAssigned
+}
+
+func dueKey(ruleID, bikeID primitive.ObjectID) string {
+	return ruleID.Hex() + ":" + bikeID.Hex()
+}
@@ -0,0 +1,16 @@
+package maintenance
+
+import (
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
+)
+
+func RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("/maintenance/rules", middleware.RequirePermission(auth.PermMaintenance, http.HandlerFunc(HandleRules)))
+	mux.Handle("/maintenance/rules/", middleware.RequirePermission(auth.PermMaintenance, http.HandlerFunc(HandleRuleByID)))
+	mux.Handle("/maintenance/orders", middleware.RequirePermission(auth.PermMaintenance, http.HandlerFunc(HandleWorkOrders)))
+	mux.Handle("/maintenance/orders/", middleware.RequirePermission(auth.PermMaintenance, http.HandlerFunc(HandleWorkOrderByID)))
+	mux.Handle("/maintenance/check", middleware.RequirePermission(auth.PermMaintenance, http.HandlerFunc(HandleCheckDue)))
+}
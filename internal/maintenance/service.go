@@ -0,0 +1,423 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidRule      = errors.New("regla inválida: requiere nombre y al menos un intervalo positivo (usage_minutes, rides o days)")
+	ErrWorkOrderClosed  = errors.New("la orden de trabajo ya está cerrada")
+	ErrReasonRequired   = errors.New("el motivo de la orden es requerido")
+	ErrTechnicianNeeded = errors.New("la orden no tiene técnico asignado")
+)
+
+var openStatuses = []string{StatusOpen, StatusAssigned}
+
+// Create a maintenance rule
+func CreateRule(req RuleRequest) (Rule, error) {
+	now := time.Now()
+	rule := Rule{ID: primitive.NewObjectID(), CreatedAt: now}
+	applyRule(&rule, req, now)
+
+	if err := validateRule(rule); err != nil {
+		return rule, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := ruleStore.Insert(ctx, rule); err != nil {
+		return rule, errors.New("error al guardar la regla: " + err.Error())
+	}
+	return rule, nil
+}
+
+// Replace the intervals of a rule
+func UpdateRule(ruleID string, req RuleRequest) (Rule, error) {
+	id, err := primitive.ObjectIDFromHex(ruleID)
+	if err != nil {
+		return Rule{}, ErrRuleNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rule, err := ruleStore.FindByID(ctx, id)
+	if err != nil {
+		return rule, err
+	}
+
+	applyRule(&rule, req, time.Now())
+	if err := validateRule(rule); err != nil {
+		return rule, err
+	}
+	return rule, ruleStore.Update(ctx, rule)
+}
+
+// Delete a rule. Open work orders it created stay open
+func DeleteRule(ruleID string) error {
+	id, err := primitive.ObjectIDFromHex(ruleID)
+	if err != nil {
+		return ErrRuleNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return ruleStore.Delete(ctx, id)
+}
+
+// Get all rules
+func GetRules() ([]Rule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return ruleStore.FindAll(ctx)
+}
+
+// Open a work order for a bike by hand
+func CreateWorkOrder(req WorkOrderRequest, createdBy primitive.ObjectID) (WorkOrder, error) {
+	bikeID, err := primitive.ObjectIDFromHex(req.BikeID)
+	if err != nil {
+		return WorkOrder{}, bike.ErrBikeNotFound
+	}
+
+	order, err := OpenWorkOrder(bikeID, SourceManual, req.Reason, &createdBy)
+	if err != nil || req.Technician == "" {
+		return order, err
+	}
+	return UpdateWorkOrder(order.ID.Hex(), UpdateWorkOrderRequest{Technician: &req.Technician})
+}
+
+// Open a work order for a bike and take the bike out of service. A bike in
+// use or reserved is pulled by the scheduler once it is free
+func OpenWorkOrder(bikeID primitive.ObjectID, source, reason string, createdBy *primitive.ObjectID) (WorkOrder, error) {
+	return openWorkOrder(bikeID, source, reason, createdBy, nil)
+}
+
+func openWorkOrder(bikeID primitive.ObjectID, source, reason string, createdBy, ruleID *primitive.ObjectID) (WorkOrder, error) {
+	if strings.TrimSpace(reason) == "" {
+		return WorkOrder{}, ErrReasonRequired
+	}
+	if _, err := bike.GetBikeByID(bikeID); err != nil {
+		return WorkOrder{}, err
+	}
+
+	now := time.Now()
+	order := WorkOrder{
+		ID:        primitive.NewObjectID(),
+		BikeID:    bikeID,
+		Source:    source,
+		RuleID:    ruleID,
+		Reason:    reason,
+		Status:    StatusOpen,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if ruleID != nil {
+		order.DueKey = dueKey(*ruleID, bikeID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := orderStore.Insert(ctx, order); err != nil {
+		return order, err
+	}
+
+	pullBike(bikeID)
+	return order, nil
+}
+
+// Get work order by ID
+func GetWorkOrder(orderID string) (WorkOrder, error) {
+	id, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return WorkOrder{}, ErrWorkOrderNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return orderStore.FindByID(ctx, id)
+}
+
+// Get the work orders matching a filter
+func GetWorkOrders(filter OrderFilter) ([]WorkOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return orderStore.Find(ctx, filter)
+}
+
+// Assign a technician or add notes to an open work order
+func UpdateWorkOrder(orderID string, req UpdateWorkOrderRequest) (WorkOrder, error) {
+	return changeWorkOrder(orderID, func(order *WorkOrder, now time.Time) error {
+		if req.Technician != nil {
+			order.Technician = strings.TrimSpace(*req.Technician)
+			order.Status = StatusOpen
+			order.AssignedAt = nil
+			if order.Technician != "" {
+				order.Status = StatusAssigned
+				order.AssignedAt = &now
+			}
+		}
+		if req.PartsNotes != nil {
+			order.PartsNotes = *req.PartsNotes
+		}
+		if req.Notes != nil {
+			order.Notes = *req.Notes
+		}
+		return nil
+	})
+}
+
+// Complete a work order, stamping the service on the bike. The bike returns
+// to service unless other orders on it are still open
+func CompleteWorkOrder(orderID string, req CompleteWorkOrderRequest) (WorkOrder, error) {
+	order, err := changeWorkOrder(orderID, func(order *WorkOrder, now time.Time) error {
+		if order.Technician == "" {
+			return ErrTechnicianNeeded
+		}
+		if req.PartsNotes != "" {
+			order.PartsNotes = req.PartsNotes
+		}
+		if req.Notes != "" {
+			order.Notes = req.Notes
+		}
+		order.Status = StatusCompleted
+		order.CompletedAt = &now
+		order.DueKey = ""
+		return nil
+	})
+	if err != nil {
+		return order, err
+	}
+
+	next, err := nextMaintenance(time.Now())
+	if err == nil {
+		_, err = bike.CompleteMaintenance(order.BikeID, next, !hasOpenOrders(order.BikeID))
+	}
+	if err != nil {
+		logger.Error("CompleteWorkOrder - Error al registrar el servicio en la bicicleta", map[string]interface{}{
+			"work_order_id": order.ID.Hex(),
+			"bike_id":       order.BikeID.Hex(),
+			"error":         err.Error(),
+		})
+	}
+	return order, nil
+}
+
+// Cancel a work order. The bike returns to service unless other orders on it
+// are still open
+func CancelWorkOrder(orderID string) (WorkOrder, error) {
+	order, err := changeWorkOrder(orderID, func(order *WorkOrder, now time.Time) error {
+		order.Status = StatusCancelled
+		order.DueKey = ""
+		return nil
+	})
+	if err != nil {
+		return order, err
+	}
+
+	if !hasOpenOrders(order.BikeID) {
+		if err := bike.ReleaseMaintenance(order.BikeID); err != nil && !errors.Is(err, bike.ErrBikeUnavailable) {
+			logger.Error("CancelWorkOrder - Error al devolver la bicicleta al servicio", map[string]interface{}{
+				"work_order_id": order.ID.Hex(),
+				"bike_id":       order.BikeID.Hex(),
+				"error":         err.Error(),
+			})
+		}
+	}
+	return order, nil
+}
+
+// Open work orders for the bikes due for service under the active rules and
+// take out of service the bikes with open orders that became free. Returns how
+// many orders were opened
+func CheckDueBikes() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rules, err := ruleStore.FindAll(ctx)
+	if err != nil {
+		return 0, errors.New("error al consultar reglas de mantenimiento: " + err.Error())
+	}
+	bikes, err := bike.GetAllBikes()
+	if err != nil {
+		return 0, errors.New("error al consultar bicicletas: " + err.Error())
+	}
+
+	now := time.Now()
+	opened := 0
+	for _, bicycle := range bikes {
+		for _, rule := range rules {
+			reason, due := dueReason(rule, bicycle, now)
+			if !due {
+				continue
+			}
+
+			ruleID := rule.ID
+			_, err := openWorkOrder(bicycle.ID, SourceRule, reason, nil, &ruleID)
+			if errors.Is(err, ErrWorkOrderConflict) {
+				continue
+			} else if err != nil {
+				logger.Error("CheckDueBikes - Error al abrir orden de trabajo", map[string]interface{}{
+					"bike_id": bicycle.ID.Hex(),
+					"rule_id": rule.ID.Hex(),
+					"error":   err.Error(),
+				})
+				continue
+			}
+			opened++
+		}
+
+		if (bicycle.Status == bike.StatusFree || bicycle.Status == bike.StatusNoBattery) && hasOpenOrders(bicycle.ID) {
+			pullBike(bicycle.ID)
+		}
+	}
+
+	return opened, nil
+}
+
+// Periodically check which bikes are due for service in background
+func StartMaintenanceScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			opened, err := CheckDueBikes()
+			if err != nil {
+				logger.Error("StartMaintenanceScheduler - Error al programar mantenimientos", map[string]interface{}{
+					"error": err.Error(),
+				})
+				continue
+			}
+			if opened > 0 {
+				logger.Info("StartMaintenanceScheduler - Órdenes de trabajo abiertas", map[string]interface{}{
+					"work_orders": opened,
+				})
+			}
+		}
+	}()
+}
+
+// Whether a bike is due for service under a rule, and why
+func dueReason(rule Rule, bicycle bike.Bike, now time.Time) (string, bool) {
+	if !rule.Active {
+		return "", false
+	}
+
+	if rule.UsageMinutes > 0 && bicycle.TotalUsageMinutes-bicycle.UsageAtMaintenance >= rule.UsageMinutes {
+		return fmt.Sprintf("%s: %.0f minutos de uso desde el último servicio", rule.Name, bicycle.TotalUsageMinutes-bicycle.UsageAtMaintenance), true
+	}
+	if rule.Rides > 0 && bicycle.RideCount-bicycle.RidesAtMaintenance >= rule.Rides {
+		return fmt.Sprintf("%s: %d viajes desde el último servicio", rule.Name, bicycle.RideCount-bicycle.RidesAtMaintenance), true
+	}
+
+	// Sin servicios previos se cuenta desde que entró en operación
+	since := bicycle.LastMaintenance
+	if since.IsZero() {
+		since = bicycle.OperationalSince
+	}
+	if rule.Days > 0 && !since.IsZero() && !now.Before(since.AddDate(0, 0, rule.Days)) {
+		return fmt.Sprintf("%s: %d días desde el último servicio", rule.Name, rule.Days), true
+	}
+	return "", false
+}
+
+// Date of the next calendar service under the active rules, zero if none
+// schedules by days
+func nextMaintenance(from time.Time) (time.Time, error) {
+	rules, err := GetRules()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	for _, rule := range rules {
+		if !rule.Active || rule.Days <= 0 {
+			continue
+		}
+		if date := from.AddDate(0, 0, rule.Days); next.IsZero() || date.Before(next) {
+			next = date
+		}
+	}
+	return next, nil
+}
+
+// Apply a change to an open work order with compare-and-set
+func changeWorkOrder(orderID string, change func(order *WorkOrder, now time.Time) error) (WorkOrder, error) {
+	id, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return WorkOrder{}, ErrWorkOrderNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := orderStore.FindByID(ctx, id)
+	if err != nil {
+		return order, err
+	}
+	if !order.open() {
+		return order, ErrWorkOrderClosed
+	}
+
+	now := time.Now()
+	updated := order
+	if err := change(&updated, now); err != nil {
+		return order, err
+	}
+	updated.UpdatedAt = now
+
+	if err := orderStore.UpdateIfStatus(ctx, updated, order.Status); err != nil {
+		return order, err
+	}
+	return updated, nil
+}
+
+func hasOpenOrders(bikeID primitive.ObjectID) bool {
+	orders, err := GetWorkOrders(OrderFilter{BikeID: bikeID, Statuses: openStatuses})
+	// Ante la duda la bicicleta sigue fuera de servicio
+	return err != nil || len(orders) > 0
+}
+
+// Take a bike out of service. Bikes in use or reserved are left as they are
+func pullBike(bikeID primitive.ObjectID) {
+	if _, err := bike.StartMaintenance(bikeID); err != nil && !errors.Is(err, bike.ErrBikeUnavailable) {
+		logger.Error("pullBike - Error al pasar la bicicleta a mantenimiento", map[string]interface{}{
+			"bike_id": bikeID.Hex(),
+			"error":   err.Error(),
+		})
+	}
+}
+
+func applyRule(rule *Rule, req RuleRequest, now time.Time) {
+	rule.Name = strings.TrimSpace(req.Name)
+	rule.UsageMinutes = req.UsageMinutes
+	rule.Rides = req.Rides
+	rule.Days = req.Days
+	rule.Active = req.Active == nil || *req.Active
+	rule.UpdatedAt = now
+}
+
+func validateRule(rule Rule) error {
+	if rule.Name == "" || rule.UsageMinutes < 0 || rule.Rides < 0 || rule.Days < 0 {
+		return ErrInvalidRule
+	}
+	if rule.UsageMinutes == 0 && rule.Rides == 0 && rule.Days == 0 {
+		return ErrInvalidRule
+	}
+	return nil
+}
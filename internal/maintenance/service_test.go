@@ -0,0 +1,222 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fresh stores; returns the bike store so tests can add bikes with any usage
+func setupStores(t *testing.T) *bike.MemoryStore {
+	t.Helper()
+	bikes := bike.NewMemoryStore()
+	bike.SetStore(bikes)
+	SetRuleStore(NewMemoryRuleStore())
+	SetWorkOrderStore(NewMemoryWorkOrderStore())
+	return bikes
+}
+
+func addBike(t *testing.T, bikes *bike.MemoryStore, bicycle bike.Bike) primitive.ObjectID {
+	t.Helper()
+	bicycle.ID = primitive.NewObjectID()
+	if bicycle.Status == 0 {
+		bicycle.Status = bike.StatusFree
+	}
+	if bicycle.BatteryLevel == 0 {
+		bicycle.BatteryLevel = 100
+	}
+	if err := bikes.Insert(context.Background(), bicycle); err != nil {
+		t.Fatal(err)
+	}
+	return bicycle.ID
+}
+
+func bikeStatus(t *testing.T, bikeID primitive.ObjectID) int {
+	t.Helper()
+	bicycle, err := bike.GetBikeByID(bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bicycle.Status
+}
+
+func TestCreateRule(t *testing.T) {
+	inactive := false
+
+	tests := []struct {
+		name    string
+		req     RuleRequest
+		wantErr bool
+	}{
+		{name: "usage", req: RuleRequest{Name: "Revisión", UsageMinutes: 600}},
+		{name: "several intervals", req: RuleRequest{Name: "Revisión", Rides: 50, Days: 30, Active: &inactive}},
+		{name: "without name", req: RuleRequest{Name: "  ", Days: 30}, wantErr: true},
+		{name: "without interval", req: RuleRequest{Name: "Revisión"}, wantErr: true},
+		{name: "negative interval", req: RuleRequest{Name: "Revisión", Days: 30, Rides: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupStores(t)
+			rule, err := CreateRule(tt.req)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Errorf("CreateRule() = %v, want ErrInvalidRule", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.Active != (tt.req.Active == nil) {
+				t.Errorf("active = %v", rule.Active)
+			}
+		})
+	}
+}
+
+func TestCheckDueBikes(t *testing.T) {
+	longAgo := time.Now().AddDate(0, 0, -40)
+
+	tests := []struct {
+		name       string
+		rule       RuleRequest
+		bike       bike.Bike
+		wantOpened int
+		wantStatus int
+	}{
+		{name: "usage reached", rule: RuleRequest{Name: "Uso", UsageMinutes: 600}, bike: bike.Bike{TotalUsageMinutes: 700}, wantOpened: 1, wantStatus: bike.StatusMaintenance},
+		{name: "usage since the last service", rule: RuleRequest{Name: "Uso", UsageMinutes: 600}, bike: bike.Bike{TotalUsageMinutes: 700, UsageAtMaintenance: 200}, wantStatus: bike.StatusFree},
+		{name: "rides reached", rule: RuleRequest{Name: "Viajes", Rides: 50}, bike: bike.Bike{RideCount: 51}, wantOpened: 1, wantStatus: bike.StatusMaintenance},
+		{name: "days in operation", rule: RuleRequest{Name: "Mensual", Days: 30}, bike: bike.Bike{OperationalSince: longAgo}, wantOpened: 1, wantStatus: bike.StatusMaintenance},
+		{name: "days since the last service", rule: RuleRequest{Name: "Mensual", Days: 30}, bike: bike.Bike{OperationalSince: longAgo, LastMaintenance: time.Now()}, wantStatus: bike.StatusFree},
+		{name: "inactive rule", rule: RuleRequest{Name: "Uso", UsageMinutes: 600, Active: new(bool)}, bike: bike.Bike{TotalUsageMinutes: 700}, wantStatus: bike.StatusFree},
+		{name: "bike in use", rule: RuleRequest{Name: "Uso", UsageMinutes: 600}, bike: bike.Bike{Status: bike.StatusInUse, TotalUsageMinutes: 700}, wantOpened: 1, wantStatus: bike.StatusInUse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bikes := setupStores(t)
+			bikeID := addBike(t, bikes, tt.bike)
+			if _, err := CreateRule(tt.rule); err != nil {
+				t.Fatal(err)
+			}
+
+			opened, err := CheckDueBikes()
+			if err != nil || opened != tt.wantOpened {
+				t.Fatalf("CheckDueBikes() = %d, %v; want %d", opened, err, tt.wantOpened)
+			}
+			if status := bikeStatus(t, bikeID); status != tt.wantStatus {
+				t.Errorf("bike status = %d, want %d", status, tt.wantStatus)
+			}
+
+			// Una regla abre una sola orden por bicicleta
+			if opened, err := CheckDueBikes(); err != nil || opened != 0 {
+				t.Errorf("second CheckDueBikes() = %d, %v; want 0", opened, err)
+			}
+		})
+	}
+}
+
+func TestCheckDueBikesPullsFreedBike(t *testing.T) {
+	bikes := setupStores(t)
+	bikeID := addBike(t, bikes, bike.Bike{Status: bike.StatusInUse})
+	if _, err := OpenWorkOrder(bikeID, SourceManual, "freno suelto", nil); err != nil {
+		t.Fatal(err)
+	}
+	if status := bikeStatus(t, bikeID); status != bike.StatusInUse {
+		t.Fatalf("bike in use status = %d", status)
+	}
+
+	// El viaje termina y la bicicleta queda libre con la orden abierta
+	bicycle, _ := bike.GetBikeByID(bikeID)
+	bicycle.Status = bike.StatusFree
+	if err := bikes.UpdateIfVersion(context.Background(), bicycle); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CheckDueBikes(); err != nil {
+		t.Fatal(err)
+	}
+	if status := bikeStatus(t, bikeID); status != bike.StatusMaintenance {
+		t.Errorf("bike status = %d, want maintenance", status)
+	}
+}
+
+func TestWorkOrderLifecycle(t *testing.T) {
+	bikes := setupStores(t)
+	bikeID := addBike(t, bikes, bike.Bike{TotalUsageMinutes: 700, RideCount: 40})
+	if _, err := CreateRule(RuleRequest{Name: "Mensual", Days: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CreateWorkOrder(WorkOrderRequest{BikeID: bikeID.Hex()}, primitive.NewObjectID()); !errors.Is(err, ErrReasonRequired) {
+		t.Errorf("CreateWorkOrder(no reason) = %v, want ErrReasonRequired", err)
+	}
+	order, err := CreateWorkOrder(WorkOrderRequest{BikeID: bikeID.Hex(), Reason: "cadena"}, primitive.NewObjectID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != StatusOpen || bikeStatus(t, bikeID) != bike.StatusMaintenance {
+		t.Fatalf("order = %+v, bike status = %d", order, bikeStatus(t, bikeID))
+	}
+
+	if _, err := CompleteWorkOrder(order.ID.Hex(), CompleteWorkOrderRequest{}); !errors.Is(err, ErrTechnicianNeeded) {
+		t.Errorf("CompleteWorkOrder(unassigned) = %v, want ErrTechnicianNeeded", err)
+	}
+	technician := "Rosa"
+	if order, err = UpdateWorkOrder(order.ID.Hex(), UpdateWorkOrderRequest{Technician: &technician}); err != nil || order.Status != StatusAssigned {
+		t.Fatalf("UpdateWorkOrder() = %+v, %v", order, err)
+	}
+
+	completed, err := CompleteWorkOrder(order.ID.Hex(), CompleteWorkOrderRequest{PartsNotes: "cadena nueva"})
+	if err != nil || completed.Status != StatusCompleted || completed.CompletedAt == nil {
+		t.Fatalf("CompleteWorkOrder() = %+v, %v", completed, err)
+	}
+
+	// El servicio queda registrado y la bicicleta vuelve a operar
+	bicycle, _ := bike.GetBikeByID(bikeID)
+	if bicycle.Status != bike.StatusFree || bicycle.UsageAtMaintenance != 700 || bicycle.RidesAtMaintenance != 40 {
+		t.Errorf("bike after the service = %+v", bicycle)
+	}
+	if days := bicycle.NextMaintenance.Sub(bicycle.LastMaintenance).Hours() / 24; days < 29.9 || days > 30.1 {
+		t.Errorf("next maintenance in %.1f days, want 30", days)
+	}
+
+	if _, err := CancelWorkOrder(order.ID.Hex()); !errors.Is(err, ErrWorkOrderClosed) {
+		t.Errorf("CancelWorkOrder(completed) = %v, want ErrWorkOrderClosed", err)
+	}
+}
+
+func TestCancelWorkOrder(t *testing.T) {
+	bikes := setupStores(t)
+	bikeID := addBike(t, bikes, bike.Bike{})
+
+	first, err := OpenWorkOrder(bikeID, SourceManual, "freno", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := OpenWorkOrder(bikeID, SourceIssue, "luz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Con otra orden abierta la bicicleta sigue fuera de servicio
+	if _, err := CancelWorkOrder(first.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if status := bikeStatus(t, bikeID); status != bike.StatusMaintenance {
+		t.Errorf("bike status with an open order = %d, want maintenance", status)
+	}
+
+	if _, err := CancelWorkOrder(second.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if status := bikeStatus(t, bikeID); status != bike.StatusFree {
+		t.Errorf("bike status without open orders = %d, want free", status)
+	}
+}
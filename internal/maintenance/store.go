@@ -0,0 +1,49 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrRuleNotFound      = errors.New("regla de mantenimiento no encontrada")
+	ErrWorkOrderNotFound = errors.New("orden de trabajo no encontrada")
+	ErrWorkOrderConflict = errors.New("la orden de trabajo cambió de estado, intente nuevamente")
+)
+
+// RuleStore abstracts the persistence of maintenance rules
+type RuleStore interface {
+	Insert(ctx context.Context, rule Rule) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (Rule, error)
+	FindAll(ctx context.Context) ([]Rule, error)
+	Update(ctx context.Context, rule Rule) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+var ruleStore RuleStore
+
+// Inject the store used for maintenance rules
+func SetRuleStore(s RuleStore) {
+	ruleStore = s
+}
+
+// WorkOrderStore abstracts the persistence of work orders
+type WorkOrderStore interface {
+	// Insert fails with ErrWorkOrderConflict if an open order has the same due key
+	Insert(ctx context.Context, order WorkOrder) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (WorkOrder, error)
+	// Find returns the orders matching the filter, newest first
+	Find(ctx context.Context, filter OrderFilter) ([]WorkOrder, error)
+	// UpdateIfStatus replaces the order only while its stored status is still
+	// expected, failing with ErrWorkOrderConflict otherwise
+	UpdateIfStatus(ctx context.Context, order WorkOrder, expected string) error
+}
+
+var orderStore WorkOrderStore
+
+// Inject the store used for work orders
+func SetWorkOrderStore(s WorkOrderStore) {
+	orderStore = s
+}
@@ -0,0 +1,152 @@
+package maintenance
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryRuleStore keeps maintenance rules in memory, for tests and local demos
+type MemoryRuleStore struct {
+	mu    sync.RWMutex
+	rules map[primitive.ObjectID]Rule
+}
+
+func NewMemoryRuleStore() *MemoryRuleStore {
+	return &MemoryRuleStore{rules: make(map[primitive.ObjectID]Rule)}
+}
+
+func (s *MemoryRuleStore) Insert(ctx context.Context, rule Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules[rule.ID] = rule
+	return nil
+}
+
+func (s *MemoryRuleStore) FindByID(ctx context.Context, id primitive.ObjectID) (Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rule, ok := s.rules[id]
+	if !ok {
+		return Rule{}, ErrRuleNotFound
+	}
+	return rule, nil
+}
+
+func (s *MemoryRuleStore) FindAll(ctx context.Context) ([]Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := make([]Rule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].CreatedAt.Before(rules[j].CreatedAt) })
+	return rules, nil
+}
+
+func (s *MemoryRuleStore) Update(ctx context.Context, rule Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[rule.ID]; !ok {
+		return ErrRuleNotFound
+	}
+	s.rules[rule.ID] = rule
+	return nil
+}
+
+func (s *MemoryRuleStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return ErrRuleNotFound
+	}
+	delete(s.rules, id)
+	return nil
+}
+
+// MemoryWorkOrderStore keeps work orders in memory, for tests and local demos
+type MemoryWorkOrderStore struct {
+	mu     sync.RWMutex
+	orders map[primitive.ObjectID]WorkOrder
+}
+
+func NewMemoryWorkOrderStore() *MemoryWorkOrderStore {
+	return &MemoryWorkOrderStore{orders: make(map[primitive.ObjectID]WorkOrder)}
+}
+
+func (s *MemoryWorkOrderStore) Insert(ctx context.Context, order WorkOrder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Igual que el índice único disperso de Mongo
+	if order.DueKey != "" {
+		for _, existing := range s.orders {
+			if existing.DueKey == order.DueKey {
+				return ErrWorkOrderConflict
+			}
+		}
+	}
+
+	s.orders[order.ID] = order
+	return nil
+}
+
+func (s *MemoryWorkOrderStore) FindByID(ctx context.Context, id primitive.ObjectID) (WorkOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	order, ok := s.orders[id]
+	if !ok {
+		return WorkOrder{}, ErrWorkOrderNotFound
+	}
+	return order, nil
+}
+
+func (s *MemoryWorkOrderStore) Find(ctx context.Context, filter OrderFilter) ([]WorkOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := []WorkOrder{}
+	for _, order := range s.orders {
+		if !filter.BikeID.IsZero() && order.BikeID != filter.BikeID {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !contains(filter.Statuses, order.Status) {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	return orders, nil
+}
+
+func (s *MemoryWorkOrderStore) UpdateIfStatus(ctx context.Context, order WorkOrder, expected string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.orders[order.ID]
+	if !ok {
+		return ErrWorkOrderNotFound
+	}
+	if current.Status != expected {
+		return ErrWorkOrderConflict
+	}
+	s.orders[order.ID] = order
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRuleStore persists maintenance rules in a MongoDB collection
+type MongoRuleStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRuleStore(collection *mongo.Collection) *MongoRuleStore {
+	return &MongoRuleStore{collection: collection}
+}
+
+func (s *MongoRuleStore) Insert(ctx context.Context, rule Rule) error {
+	_, err := s.collection.InsertOne(ctx, rule)
+	return err
+}
+
+func (s *MongoRuleStore) FindByID(ctx context.Context, id primitive.ObjectID) (Rule, error) {
+	var rule Rule
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&rule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return rule, ErrRuleNotFound
+	}
+	return rule, err
+}
+
+func (s *MongoRuleStore) FindAll(ctx context.Context) ([]Rule, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rules := []Rule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *MongoRuleStore) Update(ctx context.Context, rule Rule) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": rule.ID}, rule)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+func (s *MongoRuleStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// MongoWorkOrderStore persists work orders in a MongoDB collection
+type MongoWorkOrderStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoWorkOrderStore(collection *mongo.Collection) *MongoWorkOrderStore {
+	return &MongoWorkOrderStore{collection: collection}
+}
+
+func (s *MongoWorkOrderStore) Insert(ctx context.Context, order WorkOrder) error {
+	_, err := s.collection.InsertOne(ctx, order)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrWorkOrderConflict
+	}
+	return err
+}
+
+func (s *MongoWorkOrderStore) FindByID(ctx context.Context, id primitive.ObjectID) (WorkOrder, error) {
+	var order WorkOrder
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return order, ErrWorkOrderNotFound
+	}
+	return order, err
+}
+
+func (s *MongoWorkOrderStore) Find(ctx context.Context, filter OrderFilter) ([]WorkOrder, error) {
+	query := bson.M{}
+	if !filter.BikeID.IsZero() {
+		query["bike_id"] = filter.BikeID
+	}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+
+	cursor, err := s.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	orders := []WorkOrder{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (s *MongoWorkOrderStore) UpdateIfStatus(ctx context.Context, order WorkOrder, expected string) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": order.ID, "status": expected}, order)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if err := s.collection.FindOne(ctx, bson.M{"_id": order.ID}).Err(); errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrWorkOrderNotFound
+		}
+		return ErrWorkOrderConflict
+	}
+	return nil
+}
+
+// Create the indexes that allow a single open order per rule and bike (closed
+// orders drop their due key), plus the ones used to list orders
+func (s *MongoWorkOrderStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "due_key", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "bike_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
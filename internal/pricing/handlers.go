@@ -0,0 +1,83 @@
+package pricing
+
+import (
+	"encoding/json"
+	"net/http"
+
+	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+)
+
+// GET Tariffs
+func HandleGetTariffs(w http.ResponseWriter, r *http.Request) {
+	tariffs, err := GetAllTariffs()
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al obtener tarifas",
+		})
+		logger.Error("GET /pricing/tariffs - Error al consultar tarifas", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, tariffs)
+	logger.Info("GET /pricing/tariffs - Tarifas devueltas", map[string]interface{}{
+		"total_tariffs": len(tariffs),
+	})
+}
+
+// POST New tariff version
+func HandleCreateTariff(w http.ResponseWriter, r *http.Request) {
+	var input Tariff
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Error en el formato del JSON",
+		})
+		logger.Error("POST /pricing/tariffs - JSON inválido", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tariff, err := CreateTariff(input)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /pricing/tariffs - Error al crear tarifa", map[string]interface{}{
+			"tariff_id": input.ID,
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusCreated, tariff)
+	logger.Info("POST /pricing/tariffs - Tarifa creada", map[string]interface{}{
+		"tariff_id": tariff.ID,
+		"version":   tariff.Version,
+	})
+}
+
+// GET Tariff in force
+func HandleGetActiveTariff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	tariff, err := ActiveTariff()
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al obtener la tarifa vigente",
+		})
+		logger.Error("GET /pricing/tariffs/active - Error al consultar tarifa", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, tariff)
+}
@@ -0,0 +1,57 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+)
+
+// Tariff is a versioned pricing plan. A new version of the same plan is a new
+// document: tariffs are never edited once rides reference them
+type Tariff struct {
+	ID              string           `bson:"_id" json:"id"`
+	Name            string           `bson:"name" json:"name"`
+	Version         int              `bson:"version" json:"version"`
+	UnlockFee       money.Money      `bson:"unlock_fee" json:"unlock_fee"`
+	PerMinute       money.Money      `bson:"per_minute" json:"per_minute"`
+	PerKm           money.Money      `bson:"per_km" json:"per_km"`
+	MinimumFare     money.Money      `bson:"minimum_fare" json:"minimum_fare"`
+	MaximumFare     money.Money      `bson:"maximum_fare" json:"maximum_fare"` // 0 = sin tope
+	Timezone        string           `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	TimeMultipliers []TimeMultiplier `bson:"time_multipliers,omitempty" json:"time_multipliers,omitempty"`
+	ZoneMultipliers []ZoneMultiplier `bson:"zone_multipliers,omitempty" json:"zone_multipliers,omitempty"`
+	ValidFrom       time.Time        `bson:"valid_from" json:"valid_from"`
+	Active          bool             `bson:"active" json:"active"`
+}
+
+// TimeMultiplier applies between StartHour (inclusive) and EndHour (exclusive)
+// in the tariff timezone; windows may wrap midnight (22 -> 6)
+type TimeMultiplier struct {
+	StartHour  int     `bson:"start_hour" json:"start_hour"`
+	EndHour    int     `bson:"end_hour" json:"end_hour"`
+	Multiplier float64 `bson:"multiplier" json:"multiplier"`
+}
+
+// ZoneMultiplier applies to trips that start or end inside a geofence zone
+type ZoneMultiplier struct {
+	Zone       string  `bson:"zone" json:"zone"` // ID de la zona de geofence
+	Multiplier float64 `bson:"multiplier" json:"multiplier"`
+}
+
+// Trip describes what is being priced
+type Trip struct {
+	StartedAt      time.Time `json:"started_at"`
+	Minutes        float64   `json:"minutes"`
+	DistanceMeters float64   `json:"distance_meters"`
+	Zones          []string  `json:"zones,omitempty"` // Zonas de geofence donde empieza o termina
+}
+
+// Fare is the breakdown of a priced trip
+type Fare struct {
+	TariffID       string      `bson:"tariff_id" json:"tariff_id"`
+	UnlockFee      money.Money `bson:"unlock_fee" json:"unlock_fee"`
+	TimeCharge     money.Money `bson:"time_charge" json:"time_charge"`
+	DistanceCharge money.Money `bson:"distance_charge" json:"distance_charge"`
+	Multiplier     float64     `bson:"multiplier" json:"multiplier"`
+	Total          money.Money `bson:"total" json:"total"`
+}
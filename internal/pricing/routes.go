@@ -0,0 +1,23 @@
+package pricing
+
+import (
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
+)
+
+func RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/pricing/tariffs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			middleware.Public(http.HandlerFunc(HandleGetTariffs)).ServeHTTP(w, r)
+		case http.MethodPost:
+			middleware.RequirePermission(auth.PermPricingManage, http.HandlerFunc(HandleCreateTariff)).ServeHTTP(w, r)
+		default:
+			http.Error(w, `{"error": "Método no permitido"}`, http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.Handle("/pricing/tariffs/active", middleware.Public(http.HandlerFunc(HandleGetActiveTariff)))
+}
@@ -0,0 +1,193 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+)
+
+// ID of the built-in tariff used when none is configured
+const DefaultTariffID = "default-v1"
+
+// Built-in tariff: the historical 5.00 unlock fee plus 0.50 per minute
+func DefaultTariff() Tariff {
+	return Tariff{
+		ID:          DefaultTariffID,
+		Name:        "default",
+		Version:     1,
+		UnlockFee:   money.FromMinor(500),
+		PerMinute:   money.FromMinor(50),
+		PerKm:       money.FromMinor(0),
+		MinimumFare: money.FromMinor(0),
+		MaximumFare: money.FromMinor(0),
+		Active:      true,
+	}
+}
+
+// Get the tariff currently in force
+func ActiveTariff() (Tariff, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tariff, err := store.FindActive(ctx, time.Now())
+	if errors.Is(err, ErrTariffNotFound) {
+		return DefaultTariff(), nil
+	}
+	return tariff, err
+}
+
+// Get a tariff by ID (the active one if the ID is empty)
+func GetTariff(tariffID string) (Tariff, error) {
+	if tariffID == "" {
+		return ActiveTariff()
+	}
+	if tariffID == DefaultTariffID {
+		return DefaultTariff(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByID(ctx, tariffID)
+}
+
+// Get every stored tariff
+func GetAllTariffs() ([]Tariff, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindAll(ctx)
+}
+
+// Store a new tariff version
+func CreateTariff(tariff Tariff) (Tariff, error) {
+	if err := validateTariff(tariff); err != nil {
+		return tariff, err
+	}
+	if tariff.ValidFrom.IsZero() {
+		tariff.ValidFrom = time.Now()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := store.FindByID(ctx, tariff.ID); err == nil {
+		return tariff, errors.New("ya existe una tarifa con ese ID, cree una nueva versión")
+	}
+
+	if err := store.Insert(ctx, tariff); err != nil {
+		return tariff, err
+	}
+	return tariff, nil
+}
+
+// Price a trip with the given tariff (the active one if the ID is empty). Ride
+// start and ride end both go through here
+func Price(tariffID string, trip Trip) (Fare, error) {
+	tariff, err := GetTariff(tariffID)
+	if err != nil {
+		return Fare{}, err
+	}
+	return Calculate(tariff, trip)
+}
+
+// Calculate the fare of a trip: unlock fee plus time and distance charges,
+// the latter scaled by the time-of-day and zone multipliers, then clamped to
+// the minimum fare and the cap. Fails if the tariff is not in the system currency
+func Calculate(tariff Tariff, trip Trip) (Fare, error) {
+	// Una tarifa guardada con otra moneda no se puede sumar a los saldos
+	if _, err := money.Sum(money.FromMinor(0), tariff.UnlockFee, tariff.PerMinute, tariff.PerKm, tariff.MinimumFare, tariff.MaximumFare); err != nil {
+		return Fare{}, err
+	}
+
+	multiplier := timeMultiplier(tariff, trip.StartedAt) * zoneMultiplier(tariff, trip.Zones)
+
+	fare := Fare{
+		TariffID:       tariff.ID,
+		UnlockFee:      tariff.UnlockFee,
+		TimeCharge:     tariff.PerMinute.Mul(trip.Minutes * multiplier),
+		DistanceCharge: tariff.PerKm.Mul(trip.DistanceMeters / 1000 * multiplier),
+		Multiplier:     multiplier,
+	}
+
+	total := fare.UnlockFee.Add(fare.TimeCharge).Add(fare.DistanceCharge)
+	total = money.Max(total, tariff.MinimumFare)
+	if tariff.MaximumFare.IsPositive() {
+		total = money.Min(total, tariff.MaximumFare)
+	}
+	fare.Total = total
+
+	return fare, nil
+}
+
+func timeMultiplier(tariff Tariff, at time.Time) float64 {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if location, err := time.LoadLocation(tariff.Timezone); err == nil {
+		at = at.In(location)
+	}
+
+	hour := at.Hour()
+	for _, window := range tariff.TimeMultipliers {
+		inWindow := hour >= window.StartHour && hour < window.EndHour
+		if window.StartHour > window.EndHour {
+			// Ventana que cruza la medianoche
+			inWindow = hour >= window.StartHour || hour < window.EndHour
+		}
+		if inWindow {
+			return window.Multiplier
+		}
+	}
+	return 1
+}
+
+// Highest multiplier among the zones of the trip, 1 if none has one
+func zoneMultiplier(tariff Tariff, zones []string) float64 {
+	multiplier, found := 1.0, false
+	for _, z := range tariff.ZoneMultipliers {
+		for _, zone := range zones {
+			if z.Zone == zone && (!found || z.Multiplier > multiplier) {
+				multiplier, found = z.Multiplier, true
+			}
+		}
+	}
+	return multiplier
+}
+
+func validateTariff(tariff Tariff) error {
+	if tariff.ID == "" || tariff.Version <= 0 {
+		return errors.New("la tarifa requiere ID y versión")
+	}
+
+	for _, amount := range []money.Money{tariff.UnlockFee, tariff.PerMinute, tariff.PerKm, tariff.MinimumFare, tariff.MaximumFare} {
+		if amount.IsNegative() {
+			return errors.New("los montos de la tarifa no pueden ser negativos")
+		}
+		if err := amount.SameCurrency(money.FromMinor(0)); err != nil {
+			return errors.New("los montos de la tarifa deben estar en la moneda del sistema: " + err.Error())
+		}
+	}
+
+	if tariff.Timezone != "" {
+		if _, err := time.LoadLocation(tariff.Timezone); err != nil {
+			return errors.New("zona horaria inválida")
+		}
+	}
+
+	for _, window := range tariff.TimeMultipliers {
+		if window.StartHour < 0 || window.StartHour > 23 || window.EndHour < 0 || window.EndHour > 24 || window.Multiplier <= 0 {
+			return errors.New("multiplicador horario inválido")
+		}
+	}
+
+	for _, zone := range tariff.ZoneMultipliers {
+		if zone.Zone == "" || zone.Multiplier <= 0 {
+			return errors.New("multiplicador de zona inválido")
+		}
+	}
+
+	return nil
+}
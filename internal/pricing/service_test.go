@@ -0,0 +1,193 @@
+package pricing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+)
+
+// Tariff of 1.00 to unlock, 0.20 per minute and 0.50 per km, in UTC
+func testTariff() Tariff {
+	return Tariff{
+		ID:          "city-v1",
+		Name:        "city",
+		Version:     1,
+		UnlockFee:   money.FromMinor(100),
+		PerMinute:   money.FromMinor(20),
+		PerKm:       money.FromMinor(50),
+		MinimumFare: money.FromMinor(0),
+		MaximumFare: money.FromMinor(0),
+		Timezone:    "UTC",
+		Active:      true,
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	noon := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2025, 3, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		tariff         func(*Tariff)
+		trip           Trip
+		wantTotal      int64
+		wantMultiplier float64
+	}{
+		{name: "time and distance", trip: Trip{StartedAt: noon, Minutes: 10, DistanceMeters: 2000}, wantTotal: 400, wantMultiplier: 1},
+		{name: "time window", tariff: func(t *Tariff) {
+			t.TimeMultipliers = []TimeMultiplier{{StartHour: 7, EndHour: 10, Multiplier: 3}, {StartHour: 11, EndHour: 14, Multiplier: 1.5}}
+		}, trip: Trip{StartedAt: noon, Minutes: 10}, wantTotal: 400, wantMultiplier: 1.5},
+		{name: "window across midnight", tariff: func(t *Tariff) {
+			t.TimeMultipliers = []TimeMultiplier{{StartHour: 22, EndHour: 6, Multiplier: 2}}
+		}, trip: Trip{StartedAt: night, Minutes: 10}, wantTotal: 500, wantMultiplier: 2},
+		{name: "highest zone", tariff: func(t *Tariff) {
+			t.ZoneMultipliers = []ZoneMultiplier{{Zone: "centro", Multiplier: 1.5}, {Zone: "aeropuerto", Multiplier: 2}}
+		}, trip: Trip{StartedAt: noon, Minutes: 10, Zones: []string{"centro", "aeropuerto", "otra"}}, wantTotal: 500, wantMultiplier: 2},
+		{name: "minimum fare", tariff: func(t *Tariff) { t.MinimumFare = money.FromMinor(250) }, trip: Trip{StartedAt: noon, Minutes: 1}, wantTotal: 250, wantMultiplier: 1},
+		{name: "cap", tariff: func(t *Tariff) { t.MaximumFare = money.FromMinor(1000) }, trip: Trip{StartedAt: noon, Minutes: 120}, wantTotal: 1000, wantMultiplier: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tariff := testTariff()
+			if tt.tariff != nil {
+				tt.tariff(&tariff)
+			}
+
+			fare, err := Calculate(tariff, tt.trip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fare.Total != money.FromMinor(tt.wantTotal) || fare.Multiplier != tt.wantMultiplier || fare.TariffID != tariff.ID {
+				t.Errorf("Calculate() = %+v, want total %d and multiplier %v", fare, tt.wantTotal, tt.wantMultiplier)
+			}
+		})
+	}
+}
+
+func TestCalculateRejectsForeignCurrency(t *testing.T) {
+	// Tarifa guardada antes de cambiar la moneda del sistema
+	tariff := testTariff()
+	tariff.UnlockFee = money.New(100, "EUR")
+	tariff.PerMinute = money.New(20, "EUR")
+	tariff.PerKm = money.New(50, "EUR")
+	tariff.MinimumFare = money.New(0, "EUR")
+	tariff.MaximumFare = money.New(0, "EUR")
+
+	if _, err := Calculate(tariff, Trip{Minutes: 10}); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("Calculate() = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestCreateTariff(t *testing.T) {
+	tests := []struct {
+		name    string
+		tariff  func(*Tariff)
+		wantErr bool
+	}{
+		{name: "valid"},
+		{name: "without version", tariff: func(t *Tariff) { t.Version = 0 }, wantErr: true},
+		{name: "negative amount", tariff: func(t *Tariff) { t.PerKm = money.FromMinor(-1) }, wantErr: true},
+		{name: "other currency", tariff: func(t *Tariff) { t.UnlockFee = money.New(100, "EUR") }, wantErr: true},
+		{name: "unknown timezone", tariff: func(t *Tariff) { t.Timezone = "Mars/Olympus" }, wantErr: true},
+		{name: "bad time window", tariff: func(t *Tariff) { t.TimeMultipliers = []TimeMultiplier{{StartHour: 25, EndHour: 2, Multiplier: 1}} }, wantErr: true},
+		{name: "zone without multiplier", tariff: func(t *Tariff) { t.ZoneMultipliers = []ZoneMultiplier{{Zone: "centro"}} }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStore(NewMemoryStore())
+			tariff := testTariff()
+			if tt.tariff != nil {
+				tt.tariff(&tariff)
+			}
+
+			created, err := CreateTariff(tariff)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTariff() = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && created.ValidFrom.IsZero() {
+				t.Error("ValidFrom was not set")
+			}
+		})
+	}
+}
+
+func TestCreateTariffTwice(t *testing.T) {
+	SetStore(NewMemoryStore())
+	if _, err := CreateTariff(testTariff()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Las tarifas no se editan: un cambio es una versión nueva
+	if _, err := CreateTariff(testTariff()); err == nil {
+		t.Error("CreateTariff() replaced a tariff with the same ID")
+	}
+}
+
+func TestActiveTariff(t *testing.T) {
+	SetStore(NewMemoryStore())
+
+	if tariff, err := ActiveTariff(); err != nil || tariff.ID != DefaultTariffID {
+		t.Fatalf("ActiveTariff() without tariffs = %+v, %v; want the default tariff", tariff, err)
+	}
+
+	v1 := testTariff()
+	v1.ValidFrom = time.Now().Add(-time.Hour)
+	v2 := testTariff()
+	v2.ID, v2.Version = "city-v2", 2
+	v2.ValidFrom = time.Now().Add(-time.Minute)
+	future := testTariff()
+	future.ID, future.Version = "city-v3", 3
+	future.ValidFrom = time.Now().Add(time.Hour)
+	for _, tariff := range []Tariff{v1, v2, future} {
+		if _, err := CreateTariff(tariff); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tariff, err := ActiveTariff(); err != nil || tariff.ID != "city-v2" {
+		t.Errorf("ActiveTariff() = %+v, %v; want city-v2", tariff, err)
+	}
+	if fare, err := Price("city-v1", Trip{Minutes: 5}); err != nil || fare.TariffID != "city-v1" {
+		t.Errorf("Price(city-v1) = %+v, %v", fare, err)
+	}
+}
+
+func TestNewFileStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `[{"id": "file-v1", "version": 1, "unlock_fee": 1, "per_minute": "0.25", "active": true}]`},
+		{name: "invalid tariff", content: `[{"id": "file-v1", "version": 1, "unlock_fee": -1}]`, wantErr: true},
+		{name: "other currency", content: `[{"id": "file-v1", "version": 1, "unlock_fee": {"amount": 1, "currency": "EUR"}}]`, wantErr: true},
+		{name: "not JSON", content: `tarifas`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tarifas.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			fileStore, err := NewFileStore(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFileStore() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			SetStore(fileStore)
+			if tariff, err := GetTariff("file-v1"); err != nil || tariff.PerMinute != money.FromMinor(25) {
+				t.Errorf("GetTariff() = %+v, %v", tariff, err)
+			}
+		})
+	}
+}
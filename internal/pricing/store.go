@@ -0,0 +1,25 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrTariffNotFound = errors.New("tarifa no encontrada")
+
+// TariffStore abstracts the persistence of tariffs
+type TariffStore interface {
+	Insert(ctx context.Context, tariff Tariff) error
+	FindByID(ctx context.Context, id string) (Tariff, error)
+	FindAll(ctx context.Context) ([]Tariff, error)
+	// FindActive returns the highest version of the active tariffs valid at the given time
+	FindActive(ctx context.Context, at time.Time) (Tariff, error)
+}
+
+var store TariffStore
+
+// Inject the store used by the pricing services
+func SetStore(s TariffStore) {
+	store = s
+}
@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps tariffs in memory, for tests, local demos and tariffs
+// loaded from a configuration file
+type MemoryStore struct {
+	mu      sync.RWMutex
+	tariffs map[string]Tariff
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tariffs: make(map[string]Tariff)}
+}
+
+// Load the tariffs of a JSON file (an array of tariffs) into a memory store
+func NewFileStore(path string) (*MemoryStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tariffs []Tariff
+	if err := json.Unmarshal(data, &tariffs); err != nil {
+		return nil, err
+	}
+
+	s := NewMemoryStore()
+	for _, tariff := range tariffs {
+		if err := validateTariff(tariff); err != nil {
+			return nil, fmt.Errorf("tarifa %s: %w", tariff.ID, err)
+		}
+		s.tariffs[tariff.ID] = tariff
+	}
+	return s, nil
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, tariff Tariff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tariffs[tariff.ID] = tariff
+	return nil
+}
+
+func (s *MemoryStore) FindByID(ctx context.Context, id string) (Tariff, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tariff, ok := s.tariffs[id]
+	if !ok {
+		return Tariff{}, ErrTariffNotFound
+	}
+	return tariff, nil
+}
+
+func (s *MemoryStore) FindAll(ctx context.Context) ([]Tariff, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tariffs := make([]Tariff, 0, len(s.tariffs))
+	for _, tariff := range s.tariffs {
+		tariffs = append(tariffs, tariff)
+	}
+	sort.Slice(tariffs, func(i, j int) bool { return newer(tariffs[j], tariffs[i]) })
+	return tariffs, nil
+}
+
+func (s *MemoryStore) FindActive(ctx context.Context, at time.Time) (Tariff, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *Tariff
+	for _, tariff := range s.tariffs {
+		if !tariff.Active || tariff.ValidFrom.After(at) {
+			continue
+		}
+		if found == nil || newer(tariff, *found) {
+			t := tariff
+			found = &t
+		}
+	}
+
+	if found == nil {
+		return Tariff{}, ErrTariffNotFound
+	}
+	return *found, nil
+}
+
+// Whether a supersedes b
+func newer(a, b Tariff) bool {
+	if !a.ValidFrom.Equal(b.ValidFrom) {
+		return a.ValidFrom.After(b.ValidFrom)
+	}
+	return a.Version > b.Version
+}
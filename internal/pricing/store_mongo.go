@@ -0,0 +1,63 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists tariffs in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, tariff Tariff) error {
+	_, err := s.collection.InsertOne(ctx, tariff)
+	return err
+}
+
+func (s *MongoStore) FindByID(ctx context.Context, id string) (Tariff, error) {
+	var tariff Tariff
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tariff)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return tariff, ErrTariffNotFound
+	}
+	return tariff, err
+}
+
+func (s *MongoStore) FindAll(ctx context.Context) ([]Tariff, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "valid_from", Value: 1}, {Key: "version", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tariffs []Tariff
+	if err := cursor.All(ctx, &tariffs); err != nil {
+		return nil, err
+	}
+	return tariffs, nil
+}
+
+func (s *MongoStore) FindActive(ctx context.Context, at time.Time) (Tariff, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "valid_from", Value: -1}, {Key: "version", Value: -1}})
+
+	var tariff Tariff
+	err := s.collection.FindOne(ctx, bson.M{
+		"active":     true,
+		"valid_from": bson.M{"$lte": at},
+	}, opts).Decode(&tariff)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return tariff, ErrTariffNotFound
+	}
+	return tariff, err
+}
@@ -0,0 +1,152 @@
+package reservation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+)
+
+// POST Reserve a free bike
+func HandleReserveBike(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		logger.Error("POST /reservations - Usuario no autenticado", nil)
+		return
+	}
+
+	var req ReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.BikeID == "" {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Datos inválidos (bike_id requerido)",
+		})
+		logger.Error("POST /reservations - JSON inválido", map[string]interface{}{
+			"user_id": userID,
+		})
+		return
+	}
+
+	reservation, err := Reserve(userID, req.BikeID)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrAlreadyReserved), errors.Is(err, bike.ErrBikeUnavailable):
+			status = http.StatusConflict
+		case errors.Is(err, bike.ErrBikeNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, wallet.ErrInsufficientFunds):
+			status = http.StatusPaymentRequired
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /reservations - Error al reservar bicicleta", map[string]interface{}{
+			"user_id": userID,
+			"bike_id": req.BikeID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusCreated, reservation)
+	logger.Info("POST /reservations - Bicicleta reservada", map[string]interface{}{
+		"reservation_id": reservation.ID.Hex(),
+		"user_id":        userID,
+		"bike_id":        req.BikeID,
+		"expires_at":     reservation.ExpiresAt,
+	})
+}
+
+// GET Active reservation of the authenticated user
+func HandleGetActiveReservation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		logger.Error("GET /reservations/active - Usuario no autenticado", nil)
+		return
+	}
+
+	reservation, err := GetActiveReservation(userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrReservationNotFound) {
+			status = http.StatusNotFound
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, reservation)
+}
+
+// POST Cancel the active reservation of the authenticated user
+func HandleCancelReservation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		logger.Error("POST /reservations/cancel - Usuario no autenticado", nil)
+		return
+	}
+
+	reservation, err := Cancel(userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrReservationNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, ErrReservationConflict) {
+			status = http.StatusConflict
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /reservations/cancel - Error al cancelar la reserva", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, reservation)
+	logger.Info("POST /reservations/cancel - Reserva cancelada", map[string]interface{}{
+		"reservation_id": reservation.ID.Hex(),
+		"user_id":        userID,
+	})
+}
@@ -0,0 +1,45 @@
+package reservation
+
+import (
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reservation holds a free bike for a rider until it expires or the rider
+// starts a ride with it. Fee is charged if it expires unused
+type Reservation struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	BikeID    primitive.ObjectID  `bson:"bike_id" json:"bike_id"`
+	Status    string              `bson:"status" json:"status"`
+	Fee       money.Money         `bson:"fee" json:"fee"`
+	RideID    *primitive.ObjectID `bson:"ride_id,omitempty" json:"ride_id,omitempty"`
+	ExpiresAt time.Time           `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+type ReservationRequest struct {
+	BikeID string `json:"bike_id"`
+}
+
+// Reservation states
+const (
+	StatusPending   = "pending" // Reserve aún no retuvo el cargo ni la bicicleta
+	StatusActive    = "active"
+	StatusConverted = "converted" // Se inició un viaje con la bicicleta
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+// Whether the reservation holds its bike, or is about to
+func (r Reservation) open() bool {
+	return r.Status == StatusPending || r.Status == StatusActive
+}
+
+// Wallet hold reference of the reservation fee
+func (r Reservation) holdReference() string {
+	return "reservation:" + r.ID.Hex()
+}
@@ -0,0 +1,15 @@
+package reservation
+
+import (
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/idempotency"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
+)
+
+func RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("/reservations", middleware.RequirePermission(auth.PermRide, idempotency.Middleware(http.HandlerFunc(HandleReserveBike))))
+	mux.Handle("/reservations/active", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(HandleGetActiveReservation)))
+	mux.Handle("/reservations/cancel", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(HandleCancelReservation)))
+}
@@ -0,0 +1,458 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	holdMargin  = time.Hour   // La retención del cargo dura más que la reserva para cobrarlo al vencer
+	orphanGrace = time.Minute // Antigüedad mínima de una bicicleta reservada sin reserva para liberarla
+)
+
+var ErrAlreadyReserved = errors.New("ya tiene una reserva activa")
+
+var (
+	window = 10 * time.Minute
+	fee    money.Money // Cargo si la reserva vence sin usarse, cero para no cobrar
+)
+
+// Set how long a reservation lasts and the fee charged when it expires unused
+func Configure(reservationWindow time.Duration, expiryFee money.Money) {
+	window = reservationWindow
+	fee = expiryFee
+}
+
+// Configure reservations from RESERVATION_MINUTES and RESERVATION_FEE, keeping
+// the defaults for the unset ones
+func ConfigureFromEnv() error {
+	reservationWindow, expiryFee := window, fee
+
+	if value := os.Getenv("RESERVATION_MINUTES"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			return errors.New("RESERVATION_MINUTES debe ser un número de minutos positivo")
+		}
+		reservationWindow = time.Duration(minutes) * time.Minute
+	}
+
+	if value := os.Getenv("RESERVATION_FEE"); value != "" {
+		amount, err := money.Parse(value, money.DefaultCurrency)
+		if err != nil || amount.IsNegative() {
+			return errors.New("RESERVATION_FEE debe ser un monto no negativo")
+		}
+		expiryFee = amount
+	}
+
+	Configure(reservationWindow, expiryFee)
+	return nil
+}
+
+// Reserve a free bike for a rider. When there is a fee, it is held in the
+// wallet of the rider until the reservation is used, cancelled or expires.
+// The reservation is stored as pending first and activated once the fee is
+// held and the bike reserved
+func Reserve(userID, bikeID string) (Reservation, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return Reservation{}, errors.New("ID de usuario inválido")
+	}
+	bikeObjectID, err := primitive.ObjectIDFromHex(bikeID)
+	if err != nil {
+		return Reservation{}, errors.New("ID de bicicleta inválido")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	current, err := store.FindActiveByUser(ctx, userObjectID)
+	if err == nil && !current.expired(now) {
+		return current, ErrAlreadyReserved
+	} else if err == nil {
+		expireReservation(ctx, current)
+	} else if !errors.Is(err, ErrReservationNotFound) {
+		return Reservation{}, err
+	}
+
+	reservation := Reservation{
+		ID:        primitive.NewObjectID(),
+		UserID:    userObjectID,
+		BikeID:    bikeObjectID,
+		Status:    StatusPending,
+		Fee:       fee,
+		ExpiresAt: now.Add(window),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// La reserva pendiente se guarda antes de retener el cargo y la bicicleta,
+	// así lo que deje a medias una caída lo limpia el barrido
+	if err := insertPending(ctx, reservation, now); err != nil {
+		return Reservation{}, err
+	}
+
+	if reservation.Fee.IsPositive() {
+		if _, err := wallet.PlaceHold(userID, reservation.Fee, reservation.holdReference(), window+holdMargin); err != nil {
+			abandon(ctx, reservation, false)
+			return Reservation{}, err
+		}
+	}
+
+	if _, err := bike.ReserveBike(bikeObjectID); err != nil {
+		abandon(ctx, reservation, false)
+		return Reservation{}, err
+	}
+
+	active := reservation
+	active.Status = StatusActive
+	active.UpdatedAt = time.Now()
+	if err := store.UpdateIfStatus(ctx, active, StatusPending); err != nil {
+		abandon(ctx, reservation, true)
+		return Reservation{}, errors.New("error al guardar la reserva: " + err.Error())
+	}
+
+	return active, nil
+}
+
+// Insert a pending reservation. A reservation of the bike that expired before
+// the sweeper processed it must not block the bike
+func insertPending(ctx context.Context, reservation Reservation, now time.Time) error {
+	err := store.Insert(ctx, reservation)
+	if errors.Is(err, ErrReservationConflict) {
+		previous, findErr := store.FindOpenByBike(ctx, reservation.BikeID)
+		switch {
+		case findErr != nil || previous.UserID == reservation.UserID:
+			return ErrAlreadyReserved
+		case !previous.expired(now):
+			return bike.ErrBikeUnavailable
+		}
+
+		expireReservation(ctx, previous)
+		err = store.Insert(ctx, reservation)
+		if errors.Is(err, ErrReservationConflict) {
+			return bike.ErrBikeUnavailable
+		}
+	}
+	if err != nil {
+		return errors.New("error al guardar la reserva: " + err.Error())
+	}
+	return nil
+}
+
+// Cancel a pending reservation, giving back its fee hold and, when Reserve got
+// that far, its bike. Returns false if another process changed it first
+func abandon(ctx context.Context, reservation Reservation, reserved bool) bool {
+	cancelled := reservation
+	cancelled.Status = StatusCancelled
+	cancelled.UpdatedAt = time.Now()
+	if err := store.UpdateIfStatus(ctx, cancelled, StatusPending); err != nil {
+		if !errors.Is(err, ErrReservationConflict) {
+			logger.Error("abandon - Error al cancelar la reserva pendiente", map[string]interface{}{
+				"reservation_id": reservation.ID.Hex(),
+				"error":          err.Error(),
+			})
+		}
+		return false
+	}
+
+	releaseFeeHold(cancelled)
+	if reserved {
+		releaseBike(cancelled)
+	}
+	return true
+}
+
+// Get the active reservation of a rider
+func GetActiveReservation(userID string) (Reservation, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return Reservation{}, errors.New("ID de usuario inválido")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reservation, err := store.FindActiveByUser(ctx, userObjectID)
+	if err == nil && reservation.expired(time.Now()) {
+		return reservation, ErrReservationNotFound
+	}
+	return reservation, err
+}
+
+// Cancel the active reservation of a rider, freeing the bike without charging
+func Cancel(userID string) (Reservation, error) {
+	reservation, err := GetActiveReservation(userID)
+	if err != nil {
+		return reservation, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cancelled := reservation
+	cancelled.Status = StatusCancelled
+	cancelled.UpdatedAt = time.Now()
+	if err := store.UpdateIfStatus(ctx, cancelled, StatusActive); err != nil {
+		return reservation, err
+	}
+
+	releaseFeeHold(cancelled)
+	releaseBike(cancelled)
+	return cancelled, nil
+}
+
+// Whether a rider may start a ride with a reserved bike: the reservation is
+// theirs or has already expired
+func CanClaim(userID, bikeID primitive.ObjectID) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reservation, err := store.FindActiveByBike(ctx, bikeID)
+	if err != nil {
+		return false
+	}
+	return reservation.UserID == userID || reservation.expired(time.Now())
+}
+
+// Convert the reservation of a bike into a ride, claiming the bike for the
+// rider. Returns false when there is no reservation in force, so the bike
+// has to be claimed as a free one
+func Convert(userID, bikeID, rideID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reservation, err := store.FindActiveByBike(ctx, bikeID)
+	if errors.Is(err, ErrReservationNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if reservation.expired(time.Now()) {
+		expireReservation(ctx, reservation)
+		return false, nil
+	}
+	if reservation.UserID != userID {
+		return false, bike.ErrBikeUnavailable
+	}
+
+	converted := reservation
+	converted.Status = StatusConverted
+	converted.RideID = &rideID
+	converted.UpdatedAt = time.Now()
+	if err := store.UpdateIfStatus(ctx, converted, StatusActive); err != nil {
+		return false, bike.ErrBikeUnavailable
+	}
+
+	if _, err := bike.ClaimReservedBike(bikeID, userID, rideID); err != nil {
+		if rollbackErr := store.UpdateIfStatus(ctx, reservation, StatusConverted); rollbackErr != nil {
+			logger.Error("Convert - Error al restaurar la reserva", map[string]interface{}{
+				"reservation_id": reservation.ID.Hex(),
+				"error":          rollbackErr.Error(),
+			})
+		}
+		return false, err
+	}
+
+	releaseFeeHold(converted)
+	return true, nil
+}
+
+// Undo Convert for a ride whose start was rolled back: the reservation is
+// active again and the bike reserved. Returns false when the ride did not
+// come from a reservation
+func Restore(rideID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reservation, err := store.FindByRide(ctx, rideID)
+	if errors.Is(err, ErrReservationNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if reservation.Status == StatusConverted {
+		restored := reservation
+		restored.Status = StatusActive
+		restored.RideID = nil
+		restored.UpdatedAt = time.Now()
+		if err := store.UpdateIfStatus(ctx, restored, StatusConverted); err != nil {
+			return true, err
+		}
+
+		if restored.Fee.IsPositive() {
+			if err := wallet.RestoreHold(restored.holdReference()); err != nil && !errors.Is(err, wallet.ErrHoldNotFound) {
+				return true, err
+			}
+		}
+	}
+
+	// Si la bicicleta ya no está en uso la restauración se completó antes
+	if err := bike.RestoreReservedBike(reservation.BikeID, rideID); err != nil && !errors.Is(err, bike.ErrBikeUnavailable) {
+		return true, err
+	}
+	return true, nil
+}
+
+// Expire the reservations whose window has passed, freeing their bikes and
+// charging the fee
+func ExpireReservations() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	reservations, err := store.FindExpired(ctx, time.Now())
+	if err != nil {
+		return 0, errors.New("error al consultar reservas vencidas: " + err.Error())
+	}
+
+	expired := 0
+	for _, reservation := range reservations {
+		if expireReservation(ctx, reservation) {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// Free the bikes left reserved without a pending or active reservation, as a
+// crash halfway through Reserve or a reservation rollback may leave them.
+// Returns how many were freed
+func ReleaseOrphanBikes() (int, error) {
+	bikes, err := bike.GetReservedBikes()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	released := 0
+	for _, bicycle := range bikes {
+		// Una reserva o un viaje pueden estar moviendo la bicicleta en este momento
+		if time.Since(bicycle.LastUsedAt) < orphanGrace {
+			continue
+		}
+		if _, err := store.FindOpenByBike(ctx, bicycle.ID); !errors.Is(err, ErrReservationNotFound) {
+			continue
+		}
+
+		err := bike.ReleaseReservedBike(bicycle.ID)
+		if err == nil {
+			released++
+		} else if !errors.Is(err, bike.ErrBikeUnavailable) {
+			logger.Error("ReleaseOrphanBikes - Error al liberar la bicicleta", map[string]interface{}{
+				"bike_id": bicycle.ID.Hex(),
+				"error":   err.Error(),
+			})
+		}
+	}
+	return released, nil
+}
+
+// Periodically expire reservations and free orphan reserved bikes in background
+func StartReservationExpiry(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expired, err := ExpireReservations()
+			if err != nil {
+				logger.Error("StartReservationExpiry - Error al vencer reservas", map[string]interface{}{
+					"error": err.Error(),
+				})
+				continue
+			}
+			if expired > 0 {
+				logger.Info("StartReservationExpiry - Reservas vencidas liberadas", map[string]interface{}{
+					"reservations": expired,
+				})
+			}
+
+			released, err := ReleaseOrphanBikes()
+			if err != nil {
+				logger.Error("StartReservationExpiry - Error al liberar bicicletas sin reserva", map[string]interface{}{
+					"error": err.Error(),
+				})
+			} else if released > 0 {
+				logger.Info("StartReservationExpiry - Bicicletas sin reserva liberadas", map[string]interface{}{
+					"bikes": released,
+				})
+			}
+		}
+	}()
+}
+
+func (r Reservation) expired(now time.Time) bool {
+	return !r.ExpiresAt.After(now)
+}
+
+// Mark a reservation expired, free its bike and charge its fee. A pending
+// one was left by a failed Reserve and is cancelled instead, leaving its bike,
+// if reserved, to ReleaseOrphanBikes. Returns false if another process changed
+// it first
+func expireReservation(ctx context.Context, reservation Reservation) bool {
+	if reservation.Status == StatusPending {
+		return abandon(ctx, reservation, false)
+	}
+
+	expired := reservation
+	expired.Status = StatusExpired
+	expired.UpdatedAt = time.Now()
+	if err := store.UpdateIfStatus(ctx, expired, StatusActive); err != nil {
+		if !errors.Is(err, ErrReservationConflict) {
+			logger.Error("expireReservation - Error al vencer la reserva", map[string]interface{}{
+				"reservation_id": reservation.ID.Hex(),
+				"error":          err.Error(),
+			})
+		}
+		return false
+	}
+
+	releaseBike(expired)
+
+	if expired.Fee.IsPositive() {
+		if _, err := wallet.CaptureReservationFee(expired.holdReference(), expired.Fee); err != nil {
+			logger.Error("expireReservation - Error al cobrar el cargo de la reserva", map[string]interface{}{
+				"reservation_id": expired.ID.Hex(),
+				"user_id":        expired.UserID.Hex(),
+				"fee":            expired.Fee.String(),
+				"error":          err.Error(),
+			})
+		}
+	}
+	return true
+}
+
+func releaseBike(reservation Reservation) {
+	if err := bike.ReleaseReservedBike(reservation.BikeID); err != nil {
+		logger.Error("releaseBike - Error al liberar la bicicleta reservada", map[string]interface{}{
+			"reservation_id": reservation.ID.Hex(),
+			"bike_id":        reservation.BikeID.Hex(),
+			"error":          err.Error(),
+		})
+	}
+}
+
+func releaseFeeHold(reservation Reservation) {
+	if !reservation.Fee.IsPositive() {
+		return
+	}
+	if err := wallet.ReleaseHold(reservation.holdReference()); err != nil && !errors.Is(err, wallet.ErrHoldNotFound) {
+		logger.Error("releaseFeeHold - Error al liberar la retención de la reserva", map[string]interface{}{
+			"reservation_id": reservation.ID.Hex(),
+			"error":          err.Error(),
+		})
+	}
+}
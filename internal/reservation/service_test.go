@@ -0,0 +1,390 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Memory stores of the packages a reservation touches
+type fixture struct {
+	bikes        *bike.MemoryStore
+	reservations *MemoryStore
+	bikeID       primitive.ObjectID
+}
+
+// Fresh stores with a free bike and a reservation fee of 500 minor units
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{bikes: bike.NewMemoryStore(), reservations: NewMemoryStore()}
+	bike.SetStore(f.bikes)
+	wallet.SetStore(wallet.NewMemoryStore())
+	SetStore(f.reservations)
+
+	previousWindow, previousFee := window, fee
+	Configure(10*time.Minute, money.FromMinor(500))
+	t.Cleanup(func() { Configure(previousWindow, previousFee) })
+
+	f.bikeID = f.newBike(t)
+	return f
+}
+
+func (f *fixture) newBike(t *testing.T) primitive.ObjectID {
+	t.Helper()
+	bicycle, err := bike.RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bicycle.ID
+}
+
+// A rider whose wallet holds balance minor units
+func (f *fixture) rider(t *testing.T, balance int64) primitive.ObjectID {
+	t.Helper()
+	userID := primitive.NewObjectID()
+	if _, err := wallet.CreateDefaultWallet(userID); err != nil {
+		t.Fatal(err)
+	}
+	if balance > 0 {
+		if _, err := wallet.TopUp(userID, money.FromMinor(balance)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userID
+}
+
+// Change a stored bike as if something else had written it
+func (f *fixture) setBike(t *testing.T, bikeID primitive.ObjectID, change func(*bike.Bike)) {
+	t.Helper()
+	bicycle, err := f.bikes.FindByID(context.Background(), bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(&bicycle)
+	if err := f.bikes.UpdateIfVersion(context.Background(), bicycle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Move a reservation past its expiry
+func (f *fixture) expire(t *testing.T, reservation Reservation) {
+	t.Helper()
+	f.reservations.mu.Lock()
+	defer f.reservations.mu.Unlock()
+
+	stored := f.reservations.reservations[reservation.ID]
+	stored.ExpiresAt = time.Now().Add(-time.Second)
+	f.reservations.reservations[reservation.ID] = stored
+}
+
+func (f *fixture) assertBike(t *testing.T, bikeID primitive.ObjectID, status int) {
+	t.Helper()
+	bicycle, err := f.bikes.FindByID(context.Background(), bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bicycle.Status != status {
+		t.Errorf("bike status = %d, want %d", bicycle.Status, status)
+	}
+}
+
+func assertWallet(t *testing.T, userID primitive.ObjectID, balance, held int64) {
+	t.Helper()
+	w, err := wallet.GetWallet(userID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Balance != money.FromMinor(balance) || w.Held != money.FromMinor(held) {
+		t.Errorf("balance = %s, held = %s; want %d, %d", w.Balance, w.Held, balance, held)
+	}
+}
+
+// Status of every reservation of a rider
+func (f *fixture) statuses(userID primitive.ObjectID) []string {
+	f.reservations.mu.RLock()
+	defer f.reservations.mu.RUnlock()
+
+	var statuses []string
+	for _, reservation := range f.reservations.reservations {
+		if reservation.UserID == userID {
+			statuses = append(statuses, reservation.Status)
+		}
+	}
+	return statuses
+}
+
+func TestReserve(t *testing.T) {
+	f := newFixture(t)
+	userID := f.rider(t, 1000)
+
+	reservation, err := Reserve(userID.Hex(), f.bikeID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != StatusActive || reservation.Fee != money.FromMinor(500) {
+		t.Errorf("reservation = %+v", reservation)
+	}
+	f.assertBike(t, f.bikeID, bike.StatusReserved)
+	assertWallet(t, userID, 1000, 500)
+
+	if active, err := GetActiveReservation(userID.Hex()); err != nil || active.ID != reservation.ID {
+		t.Errorf("GetActiveReservation() = %+v, %v", active, err)
+	}
+}
+
+func TestReserveFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int64
+		prepare func(t *testing.T, f *fixture, userID primitive.ObjectID) primitive.ObjectID // Bicicleta a reservar
+		wantErr error
+	}{
+		{
+			name:    "insufficient funds",
+			balance: 100,
+			prepare: func(t *testing.T, f *fixture, userID primitive.ObjectID) primitive.ObjectID { return f.bikeID },
+			wantErr: wallet.ErrInsufficientFunds,
+		},
+		{
+			name:    "bike in maintenance",
+			balance: 1000,
+			prepare: func(t *testing.T, f *fixture, userID primitive.ObjectID) primitive.ObjectID {
+				f.setBike(t, f.bikeID, func(b *bike.Bike) { b.Status = bike.StatusMaintenance })
+				return f.bikeID
+			},
+			wantErr: bike.ErrBikeUnavailable,
+		},
+		{
+			name:    "low battery",
+			balance: 1000,
+			prepare: func(t *testing.T, f *fixture, userID primitive.ObjectID) primitive.ObjectID {
+				f.setBike(t, f.bikeID, func(b *bike.Bike) { b.BatteryLevel = 1 })
+				return f.bikeID
+			},
+			wantErr: bike.ErrLowBattery,
+		},
+		{
+			name:    "reserved by another rider",
+			balance: 1000,
+			prepare: func(t *testing.T, f *fixture, userID primitive.ObjectID) primitive.ObjectID {
+				if _, err := Reserve(f.rider(t, 1000).Hex(), f.bikeID.Hex()); err != nil {
+					t.Fatal(err)
+				}
+				return f.bikeID
+			},
+			wantErr: bike.ErrBikeUnavailable,
+		},
+		{
+			name:    "rider already has one",
+			balance: 1000,
+			prepare: func(t *testing.T, f *fixture, userID primitive.ObjectID) primitive.ObjectID {
+				if _, err := Reserve(userID.Hex(), f.newBike(t).Hex()); err != nil {
+					t.Fatal(err)
+				}
+				return f.bikeID
+			},
+			wantErr: ErrAlreadyReserved,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			userID := f.rider(t, tt.balance)
+			bikeID := tt.prepare(t, f, userID)
+			before, err := f.bikes.FindByID(context.Background(), bikeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantHeld := int64(len(f.statuses(userID))) * 500
+
+			if _, err := Reserve(userID.Hex(), bikeID.Hex()); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve() = %v, want %v", err, tt.wantErr)
+			}
+
+			// Nada queda retenido ni pendiente por el intento fallido
+			f.assertBike(t, bikeID, before.Status)
+			assertWallet(t, userID, tt.balance, wantHeld)
+			for _, status := range f.statuses(userID) {
+				if status == StatusPending {
+					t.Error("a pending reservation was left behind")
+				}
+			}
+		})
+	}
+}
+
+func TestReserveReplacesExpiredReservation(t *testing.T) {
+	f := newFixture(t)
+	first, second := f.rider(t, 1000), f.rider(t, 1000)
+
+	previous, err := Reserve(first.Hex(), f.bikeID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.expire(t, previous)
+
+	if _, err := Reserve(second.Hex(), f.bikeID.Hex()); err != nil {
+		t.Fatalf("Reserve() = %v", err)
+	}
+	f.assertBike(t, f.bikeID, bike.StatusReserved)
+	assertWallet(t, first, 500, 0)
+	assertWallet(t, second, 1000, 500)
+}
+
+// Fails the activation of pending reservations
+type failingActivationStore struct {
+	*MemoryStore
+}
+
+func (s failingActivationStore) UpdateIfStatus(ctx context.Context, reservation Reservation, expected string) error {
+	if expected == StatusPending && reservation.Status == StatusActive {
+		return errors.New("escritura fallida")
+	}
+	return s.MemoryStore.UpdateIfStatus(ctx, reservation, expected)
+}
+
+func TestReserveActivationFailure(t *testing.T) {
+	f := newFixture(t)
+	SetStore(failingActivationStore{f.reservations})
+	userID := f.rider(t, 1000)
+
+	if _, err := Reserve(userID.Hex(), f.bikeID.Hex()); err == nil {
+		t.Fatal("Reserve() succeeded without activating the reservation")
+	}
+	f.assertBike(t, f.bikeID, bike.StatusFree)
+	assertWallet(t, userID, 1000, 0)
+	if statuses := f.statuses(userID); len(statuses) != 1 || statuses[0] != StatusCancelled {
+		t.Errorf("statuses = %v, want [%s]", statuses, StatusCancelled)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	f := newFixture(t)
+	userID := f.rider(t, 1000)
+	if _, err := Reserve(userID.Hex(), f.bikeID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, err := Cancel(userID.Hex())
+	if err != nil || cancelled.Status != StatusCancelled {
+		t.Fatalf("Cancel() = %+v, %v", cancelled, err)
+	}
+	f.assertBike(t, f.bikeID, bike.StatusFree)
+	assertWallet(t, userID, 1000, 0)
+
+	if _, err := Cancel(userID.Hex()); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("second Cancel() = %v, want ErrReservationNotFound", err)
+	}
+}
+
+func TestConvertAndRestore(t *testing.T) {
+	f := newFixture(t)
+	userID, other := f.rider(t, 1000), f.rider(t, 1000)
+	if _, err := Reserve(userID.Hex(), f.bikeID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	rideID := primitive.NewObjectID()
+
+	if !CanClaim(userID, f.bikeID) || CanClaim(other, f.bikeID) {
+		t.Error("CanClaim() must only let the rider who reserved claim the bike")
+	}
+	if _, err := Convert(other, f.bikeID, rideID); !errors.Is(err, bike.ErrBikeUnavailable) {
+		t.Errorf("Convert(other rider) = %v, want ErrBikeUnavailable", err)
+	}
+
+	converted, err := Convert(userID, f.bikeID, rideID)
+	if err != nil || !converted {
+		t.Fatalf("Convert() = %v, %v", converted, err)
+	}
+	f.assertBike(t, f.bikeID, bike.StatusInUse)
+	assertWallet(t, userID, 1000, 0)
+
+	// Revertir el inicio del viaje devuelve la reserva; repetirlo no cambia nada
+	for i, want := range []bool{true, false} {
+		restored, err := Restore(rideID)
+		if err != nil || restored != want {
+			t.Fatalf("Restore() #%d = %v, %v; want %v", i+1, restored, err, want)
+		}
+		f.assertBike(t, f.bikeID, bike.StatusReserved)
+		assertWallet(t, userID, 1000, 500)
+	}
+	if active, err := GetActiveReservation(userID.Hex()); err != nil || active.RideID != nil {
+		t.Errorf("GetActiveReservation() = %+v, %v", active, err)
+	}
+}
+
+func TestExpireReservations(t *testing.T) {
+	f := newFixture(t)
+	rider, crashed := f.rider(t, 1000), f.rider(t, 1000)
+
+	active, err := Reserve(rider.Hex(), f.bikeID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.expire(t, active)
+
+	// Un Reserve interrumpido tras retener el cargo deja la reserva pendiente
+	pending := Reservation{
+		ID:        primitive.NewObjectID(),
+		UserID:    crashed,
+		BikeID:    f.newBike(t),
+		Status:    StatusPending,
+		Fee:       money.FromMinor(500),
+		ExpiresAt: time.Now().Add(-time.Second),
+	}
+	if err := f.reservations.Insert(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.PlaceHold(crashed.Hex(), pending.Fee, pending.holdReference(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := ExpireReservations()
+	if err != nil || expired != 2 {
+		t.Fatalf("ExpireReservations() = %d, %v; want 2", expired, err)
+	}
+
+	// La vencida cobra el cargo; la pendiente se cancela sin cobrar
+	f.assertBike(t, f.bikeID, bike.StatusFree)
+	assertWallet(t, rider, 500, 0)
+	assertWallet(t, crashed, 1000, 0)
+	if statuses := f.statuses(crashed); len(statuses) != 1 || statuses[0] != StatusCancelled {
+		t.Errorf("pending reservation statuses = %v, want [%s]", statuses, StatusCancelled)
+	}
+
+	if expired, err := ExpireReservations(); err != nil || expired != 0 {
+		t.Errorf("second ExpireReservations() = %d, %v; want 0", expired, err)
+	}
+}
+
+func TestReleaseOrphanBikes(t *testing.T) {
+	f := newFixture(t)
+	old := time.Now().Add(-2 * orphanGrace)
+
+	orphan := f.newBike(t)
+	f.setBike(t, orphan, func(b *bike.Bike) { b.Status, b.LastUsedAt = bike.StatusReserved, old })
+
+	// Recién reservada: una reserva puede estar guardándose
+	recent := f.newBike(t)
+	f.setBike(t, recent, func(b *bike.Bike) { b.Status, b.LastUsedAt = bike.StatusReserved, time.Now() })
+
+	if _, err := Reserve(f.rider(t, 1000).Hex(), f.bikeID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	f.setBike(t, f.bikeID, func(b *bike.Bike) { b.LastUsedAt = old })
+
+	released, err := ReleaseOrphanBikes()
+	if err != nil || released != 1 {
+		t.Fatalf("ReleaseOrphanBikes() = %d, %v; want 1", released, err)
+	}
+	f.assertBike(t, orphan, bike.StatusFree)
+	f.assertBike(t, recent, bike.StatusReserved)
+	f.assertBike(t, f.bikeID, bike.StatusReserved)
+}
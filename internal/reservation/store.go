@@ -0,0 +1,39 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrReservationNotFound = errors.New("reserva no encontrada")
+	ErrReservationConflict = errors.New("la reserva cambió de estado, intente nuevamente")
+)
+
+// ReservationStore abstracts the persistence of bike reservations
+type ReservationStore interface {
+	// Insert fails with ErrReservationConflict while the bike or the rider has
+	// a pending or active reservation
+	Insert(ctx context.Context, reservation Reservation) error
+	FindActiveByBike(ctx context.Context, bikeID primitive.ObjectID) (Reservation, error)
+	FindActiveByUser(ctx context.Context, userID primitive.ObjectID) (Reservation, error)
+	FindByRide(ctx context.Context, rideID primitive.ObjectID) (Reservation, error)
+	// FindOpenByBike returns the pending or active reservation of a bike
+	FindOpenByBike(ctx context.Context, bikeID primitive.ObjectID) (Reservation, error)
+	// FindExpired returns the pending or active reservations whose expiry is
+	// before now
+	FindExpired(ctx context.Context, now time.Time) ([]Reservation, error)
+	// UpdateIfStatus replaces the reservation only while its stored status is
+	// still expected, failing with ErrReservationConflict otherwise
+	UpdateIfStatus(ctx context.Context, reservation Reservation, expected string) error
+}
+
+var store ReservationStore
+
+// Inject the store used by the reservation services
+func SetStore(s ReservationStore) {
+	store = s
+}
@@ -0,0 +1,90 @@
+package reservation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps reservations in memory, for tests and local demos
+type MemoryStore struct {
+	mu           sync.RWMutex
+	reservations map[primitive.ObjectID]Reservation
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{reservations: make(map[primitive.ObjectID]Reservation)}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, reservation Reservation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Igual que los índices únicos parciales de Mongo
+	for _, existing := range s.reservations {
+		if existing.open() && (existing.BikeID == reservation.BikeID || existing.UserID == reservation.UserID) {
+			return ErrReservationConflict
+		}
+	}
+
+	s.reservations[reservation.ID] = reservation
+	return nil
+}
+
+func (s *MemoryStore) FindActiveByBike(ctx context.Context, bikeID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(func(r Reservation) bool { return r.Status == StatusActive && r.BikeID == bikeID })
+}
+
+func (s *MemoryStore) FindActiveByUser(ctx context.Context, userID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(func(r Reservation) bool { return r.Status == StatusActive && r.UserID == userID })
+}
+
+func (s *MemoryStore) FindOpenByBike(ctx context.Context, bikeID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(func(r Reservation) bool { return r.open() && r.BikeID == bikeID })
+}
+
+func (s *MemoryStore) FindByRide(ctx context.Context, rideID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(func(r Reservation) bool { return r.RideID != nil && *r.RideID == rideID })
+}
+
+func (s *MemoryStore) FindExpired(ctx context.Context, now time.Time) ([]Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expired := []Reservation{}
+	for _, reservation := range s.reservations {
+		if reservation.open() && reservation.ExpiresAt.Before(now) {
+			expired = append(expired, reservation)
+		}
+	}
+	return expired, nil
+}
+
+func (s *MemoryStore) UpdateIfStatus(ctx context.Context, reservation Reservation, expected string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.reservations[reservation.ID]
+	if !ok {
+		return ErrReservationNotFound
+	}
+	if current.Status != expected {
+		return ErrReservationConflict
+	}
+	s.reservations[reservation.ID] = reservation
+	return nil
+}
+
+func (s *MemoryStore) findOne(match func(Reservation) bool) (Reservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, reservation := range s.reservations {
+		if match(reservation) {
+			return reservation, nil
+		}
+	}
+	return Reservation{}, ErrReservationNotFound
+}
@@ -0,0 +1,109 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const indexNotFound = 27 // Código de error de MongoDB
+
+// MongoStore persists reservations in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, reservation Reservation) error {
+	_, err := s.collection.InsertOne(ctx, reservation)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrReservationConflict
+	}
+	return err
+}
+
+func (s *MongoStore) FindActiveByBike(ctx context.Context, bikeID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(ctx, bson.M{"bike_id": bikeID, "status": StatusActive})
+}
+
+func (s *MongoStore) FindActiveByUser(ctx context.Context, userID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(ctx, bson.M{"user_id": userID, "status": StatusActive})
+}
+
+func (s *MongoStore) FindOpenByBike(ctx context.Context, bikeID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(ctx, bson.M{"bike_id": bikeID, "status": bson.M{"$in": []string{StatusPending, StatusActive}}})
+}
+
+func (s *MongoStore) FindByRide(ctx context.Context, rideID primitive.ObjectID) (Reservation, error) {
+	return s.findOne(ctx, bson.M{"ride_id": rideID})
+}
+
+func (s *MongoStore) FindExpired(ctx context.Context, now time.Time) ([]Reservation, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"status": bson.M{"$in": []string{StatusPending, StatusActive}}, "expires_at": bson.M{"$lt": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	reservations := []Reservation{}
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+func (s *MongoStore) UpdateIfStatus(ctx context.Context, reservation Reservation, expected string) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": reservation.ID, "status": expected}, reservation)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if err := s.collection.FindOne(ctx, bson.M{"_id": reservation.ID}).Err(); errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrReservationNotFound
+		}
+		return ErrReservationConflict
+	}
+	return nil
+}
+
+// Create the indexes that allow a single pending or active reservation per
+// bike and per rider, plus the ones used by the expiry sweeper and by ride
+// rollbacks
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	open := bson.M{"status": bson.M{"$in": []string{StatusPending, StatusActive}}}
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "bike_id", Value: 1}}, Options: options.Index().SetName("bike_id_open").SetUnique(true).SetPartialFilterExpression(open)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetName("user_id_open").SetUnique(true).SetPartialFilterExpression(open)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "ride_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Los índices únicos anteriores solo cubrían las reservas activas
+	for _, legacy := range []string{"bike_id_1", "user_id_1"} {
+		var commandErr mongo.CommandError
+		if _, err := s.collection.Indexes().DropOne(ctx, legacy); err != nil && !(errors.As(err, &commandErr) && commandErr.Code == indexNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (Reservation, error) {
+	var reservation Reservation
+	err := s.collection.FindOne(ctx, filter).Decode(&reservation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return reservation, ErrReservationNotFound
+	}
+	return reservation, err
+}
@@ -0,0 +1,392 @@
+package ride
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatGPX     = "gpx"
+	FormatGeoJSON = "geojson"
+	FormatKML     = "kml"
+)
+
+var ErrUnsupportedFormat = errors.New("formato de exportación no soportado (gpx, geojson o kml)")
+
+// Content type and file extension by export format
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+	write       func(w io.Writer, rides []rideExport) error
+}{
+	FormatGPX:     {"application/gpx+xml", "gpx", writeGPX},
+	FormatGeoJSON: {"application/geo+json", "geojson", writeGeoJSON},
+	FormatKML:     {"application/vnd.google-earth.kml+xml", "kml", writeKML},
+}
+
+// rideExport is a ride with every timed point of its route: start, track and end
+type rideExport struct {
+	Ride   Ride
+	Points []TrackPoint
+}
+
+// Load the track of each ride and build its exportable route
+func buildExports(rides []Ride) ([]rideExport, error) {
+	exports := make([]rideExport, 0, len(rides))
+	for _, ride := range rides {
+		track, err := getTrack(ride.ID)
+		if err != nil {
+			return nil, errors.New("error al consultar el recorrido: " + err.Error())
+		}
+
+		points := make([]TrackPoint, 0, len(track)+2)
+		if len(ride.StartCoords) == 2 {
+			points = append(points, TrackPoint{Lat: ride.StartCoords[0], Lon: ride.StartCoords[1], Timestamp: ride.CreatedAt})
+		}
+		points = append(points, track...)
+		if len(ride.EndCoords) == 2 {
+			points = append(points, TrackPoint{Lat: ride.EndCoords[0], Lon: ride.EndCoords[1], Timestamp: ride.UpdatedAt})
+		}
+
+		exports = append(exports, rideExport{Ride: ride, Points: points})
+	}
+	return exports, nil
+}
+
+// Write the rides in the given format
+func exportRides(w io.Writer, format string, rides []Ride) error {
+	exporter, ok := exportFormats[format]
+	if !ok {
+		return ErrUnsupportedFormat
+	}
+
+	exports, err := buildExports(rides)
+	if err != nil {
+		return err
+	}
+	return exporter.write(w, exports)
+}
+
+// Properties shared by every format
+func (e rideExport) properties() map[string]interface{} {
+	properties := map[string]interface{}{
+		"ride_id":    e.Ride.ID.Hex(),
+		"bike_id":    e.Ride.BikeID.Hex(),
+		"user_id":    e.Ride.UserID.Hex(),
+		"started_at": e.Ride.CreatedAt.UTC().Format(time.RFC3339),
+		"ongoing":    e.Ride.Status,
+		"final_cost": e.Ride.FinalCost.String(),
+		"currency":   e.Ride.FinalCost.Currency,
+		"distance_m": e.Ride.Distance,
+		"tariff_id":  e.Ride.TariffID,
+	}
+	if !e.Ride.Status {
+		properties["ended_at"] = e.Ride.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	if e.Ride.CancelledAt != nil {
+		properties["cancelled"] = true
+	}
+	if len(e.Ride.StartCoords) == 2 {
+		properties["start_coords"] = e.Ride.StartCoords
+	}
+	if len(e.Ride.EndCoords) == 2 {
+		properties["end_coords"] = e.Ride.EndCoords
+	}
+	return properties
+}
+
+func (e rideExport) name() string {
+	return "Viaje " + e.Ride.ID.Hex()
+}
+
+func (e rideExport) description() string {
+	return fmt.Sprintf("Bicicleta %s, costo %s", e.Ride.BikeID.Hex(), e.Ride.FinalCost.String())
+}
+
+// GPX 1.1
+
+type gpxFile struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsBT  string      `xml:"xmlns:bt,attr"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Wpts     []gpxPoint  `xml:"wpt"`
+	Trks     []gpxTrack  `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name"`
+	Time string `xml:"time"`
+}
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele,omitempty"`
+	Time string   `xml:"time,omitempty"`
+	Name string   `xml:"name,omitempty"`
+}
+
+type gpxTrack struct {
+	Name       string        `xml:"name"`
+	Desc       string        `xml:"desc"`
+	Type       string        `xml:"type"`
+	Extensions gpxExtensions `xml:"extensions"`
+	Segments   []gpxSegment  `xml:"trkseg"`
+}
+
+type gpxExtensions struct {
+	RideID    string  `xml:"bt:ride_id"`
+	BikeID    string  `xml:"bt:bike_id"`
+	FinalCost string  `xml:"bt:final_cost"`
+	Currency  string  `xml:"bt:currency"`
+	Distance  float64 `xml:"bt:distance_meters"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+func writeGPX(w io.Writer, rides []rideExport) error {
+	file := gpxFile{
+		Version:  "1.1",
+		Creator:  "bike-tracker",
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		XmlnsBT:  "https://github.com/clementeaf/bike-tracker",
+		Metadata: gpxMetadata{Name: "Viajes bike-tracker", Time: time.Now().UTC().Format(time.RFC3339)},
+	}
+
+	for _, ride := range rides {
+		if len(ride.Ride.StartCoords) == 2 {
+			file.Wpts = append(file.Wpts, gpxPoint{Lat: ride.Ride.StartCoords[0], Lon: ride.Ride.StartCoords[1], Time: formatTime(ride.Ride.CreatedAt), Name: "Inicio " + ride.Ride.ID.Hex()})
+		}
+		if len(ride.Ride.EndCoords) == 2 {
+			file.Wpts = append(file.Wpts, gpxPoint{Lat: ride.Ride.EndCoords[0], Lon: ride.Ride.EndCoords[1], Time: formatTime(ride.Ride.UpdatedAt), Name: "Fin " + ride.Ride.ID.Hex()})
+		}
+
+		segment := gpxSegment{}
+		for _, point := range ride.Points {
+			trkpt := gpxPoint{Lat: point.Lat, Lon: point.Lon, Time: formatTime(point.Timestamp)}
+			if point.Altitude != 0 {
+				altitude := point.Altitude
+				trkpt.Ele = &altitude
+			}
+			segment.Points = append(segment.Points, trkpt)
+		}
+
+		file.Trks = append(file.Trks, gpxTrack{
+			Name: ride.name(),
+			Desc: ride.description(),
+			Type: "cycling",
+			Extensions: gpxExtensions{
+				RideID:    ride.Ride.ID.Hex(),
+				BikeID:    ride.Ride.BikeID.Hex(),
+				FinalCost: ride.Ride.FinalCost.String(),
+				Currency:  ride.Ride.FinalCost.Currency,
+				Distance:  ride.Ride.Distance,
+			},
+			Segments: []gpxSegment{segment},
+		})
+	}
+
+	return writeXML(w, file)
+}
+
+// GeoJSON (RFC 7946)
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+func writeGeoJSON(w io.Writer, rides []rideExport) error {
+	collection := geoJSONCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	for _, ride := range rides {
+		if len(ride.Points) == 0 {
+			continue
+		}
+
+		// GeoJSON usa [lon, lat]; los tiempos siguen la convención coordTimes.
+		// La altitud solo se incluye si todos los puntos la tienen
+		withAltitude := true
+		for _, point := range ride.Points {
+			withAltitude = withAltitude && point.Altitude != 0
+		}
+
+		coordinates := make([][]float64, 0, len(ride.Points))
+		times := make([]string, 0, len(ride.Points))
+		for _, point := range ride.Points {
+			coordinate := []float64{point.Lon, point.Lat}
+			if withAltitude {
+				coordinate = append(coordinate, point.Altitude)
+			}
+			coordinates = append(coordinates, coordinate)
+			times = append(times, formatTime(point.Timestamp))
+		}
+
+		properties := ride.properties()
+		properties["coordTimes"] = times
+
+		geometry := geoJSONGeometry{Type: "LineString", Coordinates: coordinates}
+		if len(coordinates) == 1 {
+			geometry = geoJSONGeometry{Type: "Point", Coordinates: coordinates[0]}
+		}
+
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geometry,
+			Properties: properties,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(collection)
+}
+
+// KML 2.2 with gx:Track for timed points
+
+type kmlFile struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsGX  string      `xml:"xmlns:gx,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name         string       `xml:"name"`
+	Description  string       `xml:"description,omitempty"`
+	TimeSpan     *kmlTimeSpan `xml:"TimeSpan,omitempty"`
+	ExtendedData *kmlExtended `xml:"ExtendedData,omitempty"`
+	Point        *kmlPoint    `xml:"Point,omitempty"`
+	Track        *kmlTrack    `xml:"gx:Track,omitempty"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end,omitempty"`
+}
+
+type kmlExtended struct {
+	Data []kmlData `xml:"Data"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlTrack struct {
+	When  []string `xml:"when"`
+	Coord []string `xml:"gx:coord"`
+}
+
+func writeKML(w io.Writer, rides []rideExport) error {
+	file := kmlFile{
+		Xmlns:    "http://www.opengis.net/kml/2.2",
+		XmlnsGX:  "http://www.google.com/kml/ext/2.2",
+		Document: kmlDocument{Name: "Viajes bike-tracker"},
+	}
+
+	for _, ride := range rides {
+		span := &kmlTimeSpan{Begin: formatTime(ride.Ride.CreatedAt)}
+		if !ride.Ride.Status {
+			span.End = formatTime(ride.Ride.UpdatedAt)
+		}
+
+		extended := &kmlExtended{}
+		for _, key := range []string{"ride_id", "bike_id", "user_id", "final_cost", "currency", "distance_m", "tariff_id"} {
+			extended.Data = append(extended.Data, kmlData{Name: key, Value: fmt.Sprint(ride.properties()[key])})
+		}
+
+		track := &kmlTrack{}
+		for _, point := range ride.Points {
+			track.When = append(track.When, formatTime(point.Timestamp))
+			track.Coord = append(track.Coord, fmt.Sprintf("%f %f %f", point.Lon, point.Lat, point.Altitude))
+		}
+
+		file.Document.Placemarks = append(file.Document.Placemarks, kmlPlacemark{
+			Name:         ride.name(),
+			Description:  ride.description(),
+			TimeSpan:     span,
+			ExtendedData: extended,
+			Track:        track,
+		})
+
+		if len(ride.Ride.StartCoords) == 2 {
+			file.Document.Placemarks = append(file.Document.Placemarks, kmlPlacemark{
+				Name:  "Inicio " + ride.Ride.ID.Hex(),
+				Point: &kmlPoint{Coordinates: kmlCoordinates(ride.Ride.StartCoords)},
+			})
+		}
+		if len(ride.Ride.EndCoords) == 2 {
+			file.Document.Placemarks = append(file.Document.Placemarks, kmlPlacemark{
+				Name:  "Fin " + ride.Ride.ID.Hex(),
+				Point: &kmlPoint{Coordinates: kmlCoordinates(ride.Ride.EndCoords)},
+			})
+		}
+	}
+
+	return writeXML(w, file)
+}
+
+// KML coordinates are lon,lat
+func kmlCoordinates(coords []float64) string {
+	return fmt.Sprintf("%f,%f", coords[1], coords[0])
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func writeXML(w io.Writer, document interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Normalize the requested format, geojson by default
+func exportFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" || format == "json" {
+		return FormatGeoJSON
+	}
+	return format
+}
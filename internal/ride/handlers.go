@@ -1,19 +1,23 @@
 package ride
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/command"
+	"github.com/clementeaf/bike-tracker/internal/geofence"
+	"github.com/clementeaf/bike-tracker/internal/user"
 	"github.com/clementeaf/bike-tracker/internal/wallet"
 	"github.com/clementeaf/bike-tracker/pkg/auth"
-	"github.com/clementeaf/bike-tracker/pkg/database"
 	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
 	"github.com/clementeaf/bike-tracker/pkg/logger"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -51,16 +55,6 @@ func handleStartRide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bikeObject, err := validateBike(rideRequest.BikeID)
-	if err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
-		logger.Error("handleStartRide - Bicicleta no válida", map[string]interface{}{
-			"bike_id": rideRequest.BikeID,
-			"error":   err.Error(),
-		})
-		return
-	}
-
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "ID de usuario no válido"})
@@ -71,41 +65,61 @@ func handleStartRide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := wallet.DeductRideFee(userObjectID.Hex()); err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusPaymentRequired, map[string]string{"error": "Saldo insuficiente en la wallet"})
-		logger.Error("handleStartRide - Wallet insuficiente", map[string]interface{}{
+	if err := user.RequireVerifiedEmail(userObjectID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, user.ErrEmailNotVerified) {
+			status = http.StatusForbidden
+		}
+		httpresponse.SendJSONResponse(w, status, map[string]string{"error": err.Error()})
+		logger.Error("handleStartRide - Email sin verificar", map[string]interface{}{
 			"user_id": userID,
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	if err := bike.UpdateBikeStatus(bikeObject.ID.Hex(), userID, bike.StatusInUse); err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error al actualizar el estado de la bicicleta"})
-		logger.Error("handleStartRide - Error al actualizar estado de la bicicleta", map[string]interface{}{
-			"bike_id": bikeObject.ID.Hex(),
-			"user_id": userID,
-			"status":  bike.StatusInUse,
+	bikeObject, err := validateBike(rideRequest.BikeID, userObjectID)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		logger.Error("handleStartRide - Bicicleta no válida", map[string]interface{}{
+			"bike_id": rideRequest.BikeID,
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	ride := Ride{
-		ID:          primitive.NewObjectID(),
-		UserID:      userObjectID,
-		BikeID:      bikeObject.ID,
-		StartCoords: rideRequest.StartCoords,
-		Status:      true,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	if err := insertRide(ride); err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error al iniciar el viaje"})
-		logger.Error("handleStartRide - Error al crear ride", map[string]interface{}{
-			"ride":  ride,
-			"error": err.Error(),
+	ride, err := startRide(userObjectID, bikeObject.ID, rideRequest.StartCoords)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Error al iniciar el viaje"
+		var sagaErr *SagaError
+		if errors.As(err, &sagaErr) {
+			switch sagaErr.Step {
+			case StepHoldFunds:
+				message = "Error al reservar saldo en la wallet"
+				if errors.Is(err, wallet.ErrInsufficientFunds) {
+					status, message = http.StatusPaymentRequired, "Saldo insuficiente en la wallet"
+				}
+			case StepClaimBike:
+				message = "Error al actualizar el estado de la bicicleta"
+				if errors.Is(err, bike.ErrBikeUnavailable) {
+					status, message = http.StatusConflict, bike.ErrBikeUnavailable.Error()
+				}
+			case StepUnlockBike:
+				message = "Error al desbloquear la bicicleta"
+				switch {
+				case errors.Is(err, command.ErrAckTimeout):
+					status, message = http.StatusGatewayTimeout, "La bicicleta no confirmó el desbloqueo"
+				case errors.Is(err, command.ErrCommandRejected):
+					status, message = http.StatusBadGateway, "La bicicleta no pudo desbloquearse"
+				}
+			}
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{"error": message})
+		logger.Error("handleStartRide - Error al iniciar el viaje, pasos revertidos", map[string]interface{}{
+			"bike_id": bikeObject.ID.Hex(),
+			"user_id": userID,
+			"error":   err.Error(),
 		})
 		return
 	}
@@ -152,6 +166,17 @@ func handleEndRide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(req.EndCoords) != 2 {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Faltan datos requeridos (Coordenadas)",
+		})
+		logger.Error("handleEndRide - Coordenadas faltantes", map[string]interface{}{
+			"ride_id":    req.RideID,
+			"end_coords": req.EndCoords,
+		})
+		return
+	}
+
 	rideID, err := primitive.ObjectIDFromHex(req.RideID)
 	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
@@ -164,8 +189,8 @@ func handleEndRide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ride Ride
-	if err := database.GetCollection("rides").FindOne(context.Background(), bson.M{"_id": rideID}).Decode(&ride); err != nil {
+	ride, err := store.FindByID(context.Background(), rideID)
+	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
 			"error": "Viaje no encontrado",
 		})
@@ -188,11 +213,18 @@ func handleEndRide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	duration := time.Since(ride.CreatedAt).Minutes()
-	finalCost := calculateCost(duration)
+	if !ride.Status {
+		httpresponse.SendJSONResponse(w, http.StatusConflict, map[string]string{
+			"error": ErrRideClosed.Error(),
+		})
+		logger.Error("handleEndRide - El viaje ya fue finalizado", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+		})
+		return
+	}
 
-	var bike bike.Bike
-	if err := database.GetCollection("bikes").FindOne(context.Background(), bson.M{"_id": ride.BikeID}).Decode(&bike); err != nil {
+	bicycle, err := bike.GetBikeByID(ride.BikeID)
+	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
 			"error": "Bicicleta no encontrada",
 		})
@@ -203,60 +235,179 @@ func handleEndRide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	batteryConsumptionPerMinute := 2.0
-	totalBatteryConsumed := batteryConsumptionPerMinute * duration
-	batteryLeft := bike.BatteryLevel - totalBatteryConsumed
-	if batteryLeft < 0 {
-		batteryLeft = 0
+	// La posición informada por el candado manda sobre la que envía la app,
+	// que solo se usa si el candado no reportó una hace poco
+	endCoords := req.EndCoords
+	if coords, ok := bicycle.DevicePosition(ride.CreatedAt, devicePositionMaxAge); ok {
+		endCoords = coords
 	}
 
-	updateRide := bson.M{
-		"$set": bson.M{
-			"end_coords":   req.EndCoords,
-			"status":       false,
-			"updated_at":   time.Now(),
-			"final_cost":   finalCost,
-			"battery_left": batteryLeft,
-		},
+	// Comprobar que la bicicleta se deja dentro de una zona permitida
+	parking, err := geofence.CheckParking(endCoords[0], endCoords[1])
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "No se pudo comprobar la zona de estacionamiento",
+		})
+		logger.Error("handleEndRide - Error al comprobar zonas", map[string]interface{}{
+			"ride_id":    ride.ID.Hex(),
+			"end_coords": endCoords,
+			"error":      err.Error(),
+		})
+		return
+	}
+	if !parking.Allowed {
+		httpresponse.SendJSONResponse(w, http.StatusConflict, map[string]interface{}{
+			"error": parking.Reason,
+			"zones": parking.Zones,
+		})
+		logger.Error("handleEndRide - Estacionamiento no permitido", map[string]interface{}{
+			"ride_id":    ride.ID.Hex(),
+			"end_coords": endCoords,
+			"reason":     parking.Reason,
+		})
+		return
 	}
 
-	if _, err := database.GetCollection("rides").UpdateOne(context.Background(), bson.M{"_id": rideID}, updateRide); err != nil {
+	duration := time.Since(ride.CreatedAt).Minutes()
+	distance := rideDistance(ride, endCoords)
+	fare, err := calculateFare(ride, endCoords, distance, time.Now())
+	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
-			"error": "No se pudo actualizar el viaje",
+			"error": "Error al calcular la tarifa del viaje",
 		})
-		logger.Error("handleEndRide - Error al actualizar viaje", map[string]interface{}{
-			"ride_id": ride.ID.Hex(),
-			"error":   err.Error(),
+		logger.Error("handleEndRide - Error al calcular la tarifa", map[string]interface{}{
+			"ride_id":   ride.ID.Hex(),
+			"tariff_id": ride.TariffID,
+			"error":     err.Error(),
 		})
 		return
 	}
+	finalCost := fare.Total.Add(parking.Surcharge)
+	ride.ParkingSurcharge = parking.Surcharge
 
-	updateBike := bson.M{
-		"$set": bson.M{
-			"status":        1,
-			"battery_level": batteryLeft,
-			"latitude":      req.EndCoords[0],
-			"longitude":     req.EndCoords[1],
-			"last_used_at":  time.Now(),
-		},
-	}
+	batteryLeft := endBattery(bicycle, ride, req.Battery, duration)
 
-	if _, err := database.GetCollection("bikes").UpdateOne(context.Background(), bson.M{"_id": ride.BikeID}, updateBike); err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
-			"error": "No se pudo actualizar la bicicleta",
-		})
-		logger.Error("handleEndRide - Error al actualizar bicicleta", map[string]interface{}{
+	endedRide, transaction, err := endRide(ride, endCoords, finalCost, distance, batteryLeft)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "No se pudo actualizar el viaje"
+		var sagaErr *SagaError
+		if errors.As(err, &sagaErr) {
+			switch sagaErr.Step {
+			case StepCloseRide:
+				if errors.Is(err, ErrRideClosed) {
+					status, message = http.StatusConflict, ErrRideClosed.Error()
+				}
+			case StepReleaseBike:
+				message = "No se pudo actualizar la bicicleta"
+			case StepSettleFare:
+				message = "No se pudo cobrar el viaje"
+			}
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": message,
+		})
+		logger.Error("handleEndRide - Error al finalizar el viaje, pasos revertidos", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
 			"bike_id": ride.BikeID.Hex(),
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]string{
-		"status": "finalizado",
+	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"status":            "finalizado",
+		"final_cost":        endedRide.FinalCost,
+		"parking_surcharge": endedRide.ParkingSurcharge,
+		"transaction":       transaction,
 	})
 
 	logger.Info("handleEndRide - Viaje finalizado con éxito", map[string]interface{}{
+		"ride_id":    ride.ID.Hex(),
+		"bike_id":    ride.BikeID.Hex(),
+		"final_cost": endedRide.FinalCost.String(),
+	})
+}
+
+// POST Cancel a ride shortly after starting it, without charging
+func handleCancelRide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		logger.Error("handleCancelRide - Usuario no autenticado", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var req CancelRideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Datos inválidos",
+		})
+		logger.Error("handleCancelRide - JSON inválido", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ride, err := getRideByID(req.RideID)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Viaje no encontrado",
+		})
+		logger.Error("handleCancelRide - Viaje no encontrado", map[string]interface{}{
+			"ride_id": req.RideID,
+		})
+		return
+	}
+
+	if ride.UserID.Hex() != userID {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado para cancelar este viaje",
+		})
+		logger.Error("handleCancelRide - Usuario no autorizado para cancelar el viaje", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+			"user_id": userID,
+		})
+		return
+	}
+
+	if !ride.Status {
+		httpresponse.SendJSONResponse(w, http.StatusConflict, map[string]string{
+			"error": ErrRideClosed.Error(),
+		})
+		return
+	}
+
+	cancelled, err := cancelRide(ride)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrCancelWindowExpired) || errors.Is(err, ErrRideClosed) {
+			status = http.StatusConflict
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("handleCancelRide - Error al cancelar el viaje", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, cancelled)
+	logger.Info("handleCancelRide - Viaje cancelado", map[string]interface{}{
 		"ride_id": ride.ID.Hex(),
 		"bike_id": ride.BikeID.Hex(),
 	})
@@ -288,8 +439,10 @@ func handleGetAllRides(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GET ride by ID.
+// GET ride by ID, or one of its sub-resources (/rides/{id}/summary, and
+// /rides/{id}/export as GPX, GeoJSON or KML). Riders only see their own rides
 func handleGetRideByID(w http.ResponseWriter, r *http.Request) {
+	rideID, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/rides/"), "/")
 	if r.Method != http.MethodGet {
 		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
 			"error": "Método no permitido",
@@ -297,7 +450,13 @@ func handleGetRideByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rideID := strings.TrimPrefix(r.URL.Path, "/rides/")
+	if resource != "" && resource != "summary" && resource != "export" {
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Recurso no encontrado",
+		})
+		return
+	}
+
 	if rideID == "" {
 		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
 			"error": "Falta el ID del viaje",
@@ -307,7 +466,11 @@ func handleGetRideByID(w http.ResponseWriter, r *http.Request) {
 
 	ride, err := getRideByID(rideID)
 	if err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrRideNotFound) {
+			status = http.StatusNotFound
+		}
+		httpresponse.SendJSONResponse(w, status, map[string]string{
 			"error": err.Error(),
 		})
 		logger.Error("handleGetRideByID - Error al obtener el ride", map[string]interface{}{
@@ -317,12 +480,212 @@ func handleGetRideByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, _ := auth.GetAuthenticatedUserID(r)
+	if ride.UserID.Hex() != userID && !auth.HasPermission(r, auth.PermRidesRead) {
+		sendForbidden(w, "handleGetRideByID", rideID)
+		return
+	}
+
+	switch resource {
+	case "summary":
+		handleGetRideSummary(w, ride)
+		return
+	case "export":
+		sendExport(w, r, "ride-"+ride.ID.Hex(), []Ride{ride})
+		return
+	}
+
 	httpresponse.SendJSONResponse(w, http.StatusOK, ride)
 	logger.Info("handleGetRideByID - Ride obtenido exitosamente", map[string]interface{}{
 		"ride_id": rideID,
 	})
 }
 
+func sendForbidden(w http.ResponseWriter, route, rideID string) {
+	httpresponse.SendJSONResponse(w, http.StatusForbidden, map[string]string{
+		"error": "Prohibido: permisos insuficientes",
+	})
+	logger.Error(route+" - Acceso denegado al viaje", map[string]interface{}{
+		"ride_id": rideID,
+	})
+}
+
+// POST GPS points of an ongoing ride, in batches
+func handleTrackRide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		logger.Error("handleTrackRide - Usuario no autenticado", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var req TrackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Datos inválidos",
+		})
+		logger.Error("handleTrackRide - JSON inválido", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ride, err := getRideByID(req.RideID)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Viaje no encontrado",
+		})
+		logger.Error("handleTrackRide - Viaje no encontrado", map[string]interface{}{
+			"ride_id": req.RideID,
+		})
+		return
+	}
+
+	if ride.UserID.Hex() != userID {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado para registrar el recorrido de este viaje",
+		})
+		logger.Error("handleTrackRide - Usuario no autorizado", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+			"user_id": userID,
+		})
+		return
+	}
+
+	result, err := ingestTrack(ride, req.Points)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrTrackBatchTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, ErrRideClosed):
+			status = http.StatusConflict
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("handleTrackRide - Error al registrar el recorrido", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusAccepted, result)
+	logger.Info("handleTrackRide - Puntos registrados", map[string]interface{}{
+		"ride_id":  ride.ID.Hex(),
+		"accepted": result.Accepted,
+		"rejected": result.Rejected,
+	})
+}
+
+// GET summary of a ride computed from its track
+func handleGetRideSummary(w http.ResponseWriter, ride Ride) {
+	rideID := ride.ID.Hex()
+	summary, err := summarizeRide(ride)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al calcular el resumen del viaje",
+		})
+		logger.Error("handleGetRideSummary - Error al calcular el resumen", map[string]interface{}{
+			"ride_id": rideID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, summary)
+	logger.Info("handleGetRideSummary - Resumen obtenido exitosamente", map[string]interface{}{
+		"ride_id": rideID,
+		"points":  summary.Points,
+	})
+}
+
+// GET the ride history of the authenticated user as GPX, GeoJSON or KML (?format=)
+func handleExportRideHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		logger.Error("handleExportRideHistory - Usuario no autenticado", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	rides, err := getRidesByUser(userID)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al obtener los viajes",
+		})
+		logger.Error("handleExportRideHistory - Error al consultar viajes", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	sendExport(w, r, "rides-"+userID, rides)
+}
+
+// Write the export as a file download
+func sendExport(w http.ResponseWriter, r *http.Request, filename string, rides []Ride) {
+	format := exportFormat(r.URL.Query().Get("format"))
+
+	var body bytes.Buffer
+	if err := exportRides(&body, format, rides); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrUnsupportedFormat) {
+			status = http.StatusBadRequest
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("sendExport - Error al exportar viajes", map[string]interface{}{
+			"format": format,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	exporter := exportFormats[format]
+	w.Header().Set("Content-Type", exporter.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, exporter.extension))
+	w.WriteHeader(http.StatusOK)
+	if _, err := body.WriteTo(w); err != nil {
+		logger.Error("sendExport - Error al enviar la exportación", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	logger.Info("sendExport - Viajes exportados", map[string]interface{}{
+		"format": format,
+		"rides":  len(rides),
+	})
+}
+
 // GET rides if status = true
 func handleGetActiveRides(w http.ResponseWriter, r *http.Request) {
 	rides, err := getRidesByStatus(true)
@@ -341,3 +704,78 @@ func handleGetActiveRides(w http.ResponseWriter, r *http.Request) {
 		"active_rides_count": len(rides),
 	})
 }
+
+// GET rides ended by the system pending support review
+func handleGetRidesForReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	rides, err := getRidesForReview()
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al obtener viajes por revisar",
+		})
+		logger.Error("handleGetRidesForReview - Error al consultar viajes", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, rides)
+}
+
+// POST Close the review of a ride ended by the system (/rides/{id}/review)
+func handleResolveReview(w http.ResponseWriter, r *http.Request) {
+	rideID := r.PathValue("id")
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	reviewerID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "No autorizado",
+		})
+		return
+	}
+
+	var req ReviewRideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Datos inválidos",
+		})
+		return
+	}
+
+	ride, err := resolveReview(rideID, req.Note)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrRideNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, ErrReviewClosed) {
+			status = http.StatusConflict
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("handleResolveReview - Error al cerrar la revisión", map[string]interface{}{
+			"ride_id": rideID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, ride)
+	logger.Info("handleResolveReview - Revisión cerrada", map[string]interface{}{
+		"ride_id":     rideID,
+		"reviewer_id": reviewerID,
+	})
+}
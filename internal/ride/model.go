@@ -3,29 +3,100 @@ package ride
 import (
 	"time"
 
+	"github.com/clementeaf/bike-tracker/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Ride struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
-	BikeID      primitive.ObjectID `bson:"bike_id" json:"bike_id"`
-	StartCoords []float64          `bson:"start_coords" json:"start_coords"`
-	EndCoords   []float64          `bson:"end_coords,omitempty" json:"end_coords,omitempty"`
-	Status      bool               `bson:"status" json:"status"` // true = on going, false = ended
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
-	FinalCost   float64            `bson:"final_cost,omitempty" json:"final_cost,omitempty"`
-	BatteryLeft float64            `bson:"battery_left,omitempty" json:"battery_left,omitempty"`
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID           primitive.ObjectID `bson:"user_id" json:"user_id"`
+	BikeID           primitive.ObjectID `bson:"bike_id" json:"bike_id"`
+	StartCoords      []float64          `bson:"start_coords" json:"start_coords"`
+	EndCoords        []float64          `bson:"end_coords,omitempty" json:"end_coords,omitempty"`
+	Status           bool               `bson:"status" json:"status"` // true = on going, false = ended
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+	TariffID         string             `bson:"tariff_id,omitempty" json:"tariff_id,omitempty"`
+	UnlockFee        money.Money        `bson:"unlock_fee,omitempty" json:"unlock_fee,omitempty"`
+	HoldAmount       money.Money        `bson:"hold_amount,omitempty" json:"hold_amount,omitempty"`
+	CancelledAt      *time.Time         `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	FinalCost        money.Money        `bson:"final_cost,omitempty" json:"final_cost,omitempty"`
+	Distance         float64            `bson:"distance_meters,omitempty" json:"distance_meters,omitempty"`
+	BatteryLeft      float64            `bson:"battery_left,omitempty" json:"battery_left,omitempty"`
+	ParkingSurcharge money.Money        `bson:"parking_surcharge,omitempty" json:"parking_surcharge,omitempty"`
+	Termination      *RideTermination   `bson:"termination,omitempty" json:"termination,omitempty"`
 }
 
+// RideTermination records a ride ended by the system instead of the rider,
+// pending review by support
+type RideTermination struct {
+	Reason       string      `bson:"reason" json:"reason"`
+	LastSeenAt   time.Time   `bson:"last_seen_at" json:"last_seen_at"` // Último punto GPS o telemetría del candado, o el inicio si no hubo
+	Fare         money.Money `bson:"fare" json:"fare"`                 // Tarifa antes de aplicar el tope
+	FareCapped   bool        `bson:"fare_capped" json:"fare_capped"`
+	ReviewStatus string      `bson:"review_status" json:"review_status"`
+	ReviewNote   string      `bson:"review_note,omitempty" json:"review_note,omitempty"`
+	ReviewedAt   *time.Time  `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+}
+
+// Reasons of a forced termination
+const (
+	TerminationMaxDuration = "max_duration"
+	TerminationNoTelemetry = "no_telemetry"
+)
+
+// Review states of a forced termination
+const (
+	ReviewPending  = "pending"
+	ReviewResolved = "resolved"
+)
+
 type RideRequest struct {
 	BikeID      string    `json:"bike_id"`
 	StartCoords []float64 `json:"start_coords"`
 }
 
+// TrackPoint is a GPS fix of a bike during a ride
+type TrackPoint struct {
+	Lat       float64   `bson:"lat" json:"lat"`
+	Lon       float64   `bson:"lon" json:"lon"`
+	Altitude  float64   `bson:"alt,omitempty" json:"altitude,omitempty"`
+	Accuracy  float64   `bson:"acc,omitempty" json:"accuracy,omitempty"`
+	Timestamp time.Time `bson:"t" json:"timestamp"`
+}
+
+type TrackRequest struct {
+	RideID string       `json:"ride_id"`
+	Points []TrackPoint `json:"points"`
+}
+
+type TrackResult struct {
+	Received int `json:"received"`
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+// RideSummary is computed from the stored track of a ride
+type RideSummary struct {
+	RideID          string  `json:"ride_id"`
+	Points          int     `json:"points"`
+	DistanceMeters  float64 `json:"distance_meters"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	AvgSpeedKmh     float64 `json:"avg_speed_kmh"`
+	MaxSpeedKmh     float64 `json:"max_speed_kmh"`
+	Polyline        string  `json:"polyline"`
+}
+
+type ReviewRideRequest struct {
+	Note string `json:"note"`
+}
+
+type CancelRideRequest struct {
+	RideID string `json:"ride_id"`
+}
+
 type EndRideRequest struct {
 	RideID    string    `json:"ride_id"`
 	EndCoords []float64 `json:"end_coords"`
-	Battery   float64   `json:"battery"`
+	Battery   *float64  `json:"battery,omitempty"`
 }
@@ -1,11 +1,25 @@
 package ride
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/idempotency"
+	"github.com/clementeaf/bike-tracker/pkg/middleware"
+)
 
 func RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/rides/start", handleStartRide)
-	mux.HandleFunc("/rides/end", handleEndRide)
-	mux.HandleFunc("/rides/active", handleGetActiveRides)
-	mux.HandleFunc("/rides", handleGetAllRides)
-	mux.HandleFunc("/rides/", handleGetRideByID)
+	mux.Handle("/rides/start", middleware.RequirePermission(auth.PermRide, idempotency.Middleware(http.HandlerFunc(handleStartRide))))
+	mux.Handle("/rides/end", middleware.RequirePermission(auth.PermRide, idempotency.Middleware(http.HandlerFunc(handleEndRide))))
+	mux.Handle("/rides/cancel", middleware.RequirePermission(auth.PermRide, idempotency.Middleware(http.HandlerFunc(handleCancelRide))))
+	mux.Handle("/rides/track", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(handleTrackRide)))
+	mux.Handle("/rides/export", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(handleExportRideHistory)))
+	mux.Handle("/rides/active", middleware.RequirePermission(auth.PermRidesRead, http.HandlerFunc(handleGetActiveRides)))
+	mux.Handle("/rides/review", middleware.RequirePermission(auth.PermRidesReview, http.HandlerFunc(handleGetRidesForReview)))
+	mux.Handle("/rides", middleware.RequirePermission(auth.PermRidesRead, http.HandlerFunc(handleGetAllRides)))
+
+	mux.Handle("/rides/{id}/review", middleware.RequirePermission(auth.PermRidesReview, http.HandlerFunc(handleResolveReview)))
+
+	// El handler deja ver el viaje a su dueño o a quien tenga rides:read
+	mux.Handle("/rides/", middleware.RequireAnyPermission([]auth.Permission{auth.PermRide, auth.PermRidesRead}, http.HandlerFunc(handleGetRideByID)))
 }
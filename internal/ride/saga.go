@@ -0,0 +1,365 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/command"
+	"github.com/clementeaf/bike-tracker/internal/reservation"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Saga kinds
+const (
+	SagaStartRide  = "start_ride"
+	SagaEndRide    = "end_ride"
+	SagaCancelRide = "cancel_ride"
+)
+
+// Saga states
+const (
+	SagaPending     = "pending"
+	SagaCompleted   = "completed"
+	SagaCompensated = "compensated"
+	SagaFailed      = "failed" // La compensación falló, se reintenta en la recuperación
+)
+
+// Step states
+const (
+	StepStarted     = "started" // Registrado antes de ejecutarse: si queda así, no se sabe si se aplicó
+	StepDone        = "done"
+	StepFailed      = "failed" // Falló sin aplicarse, no se compensa
+	StepCompensated = "compensated"
+)
+
+// Steps of the ride sagas
+const (
+	StepHoldFunds   = "hold_funds"
+	StepReleaseHold = "release_hold"
+	StepClaimBike   = "claim_bike"
+	StepUnlockBike  = "unlock_bike" // Espera la confirmación del candado
+	StepInsertRide  = "insert_ride"
+	StepCloseRide   = "close_ride"
+	StepSettleFare  = "settle_fare"
+	StepReleaseBike = "release_bike"
+)
+
+// Saga records the steps applied while starting or ending a ride, so that a
+// partial failure can be rolled back (or retried after a crash)
+type Saga struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Kind         string             `bson:"kind" json:"kind"`
+	Status       string             `bson:"status" json:"status"`
+	RideID       primitive.ObjectID `bson:"ride_id" json:"ride_id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	BikeID       primitive.ObjectID `bson:"bike_id" json:"bike_id"`
+	Amount       money.Money        `bson:"amount,omitempty" json:"amount,omitempty"`
+	PreviousRide *Ride              `bson:"previous_ride,omitempty" json:"previous_ride,omitempty"`
+	ClosedAt     *time.Time         `bson:"closed_at,omitempty" json:"closed_at,omitempty"` // updated_at que escribió el cierre
+	Steps        []SagaStep         `bson:"steps" json:"steps"`
+	Error        string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type SagaStep struct {
+	Name   string    `bson:"name" json:"name"`
+	Status string    `bson:"status" json:"status"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// SagaError identifies the step that made a saga fail
+type SagaError struct {
+	Step string
+	Err  error
+}
+
+func (e *SagaError) Error() string {
+	return e.Step + ": " + e.Err.Error()
+}
+
+func (e *SagaError) Unwrap() error {
+	return e.Err
+}
+
+// Step reported by a SagaError when the saga log could not be saved
+const stepSave = "save"
+
+type sagaAction struct {
+	name string
+	run  func() error
+}
+
+// Steps each saga kind must complete
+var sagaSteps = map[string][]string{
+	SagaStartRide:  {StepClaimBike, StepHoldFunds, StepUnlockBike, StepInsertRide},
+	SagaEndRide:    {StepCloseRide, StepSettleFare, StepReleaseBike},
+	SagaCancelRide: {StepCloseRide, StepReleaseHold, StepReleaseBike},
+}
+
+// Undo operations by step, rebuilt from the persisted saga. Each one may run
+// more than once, and for a step whose action never ran (a started step left
+// by a crash), so it must leave things as they are when there is nothing to undo
+var compensations = map[string]func(saga Saga) error{
+	StepClaimBike: func(saga Saga) error {
+		// Una bicicleta reservada vuelve a quedar reservada para el usuario
+		restored, err := reservation.Restore(saga.RideID)
+		if err != nil || restored {
+			return err
+		}
+		// Si no está tomada por este viaje no hay nada que liberar
+		err = bike.ReleaseClaimedBike(saga.BikeID, saga.RideID)
+		if errors.Is(err, bike.ErrBikeUnavailable) {
+			return nil
+		}
+		return err
+	},
+	StepHoldFunds: func(saga Saga) error {
+		err := wallet.ReleaseHold(saga.RideID.Hex())
+		if errors.Is(err, wallet.ErrHoldNotFound) {
+			return nil
+		}
+		return err
+	},
+	StepUnlockBike: func(saga Saga) error {
+		return lockBike(saga.BikeID, saga.RideID, command.SourceRollback)
+	},
+	StepInsertRide: func(saga Saga) error {
+		// El viaje insertado se cierra como cancelado
+		ctx := context.Background()
+		ride, err := store.FindByID(ctx, saga.RideID)
+		if errors.Is(err, ErrRideNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !ride.Status {
+			return nil
+		}
+
+		now := time.Now().Truncate(time.Millisecond)
+		ride.Status = false
+		ride.UpdatedAt = now
+		ride.CancelledAt = &now
+		err = store.Close(ctx, ride)
+		if errors.Is(err, ErrRideClosed) {
+			return nil
+		}
+		return err
+	},
+	StepSettleFare: func(saga Saga) error {
+		err := wallet.ReverseCapture(saga.RideID.Hex())
+		if errors.Is(err, wallet.ErrHoldNotFound) {
+			return wallet.ReverseRideFare(saga.UserID.Hex(), saga.RideID.Hex())
+		}
+		return err
+	},
+	StepReleaseHold: func(saga Saga) error {
+		err := wallet.RestoreHold(saga.RideID.Hex())
+		if errors.Is(err, wallet.ErrHoldNotFound) {
+			return nil
+		}
+		return err
+	},
+	StepReleaseBike: func(saga Saga) error {
+		if saga.Kind == SagaCancelRide {
+			return bike.ReclaimBike(saga.BikeID, saga.RideID)
+		}
+
+		var minutes float64
+		if saga.PreviousRide != nil && saga.ClosedAt != nil {
+			minutes = saga.ClosedAt.Sub(saga.PreviousRide.CreatedAt).Minutes()
+		}
+		return bike.UndoFinishTrip(saga.BikeID, saga.RideID, minutes, saga.Amount)
+	},
+	StepCloseRide: func(saga Saga) error {
+		if saga.PreviousRide == nil {
+			return nil
+		}
+
+		var closedAt time.Time
+		if saga.ClosedAt != nil {
+			closedAt = *saga.ClosedAt
+		}
+
+		// Solo se reabre la versión que cerró esta saga; si cambió, o nunca se
+		// cerró, ya no es suya
+		err := store.Reopen(context.Background(), *saga.PreviousRide, closedAt)
+		if errors.Is(err, ErrRideChanged) {
+			logger.Error("compensations - El viaje cambió tras cerrarse, no se reabre", map[string]interface{}{
+				"saga_id": saga.ID.Hex(),
+				"ride_id": saga.RideID.Hex(),
+			})
+			return nil
+		}
+		return err
+	},
+}
+
+// Run the actions in order. Each step is saved as started before it runs and
+// as done after, the last one together with the completion of the saga, so a
+// crash leaves a record of every step that may have been applied. On failure,
+// also when the saga cannot be saved, the applied steps are compensated in
+// reverse order
+func runSaga(saga *Saga, actions []sagaAction) error {
+	ctx := context.Background()
+
+	saga.ID = primitive.NewObjectID()
+	saga.Status = SagaPending
+	saga.Steps = []SagaStep{}
+	saga.CreatedAt = time.Now()
+	saga.UpdatedAt = saga.CreatedAt
+	if err := sagaStore.Insert(ctx, *saga); err != nil {
+		return &SagaError{Step: "init", Err: err}
+	}
+
+	for i, action := range actions {
+		saga.Steps = append(saga.Steps, SagaStep{Name: action.name, Status: StepStarted, At: time.Now()})
+		saga.UpdatedAt = time.Now()
+		if err := sagaStore.Update(ctx, *saga); err != nil {
+			// Sin registro el paso no se ejecuta
+			saga.Steps = saga.Steps[:len(saga.Steps)-1]
+			return failSaga(saga, stepSave, err)
+		}
+
+		step := &saga.Steps[len(saga.Steps)-1]
+		if err := action.run(); err != nil {
+			step.Status = StepFailed
+			return failSaga(saga, action.name, err)
+		}
+
+		step.Status = StepDone
+		step.At = time.Now()
+		if i == len(actions)-1 {
+			saga.Status = SagaCompleted
+		}
+		saga.UpdatedAt = time.Now()
+		if err := sagaStore.Update(ctx, *saga); err != nil {
+			// El paso quedó aplicado pero registrado como iniciado: se compensa igual
+			step.Status = StepStarted
+			saga.Status = SagaPending
+			return failSaga(saga, stepSave, err)
+		}
+	}
+
+	return nil
+}
+
+// Roll back a saga whose step failed, returning the error of the step
+func failSaga(saga *Saga, step string, err error) error {
+	saga.Error = err.Error()
+	if compErr := compensateSaga(saga); compErr != nil {
+		logger.Error("runSaga - Error al compensar saga", map[string]interface{}{
+			"saga_id": saga.ID.Hex(),
+			"kind":    saga.Kind,
+			"step":    step,
+			"error":   compErr.Error(),
+		})
+	}
+	return &SagaError{Step: step, Err: err}
+}
+
+// Undo the steps that were or may have been applied, in reverse order
+func compensateSaga(saga *Saga) error {
+	ctx := context.Background()
+
+	for i := len(saga.Steps) - 1; i >= 0; i-- {
+		step := &saga.Steps[i]
+		if step.Status != StepDone && step.Status != StepStarted {
+			continue
+		}
+
+		if compensate, ok := compensations[step.Name]; ok {
+			if err := compensate(*saga); err != nil {
+				saga.Status = SagaFailed
+				saga.Error = step.Name + ": " + err.Error()
+				saga.UpdatedAt = time.Now()
+				_ = sagaStore.Update(ctx, *saga)
+				return err
+			}
+		}
+
+		step.Status = StepCompensated
+		step.At = time.Now()
+	}
+
+	saga.Status = SagaCompensated
+	saga.UpdatedAt = time.Now()
+	return sagaStore.Update(ctx, *saga)
+}
+
+// Resolve sagas left unfinished by a crash or a failed compensation: sagas
+// that completed every step are marked completed, the rest are rolled back,
+// including the step that was started and may have been applied
+func RecoverSagas(olderThan time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sagas, err := sagaStore.FindUnfinished(ctx, time.Now().Add(-olderThan))
+	if err != nil {
+		return errors.New("error al consultar sagas pendientes: " + err.Error())
+	}
+
+	for i := range sagas {
+		saga := &sagas[i]
+
+		if saga.Status == SagaPending && saga.allStepsDone() {
+			saga.Status = SagaCompleted
+			saga.UpdatedAt = time.Now()
+			err = sagaStore.Update(ctx, *saga)
+		} else {
+			err = compensateSaga(saga)
+		}
+
+		if err != nil {
+			logger.Error("RecoverSagas - Error al recuperar saga", map[string]interface{}{
+				"saga_id": saga.ID.Hex(),
+				"kind":    saga.Kind,
+				"error":   err.Error(),
+			})
+			continue
+		}
+
+		logger.Info("RecoverSagas - Saga recuperada", map[string]interface{}{
+			"saga_id": saga.ID.Hex(),
+			"kind":    saga.Kind,
+			"status":  saga.Status,
+		})
+	}
+
+	return nil
+}
+
+// Periodically recover unfinished sagas in background
+func StartSagaRecovery(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := RecoverSagas(interval); err != nil {
+				logger.Error("StartSagaRecovery - Error en la recuperación de sagas", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+}
+
+// Whether every step of the saga kind is done
+func (s Saga) allStepsDone() bool {
+	if len(s.Steps) != len(sagaSteps[s.Kind]) {
+		return false
+	}
+	for _, step := range s.Steps {
+		if step.Status != StepDone {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,548 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/internal/command"
+	"github.com/clementeaf/bike-tracker/internal/geofence"
+	"github.com/clementeaf/bike-tracker/internal/pricing"
+	"github.com/clementeaf/bike-tracker/internal/reservation"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var santiago = []float64{-33.45, -70.66}
+
+// Memory stores of every package the ride sagas touch
+type sagaFixture struct {
+	bikes  *bike.MemoryStore
+	sagas  *MemorySagaStore
+	userID primitive.ObjectID
+	bikeID primitive.ObjectID
+}
+
+// Fresh stores with a free bike and a rider whose wallet holds balance minor units
+func newSagaFixture(t *testing.T, balance int64) *sagaFixture {
+	t.Helper()
+	f := &sagaFixture{bikes: bike.NewMemoryStore(), sagas: NewMemorySagaStore(), userID: primitive.NewObjectID()}
+
+	bike.SetStore(f.bikes)
+	command.SetStore(command.NewMemoryStore())
+	geofence.SetStore(geofence.NewMemoryStore())
+	pricing.SetStore(pricing.NewMemoryStore())
+	reservation.SetStore(reservation.NewMemoryStore())
+	wallet.SetStore(wallet.NewMemoryStore())
+	SetStore(NewMemoryStore())
+	SetSagaStore(f.sagas)
+	SetTrackStore(NewMemoryTrackStore())
+
+	if _, err := wallet.CreateDefaultWallet(f.userID); err != nil {
+		t.Fatal(err)
+	}
+	if balance > 0 {
+		if _, err := wallet.TopUp(f.userID, money.FromMinor(balance)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bicycle, err := bike.RegisterBike()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.bikeID = bicycle.ID
+	return f
+}
+
+func (f *sagaFixture) start(t *testing.T) Ride {
+	t.Helper()
+	ride, err := startRide(f.userID, f.bikeID, santiago)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ride
+}
+
+// Put the bike in a status the ride cannot leave, so releasing it fails
+func (f *sagaFixture) breakBike(t *testing.T) {
+	t.Helper()
+	bicycle, err := f.bikes.FindByID(context.Background(), f.bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bicycle.Status = bike.StatusMaintenance
+	if err := f.bikes.UpdateIfVersion(context.Background(), bicycle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *sagaFixture) assertWallet(t *testing.T, balance, held money.Money) {
+	t.Helper()
+	w, err := wallet.GetWallet(f.userID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Balance != balance || w.Held != held {
+		t.Errorf("balance = %s, held = %s; want %s, %s", w.Balance, w.Held, balance, held)
+	}
+
+	report, err := wallet.VerifyLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent {
+		t.Errorf("ledger is not consistent: %+v", report)
+	}
+}
+
+func (f *sagaFixture) assertBike(t *testing.T, status int) {
+	t.Helper()
+	bicycle, err := f.bikes.FindByID(context.Background(), f.bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bicycle.Status != status {
+		t.Errorf("bike status = %d, want %d", bicycle.Status, status)
+	}
+}
+
+func (f *sagaFixture) assertRideOpen(t *testing.T, rideID primitive.ObjectID, open bool) {
+	t.Helper()
+	stored, err := store.FindByID(context.Background(), rideID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != open {
+		t.Errorf("ride status = %v, want %v", stored.Status, open)
+	}
+}
+
+// Status of the saga of a kind logged for a ride
+func (f *sagaFixture) sagaStatus(t *testing.T, rideID primitive.ObjectID, kind string) string {
+	t.Helper()
+	f.sagas.mu.RLock()
+	defer f.sagas.mu.RUnlock()
+
+	for _, saga := range f.sagas.sagas {
+		if saga.RideID == rideID && saga.Kind == kind {
+			return saga.Status
+		}
+	}
+	t.Fatalf("no %s saga for ride %s", kind, rideID.Hex())
+	return ""
+}
+
+func TestStartRide(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+
+	if !ride.HoldAmount.IsPositive() {
+		t.Fatalf("HoldAmount = %s", ride.HoldAmount)
+	}
+	f.assertWallet(t, money.FromMinor(100000), ride.HoldAmount)
+	f.assertBike(t, bike.StatusInUse)
+	f.assertRideOpen(t, ride.ID, true)
+	if status := f.sagaStatus(t, ride.ID, SagaStartRide); status != SagaCompleted {
+		t.Errorf("saga status = %s, want %s", status, SagaCompleted)
+	}
+}
+
+func TestStartRideCompensation(t *testing.T) {
+	f := newSagaFixture(t, 1)
+
+	ride, err := startRide(f.userID, f.bikeID, santiago)
+	var sagaErr *SagaError
+	if !errors.As(err, &sagaErr) || sagaErr.Step != StepHoldFunds || !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Fatalf("startRide() = %v, want insufficient funds at %s", err, StepHoldFunds)
+	}
+
+	// La bicicleta reclamada se libera y no queda viaje ni retención
+	f.assertBike(t, bike.StatusFree)
+	f.assertWallet(t, money.FromMinor(1), money.FromMinor(0))
+	if _, err := store.FindByID(context.Background(), ride.ID); !errors.Is(err, ErrRideNotFound) {
+		t.Errorf("ride stored after a failed start: %v", err)
+	}
+	if status := f.sagaStatus(t, ride.ID, SagaStartRide); status != SagaCompensated {
+		t.Errorf("saga status = %s, want %s", status, SagaCompensated)
+	}
+}
+
+func TestStartRideUnlockTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		deliver  bool // El candado recibe la orden sin confirmarla
+		wantLock bool
+	}{
+		{name: "delivered", deliver: true, wantLock: true},
+		{name: "never delivered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture(t, 100000)
+			if _, err := bike.IssueDeviceKey(f.bikeID.Hex()); err != nil {
+				t.Fatal(err)
+			}
+			command.Configure(100 * time.Millisecond)
+			t.Cleanup(func() { command.Configure(30 * time.Second) })
+			if tt.deliver {
+				go command.Poll(context.Background(), f.bikeID, time.Second)
+			}
+
+			ride, err := startRide(f.userID, f.bikeID, santiago)
+			if !errors.Is(err, command.ErrAckTimeout) {
+				t.Fatalf("startRide() = %v, want ErrAckTimeout", err)
+			}
+			f.assertBike(t, bike.StatusFree)
+			f.assertWallet(t, money.FromMinor(100000), money.FromMinor(0))
+
+			commands, err := command.GetBikeCommands(f.bikeID.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			locked := false
+			for _, queued := range commands {
+				if queued.Type == command.TypeLock && queued.Source == command.SourceRollback && *queued.RideID == ride.ID {
+					locked = true
+				}
+			}
+			if locked != tt.wantLock {
+				t.Errorf("lock queued = %v, want %v", locked, tt.wantLock)
+			}
+		})
+	}
+}
+
+func TestEndRide(t *testing.T) {
+	tests := []struct {
+		name      string
+		balance   int64
+		finalCost int64
+	}{
+		{name: "fare within the hold", balance: 100000, finalCost: 150},
+		{name: "fare over the balance", balance: 100000, finalCost: 150000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture(t, tt.balance)
+			ride := f.start(t)
+
+			ended, transaction, err := endRide(ride, santiago, money.FromMinor(tt.finalCost), 1200, 80)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ended.Status || transaction == nil || transaction.Amount != money.FromMinor(tt.finalCost) {
+				t.Errorf("endRide() = %+v, %+v", ended, transaction)
+			}
+
+			f.assertWallet(t, money.FromMinor(tt.balance-tt.finalCost), money.FromMinor(0))
+			f.assertBike(t, bike.StatusFree)
+			f.assertRideOpen(t, ride.ID, false)
+			if status := f.sagaStatus(t, ride.ID, SagaEndRide); status != SagaCompleted {
+				t.Errorf("saga status = %s, want %s", status, SagaCompleted)
+			}
+		})
+	}
+}
+
+func TestEndRideCompensation(t *testing.T) {
+	tests := []struct {
+		name     string
+		breakRun func(t *testing.T, f *sagaFixture, ride Ride)
+		failedAt string
+		wantHeld bool // La retención vuelve a quedar activa
+	}{
+		{
+			name: "release bike fails",
+			breakRun: func(t *testing.T, f *sagaFixture, ride Ride) {
+				f.breakBike(t)
+			},
+			failedAt: StepReleaseBike,
+			wantHeld: true,
+		},
+		{
+			name: "settle fare fails",
+			breakRun: func(t *testing.T, f *sagaFixture, ride Ride) {
+				// Una retención ya capturada no se puede volver a cobrar
+				if _, err := wallet.CaptureHold(ride.ID.Hex(), money.FromMinor(0)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			failedAt: StepSettleFare,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture(t, 100000)
+			ride := f.start(t)
+			tt.breakRun(t, f, ride)
+
+			_, _, err := endRide(ride, santiago, money.FromMinor(500), 1200, 80)
+			var sagaErr *SagaError
+			if !errors.As(err, &sagaErr) || sagaErr.Step != tt.failedAt {
+				t.Fatalf("endRide() = %v, want a failure at %s", err, tt.failedAt)
+			}
+
+			// El cobro se devuelve y el viaje se reabre
+			held := money.FromMinor(0)
+			if tt.wantHeld {
+				held = ride.HoldAmount
+			}
+			f.assertWallet(t, money.FromMinor(100000), held)
+			f.assertRideOpen(t, ride.ID, true)
+			if status := f.sagaStatus(t, ride.ID, SagaEndRide); status != SagaCompensated {
+				t.Errorf("saga status = %s, want %s", status, SagaCompensated)
+			}
+		})
+	}
+}
+
+func TestCancelRide(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+
+	cancelled, err := cancelRide(ride)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status || cancelled.CancelledAt == nil {
+		t.Errorf("cancelRide() = %+v", cancelled)
+	}
+
+	f.assertWallet(t, money.FromMinor(100000), money.FromMinor(0))
+	f.assertBike(t, bike.StatusFree)
+	f.assertRideOpen(t, ride.ID, false)
+	if status := f.sagaStatus(t, ride.ID, SagaCancelRide); status != SagaCompleted {
+		t.Errorf("saga status = %s, want %s", status, SagaCompleted)
+	}
+}
+
+func TestCancelRideCompensation(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+	f.breakBike(t)
+
+	_, err := cancelRide(ride)
+	var sagaErr *SagaError
+	if !errors.As(err, &sagaErr) || sagaErr.Step != StepReleaseBike {
+		t.Fatalf("cancelRide() = %v, want a failure at %s", err, StepReleaseBike)
+	}
+
+	// La retención vuelve a quedar activa y el viaje sigue en curso
+	f.assertWallet(t, money.FromMinor(100000), ride.HoldAmount)
+	f.assertRideOpen(t, ride.ID, true)
+	if status := f.sagaStatus(t, ride.ID, SagaCancelRide); status != SagaCompensated {
+		t.Errorf("saga status = %s, want %s", status, SagaCompensated)
+	}
+}
+
+func TestCancelRideWindowExpired(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+	ride.CreatedAt = time.Now().Add(-cancelWindow - time.Second)
+
+	if _, err := cancelRide(ride); !errors.Is(err, ErrCancelWindowExpired) {
+		t.Errorf("cancelRide() = %v, want ErrCancelWindowExpired", err)
+	}
+	f.assertRideOpen(t, ride.ID, true)
+}
+
+func TestRecoverSagas(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+
+	// Una saga de fin de viaje interrumpida después de cerrar el viaje
+	previous := cloneRide(ride)
+	closedAt := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	closed := ride
+	closed.Status = false
+	closed.UpdatedAt = closedAt
+	if err := store.Close(context.Background(), closed); err != nil {
+		t.Fatal(err)
+	}
+	saga := Saga{
+		ID:           primitive.NewObjectID(),
+		Kind:         SagaEndRide,
+		Status:       SagaPending,
+		RideID:       ride.ID,
+		UserID:       ride.UserID,
+		BikeID:       ride.BikeID,
+		PreviousRide: &previous,
+		ClosedAt:     &closedAt,
+		Steps:        []SagaStep{{Name: StepCloseRide, Status: StepDone, At: closedAt}},
+		CreatedAt:    closedAt,
+		UpdatedAt:    closedAt,
+	}
+	if err := f.sagas.Insert(context.Background(), saga); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecoverSagas(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	f.assertRideOpen(t, ride.ID, true)
+	f.assertWallet(t, money.FromMinor(100000), ride.HoldAmount)
+	if status := f.sagaStatus(t, ride.ID, SagaEndRide); status != SagaCompensated {
+		t.Errorf("saga status = %s, want %s", status, SagaCompensated)
+	}
+}
+
+// Saga store whose failAt-th update fails, as if the database went away
+type failingSagaStore struct {
+	*MemorySagaStore
+	failAt  int
+	updates int
+}
+
+var errSagaStoreDown = errors.New("saga store down")
+
+func (s *failingSagaStore) Update(ctx context.Context, saga Saga) error {
+	s.updates++
+	if s.updates == s.failAt {
+		return errSagaStoreDown
+	}
+	return s.MemorySagaStore.Update(ctx, saga)
+}
+
+func TestStartRideSaveFailure(t *testing.T) {
+	// Cada paso se guarda dos veces: iniciado y hecho
+	tests := []struct {
+		name   string
+		failAt int
+	}{
+		{name: "claim bike not started", failAt: 1},
+		{name: "claim bike done", failAt: 2},
+		{name: "hold funds done", failAt: 4},
+		{name: "unlock bike not started", failAt: 5},
+		{name: "insert ride done", failAt: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture(t, 100000)
+			SetSagaStore(&failingSagaStore{MemorySagaStore: f.sagas, failAt: tt.failAt})
+
+			ride, err := startRide(f.userID, f.bikeID, santiago)
+			var sagaErr *SagaError
+			if !errors.As(err, &sagaErr) || sagaErr.Step != stepSave || !errors.Is(err, errSagaStoreDown) {
+				t.Fatalf("startRide() = %v, want a failure to save the saga", err)
+			}
+
+			f.assertBike(t, bike.StatusFree)
+			f.assertWallet(t, money.FromMinor(100000), money.FromMinor(0))
+			if stored, err := store.FindByID(context.Background(), ride.ID); err == nil && stored.Status {
+				t.Error("the ride is still open")
+			}
+			if status := f.sagaStatus(t, ride.ID, SagaStartRide); status != SagaCompensated {
+				t.Errorf("saga status = %s, want %s", status, SagaCompensated)
+			}
+		})
+	}
+}
+
+func TestEndRideSaveFailure(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+	before, err := f.bikes.FindByID(context.Background(), f.bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// El último paso se guarda junto con el fin de la saga
+	SetSagaStore(&failingSagaStore{MemorySagaStore: f.sagas, failAt: 6})
+	_, _, err = endRide(ride, santiago, money.FromMinor(500), 1200, 80)
+	var sagaErr *SagaError
+	if !errors.As(err, &sagaErr) || sagaErr.Step != stepSave {
+		t.Fatalf("endRide() = %v, want a failure to save the saga", err)
+	}
+
+	// La bicicleta vuelve al viaje sin contarlo en su uso
+	after, err := f.bikes.FindByID(context.Background(), f.bikeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Status != bike.StatusInUse || after.RideID == nil || *after.RideID != ride.ID {
+		t.Errorf("bike = status %d, ride %v; want in use by the ride", after.Status, after.RideID)
+	}
+	if after.RideCount != before.RideCount || after.TotalEarnings != before.TotalEarnings {
+		t.Errorf("rides = %d, earnings = %s; want %d, %s", after.RideCount, after.TotalEarnings, before.RideCount, before.TotalEarnings)
+	}
+	f.assertWallet(t, money.FromMinor(100000), ride.HoldAmount)
+	f.assertRideOpen(t, ride.ID, true)
+}
+
+func TestRecoverSagasStartedStep(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	rideID := primitive.NewObjectID()
+	startedAt := time.Now().Add(-time.Minute)
+
+	// Caída tras retener saldo y antes de registrarlo
+	if _, err := bike.ClaimBike(f.bikeID, f.userID, rideID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.PlaceHold(f.userID.Hex(), money.FromMinor(1000), rideID.Hex(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	saga := Saga{
+		ID:     primitive.NewObjectID(),
+		Kind:   SagaStartRide,
+		Status: SagaPending,
+		RideID: rideID,
+		UserID: f.userID,
+		BikeID: f.bikeID,
+		Steps: []SagaStep{
+			{Name: StepClaimBike, Status: StepDone, At: startedAt},
+			{Name: StepHoldFunds, Status: StepStarted, At: startedAt},
+		},
+		CreatedAt: startedAt,
+		UpdatedAt: startedAt,
+	}
+	if err := f.sagas.Insert(context.Background(), saga); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecoverSagas(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	f.assertBike(t, bike.StatusFree)
+	f.assertWallet(t, money.FromMinor(100000), money.FromMinor(0))
+	if status := f.sagaStatus(t, rideID, SagaStartRide); status != SagaCompensated {
+		t.Errorf("saga status = %s, want %s", status, SagaCompensated)
+	}
+}
+
+func TestCompensationsAreIdempotent(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+
+	saga := Saga{Kind: SagaStartRide, RideID: ride.ID, UserID: f.userID, BikeID: f.bikeID}
+	steps := sagaSteps[SagaStartRide]
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := compensations[steps[i]](saga); err != nil {
+			t.Fatalf("%s: %v", steps[i], err)
+		}
+	}
+	f.assertBike(t, bike.StatusFree)
+	f.assertRideOpen(t, ride.ID, false)
+
+	// Otro usuario toma la bicicleta: compensar de nuevo no se la quita
+	other := primitive.NewObjectID()
+	if _, err := bike.ClaimBike(f.bikeID, other, primitive.NewObjectID()); err != nil {
+		t.Fatal(err)
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := compensations[steps[i]](saga); err != nil {
+			t.Fatalf("%s again: %v", steps[i], err)
+		}
+	}
+	f.assertBike(t, bike.StatusInUse)
+	f.assertWallet(t, money.FromMinor(100000), money.FromMinor(0))
+}
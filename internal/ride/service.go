@@ -6,96 +6,354 @@ import (
 	"time"
 
 	"github.com/clementeaf/bike-tracker/internal/bike"
-	"github.com/clementeaf/bike-tracker/pkg/database"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/clementeaf/bike-tracker/internal/command"
+	"github.com/clementeaf/bike-tracker/internal/geofence"
+	"github.com/clementeaf/bike-tracker/internal/pricing"
+	"github.com/clementeaf/bike-tracker/internal/reservation"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	holdMinutes  = 30             // Minutos de viaje cubiertos por la retención inicial
+	holdTTL      = 24 * time.Hour // Tras esto la retención de un viaje abandonado se libera
+	cancelWindow = 2 * time.Minute
+
+	devicePositionMaxAge = 2 * time.Minute // Antigüedad máxima de la posición del candado al finalizar
+)
+
+var (
+	ErrRideClosed          = errors.New("el viaje ya fue finalizado")
+	ErrCancelWindowExpired = errors.New("el plazo para cancelar el viaje expiró")
+)
+
 // New ride in Database
 func insertRide(ride Ride) error {
-	_, err := database.GetCollection("rides").InsertOne(context.Background(), ride)
+	return store.Insert(context.Background(), ride)
+}
+
+// Start a ride as a saga: claim the bike, hold funds for the estimated fare
+// of the tariff in force, unlock the bike and insert the ride. If any step
+// fails, or the lock does not confirm the unlock in time, the previous ones
+// are rolled back
+func startRide(userID, bikeID primitive.ObjectID, startCoords []float64) (Ride, error) {
+	now := time.Now()
+	zones, err := tripZones(startCoords)
+	if err != nil {
+		return Ride{}, &SagaError{Step: "pricing", Err: err}
+	}
+	fare, err := pricing.Price("", pricing.Trip{StartedAt: now, Minutes: holdMinutes, Zones: zones})
+	if err != nil {
+		return Ride{}, &SagaError{Step: "pricing", Err: err}
+	}
+
+	ride := Ride{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		BikeID:      bikeID,
+		StartCoords: startCoords,
+		Status:      true,
+		TariffID:    fare.TariffID,
+		UnlockFee:   fare.UnlockFee,
+		HoldAmount:  fare.Total,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	saga := &Saga{Kind: SagaStartRide, RideID: ride.ID, UserID: userID, BikeID: bikeID, Amount: fare.Total}
+	err = runSaga(saga, []sagaAction{
+		{name: StepClaimBike, run: func() error {
+			return claimBike(userID, bikeID, ride.ID)
+		}},
+		{name: StepHoldFunds, run: func() error {
+			_, err := wallet.PlaceHold(userID.Hex(), fare.Total, ride.ID.Hex(), holdTTL)
+			return err
+		}},
+		{name: StepUnlockBike, run: func() error {
+			return unlockBike(ride)
+		}},
+		{name: StepInsertRide, run: func() error {
+			return insertRide(ride)
+		}},
+	})
+
+	return ride, err
+}
+
+// Claim the bike for a ride, converting the reservation of the rider when
+// there is one
+func claimBike(userID, bikeID, rideID primitive.ObjectID) error {
+	converted, err := reservation.Convert(userID, bikeID, rideID)
+	if err != nil || converted {
+		return err
+	}
+
+	_, err = bike.ClaimBike(bikeID, userID, rideID)
 	return err
 }
 
+// Ask the lock of the bike to open and wait for its acknowledgement. Bikes
+// without a connected lock are opened by hand. A delivered unlock that is not
+// acknowledged in time is followed by a lock
+func unlockBike(ride Ride) error {
+	unlock, err := command.Execute(ride.BikeID, command.TypeUnlock, command.Origin{
+		Source:   command.SourceRideStart,
+		RideID:   &ride.ID,
+		IssuedBy: &ride.UserID,
+	})
+	if errors.Is(err, command.ErrNoDevice) {
+		return nil
+	}
+	if errors.Is(err, command.ErrAckTimeout) && unlock.DeliveredAt != nil {
+		// El candado recibió la orden y pudo abrirse sin confirmarlo
+		if lockErr := lockBike(ride.BikeID, ride.ID, command.SourceRollback); lockErr != nil {
+			logger.Error("unlockBike - Error al volver a bloquear la bicicleta", map[string]interface{}{
+				"ride_id": ride.ID.Hex(),
+				"bike_id": ride.BikeID.Hex(),
+				"error":   lockErr.Error(),
+			})
+		}
+	}
+	return err
+}
+
+// Ask the lock of the bike to close, without waiting for it
+func lockBike(bikeID, rideID primitive.ObjectID, source string) error {
+	_, err := command.Enqueue(bikeID, command.TypeLock, command.Origin{Source: source, RideID: &rideID})
+	if errors.Is(err, command.ErrNoDevice) {
+		return nil
+	}
+	return err
+}
+
+// Lock the bike after a ride is closed. The ride is already settled, so a
+// failure is only logged
+func lockAfterRide(ride Ride) {
+	if err := lockBike(ride.BikeID, ride.ID, command.SourceRideEnd); err != nil {
+		logger.Error("lockAfterRide - Error al enviar el bloqueo a la bicicleta", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+			"bike_id": ride.BikeID.Hex(),
+			"error":   err.Error(),
+		})
+	}
+}
+
+// End a ride as a saga: close the ride, capture the hold for the final fare
+// and release the bike, crediting it with the trip. If a step fails the fare is
+// given back and the ride is reopened
+func endRide(ride Ride, endCoords []float64, finalCost money.Money, distanceMeters, batteryLeft float64) (Ride, *wallet.Transaction, error) {
+	previous := cloneRide(ride)
+	// Precisión de milisegundos, la misma con que se guarda, para reabrir por updated_at
+	endedAt := time.Now().Truncate(time.Millisecond)
+
+	ride.EndCoords = endCoords
+	ride.Status = false
+	ride.UpdatedAt = endedAt
+	ride.FinalCost = finalCost
+	ride.Distance = distanceMeters
+	ride.BatteryLeft = batteryLeft
+
+	var transaction *wallet.Transaction
+	saga := &Saga{Kind: SagaEndRide, RideID: ride.ID, UserID: ride.UserID, BikeID: ride.BikeID, Amount: finalCost, PreviousRide: &previous, ClosedAt: &endedAt}
+	err := runSaga(saga, []sagaAction{
+		{name: StepCloseRide, run: func() error {
+			return store.Close(context.Background(), ride)
+		}},
+		{name: StepSettleFare, run: func() error {
+			var err error
+			transaction, err = wallet.CaptureHold(ride.ID.Hex(), finalCost)
+			if errors.Is(err, wallet.ErrHoldNotFound) {
+				// Viajes iniciados antes de las retenciones pagaron el desbloqueo al iniciar
+				transaction, err = wallet.SettleRideFare(ride.UserID.Hex(), ride.UnlockFee, finalCost, ride.ID.Hex())
+			}
+			return err
+		}},
+		{name: StepReleaseBike, run: func() error {
+			minutes := endedAt.Sub(ride.CreatedAt).Minutes()
+			return bike.FinishTrip(ride.BikeID, ride.ID, batteryLeft, endCoords[0], endCoords[1], minutes, finalCost)
+		}},
+	})
+	if err == nil {
+		lockAfterRide(ride)
+	}
+
+	return ride, transaction, err
+}
+
+// Cancel a ride shortly after starting it as a saga: close the ride without
+// charging, release the hold and free the bike
+func cancelRide(ride Ride) (Ride, error) {
+	if time.Since(ride.CreatedAt) > cancelWindow {
+		return ride, ErrCancelWindowExpired
+	}
+
+	previous := cloneRide(ride)
+	now := time.Now().Truncate(time.Millisecond)
+
+	ride.Status = false
+	ride.UpdatedAt = now
+	ride.CancelledAt = &now
+
+	saga := &Saga{Kind: SagaCancelRide, RideID: ride.ID, UserID: ride.UserID, BikeID: ride.BikeID, PreviousRide: &previous, ClosedAt: &now}
+	err := runSaga(saga, []sagaAction{
+		{name: StepCloseRide, run: func() error {
+			return store.Close(context.Background(), ride)
+		}},
+		{name: StepReleaseHold, run: func() error {
+			err := wallet.ReleaseHold(ride.ID.Hex())
+			if errors.Is(err, wallet.ErrHoldNotFound) {
+				return nil
+			}
+			return err
+		}},
+		{name: StepReleaseBike, run: func() error {
+			return bike.ReleaseClaimedBike(ride.BikeID, ride.ID)
+		}},
+	})
+	if err == nil {
+		lockAfterRide(ride)
+	}
+
+	return ride, err
+}
+
 // Get ride by ID
 func getRideByID(rideID string) (Ride, error) {
-	var ride Ride
-	rideObjectID, _ := primitive.ObjectIDFromHex(rideID)
-
-	err := database.GetCollection("rides").FindOne(context.Background(), bson.M{"_id": rideObjectID}).Decode(&ride)
+	rideObjectID, err := primitive.ObjectIDFromHex(rideID)
 	if err != nil {
-		return ride, errors.New("viaje no encontrado")
+		return Ride{}, ErrRideNotFound
 	}
 
-	return ride, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ride, err := store.FindByID(ctx, rideObjectID)
+	if err != nil && !errors.Is(err, ErrRideNotFound) {
+		return ride, errors.New("error al consultar el viaje: " + err.Error())
+	}
+	return ride, err
 }
 
 // Get all rides
 func getAllRides() ([]Ride, error) {
-	var rides []Ride
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := database.GetCollection("rides").Find(ctx, bson.M{})
+	rides, err := store.FindAll(ctx)
 	if err != nil {
 		return nil, errors.New("error al consultar rides: " + err.Error())
 	}
-	defer cursor.Close(ctx)
 
-	if err := cursor.All(ctx, &rides); err != nil {
-		return nil, errors.New("error al procesar rides: " + err.Error())
+	return rides, nil
+}
+
+// Get the rides of a user
+func getRidesByUser(userID string) ([]Ride, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("ID de usuario inválido")
 	}
 
-	return rides, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByUser(ctx, userObjectID)
 }
 
 // Get rides by status
 func getRidesByStatus(status bool) ([]Ride, error) {
-	var rides []Ride
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := database.GetCollection("rides").Find(ctx, bson.M{"status": status})
+	return store.FindByStatus(ctx, status)
+}
+
+// Price a finished ride with the tariff applied when it started
+func calculateFare(ride Ride, endCoords []float64, distanceMeters float64, endedAt time.Time) (pricing.Fare, error) {
+	zones, err := tripZones(ride.StartCoords, endCoords)
 	if err != nil {
-		return nil, err
+		return pricing.Fare{}, err
 	}
-	defer cursor.Close(ctx)
 
-	if err = cursor.All(ctx, &rides); err != nil {
-		return nil, err
+	return pricing.Price(ride.TariffID, pricing.Trip{
+		StartedAt:      ride.CreatedAt,
+		Minutes:        endedAt.Sub(ride.CreatedAt).Minutes(),
+		DistanceMeters: distanceMeters,
+		Zones:          zones,
+	})
+}
+
+// IDs of the geofence zones containing any of the points, for the zone
+// multipliers of the tariff
+func tripZones(points ...[]float64) ([]string, error) {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, point := range points {
+		if len(point) != 2 {
+			continue
+		}
+		zones, err := geofence.ZonesAt(point[0], point[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, zone := range zones {
+			if id := zone.ID.Hex(); !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
 	}
+	return ids, nil
+}
 
-	return rides, nil
+// Battery level of a bike after riding it for some minutes
+func remainingBattery(level, minutes float64) float64 {
+	batteryConsumptionPerMinute := 2.0
+	batteryLeft := level - batteryConsumptionPerMinute*minutes
+	if batteryLeft < 0 {
+		batteryLeft = 0
+	}
+	return batteryLeft
 }
 
-// Calculate ride cost by time
-func calculateCost(minutes float64) float64 {
-	return minutes * 0.5 // $0.5 por minuto
+// Battery level of a bike when a ride ends: what its device reported during
+// the ride, else the level sent by the app, else an estimate from the duration
+func endBattery(bicycle bike.Bike, ride Ride, reported *float64, minutes float64) float64 {
+	if bicycle.LastSeenAt != nil && bicycle.LastSeenAt.After(ride.CreatedAt) {
+		return bicycle.BatteryLevel
+	}
+	if reported != nil && *reported >= 0 && *reported <= 100 {
+		return *reported
+	}
+	return remainingBattery(bicycle.BatteryLevel, minutes)
 }
 
 // Validate if bike is available
-func validateBike(bikeID string) (bike.Bike, error) {
-	var bicycle bike.Bike
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
+func validateBike(bikeID string, userID primitive.ObjectID) (bike.Bike, error) {
 	bikeObjectID, err := primitive.ObjectIDFromHex(bikeID)
 	if err != nil {
-		return bicycle, errors.New("ID de bicicleta inválido")
+		return bike.Bike{}, errors.New("ID de bicicleta inválido")
 	}
 
-	err = database.GetCollection("bikes").FindOne(ctx, bson.M{"_id": bikeObjectID}).Decode(&bicycle)
+	bicycle, err := bike.GetBikeByID(bikeObjectID)
 	if err != nil {
 		return bicycle, errors.New("bicicleta no encontrada")
 	}
 
-	if bicycle.Status != 1 {
-		return bicycle, errors.New("bicicleta no está disponible (no está libre)")
+	if bicycle.Status == bike.StatusMaintenance {
+		return bicycle, bike.ErrInMaintenance
+	}
+
+	// Una bicicleta reservada solo la puede usar quien la reservó
+	reservedForUser := bicycle.Status == bike.StatusReserved && reservation.CanClaim(userID, bicycle.ID)
+	if bicycle.Status != bike.StatusFree && !reservedForUser {
+		return bicycle, bike.ErrBikeUnavailable
 	}
 
-	if bicycle.BatteryLevel < 20 {
-		return bicycle, errors.New("bicicleta inactiva por nivel de batería bajo")
+	if bicycle.BatteryLevel < bike.MinBatteryLevel {
+		return bicycle, bike.ErrLowBattery
 	}
 
 	return bicycle, nil
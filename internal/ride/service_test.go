@@ -0,0 +1,36 @@
+package ride
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetRideByID(t *testing.T) {
+	f := newSagaFixture(t, 100000)
+	ride := f.start(t)
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr error
+	}{
+		{name: "stored", id: ride.ID.Hex()},
+		{name: "unknown", id: primitive.NewObjectID().Hex(), wantErr: ErrRideNotFound},
+		{name: "malformed", id: "not-an-id", wantErr: ErrRideNotFound},
+		{name: "empty", id: "", wantErr: ErrRideNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getRideByID(tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getRideByID(%q) = %v, want %v", tt.id, err, tt.wantErr)
+			}
+			if err == nil && got.ID != ride.ID {
+				t.Errorf("ride = %s, want %s", got.ID.Hex(), ride.ID.Hex())
+			}
+		})
+	}
+}
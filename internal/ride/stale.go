@@ -0,0 +1,254 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrReviewClosed = errors.New("el viaje no tiene una revisión pendiente")
+
+var (
+	staleMaxDuration = 4 * time.Hour
+	staleIdleTimeout = 30 * time.Minute
+	staleFareCap     money.Money // Cero: el tope es lo retenido al iniciar el viaje
+)
+
+// Set when an ongoing ride is considered abandoned and the most it is charged
+// when the system ends it
+func ConfigureStaleRides(maxDuration, idleTimeout time.Duration, fareCap money.Money) {
+	staleMaxDuration = maxDuration
+	staleIdleTimeout = idleTimeout
+	staleFareCap = fareCap
+}
+
+// Configure stale ride detection from STALE_RIDE_MAX_MINUTES,
+// STALE_RIDE_IDLE_MINUTES and STALE_RIDE_FARE_CAP, keeping the defaults for
+// the unset ones
+func ConfigureStaleRidesFromEnv() error {
+	maxDuration, idleTimeout, fareCap := staleMaxDuration, staleIdleTimeout, staleFareCap
+
+	for name, target := range map[string]*time.Duration{
+		"STALE_RIDE_MAX_MINUTES":  &maxDuration,
+		"STALE_RIDE_IDLE_MINUTES": &idleTimeout,
+	} {
+		if value := os.Getenv(name); value != "" {
+			minutes, err := strconv.Atoi(value)
+			if err != nil || minutes <= 0 {
+				return errors.New(name + " debe ser un número de minutos positivo")
+			}
+			*target = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	if value := os.Getenv("STALE_RIDE_FARE_CAP"); value != "" {
+		amount, err := money.Parse(value, money.DefaultCurrency)
+		if err != nil || amount.IsNegative() {
+			return errors.New("STALE_RIDE_FARE_CAP debe ser un monto no negativo")
+		}
+		fareCap = amount
+	}
+
+	ConfigureStaleRides(maxDuration, idleTimeout, fareCap)
+	return nil
+}
+
+// End the ongoing rides that exceed the max duration, or whose bike stopped
+// reporting (GPS points or device telemetry) for longer than the idle timeout.
+// A ride that never reported is only ended by the max duration. Returns how
+// many were ended
+func EndStaleRides() (int, error) {
+	rides, err := getRidesByStatus(true)
+	if err != nil {
+		return 0, errors.New("error al consultar viajes en curso: " + err.Error())
+	}
+
+	now := time.Now()
+	ended := 0
+	for _, ride := range rides {
+		lastSeenAt, endCoords, seen, err := rideLiveness(ride)
+		if err != nil {
+			logger.Error("EndStaleRides - Error al consultar la última señal del viaje", map[string]interface{}{
+				"ride_id": ride.ID.Hex(),
+				"error":   err.Error(),
+			})
+			continue
+		}
+
+		var reason string
+		switch {
+		case now.Sub(ride.CreatedAt) > staleMaxDuration:
+			reason = TerminationMaxDuration
+		case seen && now.Sub(lastSeenAt) > staleIdleTimeout:
+			reason = TerminationNoTelemetry
+		default:
+			continue
+		}
+
+		if _, err := forceEndRide(ride, reason, lastSeenAt, endCoords); err != nil {
+			logger.Error("EndStaleRides - Error al finalizar el viaje", map[string]interface{}{
+				"ride_id": ride.ID.Hex(),
+				"reason":  reason,
+				"error":   err.Error(),
+			})
+			continue
+		}
+
+		logger.Info("EndStaleRides - Viaje finalizado por el sistema", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+			"user_id": ride.UserID.Hex(),
+			"reason":  reason,
+		})
+		ended++
+	}
+
+	return ended, nil
+}
+
+// Periodically end stale rides in background
+func StartStaleRideDetection(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := EndStaleRides(); err != nil {
+				logger.Error("StartStaleRideDetection - Error al finalizar viajes abandonados", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+}
+
+// End a ride on behalf of the rider at its last known position. A ride that
+// went silent is priced until it was last seen; the fare is capped and the
+// ride flagged for review
+func forceEndRide(ride Ride, reason string, lastSeenAt time.Time, endCoords []float64) (Ride, error) {
+	// El usuario pudo finalizarlo mientras tanto
+	current, err := store.FindByID(context.Background(), ride.ID)
+	if err != nil {
+		return ride, err
+	}
+	if !current.Status {
+		return current, ErrRideClosed
+	}
+	ride = current
+
+	endedAt := time.Now()
+	if reason == TerminationNoTelemetry {
+		endedAt = lastSeenAt
+	}
+
+	distance := rideDistance(ride, endCoords)
+	fare, err := calculateFare(ride, endCoords, distance, endedAt)
+	if err != nil {
+		return ride, err
+	}
+
+	fareCap := staleFareCap
+	if fareCap.IsZero() {
+		fareCap = ride.HoldAmount
+	}
+	finalCost := fare.Total
+	capped := fareCap.IsPositive() && fareCap.LessThan(finalCost)
+	if capped {
+		finalCost = fareCap
+	}
+
+	bicycle, err := bike.GetBikeByID(ride.BikeID)
+	if err != nil {
+		return ride, err
+	}
+
+	ride.Termination = &RideTermination{
+		Reason:       reason,
+		LastSeenAt:   lastSeenAt,
+		Fare:         fare.Total,
+		FareCapped:   capped,
+		ReviewStatus: ReviewPending,
+	}
+
+	batteryLeft := endBattery(bicycle, ride, nil, endedAt.Sub(ride.CreatedAt).Minutes())
+	ended, _, err := endRide(ride, endCoords, finalCost, distance, batteryLeft)
+	return ended, err
+}
+
+// Get the rides ended by the system pending review
+func getRidesForReview() ([]Ride, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindForReview(ctx)
+}
+
+// Close the review of a ride ended by the system
+func resolveReview(rideID string, note string) (Ride, error) {
+	rideObjectID, err := primitive.ObjectIDFromHex(rideID)
+	if err != nil {
+		return Ride{}, ErrRideNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ride, err := store.FindByID(ctx, rideObjectID)
+	if err != nil {
+		return ride, err
+	}
+	if ride.Termination == nil || ride.Termination.ReviewStatus != ReviewPending {
+		return ride, ErrReviewClosed
+	}
+
+	now := time.Now()
+	ride.Termination.ReviewStatus = ReviewResolved
+	ride.Termination.ReviewNote = note
+	ride.Termination.ReviewedAt = &now
+	ride.UpdatedAt = now
+
+	return ride, store.Update(ctx, ride)
+}
+
+// Last signal of a ride: its latest GPS point or the latest telemetry of its
+// bike during the ride, with the latest position reported by either. seen is
+// false when neither reported since the start, and the start is returned instead
+func rideLiveness(ride Ride) (time.Time, []float64, bool, error) {
+	lastSeenAt, endCoords, seen := ride.CreatedAt, ride.StartCoords, false
+
+	lastPoint, err := lastTrackPoint(ride.ID)
+	if err != nil && !errors.Is(err, ErrTrackEmpty) {
+		return lastSeenAt, endCoords, false, err
+	}
+	if err == nil && lastPoint.Timestamp.After(lastSeenAt) {
+		lastSeenAt, endCoords, seen = lastPoint.Timestamp, []float64{lastPoint.Lat, lastPoint.Lon}, true
+	}
+	positionAt := lastSeenAt
+
+	bicycle, err := bike.GetBikeByID(ride.BikeID)
+	if err != nil {
+		return lastSeenAt, endCoords, false, err
+	}
+	if bicycle.LastSeenAt != nil && bicycle.LastSeenAt.After(lastSeenAt) {
+		lastSeenAt, seen = *bicycle.LastSeenAt, true
+	}
+	// La posición del candado solo cuenta si es más reciente que el último punto
+	if bicycle.PositionAt != nil && bicycle.PositionAt.After(positionAt) {
+		endCoords = []float64{bicycle.Latitude, bicycle.Longitude}
+	}
+
+	return lastSeenAt, endCoords, seen, nil
+}
+
+func lastTrackPoint(rideID primitive.ObjectID) (TrackPoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return trackStore.LastPoint(ctx, rideID)
+}
@@ -0,0 +1,75 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrRideNotFound = errors.New("viaje no encontrado")
+	ErrTrackEmpty   = errors.New("el viaje no tiene puntos GPS")
+	ErrRideChanged  = errors.New("el viaje cambió después de cerrarse")
+)
+
+// RideStore abstracts the persistence of rides
+type RideStore interface {
+	Insert(ctx context.Context, ride Ride) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (Ride, error)
+	FindByStatus(ctx context.Context, status bool) ([]Ride, error)
+	FindByUser(ctx context.Context, userID primitive.ObjectID) ([]Ride, error)
+	// FindActiveByBike returns the ongoing ride of a bike, ErrRideNotFound if it has none
+	FindActiveByBike(ctx context.Context, bikeID primitive.ObjectID) (Ride, error)
+	// FindForReview returns the rides ended by the system still pending review
+	FindForReview(ctx context.Context) ([]Ride, error)
+	FindAll(ctx context.Context) ([]Ride, error)
+	Update(ctx context.Context, ride Ride) error
+	// Close replaces an ongoing ride with its closed version. When the ride
+	// was already closed it returns ErrRideClosed and changes nothing
+	Close(ctx context.Context, ride Ride) error
+	// Reopen restores an ongoing ride only while the stored one is still the
+	// closed version written at closedAt, returning ErrRideChanged otherwise.
+	// A zero closedAt matches any closed version (sagas logged before it existed)
+	Reopen(ctx context.Context, ride Ride, closedAt time.Time) error
+}
+
+var store RideStore
+
+// Inject the store used by the ride services
+func SetStore(s RideStore) {
+	store = s
+}
+
+// TrackStore persists the GPS points of rides
+type TrackStore interface {
+	// AppendPoints stores the points, ignoring those already stored with the same timestamp
+	AppendPoints(ctx context.Context, rideID primitive.ObjectID, points []TrackPoint) error
+	// FindPoints returns the points of a ride ordered by timestamp
+	FindPoints(ctx context.Context, rideID primitive.ObjectID) ([]TrackPoint, error)
+	// LastPoint returns the latest point of a ride, ErrTrackEmpty if it has none
+	LastPoint(ctx context.Context, rideID primitive.ObjectID) (TrackPoint, error)
+}
+
+var trackStore TrackStore
+
+// Inject the store used for ride tracks
+func SetTrackStore(s TrackStore) {
+	trackStore = s
+}
+
+// SagaStore persists the saga log of ride start and end
+type SagaStore interface {
+	Insert(ctx context.Context, saga Saga) error
+	Update(ctx context.Context, saga Saga) error
+	// FindUnfinished returns pending or failed sagas last updated before the given time
+	FindUnfinished(ctx context.Context, before time.Time) ([]Saga, error)
+}
+
+var sagaStore SagaStore
+
+// Inject the store used by the ride sagas
+func SetSagaStore(s SagaStore) {
+	sagaStore = s
+}
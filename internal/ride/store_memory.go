@@ -0,0 +1,212 @@
+package ride
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps rides in memory, for tests and local demos
+type MemoryStore struct {
+	mu    sync.RWMutex
+	rides map[primitive.ObjectID]Ride
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rides: make(map[primitive.ObjectID]Ride)}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rides[ride.ID] = cloneRide(ride)
+	return nil
+}
+
+func (s *MemoryStore) FindByID(ctx context.Context, id primitive.ObjectID) (Ride, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ride, ok := s.rides[id]
+	if !ok {
+		return Ride{}, ErrRideNotFound
+	}
+	return cloneRide(ride), nil
+}
+
+func (s *MemoryStore) FindByStatus(ctx context.Context, status bool) ([]Ride, error) {
+	return s.filter(func(r Ride) bool { return r.Status == status }), nil
+}
+
+func (s *MemoryStore) FindByUser(ctx context.Context, userID primitive.ObjectID) ([]Ride, error) {
+	return s.filter(func(r Ride) bool { return r.UserID == userID }), nil
+}
+
+func (s *MemoryStore) FindActiveByBike(ctx context.Context, bikeID primitive.ObjectID) (Ride, error) {
+	rides := s.filter(func(r Ride) bool { return r.Status && r.BikeID == bikeID })
+	if len(rides) == 0 {
+		return Ride{}, ErrRideNotFound
+	}
+	return rides[0], nil
+}
+
+func (s *MemoryStore) FindForReview(ctx context.Context) ([]Ride, error) {
+	return s.filter(func(r Ride) bool { return r.Termination != nil && r.Termination.ReviewStatus == ReviewPending }), nil
+}
+
+func (s *MemoryStore) FindAll(ctx context.Context) ([]Ride, error) {
+	return s.filter(func(Ride) bool { return true }), nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rides[ride.ID]; !ok {
+		return ErrRideNotFound
+	}
+	s.rides[ride.ID] = cloneRide(ride)
+	return nil
+}
+
+func (s *MemoryStore) Close(ctx context.Context, ride Ride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.rides[ride.ID]
+	if !ok {
+		return ErrRideNotFound
+	}
+	if !stored.Status {
+		return ErrRideClosed
+	}
+	s.rides[ride.ID] = cloneRide(ride)
+	return nil
+}
+
+func (s *MemoryStore) Reopen(ctx context.Context, ride Ride, closedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.rides[ride.ID]
+	if !ok {
+		return ErrRideNotFound
+	}
+	if stored.Status || (!closedAt.IsZero() && !stored.UpdatedAt.Equal(closedAt)) {
+		return ErrRideChanged
+	}
+	s.rides[ride.ID] = cloneRide(ride)
+	return nil
+}
+
+func (s *MemoryStore) filter(match func(Ride) bool) []Ride {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rides := []Ride{}
+	for _, ride := range s.rides {
+		if match(ride) {
+			rides = append(rides, cloneRide(ride))
+		}
+	}
+	sort.Slice(rides, func(i, j int) bool { return rides[i].ID.Hex() < rides[j].ID.Hex() })
+	return rides
+}
+
+func cloneRide(ride Ride) Ride {
+	ride.StartCoords = append([]float64(nil), ride.StartCoords...)
+	ride.EndCoords = append([]float64(nil), ride.EndCoords...)
+	if ride.Termination != nil {
+		termination := *ride.Termination
+		ride.Termination = &termination
+	}
+	return ride
+}
+
+// MemorySagaStore keeps ride sagas in memory, for tests and local demos
+type MemorySagaStore struct {
+	mu    sync.RWMutex
+	sagas map[primitive.ObjectID]Saga
+}
+
+func NewMemorySagaStore() *MemorySagaStore {
+	return &MemorySagaStore{sagas: make(map[primitive.ObjectID]Saga)}
+}
+
+func (s *MemorySagaStore) Insert(ctx context.Context, saga Saga) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sagas[saga.ID] = cloneSaga(saga)
+	return nil
+}
+
+func (s *MemorySagaStore) Update(ctx context.Context, saga Saga) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sagas[saga.ID] = cloneSaga(saga)
+	return nil
+}
+
+func (s *MemorySagaStore) FindUnfinished(ctx context.Context, before time.Time) ([]Saga, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sagas := []Saga{}
+	for _, saga := range s.sagas {
+		if (saga.Status == SagaPending || saga.Status == SagaFailed) && saga.UpdatedAt.Before(before) {
+			sagas = append(sagas, cloneSaga(saga))
+		}
+	}
+	return sagas, nil
+}
+
+func cloneSaga(saga Saga) Saga {
+	saga.Steps = append([]SagaStep{}, saga.Steps...)
+	if saga.PreviousRide != nil {
+		previous := cloneRide(*saga.PreviousRide)
+		saga.PreviousRide = &previous
+	}
+	return saga
+}
+
+// MemoryTrackStore keeps ride tracks in memory, for tests and local demos
+type MemoryTrackStore struct {
+	mu     sync.RWMutex
+	tracks map[primitive.ObjectID][]TrackPoint
+}
+
+func NewMemoryTrackStore() *MemoryTrackStore {
+	return &MemoryTrackStore{tracks: make(map[primitive.ObjectID][]TrackPoint)}
+}
+
+func (s *MemoryTrackStore) AppendPoints(ctx context.Context, rideID primitive.ObjectID, points []TrackPoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tracks[rideID] = sortTrack(append(s.tracks[rideID], points...))
+	return nil
+}
+
+func (s *MemoryTrackStore) FindPoints(ctx context.Context, rideID primitive.ObjectID) ([]TrackPoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]TrackPoint{}, s.tracks[rideID]...), nil
+}
+
+func (s *MemoryTrackStore) LastPoint(ctx context.Context, rideID primitive.ObjectID) (TrackPoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	track := s.tracks[rideID]
+	if len(track) == 0 {
+		return TrackPoint{}, ErrTrackEmpty
+	}
+	return track[len(track)-1], nil
+}
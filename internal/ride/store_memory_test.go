@@ -0,0 +1,126 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryStoreCloseAndReopen(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	open := Ride{ID: primitive.NewObjectID(), BikeID: primitive.NewObjectID(), Status: true, StartCoords: []float64{1, 2}}
+	if err := s.Insert(ctx, open); err != nil {
+		t.Fatal(err)
+	}
+
+	closedAt := time.Now().Truncate(time.Millisecond)
+	closed := open
+	closed.Status = false
+	closed.UpdatedAt = closedAt
+
+	steps := []struct {
+		name    string
+		apply   func() error
+		wantErr error
+		open    bool
+	}{
+		{name: "close", apply: func() error { return s.Close(ctx, closed) }, open: false},
+		{name: "close again", apply: func() error { return s.Close(ctx, closed) }, wantErr: ErrRideClosed, open: false},
+		{name: "reopen other version", apply: func() error { return s.Reopen(ctx, open, closedAt.Add(time.Second)) }, wantErr: ErrRideChanged, open: false},
+		{name: "reopen", apply: func() error { return s.Reopen(ctx, open, closedAt) }, open: true},
+		{name: "reopen an open ride", apply: func() error { return s.Reopen(ctx, open, closedAt) }, wantErr: ErrRideChanged, open: true},
+	}
+
+	for _, step := range steps {
+		if err := step.apply(); !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: error = %v, want %v", step.name, err, step.wantErr)
+		}
+		if found, _ := s.FindByID(ctx, open.ID); found.Status != step.open {
+			t.Errorf("%s: status = %v, want %v", step.name, found.Status, step.open)
+		}
+	}
+
+	if err := s.Close(ctx, Ride{ID: primitive.NewObjectID()}); !errors.Is(err, ErrRideNotFound) {
+		t.Errorf("Close(unknown) = %v, want ErrRideNotFound", err)
+	}
+}
+
+func TestMemoryStoreFinders(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	userID, bikeID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	ended := Ride{ID: primitive.NewObjectID(), UserID: userID, BikeID: bikeID, Termination: &RideTermination{ReviewStatus: ReviewPending}}
+	ongoing := Ride{ID: primitive.NewObjectID(), UserID: userID, BikeID: bikeID, Status: true}
+	other := Ride{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), BikeID: primitive.NewObjectID(), Status: true}
+	for _, ride := range []Ride{ended, ongoing, other} {
+		if err := s.Insert(ctx, ride); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func(rides []Ride, err error) int {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(rides)
+	}
+	if n := count(s.FindByStatus(ctx, true)); n != 2 {
+		t.Errorf("FindByStatus(true) = %d rides, want 2", n)
+	}
+	if n := count(s.FindByUser(ctx, userID)); n != 2 {
+		t.Errorf("FindByUser() = %d rides, want 2", n)
+	}
+	if n := count(s.FindForReview(ctx)); n != 1 {
+		t.Errorf("FindForReview() = %d rides, want 1", n)
+	}
+
+	if found, err := s.FindActiveByBike(ctx, bikeID); err != nil || found.ID != ongoing.ID {
+		t.Errorf("FindActiveByBike() = %s, %v; want %s", found.ID.Hex(), err, ongoing.ID.Hex())
+	}
+	if _, err := s.FindActiveByBike(ctx, primitive.NewObjectID()); !errors.Is(err, ErrRideNotFound) {
+		t.Errorf("FindActiveByBike(unknown) = %v, want ErrRideNotFound", err)
+	}
+}
+
+func TestMemoryTrackStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryTrackStore()
+	rideID := primitive.NewObjectID()
+	start := time.Now().Truncate(time.Millisecond)
+
+	if _, err := s.LastPoint(ctx, rideID); !errors.Is(err, ErrTrackEmpty) {
+		t.Errorf("LastPoint() of an empty track = %v, want ErrTrackEmpty", err)
+	}
+
+	batches := [][]TrackPoint{
+		{{Lat: 1, Timestamp: start.Add(2 * time.Second)}, {Lat: 2, Timestamp: start}},
+		{{Lat: 3, Timestamp: start.Add(time.Second)}, {Lat: 9, Timestamp: start}}, // Repite un instante
+	}
+	for _, batch := range batches {
+		if err := s.AppendPoints(ctx, rideID, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := s.FindPoints(ctx, rideID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{2, 3, 1}
+	if len(points) != len(want) {
+		t.Fatalf("FindPoints() = %+v", points)
+	}
+	for i, point := range points {
+		if point.Lat != want[i] {
+			t.Errorf("point %d lat = %v, want %v", i, point.Lat, want[i])
+		}
+	}
+	if last, err := s.LastPoint(ctx, rideID); err != nil || last.Lat != 1 {
+		t.Errorf("LastPoint() = %+v, %v", last, err)
+	}
+}
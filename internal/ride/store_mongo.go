@@ -0,0 +1,244 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists rides in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, ride Ride) error {
+	_, err := s.collection.InsertOne(ctx, ride)
+	return err
+}
+
+func (s *MongoStore) FindByID(ctx context.Context, id primitive.ObjectID) (Ride, error) {
+	var ride Ride
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&ride)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ride, ErrRideNotFound
+	}
+	return ride, err
+}
+
+func (s *MongoStore) FindByStatus(ctx context.Context, status bool) ([]Ride, error) {
+	return s.find(ctx, bson.M{"status": status})
+}
+
+func (s *MongoStore) FindByUser(ctx context.Context, userID primitive.ObjectID) ([]Ride, error) {
+	return s.find(ctx, bson.M{"user_id": userID})
+}
+
+func (s *MongoStore) FindActiveByBike(ctx context.Context, bikeID primitive.ObjectID) (Ride, error) {
+	var ride Ride
+	err := s.collection.FindOne(ctx, bson.M{"bike_id": bikeID, "status": true}).Decode(&ride)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ride, ErrRideNotFound
+	}
+	return ride, err
+}
+
+func (s *MongoStore) FindForReview(ctx context.Context) ([]Ride, error) {
+	return s.find(ctx, bson.M{"termination.review_status": ReviewPending})
+}
+
+func (s *MongoStore) FindAll(ctx context.Context) ([]Ride, error) {
+	return s.find(ctx, bson.M{})
+}
+
+func (s *MongoStore) Update(ctx context.Context, ride Ride) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": ride.ID}, ride)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRideNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) Close(ctx context.Context, ride Ride) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": ride.ID, "status": true}, ride)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRideClosed
+	}
+	return nil
+}
+
+func (s *MongoStore) Reopen(ctx context.Context, ride Ride, closedAt time.Time) error {
+	filter := bson.M{"_id": ride.ID, "status": false}
+	if !closedAt.IsZero() {
+		filter["updated_at"] = closedAt
+	}
+
+	result, err := s.collection.ReplaceOne(ctx, filter, ride)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRideChanged
+	}
+	return nil
+}
+
+func (s *MongoStore) find(ctx context.Context, filter bson.M) ([]Ride, error) {
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rides []Ride
+	if err := cursor.All(ctx, &rides); err != nil {
+		return nil, err
+	}
+	return rides, nil
+}
+
+// MongoSagaStore persists ride sagas in a MongoDB collection
+type MongoSagaStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoSagaStore(collection *mongo.Collection) *MongoSagaStore {
+	return &MongoSagaStore{collection: collection}
+}
+
+func (s *MongoSagaStore) Insert(ctx context.Context, saga Saga) error {
+	_, err := s.collection.InsertOne(ctx, saga)
+	return err
+}
+
+func (s *MongoSagaStore) Update(ctx context.Context, saga Saga) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": saga.ID}, saga)
+	return err
+}
+
+func (s *MongoSagaStore) FindUnfinished(ctx context.Context, before time.Time) ([]Saga, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"status":     bson.M{"$in": []string{SagaPending, SagaFailed}},
+		"updated_at": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sagas []Saga
+	if err := cursor.All(ctx, &sagas); err != nil {
+		return nil, err
+	}
+	return sagas, nil
+}
+
+// Time span of the points grouped in one track document
+const trackBucketSpan = 10 * time.Minute
+
+// MongoTrackStore keeps the points of a ride in documents that group a time
+// span each, instead of one document per point
+type MongoTrackStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoTrackStore(collection *mongo.Collection) *MongoTrackStore {
+	return &MongoTrackStore{collection: collection}
+}
+
+func (s *MongoTrackStore) AppendPoints(ctx context.Context, rideID primitive.ObjectID, points []TrackPoint) error {
+	buckets := make(map[time.Time][]TrackPoint)
+	for _, point := range points {
+		bucket := point.Timestamp.Truncate(trackBucketSpan)
+		buckets[bucket] = append(buckets[bucket], point)
+	}
+
+	models := make([]mongo.WriteModel, 0, len(buckets))
+	for bucket, bucketPoints := range buckets {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ride_id": rideID, "bucket": bucket}).
+			SetUpdate(appendNewPoints(bucketPoints)).
+			SetUpsert(true))
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := s.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// Update pipeline that appends only the points whose timestamp the bucket does
+// not have yet, so a resent point with other coordinates does not duplicate it.
+// Timestamps come truncated to milliseconds, the precision Mongo stores
+func appendNewPoints(points []TrackPoint) mongo.Pipeline {
+	stored := bson.M{"$ifNull": bson.A{"$points", bson.A{}}}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"points": bson.M{"$concatArrays": bson.A{stored, bson.M{"$filter": bson.M{
+			"input": bson.M{"$literal": points},
+			"as":    "point",
+			"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$point.t", bson.M{"$ifNull": bson.A{"$points.t", bson.A{}}}}}}},
+		}}}},
+	}}}}
+}
+
+func (s *MongoTrackStore) FindPoints(ctx context.Context, rideID primitive.ObjectID) ([]TrackPoint, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"ride_id": rideID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var buckets []struct {
+		Points []TrackPoint `bson:"points"`
+	}
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+
+	var points []TrackPoint
+	for _, bucket := range buckets {
+		points = append(points, bucket.Points...)
+	}
+	return sortTrack(points), nil
+}
+
+// The latest point is in the latest bucket, since buckets are time spans
+func (s *MongoTrackStore) LastPoint(ctx context.Context, rideID primitive.ObjectID) (TrackPoint, error) {
+	var bucket struct {
+		Points []TrackPoint `bson:"points"`
+	}
+	err := s.collection.FindOne(ctx, bson.M{"ride_id": rideID},
+		options.FindOne().SetSort(bson.D{{Key: "bucket", Value: -1}})).Decode(&bucket)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && len(bucket.Points) == 0) {
+		return TrackPoint{}, ErrTrackEmpty
+	} else if err != nil {
+		return TrackPoint{}, err
+	}
+
+	points := sortTrack(bucket.Points)
+	return points[len(points)-1], nil
+}
+
+// Create the index used to find and upsert the buckets of a ride
+func (s *MongoTrackStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ride_id", Value: 1}, {Key: "bucket", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
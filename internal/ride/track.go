@@ -0,0 +1,193 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/bike"
+	"github.com/clementeaf/bike-tracker/pkg/geo"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxTrackBatch       = 1000
+	trackClockSkew      = 5 * time.Minute // Tolerancia con el reloj del dispositivo
+	polylineTolerance   = 5.0             // Metros
+	minSpeedSegmentSecs = 1.0             // Segmentos más cortos no cuentan para la velocidad máxima
+)
+
+var ErrTrackBatchTooLarge = errors.New("demasiados puntos en el lote")
+
+// Store a batch of GPS points of an ongoing ride. Points may arrive out of
+// order or repeated: invalid ones are rejected and repeated timestamps ignored
+func ingestTrack(ride Ride, points []TrackPoint) (TrackResult, error) {
+	result := TrackResult{Received: len(points)}
+	if len(points) > maxTrackBatch {
+		return result, ErrTrackBatchTooLarge
+	}
+	if !ride.Status {
+		return result, ErrRideClosed
+	}
+
+	now := time.Now()
+	seen := make(map[int64]bool, len(points))
+	valid := make([]TrackPoint, 0, len(points))
+	for _, point := range points {
+		// Mongo guarda milisegundos: normalizar para que los duplicados coincidan
+		point.Timestamp = point.Timestamp.UTC().Truncate(time.Millisecond)
+
+		if !validTrackPoint(point, ride.CreatedAt, now) || seen[point.Timestamp.UnixMilli()] {
+			result.Rejected++
+			continue
+		}
+		seen[point.Timestamp.UnixMilli()] = true
+		valid = append(valid, point)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := trackStore.AppendPoints(ctx, ride.ID, valid); err != nil {
+		return result, errors.New("error al guardar el recorrido: " + err.Error())
+	}
+
+	result.Accepted = len(valid)
+	return result, nil
+}
+
+// Append the positions reported by a bike's device to the track of its
+// ongoing ride, so rides are tracked even when the app sends no points
+func RecordDevicePositions(bikeID primitive.ObjectID, positions []bike.ReportedPosition) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ride, err := store.FindActiveByBike(ctx, bikeID)
+	if errors.Is(err, ErrRideNotFound) {
+		return
+	} else if err != nil {
+		logger.Error("RecordDevicePositions - Error al buscar el viaje de la bicicleta", map[string]interface{}{
+			"bike_id": bikeID.Hex(),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Las posiciones previas al viaje no son parte del recorrido
+	points := make([]TrackPoint, 0, len(positions))
+	for _, position := range positions {
+		if position.At.After(ride.CreatedAt) {
+			points = append(points, TrackPoint{Lat: position.Latitude, Lon: position.Longitude, Timestamp: position.At})
+		}
+	}
+	if len(points) == 0 {
+		return
+	}
+
+	if _, err := ingestTrack(ride, points); err != nil && !errors.Is(err, ErrRideClosed) {
+		logger.Error("RecordDevicePositions - Error al agregar posiciones al recorrido", map[string]interface{}{
+			"ride_id": ride.ID.Hex(),
+			"bike_id": bikeID.Hex(),
+			"error":   err.Error(),
+		})
+	}
+}
+
+func validTrackPoint(point TrackPoint, startedAt, now time.Time) bool {
+	if !geo.ValidCoords(point.Lat, point.Lon) {
+		return false
+	}
+	if point.Timestamp.Before(startedAt.Add(-trackClockSkew)) || point.Timestamp.After(now.Add(trackClockSkew)) {
+		return false
+	}
+	return true
+}
+
+// Get the stored track of a ride
+func getTrack(rideID primitive.ObjectID) ([]TrackPoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return trackStore.FindPoints(ctx, rideID)
+}
+
+// Order points by timestamp keeping the first point stored for each timestamp
+func sortTrack(points []TrackPoint) []TrackPoint {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+
+	unique := points[:0]
+	for i, point := range points {
+		if i > 0 && point.Timestamp.Equal(unique[len(unique)-1].Timestamp) {
+			continue
+		}
+		unique = append(unique, point)
+	}
+	return unique
+}
+
+// Path of a ride: start, tracked points and end (when known)
+func ridePath(ride Ride, track []TrackPoint, endCoords []float64) []geo.Point {
+	path := make([]geo.Point, 0, len(track)+2)
+	if len(ride.StartCoords) == 2 {
+		path = append(path, geo.Point{Lat: ride.StartCoords[0], Lon: ride.StartCoords[1]})
+	}
+	for _, point := range track {
+		path = append(path, geo.Point{Lat: point.Lat, Lon: point.Lon})
+	}
+	if len(endCoords) == 2 {
+		path = append(path, geo.Point{Lat: endCoords[0], Lon: endCoords[1]})
+	}
+	return path
+}
+
+// Distance in meters travelled in a ride, following its track when there is one
+func rideDistance(ride Ride, endCoords []float64) float64 {
+	track, err := getTrack(ride.ID)
+	if err != nil {
+		track = nil
+	}
+	return geo.PathLength(ridePath(ride, track, endCoords))
+}
+
+// Summarize a ride from its track
+func summarizeRide(ride Ride) (RideSummary, error) {
+	track, err := getTrack(ride.ID)
+	if err != nil {
+		return RideSummary{}, errors.New("error al consultar el recorrido: " + err.Error())
+	}
+
+	path := ridePath(ride, track, ride.EndCoords)
+	summary := RideSummary{
+		RideID:         ride.ID.Hex(),
+		Points:         len(track),
+		DistanceMeters: geo.PathLength(path),
+		Polyline:       geo.EncodePolyline(geo.Simplify(path, polylineTolerance)),
+	}
+
+	endedAt := time.Now()
+	if !ride.Status {
+		endedAt = ride.UpdatedAt
+	}
+	if len(track) > 0 && track[len(track)-1].Timestamp.After(endedAt) {
+		endedAt = track[len(track)-1].Timestamp
+	}
+	summary.DurationSeconds = endedAt.Sub(ride.CreatedAt).Seconds()
+	if summary.DurationSeconds > 0 {
+		summary.AvgSpeedKmh = summary.DistanceMeters / summary.DurationSeconds * 3.6
+	}
+
+	for i := 1; i < len(track); i++ {
+		seconds := track[i].Timestamp.Sub(track[i-1].Timestamp).Seconds()
+		if seconds < minSpeedSegmentSecs {
+			continue
+		}
+		meters := geo.Haversine(track[i-1].Lat, track[i-1].Lon, track[i].Lat, track[i].Lon)
+		if speed := meters / seconds * 3.6; speed > summary.MaxSpeedKmh {
+			summary.MaxSpeedKmh = speed
+		}
+	}
+
+	return summary, nil
+}
@@ -1,6 +1,11 @@
 package user
 
-import "time"
+import (
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+)
 
 type RegisterUserInput struct {
 	Name     string `json:"name"`
@@ -8,18 +13,67 @@ type RegisterUserInput struct {
 	Password string `json:"password"`
 }
 
-type WalletInput struct {
-	Email  string  `json:"email"`
-	Amount float64 `json:"amount"`
+type UserResponse struct {
+	ID             string      `json:"id"`
+	Name           string      `json:"name"`
+	Email          string      `json:"email"`
+	WalletBalance  money.Money `json:"wallet_balance"`
+	LastSession    string      `json:"last_session"`
+	LastBikeUsedID *string     `json:"last_bike_used_id"`
+	Roles          []string    `json:"roles"`
+	EmailVerified  bool        `json:"email_verified"`
+	MFAEnabled     bool        `json:"mfa_enabled"`
 }
 
-type UserResponse struct {
-	ID             string  `json:"id"`
-	Name           string  `json:"name"`
-	Email          string  `json:"email"`
-	WalletBalance  float64 `json:"wallet_balance"`
-	LastSession    string  `json:"last_session"`
-	LastBikeUsedID *string `json:"last_bike_used_id"`
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenInput struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// A TOTP code or, when the device is lost, one of the recovery codes
+type MFACodeInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFALoginInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	MFACodeInput
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // Para mostrar como código QR
+}
+
+// Response of a sign in that still needs the second factor
+type MFAChallenge struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+// Tokens of a sign in. Accounts whose role requires MFA and have none are
+// told to enroll; until then their privileged permissions do not apply
+type LoginResponse struct {
+	auth.TokenPair
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+type RolesInput struct {
+	Roles []string `json:"roles"`
 }
 
 type UpdateUserInput struct {
@@ -27,7 +81,8 @@ type UpdateUserInput struct {
 	Email *string `json:"email"`
 }
 
-func ToUserResponse(user User) UserResponse {
+// The wallet balance comes from the wallet ledger, not from the user document
+func ToUserResponse(user User, walletBalance money.Money) UserResponse {
 	var lastBikeUsedID *string
 	if user.LastBikeUsedID != nil {
 		id := user.LastBikeUsedID.Hex()
@@ -38,8 +93,11 @@ func ToUserResponse(user User) UserResponse {
 		ID:             user.ID.Hex(),
 		Name:           user.Name,
 		Email:          user.Email,
-		WalletBalance:  user.WalletBalance,
+		WalletBalance:  walletBalance,
 		LastSession:    user.LastSession.Format(time.RFC3339),
 		LastBikeUsedID: lastBikeUsedID,
+		Roles:          user.RoleList(),
+		EmailVerified:  user.EmailVerifiedAt != nil,
+		MFAEnabled:     user.MFAEnabled(),
 	}
 }
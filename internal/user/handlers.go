@@ -2,7 +2,9 @@ package user
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/clementeaf/bike-tracker/internal/wallet"
 	"github.com/clementeaf/bike-tracker/pkg/auth"
@@ -32,8 +34,12 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 
 	user, err := RegisterUser(input)
 	if err != nil {
+		message := "Error al registrar usuario"
+		if errors.Is(err, ErrInvalidEmail) || errors.Is(err, ErrNoPassword) {
+			message = err.Error()
+		}
 		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
-			"error": "Error al registrar usuario",
+			"error": message,
 		})
 		logger.Error("Error al registrar usuario en /users/register", map[string]interface{}{
 			"error": err.Error(),
@@ -53,7 +59,7 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID.Hex())
+	tokens, err := auth.StartSession(user.ID.Hex(), user.RoleList(), false)
 	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
 			"error": "Error al generar token JWT",
@@ -66,9 +72,12 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := map[string]interface{}{
-		"token":     token,
-		"user_id":   user.ID.Hex(),
-		"wallet_id": walletID.Hex(),
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+		"user_id":       user.ID.Hex(),
+		"wallet_id":     walletID.Hex(),
 	}
 
 	httpresponse.SendJSONResponse(w, http.StatusCreated, response)
@@ -107,7 +116,25 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID.Hex())
+	// Con MFA activo la contraseña solo abre el segundo paso
+	if user.MFAEnabled() {
+		challenge, err := StartMFAChallenge(user)
+		if err != nil {
+			httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "Error al iniciar la verificación de dos factores",
+			})
+			logger.Error("POST /users/login - Error al generar el desafío MFA", map[string]interface{}{
+				"user_id": user.ID.Hex(),
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		httpresponse.SendJSONResponse(w, http.StatusOK, challenge)
+		return
+	}
+
+	tokens, err := auth.StartSession(user.ID.Hex(), user.RoleList(), false)
 	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
 			"error": "Error al generar token JWT",
@@ -119,7 +146,161 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]string{"token": token})
+	httpresponse.SendJSONResponse(w, http.StatusOK, LoginResponse{
+		TokenPair:             tokens,
+		MFAEnrollmentRequired: auth.RequiresMFA(user.RoleList()),
+	})
+}
+
+// POST Second step of a sign in with MFA: challenge token and code
+func handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	var input MFALoginInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ChallengeToken == "" {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Falta el challenge_token",
+		})
+		return
+	}
+
+	user, err := CompleteMFAChallenge(input)
+	if errors.Is(err, auth.ErrInvalidActionToken) {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "Desafío inválido o expirado, inicie sesión de nuevo",
+		})
+		return
+	} else if err != nil {
+		sendMFAError(w, "POST /users/login/mfa", err)
+		return
+	}
+
+	tokens, err := auth.StartSession(user.ID.Hex(), user.RoleList(), true)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al generar token JWT",
+		})
+		logger.Error("POST /users/login/mfa - Error al generar token JWT", map[string]interface{}{
+			"user_id": user.ID.Hex(),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, LoginResponse{TokenPair: tokens})
+}
+
+// POST Exchange a refresh token for new tokens
+func handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	var input RefreshInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Falta el refresh_token",
+		})
+		return
+	}
+
+	tokens, err := auth.RefreshSession(input.RefreshToken, currentRoles)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) || errors.Is(err, ErrUserNotFound) {
+			status = http.StatusUnauthorized
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("POST /users/token/refresh - Error al renovar la sesión", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, tokens)
+}
+
+// POST Close the session of the request token
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	claims, err := auth.GetAuthenticatedClaims(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := auth.EndSession(claims.SessionID); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al cerrar la sesión",
+		})
+		logger.Error("POST /users/logout - Error al cerrar la sesión", map[string]interface{}{
+			"user_id": claims.UserID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	logger.Info("POST /users/logout - Sesión cerrada", map[string]interface{}{
+		"user_id": claims.UserID,
+	})
+}
+
+// POST Close every session of the authenticated user, on all devices
+func handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	closed, err := auth.EndAllSessions(userID)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al cerrar las sesiones",
+		})
+		logger.Error("POST /users/logout-all - Error al cerrar las sesiones", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]int{
+		"sessions_closed": closed,
+	})
+	logger.Info("POST /users/logout-all - Sesiones cerradas", map[string]interface{}{
+		"user_id":         userID,
+		"sessions_closed": closed,
+	})
 }
 
 // GEt user info
@@ -214,7 +395,11 @@ func handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	updatedUser, err := UpdateUser(userID, input)
 	if err != nil {
-		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrUserChanged) {
+			status = http.StatusConflict
+		}
+		httpresponse.SendJSONResponse(w, status, map[string]string{
 			"error": err.Error(),
 		})
 		logger.Error("PUT /users/me/update - Error al actualizar usuario", map[string]interface{}{
@@ -229,3 +414,347 @@ func handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		"user": updatedUser,
 	})
 }
+
+// PUT Roles of a user (/users/{id}/roles)
+func handleSetRoles(w http.ResponseWriter, r *http.Request) {
+	userID, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/users/"), "/")
+	if resource != "roles" {
+		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
+			"error": "Ruta no encontrada",
+		})
+		return
+	}
+	if r.Method != http.MethodPut {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	actorID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var input RolesInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Error al procesar el JSON: " + err.Error(),
+		})
+		return
+	}
+
+	updatedUser, err := SetUserRoles(userID, input, actorID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrInvalidRoles):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrOwnAdminRole), errors.Is(err, ErrUserChanged):
+			status = http.StatusConflict
+		}
+
+		httpresponse.SendJSONResponse(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Error("PUT /users/{id}/roles - Error al asignar roles", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, updatedUser)
+	logger.Info("PUT /users/{id}/roles - Roles asignados", map[string]interface{}{
+		"user_id":  userID,
+		"roles":    updatedUser.Roles,
+		"actor_id": actorID,
+	})
+}
+
+// POST Verify the email with the token of the emailed link
+func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	var input TokenInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Falta el token",
+		})
+		return
+	}
+
+	if err := VerifyEmail(input.Token); err != nil {
+		sendTokenError(w, "POST /users/email/verify", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST Send the verification link again to the authenticated user
+func handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := ResendVerificationEmail(userID); err != nil {
+		sendTokenError(w, "POST /users/email/resend", err)
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusAccepted, map[string]string{
+		"message": "Enlace de verificación enviado",
+	})
+}
+
+// POST Email a password reset link. Always accepted, registered or not
+func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	var input ForgotPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Falta el email",
+		})
+		return
+	}
+
+	if err := RequestPasswordReset(input.Email); err != nil {
+		logger.Error("POST /users/password/forgot - Error al generar el enlace", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusAccepted, map[string]string{
+		"message": "Si el email está registrado recibirá un enlace para restablecer la contraseña",
+	})
+}
+
+// POST Set a new password with the token of the emailed link
+func handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	var input ResetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Falta el token",
+		})
+		return
+	}
+
+	if err := ResetPassword(input); err != nil {
+		sendTokenError(w, "POST /users/password/reset", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sendTokenError(w http.ResponseWriter, route string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrInvalidActionToken), errors.Is(err, ErrNoPassword):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrEmailAlreadyVerified), errors.Is(err, ErrUserChanged):
+		status = http.StatusConflict
+	case errors.Is(err, ErrUserNotFound):
+		status = http.StatusNotFound
+	}
+
+	httpresponse.SendJSONResponse(w, status, map[string]string{
+		"error": err.Error(),
+	})
+	logger.Error(route+" - Error", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// POST Start enrolling an authenticator app (/users/mfa/enroll)
+func handleMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := mfaRequest(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := BeginMFAEnrollment(userID)
+	if err != nil {
+		sendMFAError(w, "POST /users/mfa/enroll", err)
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, enrollment)
+}
+
+// POST Confirm the enrollment with a code from the app (/users/mfa/confirm).
+// The other sessions are closed and a new one with MFA is returned along
+// with the recovery codes
+func handleMFAConfirm(w http.ResponseWriter, r *http.Request) {
+	userID, ok := mfaRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Falta el código",
+		})
+		return
+	}
+
+	user, codes, err := ConfirmMFAEnrollment(userID, input.Code)
+	if err != nil {
+		sendMFAError(w, "POST /users/mfa/confirm", err)
+		return
+	}
+
+	// Las sesiones abiertas solo con contraseña dejan de valer
+	if _, err := auth.EndAllSessions(userID); err != nil {
+		logger.Error("POST /users/mfa/confirm - Error al cerrar las sesiones", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+	}
+
+	tokens, err := auth.StartSession(userID, user.RoleList(), true)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al generar token JWT",
+		})
+		logger.Error("POST /users/mfa/confirm - Error al generar token JWT", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"token":          tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+		"token_type":     tokens.TokenType,
+		"expires_in":     tokens.ExpiresIn,
+		"recovery_codes": codes,
+	})
+}
+
+// POST Turn MFA off with a current code (/users/mfa/disable)
+func handleMFADisable(w http.ResponseWriter, r *http.Request) {
+	userID, ok := mfaRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Error al procesar el JSON: " + err.Error(),
+		})
+		return
+	}
+
+	if err := DisableMFA(userID, input); err != nil {
+		sendMFAError(w, "POST /users/mfa/disable", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST New recovery codes, confirmed with a current code (/users/mfa/recovery-codes)
+func handleMFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := mfaRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "Error al procesar el JSON: " + err.Error(),
+		})
+		return
+	}
+
+	codes, err := RegenerateRecoveryCodes(userID, input)
+	if err != nil {
+		sendMFAError(w, "POST /users/mfa/recovery-codes", err)
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, map[string][]string{
+		"recovery_codes": codes,
+	})
+}
+
+// Method and user of the MFA routes, all POST for the authenticated user
+func mfaRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return "", false
+	}
+
+	userID, err := auth.GetAuthenticatedUserID(r)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+		return "", false
+	}
+	return userID, true
+}
+
+func sendMFAError(w http.ResponseWriter, route string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		status = http.StatusUnauthorized
+	case errors.Is(err, ErrMFALocked):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrMFAAlreadyEnabled), errors.Is(err, ErrMFANotEnabled),
+		errors.Is(err, ErrMFANotPending), errors.Is(err, ErrMFARequired), errors.Is(err, ErrUserChanged):
+		status = http.StatusConflict
+	case errors.Is(err, ErrUserNotFound):
+		status = http.StatusNotFound
+	}
+
+	httpresponse.SendJSONResponse(w, status, map[string]string{
+		"error": err.Error(),
+	})
+	logger.Error(route+" - Error", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,287 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/totp"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("la autenticación de dos factores ya está activa")
+	ErrMFANotEnabled     = errors.New("la autenticación de dos factores no está activa")
+	ErrMFANotPending     = errors.New("no hay un enrolamiento de dos factores pendiente")
+	ErrMFARequired       = errors.New("su rol exige autenticación de dos factores")
+	ErrInvalidMFACode    = errors.New("código de verificación inválido")
+	ErrMFALocked         = errors.New("demasiados códigos inválidos, intente más tarde")
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaMaxAttempts    = 5
+	mfaLockout        = 15 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// Name authenticator apps show next to the account (MFA_ISSUER)
+var mfaIssuer = "Bike Tracker"
+
+// Generate a secret to enroll an authenticator app. It only takes effect
+// once ConfirmMFAEnrollment receives a code from the app
+func BeginMFAEnrollment(userID string) (MFAEnrollment, error) {
+	user, err := findUser(userID)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	if user.MFAEnabled() {
+		return MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.SetPendingMFASecret(ctx, user.ID, secret); err != nil {
+		return MFAEnrollment{}, err
+	}
+
+	return MFAEnrollment{Secret: secret, URI: totp.URI(mfaIssuer, user.Email, secret)}, nil
+}
+
+// Activate the pending secret with a code from the app. Returns the recovery
+// codes, which are shown only this time
+func ConfirmMFAEnrollment(userID, code string) (User, []string, error) {
+	user, err := findUser(userID)
+	if err != nil {
+		return User{}, nil, err
+	}
+	if user.MFAEnabled() {
+		return User{}, nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFA.PendingSecret == "" {
+		return User{}, nil, ErrMFANotPending
+	}
+
+	step, ok := totp.Validate(user.MFA.PendingSecret, code, time.Now(), 1)
+	if !ok {
+		return User{}, nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	user.MFA = MFA{
+		Secret:        user.MFA.PendingSecret,
+		EnabledAt:     &now,
+		RecoveryCodes: hashes,
+		LastStep:      step,
+	}
+	if err := store.EnableMFA(ctx, user.ID, user.MFA); err != nil {
+		return User{}, nil, err
+	}
+
+	logger.Info("ConfirmMFAEnrollment - Autenticación de dos factores activada", map[string]interface{}{
+		"user_id": userID,
+	})
+	return user, codes, nil
+}
+
+// Turn MFA off with a current code. Not allowed while a role requires it
+func DisableMFA(userID string, input MFACodeInput) error {
+	user, err := findUser(userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled() {
+		return ErrMFANotEnabled
+	}
+	if auth.RequiresMFA(user.RoleList()) {
+		return ErrMFARequired
+	}
+
+	if err := checkSecondFactor(&user, input); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.ClearMFA(ctx, user.ID, user.MFA.Secret); err != nil {
+		return err
+	}
+
+	logger.Info("DisableMFA - Autenticación de dos factores desactivada", map[string]interface{}{
+		"user_id": userID,
+	})
+	return nil
+}
+
+// Replace the recovery codes, invalidating the previous ones
+func RegenerateRecoveryCodes(userID string, input MFACodeInput) ([]string, error) {
+	user, err := findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled() {
+		return nil, ErrMFANotEnabled
+	}
+
+	if err := checkSecondFactor(&user, input); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.ReplaceRecoveryCodes(ctx, user.ID, user.MFA.Secret, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Token for the second step of a sign in, issued once the password matched
+func StartMFAChallenge(user User) (MFAChallenge, error) {
+	token, err := auth.IssueActionToken(auth.PurposeMFALogin, user.ID.Hex(), passwordBinding(user), mfaChallengeTTL)
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+
+	return MFAChallenge{
+		MFARequired:    true,
+		ChallengeToken: token,
+		ExpiresIn:      int(mfaChallengeTTL / time.Second),
+	}, nil
+}
+
+// Finish a sign in with the challenge token and a TOTP or recovery code.
+// The challenge works until a code is accepted
+func CompleteMFAChallenge(input MFALoginInput) (User, error) {
+	claims, err := auth.ParseActionToken(input.ChallengeToken, auth.PurposeMFALogin)
+	if err != nil {
+		return User{}, err
+	}
+
+	user, err := findUser(claims.Subject)
+	if errors.Is(err, ErrUserNotFound) || (err == nil && (claims.Binding != passwordBinding(user) || !user.MFAEnabled())) {
+		return User{}, auth.ErrInvalidActionToken
+	} else if err != nil {
+		return User{}, err
+	}
+
+	if err := checkSecondFactor(&user, input.MFACodeInput); err != nil {
+		return User{}, err
+	}
+	if err := auth.ConsumeActionToken(claims); err != nil {
+		return User{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user.LastSession = time.Now()
+	if err := store.RecordLogin(ctx, user.ID, user.LastSession); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// Check a TOTP or recovery code of the user. A TOTP code is accepted once and
+// a recovery code is spent, each with a conditional update so concurrent
+// requests cannot use the same code twice. Failures count towards a
+// temporary lockout. On success user reflects the stored second factor
+func checkSecondFactor(user *User, input MFACodeInput) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if user.MFA.LockedUntil != nil && now.Before(*user.MFA.LockedUntil) {
+		return ErrMFALocked
+	}
+
+	err := ErrInvalidMFACode
+	if input.Code != "" {
+		if step, ok := totp.Validate(user.MFA.Secret, input.Code, now, 1); ok {
+			if err = store.AcceptMFAStep(ctx, user.ID, step); err == nil {
+				user.MFA.LastStep = step
+			}
+		}
+	} else if input.RecoveryCode != "" {
+		hash := hashRecoveryCode(input.RecoveryCode)
+		if err = store.SpendRecoveryCode(ctx, user.ID, hash); err == nil {
+			for i, stored := range user.MFA.RecoveryCodes {
+				if stored == hash {
+					user.MFA.RecoveryCodes = append(user.MFA.RecoveryCodes[:i:i], user.MFA.RecoveryCodes[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	if err == nil {
+		user.MFA.FailedAttempts = 0
+		user.MFA.LockedUntil = nil
+		return nil
+	}
+	if !errors.Is(err, ErrInvalidMFACode) && !errors.Is(err, ErrMFACodeUsed) {
+		return err
+	}
+
+	until := now.Add(mfaLockout)
+	locked, err := store.RecordMFAFailure(ctx, user.ID, mfaMaxAttempts, until)
+	if err != nil {
+		return err
+	}
+	if locked {
+		logger.Error("checkSecondFactor - Segundo factor bloqueado por intentos fallidos", map[string]interface{}{
+			"user_id": user.ID.Hex(),
+			"until":   until,
+		})
+	}
+	return ErrInvalidMFACode
+}
+
+// Recovery codes in groups of four characters, with 80 random bits each
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// Codes are random enough for a plain SHA-256; dashes, spaces and case are ignored
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
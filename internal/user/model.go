@@ -3,27 +3,55 @@ package user
 import (
 	"time"
 
+	"github.com/clementeaf/bike-tracker/pkg/auth"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type User struct {
-	ID             primitive.ObjectID  `bson:"_id,omitempty"`
-	Name           string              `bson:"name"`
-	Email          string              `bson:"email"`
-	Password       string              `bson:"password"`
-	WalletBalance  float64             `bson:"wallet_balance"`
-	LastSession    time.Time           `bson:"last_session"`
-	LastBikeUsedID *primitive.ObjectID `bson:"last_bike_used_id,omitempty"`
+	ID              primitive.ObjectID  `bson:"_id,omitempty"`
+	Name            string              `bson:"name"`
+	Email           string              `bson:"email"`
+	Password        string              `bson:"password"`
+	LastSession     time.Time           `bson:"last_session"`
+	LastBikeUsedID  *primitive.ObjectID `bson:"last_bike_used_id,omitempty"`
+	Roles           []string            `bson:"roles,omitempty"`
+	EmailVerifiedAt *time.Time          `bson:"email_verified_at,omitempty"` // Nula hasta que sigue el enlace enviado al email
+	MFA             MFA                 `bson:"mfa"`
 }
 
-func NewUser(name, email, password string) User {
+// MFA is the TOTP second factor of a user
+type MFA struct {
+	Secret         string     `bson:"secret,omitempty"`         // Base32, vigente desde EnabledAt
+	PendingSecret  string     `bson:"pending_secret,omitempty"` // Enrolamiento sin confirmar
+	EnabledAt      *time.Time `bson:"enabled_at,omitempty"`
+	RecoveryCodes  []string   `bson:"recovery_codes,omitempty"` // SHA-256 de los códigos sin usar
+	LastStep       int64      `bson:"last_step,omitempty"`      // Último intervalo aceptado, para no repetir códigos
+	FailedAttempts int        `bson:"failed_attempts,omitempty"`
+	LockedUntil    *time.Time `bson:"locked_until,omitempty"`
+}
+
+// Whether sign in asks for a TOTP code after the password
+func (u User) MFAEnabled() bool {
+	return u.MFA.EnabledAt != nil
+}
+
+// Roles of the user. Users created before roles existed are riders
+func (u User) RoleList() []string {
+	if len(u.Roles) == 0 {
+		return []string{auth.RoleRider}
+	}
+	return u.Roles
+}
+
+// New rider. passwordHash must come from password.Hash, never a raw password
+func NewUser(name, email, passwordHash string) User {
 	return User{
 		ID:             primitive.NewObjectID(),
 		Name:           name,
 		Email:          email,
-		Password:       password,
-		WalletBalance:  0,
+		Password:       passwordHash,
 		LastSession:    time.Now(),
 		LastBikeUsedID: nil,
+		Roles:          []string{auth.RoleRider},
 	}
 }
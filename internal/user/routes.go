@@ -3,16 +3,30 @@ package user
 import (
 	"net/http"
 
+	"github.com/clementeaf/bike-tracker/pkg/auth"
 	"github.com/clementeaf/bike-tracker/pkg/middleware"
 )
 
 func RegisterRoutes(mux *http.ServeMux) {
 	// Public routes (no jwt)
-	mux.HandleFunc("/users/register", handleRegister)
-	mux.HandleFunc("/users/login", handleLogin)
+	mux.Handle("/users/register", middleware.Public(http.HandlerFunc(handleRegister)))
+	mux.Handle("/users/login", middleware.Public(http.HandlerFunc(handleLogin)))
+	mux.Handle("/users/login/mfa", middleware.Public(http.HandlerFunc(handleLoginMFA)))
+	mux.Handle("/users/token/refresh", middleware.Public(http.HandlerFunc(handleRefreshToken)))
+	mux.Handle("/users/email/verify", middleware.Public(http.HandlerFunc(handleVerifyEmail)))
+	mux.Handle("/users/password/forgot", middleware.Public(http.HandlerFunc(handleForgotPassword)))
+	mux.Handle("/users/password/reset", middleware.Public(http.HandlerFunc(handleResetPassword)))
 
 	// Protected routes (with jwt)
-	mux.Handle("/users/me", middleware.AuthMiddleware(http.HandlerFunc(handleGetMe)))
-	mux.Handle("/users/me/update", middleware.AuthMiddleware(http.HandlerFunc(handleUpdateUser)))
-	mux.Handle("/users/me/delete", middleware.AuthMiddleware(http.HandlerFunc(handleDeleteUser)))
+	mux.Handle("/users/logout", middleware.Authenticated(http.HandlerFunc(handleLogout)))
+	mux.Handle("/users/logout-all", middleware.Authenticated(http.HandlerFunc(handleLogoutAll)))
+	mux.Handle("/users/email/resend", middleware.Authenticated(http.HandlerFunc(handleResendVerification)))
+	mux.Handle("/users/mfa/enroll", middleware.Authenticated(http.HandlerFunc(handleMFAEnroll)))
+	mux.Handle("/users/mfa/confirm", middleware.Authenticated(http.HandlerFunc(handleMFAConfirm)))
+	mux.Handle("/users/mfa/disable", middleware.Authenticated(http.HandlerFunc(handleMFADisable)))
+	mux.Handle("/users/mfa/recovery-codes", middleware.Authenticated(http.HandlerFunc(handleMFARecoveryCodes)))
+	mux.Handle("/users/me", middleware.Authenticated(http.HandlerFunc(handleGetMe)))
+	mux.Handle("/users/me/update", middleware.Authenticated(http.HandlerFunc(handleUpdateUser)))
+	mux.Handle("/users/me/delete", middleware.Authenticated(http.HandlerFunc(handleDeleteUser)))
+	mux.Handle("/users/", middleware.RequirePermission(auth.PermUsersManage, http.HandlerFunc(handleSetRoles)))
 }
@@ -2,105 +2,194 @@ package user
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
+	"os"
+	"sync"
 	"time"
 
-	"github.com/clementeaf/bike-tracker/pkg/database"
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
 	"github.com/clementeaf/bike-tracker/pkg/logger"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"github.com/clementeaf/bike-tracker/pkg/password"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var (
+	ErrInvalidRoles = errors.New("roles inválidos: use rider, operator, fleet-admin, finance o support")
+	ErrOwnAdminRole = errors.New("no puede quitarse su propio rol fleet-admin")
+	ErrNoPassword   = errors.New("la contraseña es requerida")
+)
+
+// Hash checked when the email is not registered, so both cases take as long
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// Read the base of emailed links from APP_BASE_URL, REQUIRE_VERIFIED_EMAIL
+// and the MFA_ISSUER shown by authenticator apps
+func ConfigureFromEnv() {
+	if value := os.Getenv("APP_BASE_URL"); value != "" {
+		appBaseURL = value
+	}
+	requireVerifiedEmail = os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	if value := os.Getenv("MFA_ISSUER"); value != "" {
+		mfaIssuer = value
+	}
+}
+
 // New user to databse
 func RegisterUser(input RegisterUserInput) (User, error) {
-	userCollection := database.GetCollection("users")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	count, err := userCollection.CountDocuments(ctx, bson.M{"email": input.Email})
+	email, err := validateEmail(input.Email)
 	if err != nil {
 		return User{}, err
 	}
-	if count > 0 {
-		return User{}, errors.New("el email ya está registrado")
+
+	_, err = store.FindByEmail(ctx, email)
+	if err == nil {
+		return User{}, ErrEmailTaken
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return User{}, err
+	}
+
+	if input.Password == "" {
+		return User{}, ErrNoPassword
+	}
+	hashed, err := password.Hash(input.Password)
+	if err != nil {
+		return User{}, err
 	}
 
 	user := User{
 		ID:             primitive.NewObjectID(),
 		Name:           input.Name,
-		Email:          input.Email,
-		Password:       input.Password,
-		WalletBalance:  0.0,
+		Email:          email,
+		Password:       hashed,
 		LastSession:    time.Now(),
 		LastBikeUsedID: nil,
+		Roles:          []string{auth.RoleRider},
 	}
-
-	_, err = userCollection.InsertOne(ctx, user)
+	err = store.Insert(ctx, user)
 	if err != nil {
 		return User{}, err
 	}
 
+	if err := sendVerificationEmail(user); err != nil {
+		logger.Error("RegisterUser - Error al enviar la verificación de email", map[string]interface{}{
+			"user_id": user.ID.Hex(),
+			"error":   err.Error(),
+		})
+	}
+
 	return user, nil
 }
 
-// Login user
-func LoginUser(email, password string) (User, error) {
-	userCollection := database.GetCollection("users")
-
+// Login user. Legacy plaintext passwords and hashes with an outdated cost are
+// rehashed on a successful login
+func LoginUser(email, plain string) (User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var user User
-	err := userCollection.FindOne(ctx, bson.M{"email": email, "password": password}).Decode(&user)
-	if errors.Is(err, mongo.ErrNoDocuments) {
+	user, err := store.FindByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		dummyHashOnce.Do(func() { dummyHash, _ = password.Hash("dummy") })
+		password.Verify(plain, dummyHash)
 		return User{}, errors.New("email o contraseña incorrectos")
 	} else if err != nil {
 		return User{}, err
 	}
 
+	ok, needsRehash := checkPassword(user, plain)
+	if !ok {
+		return User{}, errors.New("email o contraseña incorrectos")
+	}
+
+	// Actualizaciones puntuales: reemplazar el usuario completo pisaría el
+	// estado del segundo factor que otra petición haya cambiado
+	if needsRehash {
+		hashed, err := password.Hash(plain)
+		if err == nil {
+			err = store.UpdatePassword(ctx, user.ID, user.Password, hashed)
+		}
+		if err == nil {
+			user.Password = hashed
+		} else {
+			logger.Error("LoginUser - Error al actualizar el hash de la contraseña", map[string]interface{}{
+				"user_id": user.ID.Hex(),
+				"error":   err.Error(),
+			})
+		}
+	}
+
 	user.LastSession = time.Now()
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"last_session": user.LastSession}})
-	if err != nil {
+	if err := store.RecordLogin(ctx, user.ID, user.LastSession); err != nil {
 		return User{}, err
 	}
 
 	return user, nil
 }
 
-// Add found to user wallet
-func AddWalletBalance(input WalletInput) (User, error) {
-	if input.Email == "" || input.Amount <= 0 {
-		return User{}, errors.New("email válido y monto positivo son obligatorios")
+// Whether plain matches the stored password, and whether the stored one has
+// to be rehashed
+func checkPassword(user User, plain string) (bool, bool) {
+	if !password.IsHash(user.Password) {
+		// Registro anterior al hash: se compara en texto plano y se migra
+		return user.Password != "" && subtle.ConstantTimeCompare([]byte(user.Password), []byte(plain)) == 1, true
 	}
 
-	userCollection := database.GetCollection("users")
+	ok, needsRehash, err := password.Verify(plain, user.Password)
+	if err != nil {
+		logger.Error("checkPassword - Hash de contraseña inválido", map[string]interface{}{
+			"user_id": user.ID.Hex(),
+			"error":   err.Error(),
+		})
+		return false, false
+	}
+	return ok, needsRehash
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Hash the passwords still stored in plaintext. Returns how many were
+// migrated; running it again skips the hashed ones
+func MigratePlaintextPasswords() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	var user User
-	err := userCollection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
-	if errors.Is(err, mongo.ErrNoDocuments) {
-		return User{}, errors.New("usuario no encontrado")
-	} else if err != nil {
-		return User{}, err
+	users, err := store.FindAll(ctx)
+	if err != nil {
+		return 0, errors.New("error al consultar usuarios: " + err.Error())
 	}
 
-	user.WalletBalance += input.Amount
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"wallet_balance": user.WalletBalance}})
-	if err != nil {
-		return User{}, err
+	migrated := 0
+	for _, user := range users {
+		if user.Password == "" || password.IsHash(user.Password) {
+			continue
+		}
+
+		hashed, err := password.Hash(user.Password)
+		if err != nil {
+			return migrated, err
+		}
+
+		// Si el usuario inició sesión mientras tanto su contraseña ya quedó con hash
+		err = store.UpdatePassword(ctx, user.ID, user.Password, hashed)
+		if errors.Is(err, ErrPasswordChanged) {
+			continue
+		} else if err != nil {
+			return migrated, errors.New("error al actualizar la contraseña de " + user.ID.Hex() + ": " + err.Error())
+		}
+		migrated++
 	}
 
-	return user, nil
+	return migrated, nil
 }
 
 // Get user by id
 func GetUserByID(userID string) (UserResponse, error) {
-	userCollection := database.GetCollection("users")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -113,9 +202,8 @@ func GetUserByID(userID string) (UserResponse, error) {
 		return UserResponse{}, errors.New("ID de usuario inválido")
 	}
 
-	var user User
-	err = userCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
-	if errors.Is(err, mongo.ErrNoDocuments) {
+	user, err := store.FindByID(ctx, objectID)
+	if errors.Is(err, ErrUserNotFound) {
 		logger.Error("GetUserByID - Usuario no encontrado", map[string]interface{}{
 			"user_id": userID,
 		})
@@ -133,13 +221,16 @@ func GetUserByID(userID string) (UserResponse, error) {
 		"email":   user.Email,
 	})
 
-	return ToUserResponse(user), nil
+	balance := money.FromMinor(0)
+	if userWallet, err := wallet.GetWallet(userID); err == nil {
+		balance = userWallet.Balance
+	}
+
+	return ToUserResponse(user, balance), nil
 }
 
 // Update user
 func UpdateUser(userID string, input UpdateUserInput) (UserResponse, error) {
-	userCollection := database.GetCollection("users")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -148,29 +239,148 @@ func UpdateUser(userID string, input UpdateUserInput) (UserResponse, error) {
 		return UserResponse{}, errors.New("ID de usuario inválido")
 	}
 
+	user, err := store.FindByID(ctx, objectID)
+	if err != nil {
+		return UserResponse{}, err
+	}
+
 	// Construir actualización
-	updateFields := bson.M{}
+	name, email := user.Name, user.Email
 	if input.Name != nil {
-		updateFields["name"] = *input.Name
+		name = *input.Name
 	}
-	if input.Email != nil {
-		updateFields["email"] = *input.Email
+	if input.Email != nil && *input.Email != user.Email {
+		validated, err := validateEmail(*input.Email)
+		if err != nil {
+			return UserResponse{}, err
+		}
+		if validated != user.Email {
+			if _, err := store.FindByEmail(ctx, validated); err == nil {
+				return UserResponse{}, ErrEmailTaken
+			} else if !errors.Is(err, ErrUserNotFound) {
+				return UserResponse{}, err
+			}
+		}
+		email = validated
 	}
 
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": updateFields})
-	if err != nil {
+	// El email nuevo se verifica de nuevo
+	emailChanged := email != user.Email
+	if err := store.UpdateProfile(ctx, user.ID, user.Email, name, email); err != nil {
 		return UserResponse{}, err
 	}
+	user.Name, user.Email = name, email
+
+	if emailChanged {
+		if err := sendVerificationEmail(user); err != nil {
+			logger.Error("UpdateUser - Error al enviar la verificación de email", map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			})
+		}
+	}
 
 	// Obtener el usuario actualizado
 	return GetUserByID(userID)
 }
 
+// Replace the roles of a user. An administrator cannot drop their own
+// fleet-admin role, so there is always one left
+func SetUserRoles(userID string, input RolesInput, actorID string) (UserResponse, error) {
+	roles := make([]string, 0, len(input.Roles))
+	seen := map[string]bool{}
+	for _, role := range input.Roles {
+		if !auth.ValidRole(role) {
+			return UserResponse{}, ErrInvalidRoles
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		return UserResponse{}, ErrInvalidRoles
+	}
+	if userID == actorID && !seen[auth.RoleFleetAdmin] {
+		return UserResponse{}, ErrOwnAdminRole
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return UserResponse{}, ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.FindByID(ctx, objectID)
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	if err := store.SetRoles(ctx, user.ID, user.Roles, roles); err != nil {
+		return UserResponse{}, err
+	}
+
+	return GetUserByID(userID)
+}
+
+// Roles a refreshed token carries; deleted users cannot refresh
+func currentRoles(userID string) ([]string, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.FindByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	return user.RoleList(), nil
+}
+
+// Add roles to the user with the email, keeping the ones it has. Used by
+// the grant-role command to create the first administrators
+func GrantRoles(email string, roles []string) (User, error) {
+	if len(roles) == 0 {
+		return User{}, ErrInvalidRoles
+	}
+	for _, role := range roles {
+		if !auth.ValidRole(role) {
+			return User{}, ErrInvalidRoles
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.FindByEmail(ctx, email)
+	if err != nil {
+		return User{}, err
+	}
+
+	current := user.RoleList()
+	for _, role := range roles {
+		held := false
+		for _, existing := range current {
+			held = held || existing == role
+		}
+		if !held {
+			current = append(current, role)
+		}
+	}
+	if err := store.SetRoles(ctx, user.ID, user.Roles, current); err != nil {
+		return User{}, err
+	}
+	user.Roles = current
+	return user, nil
+}
+
 // Delete user and its wallet
 func DeleteUser(userID string) error {
-	userCollection := database.GetCollection("users")
-	walletCollection := database.GetCollection("wallets")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -179,15 +389,22 @@ func DeleteUser(userID string) error {
 		return errors.New("ID de usuario inválido")
 	}
 
-	_, err = walletCollection.DeleteOne(ctx, bson.M{"user_id": objectID.Hex()})
-	if err != nil && err != mongo.ErrNoDocuments {
+	err = wallet.DeleteWalletByUserID(objectID)
+	if err != nil {
 		return errors.New("error al eliminar la wallet del usuario: " + err.Error())
 	}
 
-	_, err = userCollection.DeleteOne(ctx, bson.M{"_id": objectID})
+	err = store.Delete(ctx, objectID)
 	if err != nil {
 		return errors.New("error al eliminar el usuario: " + err.Error())
 	}
 
+	if _, err := auth.EndAllSessions(userID); err != nil {
+		logger.Error("DeleteUser - Error al cerrar las sesiones", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+	}
+
 	return nil
 }
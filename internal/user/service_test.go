@@ -0,0 +1,253 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/internal/wallet"
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/totp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fresh stores with a rider whose email is verified. A signing key lets the
+// services issue verification links
+func setupUser(t *testing.T) (*MemoryStore, User) {
+	t.Helper()
+	if err := auth.ConfigureKeys(nil, strings.Repeat("k", 64), "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	memory := NewMemoryStore()
+	SetStore(memory)
+	wallet.SetStore(wallet.NewMemoryStore())
+
+	verified := time.Now()
+	user := NewUser("Ana", "ana@example.com", "hash")
+	user.EmailVerifiedAt = &verified
+	if err := memory.Insert(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return memory, user
+}
+
+func storedUser(t *testing.T, id primitive.ObjectID) User {
+	t.Helper()
+	user, err := store.FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestConditionalUpdates(t *testing.T) {
+	ctx := context.Background()
+	enabled := time.Now()
+
+	tests := []struct {
+		name    string
+		mfa     MFA // Segundo factor guardado antes de actualizar
+		update  func(s *MemoryStore, id primitive.ObjectID) error
+		wantErr error
+	}{
+		{name: "profile", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.UpdateProfile(ctx, id, "ana@example.com", "Ana María", "ana@example.com")
+		}},
+		{name: "profile with a stale email", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.UpdateProfile(ctx, id, "old@example.com", "Ana María", "new@example.com")
+		}, wantErr: ErrUserChanged},
+		{name: "roles", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.SetRoles(ctx, id, []string{auth.RoleRider}, []string{auth.RoleSupport})
+		}},
+		{name: "roles with stale roles", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.SetRoles(ctx, id, []string{auth.RoleSupport}, []string{auth.RoleRider})
+		}, wantErr: ErrUserChanged},
+		{name: "email already verified", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.MarkEmailVerified(ctx, id, "ana@example.com", time.Now())
+		}, wantErr: ErrUserChanged},
+		{name: "pending secret", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.SetPendingMFASecret(ctx, id, "SECRET")
+		}},
+		{name: "pending secret with MFA on", mfa: MFA{Secret: "A", EnabledAt: &enabled}, update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.SetPendingMFASecret(ctx, id, "SECRET")
+		}, wantErr: ErrUserChanged},
+		{name: "enable", mfa: MFA{PendingSecret: "A"}, update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.EnableMFA(ctx, id, MFA{Secret: "A", EnabledAt: &enabled})
+		}},
+		{name: "enable another secret", mfa: MFA{PendingSecret: "B"}, update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.EnableMFA(ctx, id, MFA{Secret: "A", EnabledAt: &enabled})
+		}, wantErr: ErrUserChanged},
+		{name: "clear", mfa: MFA{Secret: "A", EnabledAt: &enabled}, update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.ClearMFA(ctx, id, "A")
+		}},
+		{name: "clear after a new enrollment", mfa: MFA{Secret: "B", EnabledAt: &enabled}, update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.ClearMFA(ctx, id, "A")
+		}, wantErr: ErrUserChanged},
+		{name: "recovery codes", mfa: MFA{Secret: "A", EnabledAt: &enabled}, update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.ReplaceRecoveryCodes(ctx, id, "A", []string{"x"})
+		}},
+		{name: "recovery codes with MFA off", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.ReplaceRecoveryCodes(ctx, id, "", []string{"x"})
+		}, wantErr: ErrUserChanged},
+		{name: "unknown user", update: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.SetPendingMFASecret(ctx, primitive.NewObjectID(), "SECRET")
+		}, wantErr: ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory, user := setupUser(t)
+			user.MFA = tt.mfa
+			memory.users[user.ID] = user
+
+			if err := tt.update(memory, user.ID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("update = %v, want %v", err, tt.wantErr)
+			}
+			// Un conflicto deja el usuario como estaba
+			if tt.wantErr != nil {
+				if stored := storedUser(t, user.ID); stored.Name != user.Name || stored.MFA.PendingSecret != user.MFA.PendingSecret ||
+					len(stored.Roles) != len(user.Roles) || len(stored.MFA.RecoveryCodes) != 0 {
+					t.Errorf("user = %+v, want %+v", stored, user)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	memory, user := setupUser(t)
+	other := NewUser("Bea", "bea@example.com", "hash")
+	if err := memory.Insert(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "Ana María"
+	if _, err := UpdateUser(user.ID.Hex(), UpdateUserInput{Name: &name}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedUser(t, user.ID); stored.Name != name || stored.EmailVerifiedAt == nil {
+		t.Errorf("after a new name: %+v", stored)
+	}
+
+	// El email nuevo queda sin verificar
+	email := "ana.maria@example.com"
+	if _, err := UpdateUser(user.ID.Hex(), UpdateUserInput{Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedUser(t, user.ID); stored.Email != email || stored.Name != name || stored.EmailVerifiedAt != nil {
+		t.Errorf("after a new email: %+v", stored)
+	}
+
+	taken := "bea@example.com"
+	if _, err := UpdateUser(user.ID.Hex(), UpdateUserInput{Email: &taken}); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("UpdateUser(taken email) = %v, want ErrEmailTaken", err)
+	}
+}
+
+func TestGrantRoles(t *testing.T) {
+	memory, user := setupUser(t)
+
+	// Usuario creado antes de que existieran los roles
+	user.Roles = nil
+	memory.users[user.ID] = user
+
+	granted, err := GrantRoles(user.Email, []string{auth.RoleFleetAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{auth.RoleRider, auth.RoleFleetAdmin}
+	if stored := storedUser(t, user.ID); len(stored.Roles) != 2 || stored.Roles[0] != want[0] || stored.Roles[1] != want[1] || len(granted.Roles) != 2 {
+		t.Errorf("roles = %v, want %v", stored.Roles, want)
+	}
+
+	if _, err := GrantRoles(user.Email, []string{"captain"}); !errors.Is(err, ErrInvalidRoles) {
+		t.Errorf("GrantRoles(unknown role) = %v, want ErrInvalidRoles", err)
+	}
+}
+
+// Store that runs a competing write right before enabling the second factor
+type racingStore struct {
+	*MemoryStore
+	race func()
+}
+
+func (s *racingStore) EnableMFA(ctx context.Context, id primitive.ObjectID, mfa MFA) error {
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return s.MemoryStore.EnableMFA(ctx, id, mfa)
+}
+
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	_, user := setupUser(t)
+
+	enrollment, err := BeginMFAEnrollment(user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, codes, err := ConfirmMFAEnrollment(user.ID.Hex(), currentCode(t, enrollment.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedUser(t, user.ID); !stored.MFAEnabled() || stored.MFA.Secret != enrollment.Secret || stored.Name != user.Name {
+		t.Fatalf("after confirming: %+v", stored)
+	}
+	if _, err := BeginMFAEnrollment(user.ID.Hex()); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("BeginMFAEnrollment(enabled) = %v, want ErrMFAAlreadyEnabled", err)
+	}
+
+	replaced, err := RegenerateRecoveryCodes(user.ID.Hex(), MFACodeInput{RecoveryCode: codes[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedUser(t, user.ID); len(stored.MFA.RecoveryCodes) != len(replaced) {
+		t.Errorf("recovery codes = %d, want %d", len(stored.MFA.RecoveryCodes), len(replaced))
+	}
+
+	// Los códigos anteriores dejan de servir
+	if err := DisableMFA(user.ID.Hex(), MFACodeInput{RecoveryCode: codes[1]}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("DisableMFA(old code) = %v, want ErrInvalidMFACode", err)
+	}
+	if err := DisableMFA(user.ID.Hex(), MFACodeInput{RecoveryCode: replaced[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedUser(t, user.ID); stored.MFAEnabled() || stored.EmailVerifiedAt == nil {
+		t.Errorf("after disabling: %+v", stored)
+	}
+}
+
+func TestConfirmMFAEnrollmentAfterNewEnrollment(t *testing.T) {
+	memory, user := setupUser(t)
+	racing := &racingStore{MemoryStore: memory}
+	SetStore(racing)
+
+	enrollment, err := BeginMFAEnrollment(user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Otra pestaña empieza un enrolamiento nuevo mientras se confirma el primero
+	racing.race = func() {
+		if _, err := BeginMFAEnrollment(user.ID.Hex()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := ConfirmMFAEnrollment(user.ID.Hex(), currentCode(t, enrollment.Secret)); !errors.Is(err, ErrUserChanged) {
+		t.Fatalf("ConfirmMFAEnrollment() = %v, want ErrUserChanged", err)
+	}
+	if stored := storedUser(t, user.ID); stored.MFAEnabled() {
+		t.Error("enabled a secret that is no longer pending")
+	}
+}
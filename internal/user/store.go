@@ -0,0 +1,65 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUserNotFound    = errors.New("usuario no encontrado")
+	ErrPasswordChanged = errors.New("la contraseña cambió mientras se actualizaba")
+	ErrMFACodeUsed     = errors.New("el código de verificación ya fue usado")
+	ErrUserChanged     = errors.New("el usuario cambió mientras se actualizaba, intente nuevamente")
+)
+
+// UserStore abstracts the persistence of users
+type UserStore interface {
+	Insert(ctx context.Context, user User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (User, error)
+	FindByEmail(ctx context.Context, email string) (User, error)
+	FindAll(ctx context.Context) ([]User, error)
+	// Each update below changes only its fields and only while the user is
+	// still as the caller read it, failing with ErrUserChanged otherwise
+
+	// Set the name and email while the email is still currentEmail. A new
+	// email is left unverified
+	UpdateProfile(ctx context.Context, id primitive.ObjectID, currentEmail, name, email string) error
+	// Replace the roles while they are still current (empty for users created
+	// before roles existed)
+	SetRoles(ctx context.Context, id primitive.ObjectID, current, roles []string) error
+	// Mark the email verified while it is still email and unverified
+	MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string, at time.Time) error
+	// Store the secret of an enrollment while the second factor is off
+	SetPendingMFASecret(ctx context.Context, id primitive.ObjectID, secret string) error
+	// Turn on the second factor while it is off and its pending secret is
+	// still mfa.Secret
+	EnableMFA(ctx context.Context, id primitive.ObjectID, mfa MFA) error
+	// Turn off the second factor while secret is still the active one
+	ClearMFA(ctx context.Context, id primitive.ObjectID, secret string) error
+	// Replace the recovery codes while secret is still the active one
+	ReplaceRecoveryCodes(ctx context.Context, id primitive.ObjectID, secret string, hashes []string) error
+	// Replace the stored password only if it is still current
+	UpdatePassword(ctx context.Context, id primitive.ObjectID, current, replacement string) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Set the time of the last sign in, leaving the rest of the user untouched
+	RecordLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// Record the interval of an accepted TOTP code only if it is newer than the
+	// last one accepted, failing with ErrMFACodeUsed otherwise. Clears the failures
+	AcceptMFAStep(ctx context.Context, id primitive.ObjectID, step int64) error
+	// Remove a recovery code only if it is still unused, failing with
+	// ErrMFACodeUsed otherwise. Clears the failures
+	SpendRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error
+	// Count a rejected code; on reaching maxAttempts the second factor is locked
+	// until lockedUntil and the count starts over. Reports whether it locked
+	RecordMFAFailure(ctx context.Context, id primitive.ObjectID, maxAttempts int, lockedUntil time.Time) (bool, error)
+}
+
+var store UserStore
+
+// Inject the store used by the user services
+func SetStore(s UserStore) {
+	store = s
+}
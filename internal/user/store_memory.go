@@ -0,0 +1,243 @@
+package user
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps users in memory, for tests and local demos
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]User
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[primitive.ObjectID]User)}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *MemoryStore) FindByID(ctx context.Context, id primitive.ObjectID) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) FindByEmail(ctx context.Context, email string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (s *MemoryStore) FindAll(ctx context.Context) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) UpdateProfile(ctx context.Context, id primitive.ObjectID, currentEmail, name, email string) error {
+	return s.updateIf(id, func(user *User) bool {
+		if user.Email != currentEmail {
+			return false
+		}
+		user.Name = name
+		user.Email = email
+		if email != currentEmail {
+			user.EmailVerifiedAt = nil
+		}
+		return true
+	})
+}
+
+func (s *MemoryStore) SetRoles(ctx context.Context, id primitive.ObjectID, current, roles []string) error {
+	return s.updateIf(id, func(user *User) bool {
+		if !slices.Equal(user.Roles, current) {
+			return false
+		}
+		user.Roles = append([]string(nil), roles...)
+		return true
+	})
+}
+
+func (s *MemoryStore) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string, at time.Time) error {
+	return s.updateIf(id, func(user *User) bool {
+		if user.Email != email || user.EmailVerifiedAt != nil {
+			return false
+		}
+		user.EmailVerifiedAt = &at
+		return true
+	})
+}
+
+func (s *MemoryStore) SetPendingMFASecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	return s.updateIf(id, func(user *User) bool {
+		if user.MFAEnabled() {
+			return false
+		}
+		user.MFA.PendingSecret = secret
+		return true
+	})
+}
+
+func (s *MemoryStore) EnableMFA(ctx context.Context, id primitive.ObjectID, mfa MFA) error {
+	return s.updateIf(id, func(user *User) bool {
+		if user.MFAEnabled() || user.MFA.PendingSecret != mfa.Secret {
+			return false
+		}
+		user.MFA = mfa
+		return true
+	})
+}
+
+func (s *MemoryStore) ClearMFA(ctx context.Context, id primitive.ObjectID, secret string) error {
+	return s.updateIf(id, func(user *User) bool {
+		if !user.MFAEnabled() || user.MFA.Secret != secret {
+			return false
+		}
+		user.MFA = MFA{}
+		return true
+	})
+}
+
+func (s *MemoryStore) ReplaceRecoveryCodes(ctx context.Context, id primitive.ObjectID, secret string, hashes []string) error {
+	return s.updateIf(id, func(user *User) bool {
+		if !user.MFAEnabled() || user.MFA.Secret != secret {
+			return false
+		}
+		user.MFA.RecoveryCodes = append([]string(nil), hashes...)
+		return true
+	})
+}
+
+// Apply change to a user, saving it only if change reports that the user was
+// as expected. Fails with ErrUserChanged otherwise
+func (s *MemoryStore) updateIf(id primitive.ObjectID, change func(user *User) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if !change(&user) {
+		return ErrUserChanged
+	}
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) UpdatePassword(ctx context.Context, id primitive.ObjectID, current, replacement string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok || user.Password != current {
+		return ErrPasswordChanged
+	}
+	user.Password = replacement
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, id)
+	return nil
+}
+
+func (s *MemoryStore) RecordLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.LastSession = at
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) AcceptMFAStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if step <= user.MFA.LastStep {
+		return ErrMFACodeUsed
+	}
+	user.MFA.LastStep = step
+	user.MFA.FailedAttempts = 0
+	user.MFA.LockedUntil = nil
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) SpendRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for i, stored := range user.MFA.RecoveryCodes {
+		if stored == hash {
+			user.MFA.RecoveryCodes = append(user.MFA.RecoveryCodes[:i:i], user.MFA.RecoveryCodes[i+1:]...)
+			user.MFA.FailedAttempts = 0
+			user.MFA.LockedUntil = nil
+			s.users[id] = user
+			return nil
+		}
+	}
+	return ErrMFACodeUsed
+}
+
+func (s *MemoryStore) RecordMFAFailure(ctx context.Context, id primitive.ObjectID, maxAttempts int, lockedUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return false, ErrUserNotFound
+	}
+	user.MFA.FailedAttempts++
+	locked := user.MFA.FailedAttempts >= maxAttempts
+	if locked {
+		user.MFA.LockedUntil = &lockedUntil
+		user.MFA.FailedAttempts = 0
+	}
+	s.users[id] = user
+	return locked, nil
+}
@@ -0,0 +1,207 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists users in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Insert(ctx context.Context, user User) error {
+	_, err := s.collection.InsertOne(ctx, user)
+	return err
+}
+
+func (s *MongoStore) FindByID(ctx context.Context, id primitive.ObjectID) (User, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *MongoStore) FindByEmail(ctx context.Context, email string) (User, error) {
+	return s.findOne(ctx, bson.M{"email": email})
+}
+
+func (s *MongoStore) FindAll(ctx context.Context) ([]User, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	users := []User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *MongoStore) UpdateProfile(ctx context.Context, id primitive.ObjectID, currentEmail, name, email string) error {
+	update := bson.M{"$set": bson.M{"name": name, "email": email}}
+	if email != currentEmail {
+		update["$unset"] = bson.M{"email_verified_at": ""}
+	}
+	return s.updateIf(ctx, id, bson.M{"_id": id, "email": currentEmail}, update, ErrUserChanged)
+}
+
+func (s *MongoStore) SetRoles(ctx context.Context, id primitive.ObjectID, current, roles []string) error {
+	filter := bson.M{"_id": id, "roles": current}
+	if len(current) == 0 {
+		// null también coincide con el campo ausente
+		filter = bson.M{"_id": id, "$or": bson.A{bson.M{"roles": nil}, bson.M{"roles": bson.A{}}}}
+	}
+	return s.updateIf(ctx, id, filter, bson.M{"$set": bson.M{"roles": roles}}, ErrUserChanged)
+}
+
+func (s *MongoStore) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string, at time.Time) error {
+	return s.updateIf(ctx, id,
+		bson.M{"_id": id, "email": email, "email_verified_at": nil},
+		bson.M{"$set": bson.M{"email_verified_at": at}},
+		ErrUserChanged,
+	)
+}
+
+func (s *MongoStore) SetPendingMFASecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	return s.updateIf(ctx, id,
+		bson.M{"_id": id, "mfa.enabled_at": nil},
+		bson.M{"$set": bson.M{"mfa.pending_secret": secret}},
+		ErrUserChanged,
+	)
+}
+
+func (s *MongoStore) EnableMFA(ctx context.Context, id primitive.ObjectID, mfa MFA) error {
+	return s.updateIf(ctx, id,
+		bson.M{"_id": id, "mfa.enabled_at": nil, "mfa.pending_secret": mfa.Secret},
+		bson.M{"$set": bson.M{"mfa": mfa}},
+		ErrUserChanged,
+	)
+}
+
+func (s *MongoStore) ClearMFA(ctx context.Context, id primitive.ObjectID, secret string) error {
+	return s.updateIf(ctx, id,
+		bson.M{"_id": id, "mfa.enabled_at": bson.M{"$ne": nil}, "mfa.secret": secret},
+		bson.M{"$set": bson.M{"mfa": MFA{}}},
+		ErrUserChanged,
+	)
+}
+
+func (s *MongoStore) ReplaceRecoveryCodes(ctx context.Context, id primitive.ObjectID, secret string, hashes []string) error {
+	return s.updateIf(ctx, id,
+		bson.M{"_id": id, "mfa.enabled_at": bson.M{"$ne": nil}, "mfa.secret": secret},
+		bson.M{"$set": bson.M{"mfa.recovery_codes": hashes}},
+		ErrUserChanged,
+	)
+}
+
+func (s *MongoStore) UpdatePassword(ctx context.Context, id primitive.ObjectID, current, replacement string) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "password": current},
+		bson.M{"$set": bson.M{"password": replacement}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPasswordChanged
+	}
+	return nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (s *MongoStore) RecordLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_session": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Fields reset when a second factor code is accepted
+var clearMFAFailures = bson.M{"mfa.failed_attempts": "", "mfa.locked_until": ""}
+
+func (s *MongoStore) AcceptMFAStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	// last_step se omite mientras vale cero
+	filter := bson.M{"_id": id, "$or": bson.A{
+		bson.M{"mfa.last_step": bson.M{"$lt": step}},
+		bson.M{"mfa.last_step": bson.M{"$exists": false}},
+	}}
+	return s.updateIf(ctx, id, filter, bson.M{
+		"$set":   bson.M{"mfa.last_step": step},
+		"$unset": clearMFAFailures,
+	}, ErrMFACodeUsed)
+}
+
+func (s *MongoStore) SpendRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return s.updateIf(ctx, id, bson.M{"_id": id, "mfa.recovery_codes": hash}, bson.M{
+		"$pull":  bson.M{"mfa.recovery_codes": hash},
+		"$unset": clearMFAFailures,
+	}, ErrMFACodeUsed)
+}
+
+func (s *MongoStore) RecordMFAFailure(ctx context.Context, id primitive.ObjectID, maxAttempts int, lockedUntil time.Time) (bool, error) {
+	var user User
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"mfa.failed_attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, ErrUserNotFound
+	} else if err != nil {
+		return false, err
+	}
+	if user.MFA.FailedAttempts < maxAttempts {
+		return false, nil
+	}
+
+	// Solo el fallo que alcanza el máximo bloquea y reinicia la cuenta
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "mfa.failed_attempts": bson.M{"$gte": maxAttempts}},
+		bson.M{"$set": bson.M{"mfa.locked_until": lockedUntil}, "$unset": bson.M{"mfa.failed_attempts": ""}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// Apply a conditional update, telling a missing user from a condition that
+// no longer holds, which fails with conflict
+func (s *MongoStore) updateIf(ctx context.Context, id primitive.ObjectID, filter, update bson.M, conflict error) error {
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.FindByID(ctx, id); err != nil {
+			return err
+		}
+		return conflict
+	}
+	return nil
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (User, error) {
+	var user User
+	err := s.collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
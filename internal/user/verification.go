@@ -0,0 +1,289 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	mailer "github.com/clementeaf/bike-tracker/pkg/mail"
+	"github.com/clementeaf/bike-tracker/pkg/password"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidEmail         = errors.New("email inválido")
+	ErrEmailTaken           = errors.New("el email ya está registrado")
+	ErrEmailAlreadyVerified = errors.New("el email ya está verificado")
+	ErrEmailNotVerified     = errors.New("debe verificar su email antes de iniciar un viaje")
+)
+
+const (
+	verificationTokenTTL = 48 * time.Hour
+	resetTokenTTL        = 30 * time.Minute
+)
+
+var (
+	sender mailer.Sender
+
+	// Base of the links sent by email (APP_BASE_URL)
+	appBaseURL = "http://localhost:8080"
+
+	// Whether riders must verify their email to start rides (REQUIRE_VERIFIED_EMAIL)
+	requireVerifiedEmail bool
+)
+
+// Inject the sender of verification and password reset emails
+func SetMailer(s mailer.Sender) {
+	sender = s
+}
+
+// Trimmed email, rejecting anything that is not a bare address
+func validateEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// Send a link that verifies the current email of the user
+func sendVerificationEmail(user User) error {
+	token, err := auth.IssueActionToken(auth.PurposeVerifyEmail, user.ID.Hex(), binding(strings.ToLower(user.Email)), verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	deliver(mailer.Message{
+		To:      user.Email,
+		Subject: "Verifica tu email",
+		Body: "Hola " + user.Name + ",\n\n" +
+			"Para verificar tu email abre este enlace:\n\n" +
+			link("/verify-email", token) + "\n\n" +
+			"El enlace vence en 48 horas. Si no creaste una cuenta, ignora este mensaje.\n",
+	})
+	return nil
+}
+
+// Send the verification link again to the authenticated user
+func ResendVerificationEmail(userID string) error {
+	user, err := findUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return sendVerificationEmail(user)
+}
+
+// Mark the email of the token as verified. The token stops working if the
+// email changed after it was sent
+func VerifyEmail(token string) error {
+	claims, err := auth.ParseActionToken(token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	user, err := findUser(claims.Subject)
+	if errors.Is(err, ErrUserNotFound) || (err == nil && claims.Binding != binding(strings.ToLower(user.Email))) {
+		return auth.ErrInvalidActionToken
+	} else if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	if err := auth.ConsumeActionToken(claims); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.MarkEmailVerified(ctx, user.ID, user.Email, time.Now()); err != nil {
+		return err
+	}
+
+	logger.Info("VerifyEmail - Email verificado", map[string]interface{}{
+		"user_id": user.ID.Hex(),
+	})
+	return nil
+}
+
+// Email a password reset link. Unknown emails are ignored silently so the
+// response does not reveal who is registered
+func RequestPasswordReset(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.FindByEmail(ctx, strings.TrimSpace(email))
+	if errors.Is(err, ErrUserNotFound) {
+		logger.Info("RequestPasswordReset - Email no registrado", map[string]interface{}{
+			"email": email,
+		})
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := auth.IssueActionToken(auth.PurposeResetPassword, user.ID.Hex(), passwordBinding(user), resetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	deliver(mailer.Message{
+		To:      user.Email,
+		Subject: "Restablece tu contraseña",
+		Body: "Hola " + user.Name + ",\n\n" +
+			"Para elegir una nueva contraseña abre este enlace:\n\n" +
+			link("/reset-password", token) + "\n\n" +
+			"El enlace vence en 30 minutos y solo puede usarse una vez. Si no lo pediste, ignora este mensaje.\n",
+	})
+	return nil
+}
+
+// Replace the password of the token's user and close all their sessions.
+// Following the link also proves the email, so it is marked verified
+func ResetPassword(input ResetPasswordInput) error {
+	if input.Password == "" {
+		return ErrNoPassword
+	}
+
+	claims, err := auth.ParseActionToken(input.Token, auth.PurposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	// El token queda atado al hash vigente: al cambiar la contraseña deja de servir
+	user, err := findUser(claims.Subject)
+	if errors.Is(err, ErrUserNotFound) || (err == nil && claims.Binding != passwordBinding(user)) {
+		return auth.ErrInvalidActionToken
+	} else if err != nil {
+		return err
+	}
+
+	hashed, err := password.Hash(input.Password)
+	if err != nil {
+		return err
+	}
+	if err := auth.ConsumeActionToken(claims); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.UpdatePassword(ctx, user.ID, user.Password, hashed); errors.Is(err, ErrPasswordChanged) {
+		return auth.ErrInvalidActionToken
+	} else if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := store.MarkEmailVerified(ctx, user.ID, user.Email, time.Now()); err != nil {
+			logger.Error("ResetPassword - Error al marcar el email verificado", map[string]interface{}{
+				"user_id": user.ID.Hex(),
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	closed, err := auth.EndAllSessions(user.ID.Hex())
+	if err != nil {
+		logger.Error("ResetPassword - Error al cerrar las sesiones", map[string]interface{}{
+			"user_id": user.ID.Hex(),
+			"error":   err.Error(),
+		})
+	}
+
+	logger.Info("ResetPassword - Contraseña restablecida", map[string]interface{}{
+		"user_id":         user.ID.Hex(),
+		"sessions_closed": closed,
+	})
+	return nil
+}
+
+// Refuse riders whose email is not verified, when REQUIRE_VERIFIED_EMAIL is on
+func RequireVerifiedEmail(userID primitive.ObjectID) error {
+	if !requireVerifiedEmail {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+func findUser(userID string) (User, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return User{}, ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.FindByID(ctx, objectID)
+}
+
+// Send in the background, so the response time does not depend on the mail
+// server nor reveal whether an email is registered
+func deliver(message mailer.Message) {
+	if sender == nil {
+		logger.Error("deliver - No hay servicio de correo configurado", map[string]interface{}{
+			"to":      message.To,
+			"subject": message.Subject,
+		})
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := sender.Send(ctx, message); err != nil {
+			logger.Error("deliver - Error al enviar correo", map[string]interface{}{
+				"to":      message.To,
+				"subject": message.Subject,
+				"error":   err.Error(),
+			})
+		}
+	}()
+}
+
+func link(path, token string) string {
+	return strings.TrimRight(appBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// Legacy plaintext passwords are left out of the token, where they could be
+// brute forced; the rehash on login changes the binding anyway
+func passwordBinding(user User) string {
+	if !password.IsHash(user.Password) {
+		return binding("legacy:" + user.ID.Hex())
+	}
+	return binding(user.Password)
+}
+
+// Fingerprint of the state a token is tied to, so the token does not carry
+// the email or the password hash itself
+func binding(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
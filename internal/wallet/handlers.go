@@ -7,6 +7,7 @@ import (
 	"github.com/clementeaf/bike-tracker/pkg/auth"
 	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
 	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
 )
 
 // POST Add found to wallet
@@ -21,10 +22,10 @@ func HandleAddTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		WalletID string  `json:"wallet_id"`
-		UserID   string  `json:"user_id"`
-		Amount   float64 `json:"amount"`
-		Type     string  `json:"type"`
+		WalletID string      `json:"wallet_id"`
+		UserID   string      `json:"user_id"`
+		Amount   money.Money `json:"amount"`
+		Type     string      `json:"type"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -37,7 +38,7 @@ func HandleAddTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.WalletID == "" || input.UserID == "" || input.Amount <= 0 || (input.Type != "credit" && input.Type != "debit") {
+	if input.WalletID == "" || input.UserID == "" || !input.Amount.IsPositive() || (input.Type != "credit" && input.Type != "debit") {
 		httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
 			"error": "Faltan datos requeridos o son inválidos",
 		})
@@ -130,7 +131,7 @@ func HandleGetTransactionHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	transactions, err := auth.GetAuthenticatedUserID(r)
+	transactions, err := GetTransactionHistory(userID)
 	if err != nil {
 		httpresponse.SendJSONResponse(w, http.StatusNotFound, map[string]string{
 			"error": "No se encontraron transacciones",
@@ -172,9 +173,68 @@ func HandleGetWalletBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]float64{"balance": wallet.Balance})
+	httpresponse.SendJSONResponse(w, http.StatusOK, map[string]money.Money{
+		"balance":   wallet.Balance,
+		"held":      wallet.Held,
+		"available": wallet.Available(),
+	})
 	logger.Info("GET /wallet/balance - Balance obtenido exitosamente", map[string]interface{}{
-		"user_id": userID,
-		"balance": wallet.Balance,
+		"user_id":   userID,
+		"balance":   wallet.Balance.String(),
+		"available": wallet.Available().String(),
+	})
+}
+
+// GET Verify ledger consistency
+func HandleVerifyLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	report, err := VerifyLedger()
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al verificar el libro contable",
+		})
+		logger.Error("GET /wallet/ledger/verify - Error al verificar", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, report)
+	logger.Info("GET /wallet/ledger/verify - Libro contable verificado", map[string]interface{}{
+		"entries":    report.Entries,
+		"mismatches": len(report.Mismatches),
+		"consistent": report.Consistent,
+	})
+}
+
+// POST Rebuild cached balances from the ledger
+func HandleRebuildBalances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpresponse.SendJSONResponse(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "Método no permitido",
+		})
+		return
+	}
+
+	report, err := RebuildBalances()
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al reconstruir los saldos",
+		})
+		logger.Error("POST /wallet/ledger/rebuild - Error al reconstruir", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpresponse.SendJSONResponse(w, http.StatusOK, report)
+	logger.Info("POST /wallet/ledger/rebuild - Saldos reconstruidos", map[string]interface{}{
+		"consistent": report.Consistent,
 	})
 }
@@ -0,0 +1,272 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reserve funds of the wallet of a user until the hold is captured, released
+// or expires. Fails with ErrInsufficientFunds if the available balance is short
+func PlaceHold(userID string, amount money.Money, reference string, ttl time.Duration) (*Hold, error) {
+	if amount.IsNegative() {
+		return nil, errors.New("el monto no puede ser negativo")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("ID de usuario inválido")
+	}
+
+	wallet, err := store.FindWalletByUserID(ctx, userObjectID)
+	if err != nil {
+		return nil, errors.New("wallet no encontrada")
+	}
+
+	now := time.Now()
+	hold := Hold{
+		ID:        primitive.NewObjectID(),
+		WalletID:  wallet.ID,
+		UserID:    wallet.UserID,
+		Reference: reference,
+		Amount:    amount,
+		Status:    HoldActive,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := store.AdjustHeld(ctx, wallet.ID, amount, now); err != nil {
+		return nil, err
+	}
+
+	if err := store.InsertHold(ctx, hold); err != nil {
+		if rollbackErr := store.AdjustHeld(ctx, wallet.ID, amount.Neg(), time.Now()); rollbackErr != nil {
+			logger.Error("PlaceHold - Error al revertir la retención", map[string]interface{}{
+				"wallet_id": wallet.ID.Hex(),
+				"reference": reference,
+				"error":     rollbackErr.Error(),
+			})
+		}
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// Charge the fare of a ride for its hold, freeing what was reserved. The
+// amount may exceed the hold and the available balance: the ride already
+// happened, so whatever is missing is left as a negative balance. Returns
+// nil when nothing was charged
+func CaptureHold(reference string, amount money.Money) (*Transaction, error) {
+	return captureHold(reference, amount, EntryRideFee, true)
+}
+
+// Charge the no-show fee of an expired bike reservation from its hold
+func CaptureReservationFee(reference string, amount money.Money) (*Transaction, error) {
+	return captureHold(reference, amount, EntryReservationFee, false)
+}
+
+func captureHold(reference string, amount money.Money, kind string, overdraft bool) (*Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hold, err := store.FindHoldByReference(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status == HoldCaptured {
+		return nil, ErrHoldConflict
+	}
+
+	wallet, err := store.FindWalletByID(ctx, hold.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	captured := hold
+	captured.Status = HoldCaptured
+	captured.CapturedAmount = amount
+	captured.UpdatedAt = time.Now()
+	if err := store.UpdateHoldIfStatus(ctx, captured, hold.Status); err != nil {
+		return nil, err
+	}
+
+	// Liberar lo reservado antes de cobrar, así el cargo puede usarlo
+	wasActive := hold.Status == HoldActive
+	if wasActive {
+		if err := store.AdjustHeld(ctx, wallet.ID, hold.Amount.Neg(), time.Now()); err != nil {
+			_ = store.UpdateHoldIfStatus(ctx, hold, HoldCaptured)
+			return nil, err
+		}
+	}
+
+	if amount.IsZero() {
+		return nil, nil
+	}
+
+	charge := postEntry
+	if overdraft {
+		charge = postOverdraft
+	}
+	entry, err := charge(ctx, wallet, kind, amount.Neg(), AccountRideRevenue, reference)
+	if err != nil {
+		if wasActive {
+			if rollbackErr := store.AdjustHeld(ctx, wallet.ID, hold.Amount, time.Now()); rollbackErr != nil {
+				logger.Error("CaptureHold - Error al restaurar la retención", map[string]interface{}{
+					"hold_id": hold.ID.Hex(),
+					"error":   rollbackErr.Error(),
+				})
+			}
+		}
+		_ = store.UpdateHoldIfStatus(ctx, hold, HoldCaptured)
+		return nil, err
+	}
+
+	transaction := entry.Transaction()
+	return &transaction, nil
+}
+
+// Undo a capture (compensates CaptureHold): the charge is refunded and the
+// funds are held again, or left free if they no longer fit
+func ReverseCapture(reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hold, err := store.FindHoldByReference(ctx, reference)
+	if err != nil {
+		return err
+	}
+	if hold.Status != HoldCaptured {
+		return nil
+	}
+
+	wallet, err := store.FindWalletByID(ctx, hold.WalletID)
+	if err != nil {
+		return err
+	}
+
+	if hold.CapturedAmount.IsPositive() {
+		if _, err := postEntry(ctx, wallet, EntryRefund, hold.CapturedAmount, AccountRideRevenue, reference); err != nil {
+			return err
+		}
+	}
+
+	return reactivateHold(ctx, hold)
+}
+
+// Reserve again the funds of a released hold (compensates ReleaseHold)
+func RestoreHold(reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hold, err := store.FindHoldByReference(ctx, reference)
+	if err != nil {
+		return err
+	}
+	if hold.Status != HoldReleased {
+		return nil
+	}
+
+	return reactivateHold(ctx, hold)
+}
+
+// Free the funds of an active hold without charging anything
+func ReleaseHold(reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hold, err := store.FindHoldByReference(ctx, reference)
+	if err != nil {
+		return err
+	}
+	if hold.Status != HoldActive {
+		return nil
+	}
+
+	return freeHold(ctx, hold, HoldReleased)
+}
+
+// Free the holds whose expiry has passed, e.g. those of abandoned rides
+func ExpireHolds() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	holds, err := store.FindExpiredHolds(ctx, time.Now())
+	if err != nil {
+		return 0, errors.New("error al consultar retenciones vencidas: " + err.Error())
+	}
+
+	expired := 0
+	for _, hold := range holds {
+		if err := freeHold(ctx, hold, HoldExpired); err != nil {
+			if !errors.Is(err, ErrHoldConflict) {
+				logger.Error("ExpireHolds - Error al liberar retención", map[string]interface{}{
+					"hold_id":   hold.ID.Hex(),
+					"reference": hold.Reference,
+					"error":     err.Error(),
+				})
+			}
+			continue
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// Periodically expire holds in background
+func StartHoldExpiry(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expired, err := ExpireHolds()
+			if err != nil {
+				logger.Error("StartHoldExpiry - Error al vencer retenciones", map[string]interface{}{
+					"error": err.Error(),
+				})
+				continue
+			}
+			if expired > 0 {
+				logger.Info("StartHoldExpiry - Retenciones vencidas liberadas", map[string]interface{}{
+					"holds": expired,
+				})
+			}
+		}
+	}()
+}
+
+// Make a captured or released hold active again. If the funds no longer fit in
+// the available balance the hold is left released
+func reactivateHold(ctx context.Context, hold Hold) error {
+	restored := hold
+	restored.Status = HoldActive
+	restored.CapturedAmount = money.Money{}
+	restored.UpdatedAt = time.Now()
+	if err := store.AdjustHeld(ctx, hold.WalletID, hold.Amount, restored.UpdatedAt); err != nil {
+		restored.Status = HoldReleased
+	}
+
+	return store.UpdateHoldIfStatus(ctx, restored, hold.Status)
+}
+
+// Move an active hold to status and give its funds back to the available balance
+func freeHold(ctx context.Context, hold Hold, status string) error {
+	freed := hold
+	freed.Status = status
+	freed.UpdatedAt = time.Now()
+	if err := store.UpdateHoldIfStatus(ctx, freed, HoldActive); err != nil {
+		return err
+	}
+
+	return store.AdjustHeld(ctx, hold.WalletID, hold.Amount.Neg(), freed.UpdatedAt)
+}
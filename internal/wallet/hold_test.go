@@ -0,0 +1,283 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func holdStatus(t *testing.T, reference string) string {
+	t.Helper()
+	hold, err := store.FindHoldByReference(context.Background(), reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hold.Status
+}
+
+func TestPlaceHold(t *testing.T) {
+	tests := []struct {
+		name     string
+		balance  int64
+		amounts  []int64 // Retenciones en orden
+		wantErr  error   // Error de la última
+		wantHeld int64
+	}{
+		{name: "within balance", balance: 1000, amounts: []int64{600}, wantHeld: 600},
+		{name: "whole balance", balance: 1000, amounts: []int64{1000}, wantHeld: 1000},
+		{name: "over balance", balance: 1000, amounts: []int64{1001}, wantErr: ErrInsufficientFunds},
+		{name: "over what is left", balance: 1000, amounts: []int64{600, 500}, wantErr: ErrInsufficientFunds, wantHeld: 600},
+		{name: "zero", balance: 0, amounts: []int64{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := setupWallet(t, tt.balance)
+
+			var err error
+			for i, amount := range tt.amounts {
+				_, err = PlaceHold(userID.Hex(), money.FromMinor(amount), primitive.NewObjectID().Hex(), time.Hour)
+				if i < len(tt.amounts)-1 && err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("PlaceHold() = %v, want %v", err, tt.wantErr)
+			}
+			assertWallet(t, userID, tt.balance, tt.wantHeld)
+		})
+	}
+}
+
+func TestPlaceHoldRejectsNegativeAmount(t *testing.T) {
+	userID := setupWallet(t, 1000)
+	if _, err := PlaceHold(userID.Hex(), money.FromMinor(-1), "r", time.Hour); err == nil {
+		t.Error("PlaceHold() accepted a negative amount")
+	}
+	assertWallet(t, userID, 1000, 0)
+}
+
+func TestCaptureHold(t *testing.T) {
+	tests := []struct {
+		name        string
+		balance     int64
+		hold        int64
+		capture     int64
+		reservation bool
+		wantErr     error
+		wantBalance int64
+		wantHeld    int64
+		wantStatus  string
+	}{
+		{name: "less than held", balance: 1000, hold: 500, capture: 300, wantBalance: 700, wantStatus: HoldCaptured},
+		{name: "more than held", balance: 1000, hold: 500, capture: 800, wantBalance: 200, wantStatus: HoldCaptured},
+		{name: "nothing", balance: 1000, hold: 500, capture: 0, wantBalance: 1000, wantStatus: HoldCaptured},
+		{name: "ride fare overdraws", balance: 500, hold: 500, capture: 1200, wantBalance: -700, wantStatus: HoldCaptured},
+		{name: "reservation fee does not overdraw", balance: 500, hold: 500, capture: 1200, reservation: true,
+			wantErr: ErrInsufficientFunds, wantBalance: 500, wantHeld: 500, wantStatus: HoldActive},
+		{name: "reservation fee", balance: 500, hold: 500, capture: 200, reservation: true, wantBalance: 300, wantStatus: HoldCaptured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := setupWallet(t, tt.balance)
+			reference := primitive.NewObjectID().Hex()
+			if _, err := PlaceHold(userID.Hex(), money.FromMinor(tt.hold), reference, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			capture := CaptureHold
+			if tt.reservation {
+				capture = CaptureReservationFee
+			}
+			transaction, err := capture(reference, money.FromMinor(tt.capture))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("capture = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && tt.capture > 0 && (transaction == nil || transaction.Amount != money.FromMinor(tt.capture) || transaction.Type != "debit") {
+				t.Errorf("transaction = %+v", transaction)
+			}
+
+			assertWallet(t, userID, tt.wantBalance, tt.wantHeld)
+			if status := holdStatus(t, reference); status != tt.wantStatus {
+				t.Errorf("hold status = %s, want %s", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCaptureHoldTwice(t *testing.T) {
+	userID := setupWallet(t, 1000)
+	if _, err := PlaceHold(userID.Hex(), money.FromMinor(500), "ride", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CaptureHold("ride", money.FromMinor(300)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CaptureHold("ride", money.FromMinor(300)); !errors.Is(err, ErrHoldConflict) {
+		t.Errorf("second capture = %v, want ErrHoldConflict", err)
+	}
+	assertWallet(t, userID, 700, 0)
+}
+
+func TestReverseCapture(t *testing.T) {
+	tests := []struct {
+		name       string
+		spend      int64 // Retenido por otro viaje antes de revertir
+		wantHeld   int64
+		wantStatus string
+	}{
+		{name: "hold is active again", wantHeld: 500, wantStatus: HoldActive},
+		{name: "hold no longer fits", spend: 700, wantHeld: 700, wantStatus: HoldReleased},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := setupWallet(t, 1000)
+			if _, err := PlaceHold(userID.Hex(), money.FromMinor(500), "ride", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := CaptureHold("ride", money.FromMinor(300)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.spend > 0 {
+				if _, err := PlaceHold(userID.Hex(), money.FromMinor(tt.spend), "other", time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := ReverseCapture("ride"); err != nil {
+				t.Fatal(err)
+			}
+			assertWallet(t, userID, 1000, tt.wantHeld)
+			if status := holdStatus(t, "ride"); status != tt.wantStatus {
+				t.Errorf("hold status = %s, want %s", status, tt.wantStatus)
+			}
+
+			// Revertir de nuevo no devuelve el cargo otra vez
+			if err := ReverseCapture("ride"); err != nil {
+				t.Fatal(err)
+			}
+			assertWallet(t, userID, 1000, tt.wantHeld)
+		})
+	}
+}
+
+func TestReleaseAndRestoreHold(t *testing.T) {
+	userID := setupWallet(t, 1000)
+	if _, err := PlaceHold(userID.Hex(), money.FromMinor(400), "ride", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name       string
+		apply      func(string) error
+		wantHeld   int64
+		wantStatus string
+	}{
+		{name: "release", apply: ReleaseHold, wantHeld: 0, wantStatus: HoldReleased},
+		{name: "release again", apply: ReleaseHold, wantHeld: 0, wantStatus: HoldReleased},
+		{name: "restore", apply: RestoreHold, wantHeld: 400, wantStatus: HoldActive},
+		{name: "restore again", apply: RestoreHold, wantHeld: 400, wantStatus: HoldActive},
+	}
+
+	for _, step := range steps {
+		if err := step.apply("ride"); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		assertWallet(t, userID, 1000, step.wantHeld)
+		if status := holdStatus(t, "ride"); status != step.wantStatus {
+			t.Errorf("%s: hold status = %s, want %s", step.name, status, step.wantStatus)
+		}
+	}
+
+	if err := ReleaseHold("unknown"); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("ReleaseHold(unknown) = %v, want ErrHoldNotFound", err)
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	userID := setupWallet(t, 1000)
+	if _, err := PlaceHold(userID.Hex(), money.FromMinor(300), "expired", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlaceHold(userID.Hex(), money.FromMinor(200), "current", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := ExpireHolds()
+	if err != nil || expired != 1 {
+		t.Fatalf("ExpireHolds() = %d, %v; want 1", expired, err)
+	}
+	assertWallet(t, userID, 1000, 200)
+	if status := holdStatus(t, "expired"); status != HoldExpired {
+		t.Errorf("hold status = %s, want %s", status, HoldExpired)
+	}
+
+	// Una retención ya vencida no se libera dos veces
+	if expired, err := ExpireHolds(); err != nil || expired != 0 {
+		t.Errorf("second ExpireHolds() = %d, %v; want 0", expired, err)
+	}
+	assertWallet(t, userID, 1000, 200)
+}
+
+func TestHeldFundsCannotBeWithdrawn(t *testing.T) {
+	userID := setupWallet(t, 1000)
+	wallet, err := GetWallet(userID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlaceHold(userID.Hex(), money.FromMinor(800), "ride", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AddTransaction(wallet.ID.Hex(), money.FromMinor(300), "debit"); err == nil {
+		t.Error("withdrew funds reserved by a hold")
+	}
+	assertWallet(t, userID, 1000, 800)
+}
+
+func TestSettleRideFare(t *testing.T) {
+	tests := []struct {
+		name        string
+		charged     int64
+		total       int64
+		wantBalance int64
+	}{
+		{name: "fare as charged", charged: 300, total: 300, wantBalance: 700},
+		{name: "fare above the charge", charged: 300, total: 500, wantBalance: 500},
+		{name: "fare below the charge", charged: 300, total: 100, wantBalance: 900},
+		{name: "fare above the balance", charged: 300, total: 1500, wantBalance: -500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := setupWallet(t, 1000)
+			if _, err := PlaceHold(userID.Hex(), money.FromMinor(tt.charged), "ride", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := CaptureHold("ride", money.FromMinor(tt.charged)); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := SettleRideFare(userID.Hex(), money.FromMinor(tt.charged), money.FromMinor(tt.total), "ride"); err != nil {
+				t.Fatal(err)
+			}
+			assertWallet(t, userID, tt.wantBalance, 0)
+
+			// Compensación de la saga de fin de viaje
+			// Revertir de nuevo no devuelve la diferencia otra vez
+			for i := 0; i < 2; i++ {
+				if err := ReverseRideFare(userID.Hex(), "ride"); err != nil {
+					t.Fatal(err)
+				}
+				assertWallet(t, userID, 1000-tt.charged, 0)
+			}
+		})
+	}
+}
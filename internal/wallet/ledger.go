@@ -0,0 +1,382 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrUnbalancedEntry = errors.New("asiento contable desbalanceado")
+
+// Ledger account of a wallet
+func WalletAccount(walletID primitive.ObjectID) string {
+	return "wallet:" + walletID.Hex()
+}
+
+// Sum of the postings of an entry, zero when balanced. Fails if the postings
+// mix currencies
+func (e JournalEntry) Sum() (money.Money, error) {
+	amounts := make([]money.Money, len(e.Postings))
+	for i, posting := range e.Postings {
+		amounts[i] = posting.Amount
+	}
+	return money.Sum(amounts...)
+}
+
+func (e JournalEntry) Balanced() bool {
+	sum, err := e.Sum()
+	return err == nil && len(e.Postings) >= 2 && sum.IsZero()
+}
+
+// Amount posted to an account by the entry. The postings of an entry that
+// is not balanced are not trusted
+func (e JournalEntry) AmountFor(account string) money.Money {
+	amounts := []money.Money{}
+	for _, posting := range e.Postings {
+		if posting.Account == account {
+			amounts = append(amounts, posting.Amount)
+		}
+	}
+	amount, err := money.Sum(amounts...)
+	if err != nil {
+		return money.FromMinor(0)
+	}
+	return amount
+}
+
+// Transaction view of the entry for its wallet
+func (e JournalEntry) Transaction() Transaction {
+	amount := e.AmountFor(WalletAccount(e.WalletID))
+	transactionType := "credit"
+	if amount.IsNegative() {
+		transactionType = "debit"
+	}
+
+	return Transaction{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		WalletID:  e.WalletID,
+		Amount:    amount.Abs(),
+		Type:      transactionType,
+		Kind:      e.Kind,
+		Reference: e.Reference,
+		Timestamp: e.CreatedAt,
+	}
+}
+
+// Post a balanced entry moving delta into the wallet (out of it if negative)
+// against the counter account. The cached balance is adjusted first, which
+// atomically rejects overdrafts, and rolled back if the entry cannot be stored
+func postEntry(ctx context.Context, wallet Wallet, kind string, delta money.Money, counterAccount, reference string) (JournalEntry, error) {
+	return post(ctx, wallet, kind, delta, counterAccount, reference, store.AdjustBalance)
+}
+
+// Post an entry that may leave the wallet with a negative balance, for
+// charges that cannot be refused such as the fare of a ride already made
+func postOverdraft(ctx context.Context, wallet Wallet, kind string, delta money.Money, counterAccount, reference string) (JournalEntry, error) {
+	entry, err := post(ctx, wallet, kind, delta, counterAccount, reference, store.ChargeBalance)
+	if err == nil && wallet.Balance.Add(delta).IsNegative() {
+		logger.Info("postOverdraft - La wallet queda con deuda", map[string]interface{}{
+			"wallet_id": wallet.ID.Hex(),
+			"reference": reference,
+			"delta":     delta.String(),
+		})
+	}
+	return entry, err
+}
+
+func post(ctx context.Context, wallet Wallet, kind string, delta money.Money, counterAccount, reference string, adjust func(context.Context, primitive.ObjectID, money.Money, time.Time) error) (JournalEntry, error) {
+	now := time.Now()
+	entry := newEntry(wallet, kind, delta, counterAccount, reference, now)
+
+	if !entry.Balanced() {
+		return entry, ErrUnbalancedEntry
+	}
+
+	if err := adjust(ctx, wallet.ID, delta, now); err != nil {
+		return entry, err
+	}
+
+	if err := store.AppendEntry(ctx, entry); err != nil {
+		if rollbackErr := store.ChargeBalance(ctx, wallet.ID, delta.Neg(), time.Now()); rollbackErr != nil {
+			logger.Error("post - Error al revertir el saldo cacheado", map[string]interface{}{
+				"wallet_id": wallet.ID.Hex(),
+				"delta":     delta.String(),
+				"error":     rollbackErr.Error(),
+			})
+		}
+		return entry, err
+	}
+
+	return entry, nil
+}
+
+func newEntry(wallet Wallet, kind string, delta money.Money, counterAccount, reference string, at time.Time) JournalEntry {
+	return JournalEntry{
+		ID:        primitive.NewObjectID(),
+		Kind:      kind,
+		UserID:    wallet.UserID,
+		WalletID:  wallet.ID,
+		Reference: reference,
+		Postings: []Posting{
+			{Account: WalletAccount(wallet.ID), Amount: delta},
+			{Account: counterAccount, Amount: delta.Neg()},
+		},
+		CreatedAt: at,
+	}
+}
+
+// Open the wallet account in the ledger with the given balance, against the
+// equity account. Only the cached balance delta is applied to the wallet,
+// since the rest of the opening balance is already cached
+func openWallet(ctx context.Context, wallet Wallet, opening, delta money.Money) error {
+	now := time.Now()
+	entry := newEntry(wallet, EntryOpeningBalance, opening, AccountEquity, "", now)
+	if !entry.Balanced() {
+		return ErrUnbalancedEntry
+	}
+
+	// El asiento va primero: si el ajuste falla, el saldo cacheado queda por
+	// debajo del libro y RebuildBalances lo corrige
+	if err := store.AppendEntry(ctx, entry); err != nil {
+		return err
+	}
+	if delta.IsZero() {
+		return nil
+	}
+	return store.ChargeBalance(ctx, wallet.ID, delta, now)
+}
+
+// One-time migration of the wallets that predate the ledger. Each wallet
+// without an opening entry is opened with its cached balance, which already
+// reflects the old transactions, minus what the ledger has posted to it since,
+// plus the balance the user kept in users.wallet_balance. legacy maps user IDs
+// to that balance; users with one but no wallet get a wallet. Wallets already
+// opened are skipped, so running it twice has no effect. Returns the wallets
+// opened
+func OpenLedger(legacy map[primitive.ObjectID]money.Money) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	wallets, err := store.FindAllWallets(ctx)
+	if err != nil {
+		return 0, errors.New("error al consultar wallets: " + err.Error())
+	}
+
+	pending := map[primitive.ObjectID]money.Money{}
+	for userID, amount := range legacy {
+		if !amount.IsZero() {
+			pending[userID] = amount
+		}
+	}
+
+	opened := 0
+	for _, wallet := range wallets {
+		legacyBalance, ok := pending[wallet.UserID]
+		if !ok {
+			legacyBalance = money.FromMinor(0)
+		}
+		delete(pending, wallet.UserID)
+
+		entries, err := store.FindEntriesByWallet(ctx, wallet.ID)
+		if err != nil {
+			return opened, errors.New("error al consultar el libro contable: " + err.Error())
+		}
+
+		amounts := []money.Money{wallet.Balance, legacyBalance}
+		alreadyOpened := false
+		for _, entry := range entries {
+			if entry.Kind == EntryOpeningBalance {
+				alreadyOpened = true
+				break
+			}
+			if entry.Balanced() {
+				amounts = append(amounts, entry.AmountFor(WalletAccount(wallet.ID)).Neg())
+			}
+		}
+		if alreadyOpened {
+			continue
+		}
+
+		opening, err := money.Sum(amounts...)
+		if err != nil {
+			return opened, errors.New("saldo de la wallet " + wallet.ID.Hex() + " en otra moneda: " + err.Error())
+		}
+		if err := openWallet(ctx, wallet, opening, legacyBalance); err != nil {
+			return opened, errors.New("error al abrir la wallet " + wallet.ID.Hex() + ": " + err.Error())
+		}
+		opened++
+
+		logger.Info("OpenLedger - Wallet abierta en el libro contable", map[string]interface{}{
+			"wallet_id": wallet.ID.Hex(),
+			"opening":   opening.String(),
+			"legacy":    legacyBalance.String(),
+		})
+	}
+
+	for userID, legacyBalance := range pending {
+		if err := legacyBalance.SameCurrency(money.FromMinor(0)); err != nil {
+			return opened, errors.New("saldo del usuario " + userID.Hex() + " en otra moneda: " + err.Error())
+		}
+
+		wallet := Wallet{
+			ID:          primitive.NewObjectID(),
+			UserID:      userID,
+			Balance:     money.FromMinor(0),
+			Held:        money.FromMinor(0),
+			LastUpdated: time.Now(),
+		}
+		if err := store.InsertWallet(ctx, wallet); err != nil {
+			return opened, errors.New("error al crear la wallet del usuario " + userID.Hex() + ": " + err.Error())
+		}
+		if err := openWallet(ctx, wallet, legacyBalance, legacyBalance); err != nil {
+			return opened, errors.New("error al abrir la wallet " + wallet.ID.Hex() + ": " + err.Error())
+		}
+		opened++
+	}
+
+	return opened, nil
+}
+
+// Fail when stored amounts are in a currency other than the default one (e.g.
+// after changing CURRENCY), since adding them to new amounts would mix currencies
+func CheckCurrency() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	currencies, err := store.FindCurrencies(ctx)
+	if err != nil {
+		return errors.New("error al consultar las monedas del libro contable: " + err.Error())
+	}
+
+	for _, currency := range currencies {
+		if err := money.New(0, currency).SameCurrency(money.FromMinor(0)); err != nil {
+			return fmt.Errorf("hay saldos guardados en otra moneda que la configurada: %w", err)
+		}
+	}
+	return nil
+}
+
+// Verify that every entry is balanced and every cached wallet balance equals
+// the sum of the postings on its account
+func VerifyLedger() (*LedgerReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	entries, err := store.FindEntries(ctx)
+	if err != nil {
+		return nil, errors.New("error al consultar el libro contable: " + err.Error())
+	}
+
+	wallets, err := store.FindAllWallets(ctx)
+	if err != nil {
+		return nil, errors.New("error al consultar wallets: " + err.Error())
+	}
+
+	report := &LedgerReport{
+		Entries:           len(entries),
+		UnbalancedEntries: []string{},
+		TrialBalance:      money.FromMinor(0),
+		Accounts:          map[string]money.Money{},
+		Mismatches:        []BalanceMismatch{},
+		UnopenedWallets:   []string{},
+	}
+
+	opened := map[primitive.ObjectID]bool{}
+
+	// Los asientos con monedas distintas a la del sistema se informan como
+	// desbalanceados en lugar de sumarse
+	for _, entry := range entries {
+		if entry.Kind == EntryOpeningBalance {
+			opened[entry.WalletID] = true
+		}
+		if !entry.Balanced() || entry.Postings[0].Amount.SameCurrency(report.TrialBalance) != nil {
+			report.UnbalancedEntries = append(report.UnbalancedEntries, entry.ID.Hex())
+			continue
+		}
+		for _, posting := range entry.Postings {
+			account, ok := report.Accounts[posting.Account]
+			if !ok {
+				account = money.FromMinor(0)
+			}
+			report.Accounts[posting.Account] = account.Add(posting.Amount)
+			report.TrialBalance = report.TrialBalance.Add(posting.Amount)
+		}
+	}
+
+	for _, wallet := range wallets {
+		if !opened[wallet.ID] {
+			report.UnopenedWallets = append(report.UnopenedWallets, wallet.ID.Hex())
+		}
+
+		ledger, ok := report.Accounts[WalletAccount(wallet.ID)]
+		if !ok {
+			ledger = money.FromMinor(0)
+		}
+		if cmp, err := ledger.Compare(wallet.Balance); err != nil || cmp != 0 {
+			report.Mismatches = append(report.Mismatches, BalanceMismatch{
+				WalletID: wallet.ID,
+				Cached:   wallet.Balance,
+				Ledger:   ledger,
+			})
+		}
+	}
+
+	report.Consistent = len(report.UnbalancedEntries) == 0 &&
+		len(report.Mismatches) == 0 &&
+		len(report.UnopenedWallets) == 0 &&
+		report.TrialBalance.IsZero()
+
+	return report, nil
+}
+
+// Reset the cached balance of mismatched wallets to their ledger sum. Wallets
+// without an opening entry are left alone: their ledger lacks the balance they
+// had before it existed, until OpenLedger migrates them
+func RebuildBalances() (*LedgerReport, error) {
+	report, err := VerifyLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	unopened := map[string]bool{}
+	for _, walletID := range report.UnopenedWallets {
+		unopened[walletID] = true
+	}
+
+	for _, mismatch := range report.Mismatches {
+		if unopened[mismatch.WalletID.Hex()] {
+			logger.Error("RebuildBalances - Wallet sin asiento de apertura, se omite", map[string]interface{}{
+				"wallet_id": mismatch.WalletID.Hex(),
+				"cached":    mismatch.Cached.String(),
+			})
+			continue
+		}
+		// Un saldo en otra moneda (p. ej. tras cambiar CURRENCY) no se pisa
+		if err := mismatch.Ledger.SameCurrency(mismatch.Cached); err != nil {
+			logger.Error("RebuildBalances - Saldo en otra moneda, se omite", map[string]interface{}{
+				"wallet_id": mismatch.WalletID.Hex(),
+				"error":     err.Error(),
+			})
+			continue
+		}
+		if err := store.SetBalance(ctx, mismatch.WalletID, mismatch.Ledger, time.Now()); err != nil {
+			return nil, errors.New("error al reconstruir saldo: " + err.Error())
+		}
+		logger.Info("RebuildBalances - Saldo reconstruido desde el libro contable", map[string]interface{}{
+			"wallet_id": mismatch.WalletID.Hex(),
+			"cached":    mismatch.Cached.String(),
+			"ledger":    mismatch.Ledger.String(),
+		})
+	}
+
+	return VerifyLedger()
+}
@@ -0,0 +1,317 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fresh memory store with a wallet topped up with balance minor units
+func setupWallet(t *testing.T, balance int64) primitive.ObjectID {
+	t.Helper()
+	SetStore(NewMemoryStore())
+
+	userID := primitive.NewObjectID()
+	if _, err := CreateDefaultWallet(userID); err != nil {
+		t.Fatal(err)
+	}
+	if balance > 0 {
+		if _, err := TopUp(userID, money.FromMinor(balance)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userID
+}
+
+// Fail unless the wallet has the given balance and held amount and the ledger is consistent
+func assertWallet(t *testing.T, userID primitive.ObjectID, balance, held int64) {
+	t.Helper()
+	wallet, err := GetWallet(userID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Balance != money.FromMinor(balance) || wallet.Held != money.FromMinor(held) {
+		t.Errorf("balance = %s, held = %s; want %s, %s", wallet.Balance, wallet.Held, money.FromMinor(balance), money.FromMinor(held))
+	}
+
+	report, err := VerifyLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent {
+		t.Errorf("ledger is not consistent: %+v", report)
+	}
+}
+
+func TestJournalEntryBalanced(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []Posting
+		want     bool
+	}{
+		{name: "balanced", postings: []Posting{{"a", money.FromMinor(100)}, {"b", money.FromMinor(-100)}}, want: true},
+		{name: "three postings", postings: []Posting{{"a", money.FromMinor(100)}, {"b", money.FromMinor(-60)}, {"c", money.FromMinor(-40)}}, want: true},
+		{name: "single posting", postings: []Posting{{"a", money.FromMinor(0)}}},
+		{name: "no postings"},
+		{name: "does not add up", postings: []Posting{{"a", money.FromMinor(100)}, {"b", money.FromMinor(-99)}}},
+		{name: "mixed currencies", postings: []Posting{{"a", money.FromMinor(100)}, {"b", money.New(-100, "EUR")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (JournalEntry{Postings: tt.postings}).Balanced(); got != tt.want {
+				t.Errorf("Balanced() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournalEntryTransaction(t *testing.T) {
+	walletID := primitive.NewObjectID()
+	account := WalletAccount(walletID)
+
+	tests := []struct {
+		name       string
+		postings   []Posting
+		wantAmount money.Money
+		wantType   string
+	}{
+		{name: "credit", postings: []Posting{{account, money.FromMinor(500)}, {AccountFunding, money.FromMinor(-500)}}, wantAmount: money.FromMinor(500), wantType: "credit"},
+		{name: "debit", postings: []Posting{{account, money.FromMinor(-250)}, {AccountRideRevenue, money.FromMinor(250)}}, wantAmount: money.FromMinor(250), wantType: "debit"},
+		{name: "other wallet", postings: []Posting{{WalletAccount(primitive.NewObjectID()), money.FromMinor(100)}, {AccountFunding, money.FromMinor(-100)}}, wantAmount: money.FromMinor(0), wantType: "credit"},
+		{name: "mixed currencies are not trusted", postings: []Posting{{account, money.FromMinor(100)}, {account, money.New(100, "EUR")}}, wantAmount: money.FromMinor(0), wantType: "credit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := JournalEntry{WalletID: walletID, Kind: EntryTopUp, Postings: tt.postings}.Transaction()
+			if transaction.Amount != tt.wantAmount || transaction.Type != tt.wantType {
+				t.Errorf("Transaction() = %s %s, want %s %s", transaction.Type, transaction.Amount, tt.wantType, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestAddTransaction(t *testing.T) {
+	tests := []struct {
+		name            string
+		amount          int64
+		transactionType string
+		wantErr         bool
+		wantBalance     int64
+	}{
+		{name: "credit", amount: 300, transactionType: "credit", wantBalance: 1300},
+		{name: "debit", amount: 300, transactionType: "debit", wantBalance: 700},
+		{name: "debit of the whole balance", amount: 1000, transactionType: "debit", wantBalance: 0},
+		{name: "overdraft", amount: 1001, transactionType: "debit", wantErr: true, wantBalance: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := setupWallet(t, 1000)
+			wallet, err := GetWallet(userID.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = AddTransaction(wallet.ID.Hex(), money.FromMinor(tt.amount), tt.transactionType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddTransaction() = %v, wantErr %v", err, tt.wantErr)
+			}
+			assertWallet(t, userID, tt.wantBalance, 0)
+		})
+	}
+}
+
+func TestVerifyLedger(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		corrupt        func(t *testing.T, wallet Wallet)
+		wantMismatches int
+		wantUnbalanced int
+		rebuilt        bool // Consistente después de RebuildBalances
+	}{
+		{name: "consistent", corrupt: func(*testing.T, Wallet) {}, rebuilt: true},
+		{name: "cached balance drifted", corrupt: func(t *testing.T, wallet Wallet) {
+			if err := store.SetBalance(ctx, wallet.ID, money.FromMinor(5000), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}, wantMismatches: 1, rebuilt: true},
+		{name: "unbalanced entry", corrupt: func(t *testing.T, wallet Wallet) {
+			entry := JournalEntry{ID: primitive.NewObjectID(), WalletID: wallet.ID, Postings: []Posting{
+				{WalletAccount(wallet.ID), money.FromMinor(100)},
+				{AccountFunding, money.FromMinor(-50)},
+			}}
+			if err := store.AppendEntry(ctx, entry); err != nil {
+				t.Fatal(err)
+			}
+		}, wantUnbalanced: 1},
+		{name: "entry in another currency", corrupt: func(t *testing.T, wallet Wallet) {
+			entry := JournalEntry{ID: primitive.NewObjectID(), WalletID: wallet.ID, Postings: []Posting{
+				{WalletAccount(wallet.ID), money.New(100, "EUR")},
+				{AccountFunding, money.New(-100, "EUR")},
+			}}
+			if err := store.AppendEntry(ctx, entry); err != nil {
+				t.Fatal(err)
+			}
+		}, wantUnbalanced: 1},
+		{name: "cached balance in another currency", corrupt: func(t *testing.T, wallet Wallet) {
+			if err := store.SetBalance(ctx, wallet.ID, money.New(1000, "EUR"), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}, wantMismatches: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := setupWallet(t, 1000)
+			wallet, err := store.FindWalletByUserID(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.corrupt(t, wallet)
+
+			report, err := VerifyLedger()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Mismatches) != tt.wantMismatches || len(report.UnbalancedEntries) != tt.wantUnbalanced {
+				t.Errorf("mismatches = %d, unbalanced = %d; want %d, %d", len(report.Mismatches), len(report.UnbalancedEntries), tt.wantMismatches, tt.wantUnbalanced)
+			}
+			if want := tt.wantMismatches == 0 && tt.wantUnbalanced == 0; report.Consistent != want {
+				t.Errorf("Consistent = %v, want %v", report.Consistent, want)
+			}
+			if ledger := report.Accounts[WalletAccount(wallet.ID)]; ledger != money.FromMinor(1000) {
+				t.Errorf("wallet account = %s, want 10.00", ledger)
+			}
+
+			rebuilt, err := RebuildBalances()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rebuilt.Consistent != tt.rebuilt {
+				t.Errorf("after RebuildBalances Consistent = %v, want %v", rebuilt.Consistent, tt.rebuilt)
+			}
+		})
+	}
+}
+
+// Wallet saved before the ledger existed: a cached balance and no entries
+func insertLegacyWallet(t *testing.T, balance int64) Wallet {
+	t.Helper()
+	wallet := Wallet{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Balance: money.FromMinor(balance), Held: money.FromMinor(0)}
+	if err := store.InsertWallet(context.Background(), wallet); err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+func TestRebuildBalancesSkipsUnopenedWallets(t *testing.T) {
+	SetStore(NewMemoryStore())
+	wallet := insertLegacyWallet(t, 1000)
+
+	report, err := RebuildBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Consistent || len(report.UnopenedWallets) != 1 {
+		t.Errorf("report = %+v, want the wallet reported as unopened", report)
+	}
+	if found, _ := store.FindWalletByID(context.Background(), wallet.ID); found.Balance != money.FromMinor(1000) {
+		t.Errorf("balance = %s, want the cached 10.00 untouched", found.Balance)
+	}
+}
+
+func TestOpenLedger(t *testing.T) {
+	SetStore(NewMemoryStore())
+	ctx := context.Background()
+
+	untouched := insertLegacyWallet(t, 1000)
+	// Recargada después de desplegar el libro contable y antes de migrar
+	toppedUp := insertLegacyWallet(t, 700)
+	if _, err := TopUp(toppedUp.UserID, money.FromMinor(300)); err != nil {
+		t.Fatal(err)
+	}
+	current := setupCurrentWallet(t, 400)
+	withoutWallet := primitive.NewObjectID()
+
+	legacy := map[primitive.ObjectID]money.Money{
+		untouched.UserID: money.FromMinor(250),
+		withoutWallet:    money.FromMinor(50),
+		current:          money.FromMinor(999), // Ya abierta: no se vuelve a sumar
+	}
+
+	opened, err := OpenLedger(legacy)
+	if err != nil || opened != 3 {
+		t.Fatalf("OpenLedger() = %d, %v; want 3", opened, err)
+	}
+	assertWallet(t, untouched.UserID, 1250, 0)
+	assertWallet(t, toppedUp.UserID, 1000, 0)
+	assertWallet(t, current, 400, 0)
+	assertWallet(t, withoutWallet, 50, 0)
+
+	if opened, err := OpenLedger(legacy); err != nil || opened != 0 {
+		t.Errorf("second OpenLedger() = %d, %v; want 0", opened, err)
+	}
+	assertWallet(t, untouched.UserID, 1250, 0)
+
+	report, err := VerifyLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if equity := report.Accounts[AccountEquity]; equity != money.FromMinor(-2000) {
+		t.Errorf("equity = %s, want -20.00", equity)
+	}
+
+	wallets, _ := store.FindAllWallets(ctx)
+	if len(wallets) != 4 {
+		t.Errorf("wallets = %d, want 4", len(wallets))
+	}
+}
+
+func TestOpenLedgerRejectsForeignCurrency(t *testing.T) {
+	SetStore(NewMemoryStore())
+	wallet := insertLegacyWallet(t, 1000)
+
+	if _, err := OpenLedger(map[primitive.ObjectID]money.Money{wallet.UserID: money.New(100, "EUR")}); err == nil {
+		t.Error("OpenLedger() folded a balance in another currency")
+	}
+	if report, _ := VerifyLedger(); len(report.UnopenedWallets) != 1 {
+		t.Errorf("unopened wallets = %v, want the wallet still unopened", report.UnopenedWallets)
+	}
+}
+
+// Wallet created through the service in the current store, topped up
+func setupCurrentWallet(t *testing.T, balance int64) primitive.ObjectID {
+	t.Helper()
+	userID := primitive.NewObjectID()
+	if _, err := CreateDefaultWallet(userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TopUp(userID, money.FromMinor(balance)); err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func TestCheckCurrency(t *testing.T) {
+	setupWallet(t, 1000)
+	if err := CheckCurrency(); err != nil {
+		t.Fatalf("CheckCurrency() = %v", err)
+	}
+
+	// Con otra moneda configurada, los saldos guardados ya no se pueden sumar
+	previous := money.DefaultCurrency
+	money.DefaultCurrency = "EUR"
+	defer func() { money.DefaultCurrency = previous }()
+
+	if err := CheckCurrency(); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("CheckCurrency() = %v, want ErrCurrencyMismatch", err)
+	}
+}
@@ -3,21 +3,109 @@ package wallet
 import (
 	"time"
 
+	"github.com/clementeaf/bike-tracker/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Transaction is the view of a journal entry from the point of view of a wallet
 type Transaction struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
 	WalletID  primitive.ObjectID `bson:"wallet_id" json:"wallet_id"`
-	Amount    float64            `bson:"amount" json:"amount"`
-	Type      string             `bson:"type" json:"type"`
+	Amount    money.Money        `bson:"amount" json:"amount"`
+	Type      string             `bson:"type" json:"type"` // credit | debit
+	Kind      string             `bson:"kind" json:"kind"`
+	Reference string             `bson:"reference,omitempty" json:"reference,omitempty"`
 	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
 }
 
+// Wallet.Balance is a cached projection of the postings on the wallet account.
+// Held is the part of it reserved by active holds
 type Wallet struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
-	Balance     float64            `bson:"balance" json:"balance"`
+	Balance     money.Money        `bson:"balance" json:"balance"`
+	Held        money.Money        `bson:"held" json:"held"`
 	LastUpdated time.Time          `bson:"last_updated" json:"last_updated"`
 }
+
+// Balance that can still be spent or held
+func (w Wallet) Available() money.Money {
+	return w.Balance.Sub(w.Held)
+}
+
+// Hold reserves funds of a wallet until it is captured, released or expires.
+// Holds are not ledger postings: no money moves until the capture
+type Hold struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WalletID       primitive.ObjectID `bson:"wallet_id" json:"wallet_id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Reference      string             `bson:"reference" json:"reference"`
+	Amount         money.Money        `bson:"amount" json:"amount"`
+	CapturedAmount money.Money        `bson:"captured_amount,omitempty" json:"captured_amount,omitempty"`
+	Status         string             `bson:"status" json:"status"`
+	ExpiresAt      time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Posting moves Amount into (positive) or out of (negative) an account
+type Posting struct {
+	Account string      `bson:"account" json:"account"`
+	Amount  money.Money `bson:"amount" json:"amount"`
+}
+
+// JournalEntry is an append-only, balanced set of postings
+type JournalEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Kind      string             `bson:"kind" json:"kind"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	WalletID  primitive.ObjectID `bson:"wallet_id" json:"wallet_id"`
+	Reference string             `bson:"reference,omitempty" json:"reference,omitempty"`
+	Postings  []Posting          `bson:"postings" json:"postings"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// BalanceMismatch reports a wallet whose cached balance differs from the ledger
+type BalanceMismatch struct {
+	WalletID primitive.ObjectID `json:"wallet_id"`
+	Cached   money.Money        `json:"cached"`
+	Ledger   money.Money        `json:"ledger"`
+}
+
+// LedgerReport is the result of verifying the ledger
+type LedgerReport struct {
+	Entries           int                    `json:"entries"`
+	UnbalancedEntries []string               `json:"unbalanced_entries"`
+	TrialBalance      money.Money            `json:"trial_balance"`
+	Accounts          map[string]money.Money `json:"accounts"`
+	Mismatches        []BalanceMismatch      `json:"mismatches"`
+	UnopenedWallets   []string               `json:"unopened_wallets"` // Sin asiento de apertura: falta migrar
+	Consistent        bool                   `json:"consistent"`
+}
+
+// Entry kinds
+const (
+	EntryTopUp          = "top_up"
+	EntryWithdrawal     = "withdrawal"
+	EntryRideFee        = "ride_fee"
+	EntryRefund         = "refund"
+	EntryRideFare       = "ride_fare"       // Diferencia entre la tarifa final y lo cobrado al iniciar
+	EntryReservationFee = "reservation_fee" // Reserva de bicicleta que venció sin usarse
+	EntryOpeningBalance = "opening_balance" // Saldo con el que la wallet entra al libro contable
+)
+
+// Hold states
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+	HoldExpired  = "expired"
+)
+
+// System accounts
+const (
+	AccountFunding     = "system:funding"      // Dinero que entra o sale de la plataforma
+	AccountRideRevenue = "system:ride_revenue" // Ingresos por viajes
+	AccountEquity      = "system:equity"       // Contrapartida de los saldos de apertura
+)
@@ -3,12 +3,16 @@ package wallet
 import (
 	"net/http"
 
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	"github.com/clementeaf/bike-tracker/pkg/idempotency"
 	"github.com/clementeaf/bike-tracker/pkg/middleware"
 )
 
 func RegisterRoutes(mux *http.ServeMux) {
-	mux.Handle("/wallet/transactions/add", middleware.AuthMiddleware(http.HandlerFunc(HandleAddTransaction)))
-	mux.Handle("/wallet", middleware.AuthMiddleware(http.HandlerFunc(HandleGetWallet)))
-	mux.Handle("/wallet/transactions", middleware.AuthMiddleware(http.HandlerFunc(HandleGetTransactionHistory)))
-	mux.Handle("/wallet/balance", middleware.AuthMiddleware(http.HandlerFunc(HandleGetWalletBalance)))
+	mux.Handle("/wallet/transactions/add", middleware.RequirePermission(auth.PermRide, idempotency.Middleware(http.HandlerFunc(HandleAddTransaction))))
+	mux.Handle("/wallet", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(HandleGetWallet)))
+	mux.Handle("/wallet/transactions", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(HandleGetTransactionHistory)))
+	mux.Handle("/wallet/balance", middleware.RequirePermission(auth.PermRide, http.HandlerFunc(HandleGetWalletBalance)))
+	mux.Handle("/wallet/ledger/verify", middleware.RequirePermission(auth.PermLedger, http.HandlerFunc(HandleVerifyLedger)))
+	mux.Handle("/wallet/ledger/rebuild", middleware.RequirePermission(auth.PermLedger, http.HandlerFunc(HandleRebuildBalances)))
 }
@@ -5,9 +5,8 @@ import (
 	"errors"
 	"time"
 
-	"github.com/clementeaf/bike-tracker/pkg/database"
 	"github.com/clementeaf/bike-tracker/pkg/logger"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/clementeaf/bike-tracker/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -16,17 +15,16 @@ func CreateDefaultWallet(userID primitive.ObjectID) (primitive.ObjectID, error)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	collection := database.GetCollection("wallets")
-
 	walletID := primitive.NewObjectID()
 	wallet := Wallet{
 		ID:          walletID,
 		UserID:      userID,
-		Balance:     0.0,
+		Balance:     money.FromMinor(0),
+		Held:        money.FromMinor(0),
 		LastUpdated: time.Now(),
 	}
 
-	_, err := collection.InsertOne(ctx, wallet)
+	err := store.InsertWallet(ctx, wallet)
 	if err != nil {
 		logger.Error("Error al insertar wallet en MongoDB", map[string]interface{}{
 			"user_id":   userID.Hex(),
@@ -36,6 +34,22 @@ func CreateDefaultWallet(userID primitive.ObjectID) (primitive.ObjectID, error)
 		return primitive.NilObjectID, errors.New("falló la creación de la wallet")
 	}
 
+	// Las wallets nuevas entran al libro contable con saldo cero
+	if err := openWallet(ctx, wallet, money.FromMinor(0), money.FromMinor(0)); err != nil {
+		logger.Error("Error al abrir la wallet en el libro contable", map[string]interface{}{
+			"user_id":   userID.Hex(),
+			"wallet_id": walletID.Hex(),
+			"error":     err.Error(),
+		})
+		if deleteErr := store.DeleteWalletByUserID(ctx, userID); deleteErr != nil {
+			logger.Error("Error al eliminar la wallet sin abrir", map[string]interface{}{
+				"wallet_id": walletID.Hex(),
+				"error":     deleteErr.Error(),
+			})
+		}
+		return primitive.NilObjectID, errors.New("falló la creación de la wallet")
+	}
+
 	logger.Info("Wallet creada exitosamente", map[string]interface{}{
 		"user_id":   userID.Hex(),
 		"wallet_id": walletID.Hex(),
@@ -43,11 +57,9 @@ func CreateDefaultWallet(userID primitive.ObjectID) (primitive.ObjectID, error)
 	return walletID, nil
 }
 
-// POST Found to wallet
-func AddTransaction(walletID string, amount float64, transactionType string) (*Transaction, error) {
-	walletCollection := database.GetCollection("wallets")
-	transactionCollection := database.GetCollection("transactions")
-
+// POST Found to wallet: credits are top-ups and debits withdrawals, both
+// posted against the funding account
+func AddTransaction(walletID string, amount money.Money, transactionType string) (*Transaction, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -56,49 +68,56 @@ func AddTransaction(walletID string, amount float64, transactionType string) (*T
 		return nil, errors.New("wallet ID inválido")
 	}
 
-	var wallet Wallet
-	err = walletCollection.FindOne(ctx, bson.M{"_id": walletObjectID}).Decode(&wallet)
+	wallet, err := store.FindWalletByID(ctx, walletObjectID)
 	if err != nil {
 		return nil, errors.New("wallet no encontrada")
 	}
 
-	transaction := &Transaction{
-		ID:        primitive.NewObjectID(),
-		UserID:    wallet.UserID,
-		WalletID:  walletObjectID,
-		Amount:    amount,
-		Type:      transactionType,
-		Timestamp: time.Now(),
+	var kind string
+	var delta money.Money
+	switch transactionType {
+	case "credit":
+		kind, delta = EntryTopUp, amount
+	case "debit":
+		kind, delta = EntryWithdrawal, amount.Neg()
+	default:
+		return nil, errors.New("tipo de transacción inválido")
 	}
 
-	_, err = transactionCollection.InsertOne(ctx, transaction)
+	entry, err := postEntry(ctx, wallet, kind, delta, AccountFunding, "")
 	if err != nil {
 		return nil, err
 	}
 
-	if transactionType == "credit" {
-		wallet.Balance += amount
-	} else if transactionType == "debit" {
-		if wallet.Balance < amount {
-			return nil, errors.New("saldo insuficiente")
-		}
-		wallet.Balance -= amount
-	} else {
-		return nil, errors.New("tipo de transacción inválido")
+	transaction := entry.Transaction()
+	return &transaction, nil
+}
+
+// Top up the wallet of a user
+func TopUp(userID primitive.ObjectID, amount money.Money) (*Transaction, error) {
+	if !amount.IsPositive() {
+		return nil, errors.New("el monto debe ser positivo")
 	}
 
-	_, err = walletCollection.UpdateOne(ctx, bson.M{"_id": walletObjectID}, bson.M{"$set": bson.M{"balance": wallet.Balance, "last_updated": time.Now()}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	wallet, err := store.FindWalletByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("wallet no encontrada")
+	}
+
+	entry, err := postEntry(ctx, wallet, EntryTopUp, amount, AccountFunding, "")
 	if err != nil {
 		return nil, err
 	}
 
-	return transaction, nil
+	transaction := entry.Transaction()
+	return &transaction, nil
 }
 
 // GET wallet
 func GetWallet(userID string) (*Wallet, error) {
-	walletCollection := database.GetCollection("wallets")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -107,8 +126,7 @@ func GetWallet(userID string) (*Wallet, error) {
 		return nil, errors.New("ID de usuario inválido")
 	}
 
-	var wallet Wallet
-	err = walletCollection.FindOne(ctx, bson.M{"user_id": objectID}).Decode(&wallet)
+	wallet, err := store.FindWalletByUserID(ctx, objectID)
 	if err != nil {
 		return nil, errors.New("wallet no encontrada")
 	}
@@ -118,8 +136,6 @@ func GetWallet(userID string) (*Wallet, error) {
 
 // GET Wallet transactions history
 func GetTransactionHistory(userID string) ([]Transaction, error) {
-	transactionCollection := database.GetCollection("transactions")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -128,73 +144,103 @@ func GetTransactionHistory(userID string) ([]Transaction, error) {
 		return nil, errors.New("ID de usuario inválido")
 	}
 
-	cursor, err := transactionCollection.Find(ctx, bson.M{"user_id": objectID})
+	wallet, err := store.FindWalletByUserID(ctx, objectID)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("wallet no encontrada")
 	}
-	defer cursor.Close(ctx)
 
-	var transactions []Transaction
-	if err = cursor.All(ctx, &transactions); err != nil {
+	entries, err := store.FindEntriesByWallet(ctx, wallet.ID)
+	if err != nil {
 		return nil, err
 	}
 
+	transactions := make([]Transaction, 0, len(entries))
+	for _, entry := range entries {
+		transactions = append(transactions, entry.Transaction())
+	}
+
 	return transactions, nil
 }
 
-// POST deduct ride fee from wallet
-func DeductRideFee(userID string) error {
-	const rideCost = 5.00
-
-	walletCollection := database.GetCollection("wallets")
-	transactionCollection := database.GetCollection("transactions")
+// Settle the final fare of a ride against what was charged upfront: the
+// difference is debited, even into a negative balance, or credited back when
+// the upfront charge was higher. Returns the transaction linked to the ride,
+// nil when there is nothing to settle
+func SettleRideFare(userID string, charged, total money.Money, rideID string) (*Transaction, error) {
+	delta := charged.Sub(total)
+	if delta.IsZero() {
+		return nil, nil
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return errors.New("ID de usuario inválido")
+		return nil, errors.New("ID de usuario inválido")
 	}
 
-	var wallet Wallet
-	err = walletCollection.FindOne(ctx, bson.M{"user_id": userObjectID}).Decode(&wallet)
+	wallet, err := store.FindWalletByUserID(ctx, userObjectID)
 	if err != nil {
-		return errors.New("wallet no encontrada")
+		return nil, errors.New("wallet no encontrada")
 	}
 
-	if wallet.Balance < rideCost {
-		return errors.New("saldo insuficiente en la wallet")
+	entry, err := postOverdraft(ctx, wallet, EntryRideFare, delta, AccountRideRevenue, rideID)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = walletCollection.UpdateOne(ctx, bson.M{"user_id": userObjectID}, bson.M{
-		"$inc": bson.M{"balance": -rideCost},
-		"$set": bson.M{"last_updated": time.Now()},
-	})
+	transaction := entry.Transaction()
+	return &transaction, nil
+}
+
+// Undo the fare settlements of a ride (compensates SettleRideFare). What is
+// posted is the opposite of what the ride's settlements add up to, so running
+// it again, or for a ride never settled, posts nothing
+func ReverseRideFare(userID string, rideID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return errors.New("error al descontar saldo en la wallet")
+		return errors.New("ID de usuario inválido")
 	}
 
-	transaction := Transaction{
-		ID:        primitive.NewObjectID(),
-		UserID:    userObjectID,
-		Amount:    -rideCost,
-		Type:      "debit",
-		Timestamp: time.Now(),
+	wallet, err := store.FindWalletByUserID(ctx, userObjectID)
+	if err != nil {
+		return errors.New("wallet no encontrada")
 	}
 
-	_, err = transactionCollection.InsertOne(ctx, transaction)
+	entries, err := store.FindEntriesByWallet(ctx, wallet.ID)
 	if err != nil {
-		return errors.New("error al registrar la transacción en la wallet")
+		return err
+	}
+
+	settled := []money.Money{}
+	for _, entry := range entries {
+		if entry.Kind == EntryRideFare && entry.Reference == rideID {
+			settled = append(settled, entry.AmountFor(WalletAccount(wallet.ID)))
+		}
+	}
+	net, err := money.Sum(settled...)
+	if err != nil || net.IsZero() {
+		return err
 	}
 
-	return nil
+	_, err = postOverdraft(ctx, wallet, EntryRideFare, net.Neg(), AccountRideRevenue, rideID)
+	return err
+}
+
+// DELETE wallet of a user
+func DeleteWalletByUserID(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.DeleteWalletByUserID(ctx, userID)
 }
 
 // GET Wallet by: Wallet ID and User ID
 func GetWalletByIDAndUserID(walletID, userID string) (*Wallet, error) {
-	walletCollection := database.GetCollection("wallets")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -208,9 +254,8 @@ func GetWalletByIDAndUserID(walletID, userID string) (*Wallet, error) {
 		return nil, errors.New("user ID inválido")
 	}
 
-	var wallet Wallet
-	err = walletCollection.FindOne(ctx, bson.M{"_id": walletObjectID, "user_id": userObjectID}).Decode(&wallet)
-	if err != nil {
+	wallet, err := store.FindWalletByID(ctx, walletObjectID)
+	if err != nil || wallet.UserID != userObjectID {
 		return nil, errors.New("wallet no encontrada o no pertenece al usuario")
 	}
 
@@ -0,0 +1,55 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWalletNotFound    = errors.New("wallet no encontrada")
+	ErrInsufficientFunds = errors.New("saldo insuficiente")
+	ErrHoldNotFound      = errors.New("retención no encontrada")
+	ErrHoldConflict      = errors.New("la retención cambió de estado")
+)
+
+// WalletStore abstracts the persistence of wallets and of the ledger journal
+type WalletStore interface {
+	InsertWallet(ctx context.Context, wallet Wallet) error
+	FindWalletByID(ctx context.Context, id primitive.ObjectID) (Wallet, error)
+	FindWalletByUserID(ctx context.Context, userID primitive.ObjectID) (Wallet, error)
+	FindAllWallets(ctx context.Context) ([]Wallet, error)
+	DeleteWalletByUserID(ctx context.Context, userID primitive.ObjectID) error
+	// AdjustBalance applies delta to the cached balance, failing with
+	// ErrInsufficientFunds instead of spending held funds
+	AdjustBalance(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error
+	// ChargeBalance applies delta even if the balance ends up negative
+	ChargeBalance(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error
+	// AdjustHeld reserves (positive delta) or frees funds of the wallet, failing
+	// with ErrInsufficientFunds when the available balance does not cover it
+	AdjustHeld(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error
+	SetBalance(ctx context.Context, id primitive.ObjectID, balance money.Money, at time.Time) error
+	// Journal entries are append-only: there is no update nor delete
+	AppendEntry(ctx context.Context, entry JournalEntry) error
+	FindEntriesByWallet(ctx context.Context, walletID primitive.ObjectID) ([]JournalEntry, error)
+	FindEntries(ctx context.Context) ([]JournalEntry, error)
+	InsertHold(ctx context.Context, hold Hold) error
+	FindHoldByReference(ctx context.Context, reference string) (Hold, error)
+	FindExpiredHolds(ctx context.Context, now time.Time) ([]Hold, error)
+	// UpdateHoldIfStatus replaces the hold only while its stored status is
+	// still expected, failing with ErrHoldConflict otherwise
+	UpdateHoldIfStatus(ctx context.Context, hold Hold, expected string) error
+	// Currencies of the stored balances, journal postings and holds. Legacy
+	// numeric balances carry none and are not listed
+	FindCurrencies(ctx context.Context) ([]string, error)
+}
+
+var store WalletStore
+
+// Inject the store used by the wallet services
+func SetStore(s WalletStore) {
+	store = s
+}
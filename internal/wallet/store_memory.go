@@ -0,0 +1,262 @@
+package wallet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps wallets, journal entries and holds in memory, for tests and local demos
+type MemoryStore struct {
+	mu      sync.RWMutex
+	wallets map[primitive.ObjectID]Wallet
+	entries []JournalEntry
+	holds   map[primitive.ObjectID]Hold
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		wallets: make(map[primitive.ObjectID]Wallet),
+		holds:   make(map[primitive.ObjectID]Hold),
+	}
+}
+
+func (s *MemoryStore) InsertWallet(ctx context.Context, wallet Wallet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wallets[wallet.ID] = wallet
+	return nil
+}
+
+func (s *MemoryStore) FindWalletByID(ctx context.Context, id primitive.ObjectID) (Wallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wallet, ok := s.wallets[id]
+	if !ok {
+		return Wallet{}, ErrWalletNotFound
+	}
+	return wallet, nil
+}
+
+func (s *MemoryStore) FindWalletByUserID(ctx context.Context, userID primitive.ObjectID) (Wallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, wallet := range s.wallets {
+		if wallet.UserID == userID {
+			return wallet, nil
+		}
+	}
+	return Wallet{}, ErrWalletNotFound
+}
+
+func (s *MemoryStore) FindAllWallets(ctx context.Context) ([]Wallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wallets := make([]Wallet, 0, len(s.wallets))
+	for _, wallet := range s.wallets {
+		wallets = append(wallets, wallet)
+	}
+	return wallets, nil
+}
+
+func (s *MemoryStore) DeleteWalletByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, wallet := range s.wallets {
+		if wallet.UserID == userID {
+			delete(s.wallets, id)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) AdjustBalance(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wallet, ok := s.wallets[id]
+	if !ok {
+		return ErrWalletNotFound
+	}
+	if err := wallet.Balance.SameCurrency(delta); err != nil {
+		return err
+	}
+	if delta.IsNegative() && wallet.Available().LessThan(delta.Neg()) {
+		return ErrInsufficientFunds
+	}
+
+	wallet.Balance = wallet.Balance.Add(delta)
+	wallet.LastUpdated = at
+	s.wallets[id] = wallet
+	return nil
+}
+
+func (s *MemoryStore) ChargeBalance(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wallet, ok := s.wallets[id]
+	if !ok {
+		return ErrWalletNotFound
+	}
+	if err := wallet.Balance.SameCurrency(delta); err != nil {
+		return err
+	}
+
+	wallet.Balance = wallet.Balance.Add(delta)
+	wallet.LastUpdated = at
+	s.wallets[id] = wallet
+	return nil
+}
+
+func (s *MemoryStore) AdjustHeld(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wallet, ok := s.wallets[id]
+	if !ok {
+		return ErrWalletNotFound
+	}
+	if err := wallet.Balance.SameCurrency(delta); err != nil {
+		return err
+	}
+	if delta.IsPositive() && wallet.Available().LessThan(delta) {
+		return ErrInsufficientFunds
+	}
+
+	wallet.Held = wallet.Held.Add(delta)
+	wallet.LastUpdated = at
+	s.wallets[id] = wallet
+	return nil
+}
+
+func (s *MemoryStore) SetBalance(ctx context.Context, id primitive.ObjectID, balance money.Money, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wallet, ok := s.wallets[id]
+	if !ok {
+		return ErrWalletNotFound
+	}
+
+	wallet.Balance = balance
+	wallet.LastUpdated = at
+	s.wallets[id] = wallet
+	return nil
+}
+
+func (s *MemoryStore) AppendEntry(ctx context.Context, entry JournalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Postings = append([]Posting{}, entry.Postings...)
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *MemoryStore) FindEntriesByWallet(ctx context.Context, walletID primitive.ObjectID) ([]JournalEntry, error) {
+	return s.filterEntries(func(e JournalEntry) bool { return e.WalletID == walletID }), nil
+}
+
+func (s *MemoryStore) FindEntries(ctx context.Context) ([]JournalEntry, error) {
+	return s.filterEntries(func(JournalEntry) bool { return true }), nil
+}
+
+func (s *MemoryStore) InsertHold(ctx context.Context, hold Hold) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holds[hold.ID] = hold
+	return nil
+}
+
+func (s *MemoryStore) FindHoldByReference(ctx context.Context, reference string) (Hold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, hold := range s.holds {
+		if hold.Reference == reference {
+			return hold, nil
+		}
+	}
+	return Hold{}, ErrHoldNotFound
+}
+
+func (s *MemoryStore) FindExpiredHolds(ctx context.Context, now time.Time) ([]Hold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	holds := []Hold{}
+	for _, hold := range s.holds {
+		if hold.Status == HoldActive && hold.ExpiresAt.Before(now) {
+			holds = append(holds, hold)
+		}
+	}
+	return holds, nil
+}
+
+func (s *MemoryStore) UpdateHoldIfStatus(ctx context.Context, hold Hold, expected string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.holds[hold.ID]
+	if !ok {
+		return ErrHoldNotFound
+	}
+	if current.Status != expected {
+		return ErrHoldConflict
+	}
+
+	s.holds[hold.ID] = hold
+	return nil
+}
+
+func (s *MemoryStore) filterEntries(match func(JournalEntry) bool) []JournalEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []JournalEntry{}
+	for _, entry := range s.entries {
+		if match(entry) {
+			entry.Postings = append([]Posting{}, entry.Postings...)
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (s *MemoryStore) FindCurrencies(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{}
+	for _, wallet := range s.wallets {
+		seen[wallet.Balance.Currency] = true
+		seen[wallet.Held.Currency] = true
+	}
+	for _, entry := range s.entries {
+		for _, posting := range entry.Postings {
+			seen[posting.Amount.Currency] = true
+		}
+	}
+	for _, hold := range s.holds {
+		seen[hold.Amount.Currency] = true
+	}
+
+	currencies := []string{}
+	for currency := range seen {
+		if currency != "" {
+			currencies = append(currencies, currency)
+		}
+	}
+	return currencies, nil
+}
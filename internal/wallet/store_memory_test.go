@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryStoreAdjustments(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		adjust      func(s *MemoryStore, id primitive.ObjectID) error
+		wantErr     error
+		wantBalance int64
+		wantHeld    int64
+	}{
+		{name: "credit", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.AdjustBalance(ctx, id, money.FromMinor(500), time.Now())
+		}, wantBalance: 1500, wantHeld: 200},
+		{name: "debit of what is available", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.AdjustBalance(ctx, id, money.FromMinor(-800), time.Now())
+		}, wantBalance: 200, wantHeld: 200},
+		{name: "debit of held funds", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.AdjustBalance(ctx, id, money.FromMinor(-801), time.Now())
+		}, wantErr: ErrInsufficientFunds, wantBalance: 1000, wantHeld: 200},
+		{name: "charge into debt", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.ChargeBalance(ctx, id, money.FromMinor(-1500), time.Now())
+		}, wantBalance: -500, wantHeld: 200},
+		{name: "hold what is available", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.AdjustHeld(ctx, id, money.FromMinor(800), time.Now())
+		}, wantBalance: 1000, wantHeld: 1000},
+		{name: "hold more than available", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.AdjustHeld(ctx, id, money.FromMinor(801), time.Now())
+		}, wantErr: ErrInsufficientFunds, wantBalance: 1000, wantHeld: 200},
+		{name: "other currency", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.AdjustBalance(ctx, id, money.New(100, "EUR"), time.Now())
+		}, wantErr: money.ErrCurrencyMismatch, wantBalance: 1000, wantHeld: 200},
+		{name: "unknown wallet", adjust: func(s *MemoryStore, id primitive.ObjectID) error {
+			return s.AdjustBalance(ctx, primitive.NewObjectID(), money.FromMinor(1), time.Now())
+		}, wantErr: ErrWalletNotFound, wantBalance: 1000, wantHeld: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			wallet := Wallet{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Balance: money.FromMinor(1000), Held: money.FromMinor(200)}
+			if err := s.InsertWallet(ctx, wallet); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.adjust(s, wallet.ID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			found, err := s.FindWalletByUserID(ctx, wallet.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found.Balance != money.FromMinor(tt.wantBalance) || found.Held != money.FromMinor(tt.wantHeld) {
+				t.Errorf("balance = %s, held = %s; want %s, %s", found.Balance, found.Held, money.FromMinor(tt.wantBalance), money.FromMinor(tt.wantHeld))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreHolds(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+
+	hold := Hold{ID: primitive.NewObjectID(), Reference: "ride", Status: HoldActive, ExpiresAt: now.Add(-time.Minute)}
+	if err := s.InsertHold(ctx, hold); err != nil {
+		t.Fatal(err)
+	}
+
+	if expired, _ := s.FindExpiredHolds(ctx, now); len(expired) != 1 {
+		t.Errorf("FindExpiredHolds() = %d holds, want 1", len(expired))
+	}
+
+	released := hold
+	released.Status = HoldReleased
+	if err := s.UpdateHoldIfStatus(ctx, released, HoldCaptured); !errors.Is(err, ErrHoldConflict) {
+		t.Errorf("UpdateHoldIfStatus(stale) = %v, want ErrHoldConflict", err)
+	}
+	if err := s.UpdateHoldIfStatus(ctx, released, HoldActive); err != nil {
+		t.Fatal(err)
+	}
+	if expired, _ := s.FindExpiredHolds(ctx, now); len(expired) != 0 {
+		t.Errorf("FindExpiredHolds() returned a released hold")
+	}
+
+	if found, err := s.FindHoldByReference(ctx, "ride"); err != nil || found.Status != HoldReleased {
+		t.Errorf("FindHoldByReference() = %+v, %v", found, err)
+	}
+	if _, err := s.FindHoldByReference(ctx, "other"); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("FindHoldByReference(unknown) = %v, want ErrHoldNotFound", err)
+	}
+}
+
+func TestMemoryStoreEntriesAreCopies(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	walletID := primitive.NewObjectID()
+	entry := JournalEntry{ID: primitive.NewObjectID(), WalletID: walletID, Postings: []Posting{{Account: "a", Amount: money.FromMinor(1)}}}
+	if err := s.AppendEntry(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	entry.Postings[0].Amount = money.FromMinor(99)
+	entries, err := s.FindEntriesByWallet(ctx, walletID)
+	if err != nil || len(entries) != 1 || entries[0].Postings[0].Amount != money.FromMinor(1) {
+		t.Fatalf("FindEntriesByWallet() = %+v, %v", entries, err)
+	}
+	entries[0].Postings[0].Amount = money.FromMinor(99)
+	if again, _ := s.FindEntries(ctx); again[0].Postings[0].Amount != money.FromMinor(1) {
+		t.Error("the store shares the postings it returns")
+	}
+}
@@ -0,0 +1,269 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists wallets, journal entries and holds in MongoDB collections
+type MongoStore struct {
+	wallets *mongo.Collection
+	entries *mongo.Collection
+	holds   *mongo.Collection
+}
+
+func NewMongoStore(wallets, entries, holds *mongo.Collection) *MongoStore {
+	return &MongoStore{wallets: wallets, entries: entries, holds: holds}
+}
+
+func (s *MongoStore) InsertWallet(ctx context.Context, wallet Wallet) error {
+	_, err := s.wallets.InsertOne(ctx, wallet)
+	return err
+}
+
+func (s *MongoStore) FindWalletByID(ctx context.Context, id primitive.ObjectID) (Wallet, error) {
+	return s.findWallet(ctx, bson.M{"_id": id})
+}
+
+func (s *MongoStore) FindWalletByUserID(ctx context.Context, userID primitive.ObjectID) (Wallet, error) {
+	return s.findWallet(ctx, bson.M{"user_id": userID})
+}
+
+func (s *MongoStore) FindAllWallets(ctx context.Context) ([]Wallet, error) {
+	cursor, err := s.wallets.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var wallets []Wallet
+	if err := cursor.All(ctx, &wallets); err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
+
+func (s *MongoStore) DeleteWalletByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.wallets.DeleteOne(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (s *MongoStore) AdjustBalance(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error {
+	filter := bson.M{"_id": id}
+	if delta.IsNegative() {
+		// Solo descuenta si el saldo disponible alcanza (operación atómica)
+		filter["$expr"] = availableAtLeast(-delta.Amount)
+	}
+
+	return s.incWallet(ctx, id, filter, "balance.amount", delta.Amount, at)
+}
+
+func (s *MongoStore) ChargeBalance(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error {
+	return s.incWallet(ctx, id, bson.M{"_id": id}, "balance.amount", delta.Amount, at)
+}
+
+func (s *MongoStore) AdjustHeld(ctx context.Context, id primitive.ObjectID, delta money.Money, at time.Time) error {
+	filter := bson.M{"_id": id}
+	if delta.IsPositive() {
+		filter["$expr"] = availableAtLeast(delta.Amount)
+	}
+
+	return s.incWallet(ctx, id, filter, "held.amount", delta.Amount, at)
+}
+
+// Condition balance - held >= amount, for wallets saved before holds existed too
+func availableAtLeast(amount int64) bson.M {
+	return bson.M{"$gte": bson.A{
+		bson.M{"$subtract": bson.A{"$balance.amount", bson.M{"$ifNull": bson.A{"$held.amount", 0}}}},
+		amount,
+	}}
+}
+
+func (s *MongoStore) incWallet(ctx context.Context, id primitive.ObjectID, filter bson.M, field string, amount int64, at time.Time) error {
+	update := bson.M{
+		"$inc": bson.M{field: amount},
+		"$set": bson.M{"last_updated": at},
+	}
+
+	result, err := s.wallets.UpdateOne(ctx, filter, update)
+	if err != nil || result.MatchedCount == 0 {
+		// Una wallet con el saldo en el formato antiguo se convierte y se reintenta
+		if upgraded, upgradeErr := s.upgradeLegacyBalance(ctx, id); upgradeErr != nil {
+			return upgradeErr
+		} else if upgraded {
+			result, err = s.wallets.UpdateOne(ctx, filter, update)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.FindWalletByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// Wallets saved before amounts were kept in minor units store the balance as
+// a plain number, where $inc and $expr cannot reach balance.amount. Rewrite it
+// in the current format on the first write; the filter on the old value makes
+// it safe when two writes race. Reports whether the wallet was in the old format
+func (s *MongoStore) upgradeLegacyBalance(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	var raw bson.Raw
+	err := s.wallets.FindOne(ctx, bson.M{"_id": id, "balance": bson.M{"$type": "number"}}).Decode(&raw)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	legacy := raw.Lookup("balance")
+	var balance money.Money
+	if err := balance.UnmarshalBSONValue(legacy.Type, legacy.Value); err != nil {
+		return false, err
+	}
+
+	_, err = s.wallets.UpdateOne(ctx, bson.M{"_id": id, "balance": legacy}, bson.M{
+		"$set": bson.M{"balance": balance},
+	})
+	return err == nil, err
+}
+
+func (s *MongoStore) SetBalance(ctx context.Context, id primitive.ObjectID, balance money.Money, at time.Time) error {
+	result, err := s.wallets.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"balance": balance, "last_updated": at},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWalletNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) AppendEntry(ctx context.Context, entry JournalEntry) error {
+	_, err := s.entries.InsertOne(ctx, entry)
+	return err
+}
+
+func (s *MongoStore) FindEntriesByWallet(ctx context.Context, walletID primitive.ObjectID) ([]JournalEntry, error) {
+	return s.findEntries(ctx, bson.M{"wallet_id": walletID})
+}
+
+func (s *MongoStore) FindEntries(ctx context.Context) ([]JournalEntry, error) {
+	return s.findEntries(ctx, bson.M{})
+}
+
+func (s *MongoStore) InsertHold(ctx context.Context, hold Hold) error {
+	_, err := s.holds.InsertOne(ctx, hold)
+	return err
+}
+
+func (s *MongoStore) FindHoldByReference(ctx context.Context, reference string) (Hold, error) {
+	var hold Hold
+	err := s.holds.FindOne(ctx, bson.M{"reference": reference}).Decode(&hold)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return hold, ErrHoldNotFound
+	}
+	return hold, err
+}
+
+func (s *MongoStore) FindExpiredHolds(ctx context.Context, now time.Time) ([]Hold, error) {
+	cursor, err := s.holds.Find(ctx, bson.M{"status": HoldActive, "expires_at": bson.M{"$lt": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var holds []Hold
+	if err := cursor.All(ctx, &holds); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (s *MongoStore) UpdateHoldIfStatus(ctx context.Context, hold Hold, expected string) error {
+	result, err := s.holds.ReplaceOne(ctx, bson.M{"_id": hold.ID, "status": expected}, hold)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if err := s.holds.FindOne(ctx, bson.M{"_id": hold.ID}).Err(); errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrHoldNotFound
+		}
+		return ErrHoldConflict
+	}
+	return nil
+}
+
+// Create the indexes used to find holds by ride and by expiry
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.holds.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "reference", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+	})
+	return err
+}
+
+func (s *MongoStore) findWallet(ctx context.Context, filter bson.M) (Wallet, error) {
+	var wallet Wallet
+	err := s.wallets.FindOne(ctx, filter).Decode(&wallet)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return wallet, ErrWalletNotFound
+	}
+	return wallet, err
+}
+
+func (s *MongoStore) findEntries(ctx context.Context, filter bson.M) ([]JournalEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := s.entries.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []JournalEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *MongoStore) FindCurrencies(ctx context.Context) ([]string, error) {
+	fields := []struct {
+		collection *mongo.Collection
+		field      string
+	}{
+		{s.wallets, "balance.currency"},
+		{s.wallets, "held.currency"},
+		{s.entries, "postings.amount.currency"},
+		{s.holds, "amount.currency"},
+	}
+
+	seen := map[string]bool{}
+	currencies := []string{}
+	for _, f := range fields {
+		values, err := f.collection.Distinct(ctx, f.field, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if currency, ok := value.(string); ok && currency != "" && !seen[currency] {
+				seen[currency] = true
+				currencies = append(currencies, currency)
+			}
+		}
+	}
+	return currencies, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrInvalidActionToken = errors.New("enlace inválido o expirado")
+
+// Purposes of action tokens. A token only works for the purpose it was issued for
+const (
+	PurposeVerifyEmail   = "verify-email"
+	PurposeResetPassword = "reset-password"
+	PurposeMFALogin      = "mfa-login" // Segundo paso del inicio de sesión
+)
+
+// ActionClaims are carried by the single-use tokens sent by email or handed
+// out between the steps of a sign in. Binding
+// ties the token to the state it was issued for (the email to verify, the
+// password to replace), so it stops working when that state changes
+type ActionClaims struct {
+	Purpose string `json:"purpose"`
+	Binding string `json:"bnd,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Sign a token for the subject that expires after ttl
+func IssueActionToken(purpose, subject, binding string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &ActionClaims{
+		Purpose: purpose,
+		Binding: binding,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        randomID(),
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{actionAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	return signToken(claims, actionTokenType)
+}
+
+// Check signature, expiry and purpose of an action token without using it up
+func ParseActionToken(tokenString, purpose string) (*ActionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ActionClaims{}, verificationKey)
+	if err != nil {
+		return nil, ErrInvalidActionToken
+	}
+
+	claims, ok := token.Claims.(*ActionClaims)
+	if !ok || !token.Valid || token.Header["typ"] != actionTokenType || !claims.VerifyAudience(actionAudience, true) || claims.Purpose != purpose || claims.ID == "" || claims.Subject == "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidActionToken
+	}
+	return claims, nil
+}
+
+// Use up a parsed action token. Only the first call for a token succeeds
+func ConsumeActionToken(claims *ActionClaims) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := store.UseActionToken(ctx, claims.ID, claims.ExpiresAt.Time)
+	if errors.Is(err, ErrActionTokenUsed) {
+		return ErrInvalidActionToken
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseActionToken(t *testing.T) {
+	setupAuth(t)
+	valid, err := IssueActionToken(PurposeResetPassword, "user-1", "hash", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := IssueActionToken(PurposeResetPassword, "user-1", "hash", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutSubject, err := IssueActionToken(PurposeResetPassword, "", "hash", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mismo kid, otro secreto: la firma no verifica
+	if err := ConfigureKeys(nil, strings.Repeat("x", 64), "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	forged, err := IssueActionToken(PurposeResetPassword, "user-1", "hash", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setupAuth(t)
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		wantErr bool
+	}{
+		{name: "valid", token: valid, purpose: PurposeResetPassword},
+		{name: "other purpose", token: valid, purpose: PurposeVerifyEmail, wantErr: true},
+		{name: "expired", token: expired, purpose: PurposeResetPassword, wantErr: true},
+		{name: "without subject", token: withoutSubject, purpose: PurposeResetPassword, wantErr: true},
+		{name: "other key", token: forged, purpose: PurposeResetPassword, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseActionToken(tt.token, tt.purpose)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidActionToken) {
+					t.Errorf("ParseActionToken() = %v, want ErrInvalidActionToken", err)
+				}
+				return
+			}
+			if err != nil || claims.Subject != "user-1" || claims.Binding != "hash" {
+				t.Errorf("ParseActionToken() = %+v, %v", claims, err)
+			}
+		})
+	}
+}
+
+func TestConsumeActionToken(t *testing.T) {
+	setupAuth(t)
+	token, err := IssueActionToken(PurposeVerifyEmail, "user-1", "ana@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseActionToken(token, PurposeVerifyEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ConsumeActionToken(claims); err != nil {
+		t.Fatal(err)
+	}
+	// Cada enlace sirve una sola vez, aunque siga vigente
+	if err := ConsumeActionToken(claims); !errors.Is(err, ErrInvalidActionToken) {
+		t.Errorf("second ConsumeActionToken() = %v, want ErrInvalidActionToken", err)
+	}
+
+	other, err := IssueActionToken(PurposeVerifyEmail, "user-1", "ana@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherClaims, err := ParseActionToken(other, PurposeVerifyEmail)
+	if err != nil || ConsumeActionToken(otherClaims) != nil {
+		t.Errorf("another token for the same subject was rejected: %v", err)
+	}
+}
@@ -8,21 +8,31 @@ import (
 
 // GET User id from JWT
 func GetAuthenticatedUserID(r *http.Request) (string, error) {
+	claims, err := GetAuthenticatedClaims(r)
+	if err != nil {
+		return "", err
+	}
+
+	return claims.UserID, nil
+}
+
+// GET Claims (user id and roles) from JWT
+func GetAuthenticatedClaims(r *http.Request) (*Claims, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", errors.New("token no encontrado")
+		return nil, errors.New("token no encontrado")
 	}
 
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return "", errors.New("formato de token inválido")
+		return nil, errors.New("formato de token inválido")
 	}
 	tokenString := parts[1]
 
 	claims, err := ValidateToken(tokenString)
 	if err != nil {
-		return "", errors.New("token inválido o expirado")
+		return nil, errors.New("token inválido o expirado")
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
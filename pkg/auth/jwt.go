@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"net/http"
 	"strings"
@@ -9,40 +12,68 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var SecretKey = []byte("clave-secreta-super-segura")
+var ErrTokenRevoked = errors.New("la sesión del token fue cerrada")
+
+// Type (typ header) and audience of each kind of token. Action tokens are
+// signed with the same published keys, so verifiers must check both to
+// never take one for an access token
+const (
+	accessTokenType = "at+jwt"
+	actionTokenType = "action+jwt"
+	accessAudience  = "bike-tracker-api"
+	actionAudience  = "bike-tracker-actions"
+)
 
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string   `json:"user_id"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionID string   `json:"sid"`
+	MFA       bool     `json:"mfa,omitempty"` // La sesión se abrió con un segundo factor
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID string) (string, error) {
+// Sign a short-lived access token for a session
+func generateAccessToken(session Session, roles []string, now time.Time) (string, error) {
 	claims := &Claims{
-		UserID: userID,
+		UserID:    session.UserID,
+		Roles:     roles,
+		SessionID: session.ID,
+		MFA:       session.MFA,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        randomID(),
+			Audience:  jwt.ClaimStrings{accessAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	return token.SignedString(SecretKey)
+	return signToken(claims, accessTokenType)
 }
 
+// Validate signature and expiry of an access token, and that its session was
+// not closed
 func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verificationKey)
 	if err != nil {
 		return nil, err
 	}
 
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || token.Header["typ"] != accessTokenType || !claims.VerifyAudience(accessAudience, true) || claims.SessionID == "" {
 		return nil, errors.New("token inválido o no autorizado")
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revoked, err := store.IsRevoked(ctx, claims.SessionID)
+	if err != nil {
+		return nil, errors.New("error al comprobar la sesión: " + err.Error())
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
 	return claims, nil
 }
 
@@ -64,3 +95,9 @@ func ExtractUserIDFromRequest(r *http.Request) (string, error) {
 
 	return claims.UserID, nil
 }
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const minSecretLength = 32
+
+var ErrUnknownKey = errors.New("clave de firma desconocida")
+
+// signingKey is a key tokens are verified with and, when the private part is
+// known, signed with
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	signer interface{} // Clave privada o secreto; nil si solo verifica
+	public interface{} // Clave pública o secreto
+}
+
+var (
+	keys      = map[string]signingKey{}
+	activeKey signingKey
+)
+
+// Configure the signing keys: every key verifies tokens with its kid, the
+// active one signs new tokens. Keeping retired keys lets their tokens live
+// until they expire
+func ConfigureKeys(keyFiles map[string]string, secret, secretID, activeID string) error {
+	loaded := map[string]signingKey{}
+	for id, path := range keyFiles {
+		key, err := loadKey(id, path)
+		if err != nil {
+			return err
+		}
+		loaded[id] = key
+	}
+
+	if secret != "" {
+		if len(secret) < minSecretLength {
+			return fmt.Errorf("JWT_SECRET debe tener al menos %d caracteres", minSecretLength)
+		}
+		if _, ok := loaded[secretID]; ok {
+			return errors.New("kid repetido: " + secretID)
+		}
+		loaded[secretID] = signingKey{id: secretID, method: jwt.SigningMethodHS256, signer: []byte(secret), public: []byte(secret)}
+	}
+
+	if len(loaded) == 0 {
+		return errors.New("no hay claves de firma configuradas")
+	}
+
+	if activeID == "" {
+		if len(loaded) > 1 {
+			return errors.New("JWT_ACTIVE_KID es requerido con varias claves")
+		}
+		for id := range loaded {
+			activeID = id
+		}
+	}
+	active, ok := loaded[activeID]
+	if !ok {
+		return errors.New("JWT_ACTIVE_KID no corresponde a ninguna clave: " + activeID)
+	}
+	if active.signer == nil {
+		return errors.New("la clave activa necesita su parte privada: " + activeID)
+	}
+
+	keys, activeKey = loaded, active
+	return nil
+}
+
+// Configure signing keys from JWT_KEYS ("kid=path,kid=path" of PEM keys, or
+// of files holding an HS256 secret), JWT_SECRET with JWT_SECRET_KID and
+// JWT_ACTIVE_KID. Without any, an ephemeral Ed25519 key is generated, so
+// tokens do not survive a restart
+func ConfigureKeysFromEnv() error {
+	keyFiles := map[string]string{}
+	if value := os.Getenv("JWT_KEYS"); value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			id, path, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || id == "" || path == "" {
+				return errors.New("JWT_KEYS debe tener el formato kid=ruta,kid=ruta")
+			}
+			if _, repeated := keyFiles[id]; repeated {
+				return errors.New("kid repetido en JWT_KEYS: " + id)
+			}
+			keyFiles[id] = path
+		}
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	secretID := os.Getenv("JWT_SECRET_KID")
+	if secretID == "" {
+		secretID = "hs256"
+	}
+
+	if len(keyFiles) == 0 && secret == "" {
+		return useEphemeralKey()
+	}
+	return ConfigureKeys(keyFiles, secret, secretID, os.Getenv("JWT_ACTIVE_KID"))
+}
+
+func useEphemeralKey() error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	id := "ephemeral-" + randomID()[:8]
+	keys = map[string]signingKey{id: {id: id, method: jwt.SigningMethodEdDSA, signer: private, public: public}}
+	activeKey = keys[id]
+
+	logger.Info("ConfigureKeysFromEnv - Sin JWT_KEYS ni JWT_SECRET: se usa una clave temporal y los tokens no sobreviven un reinicio", map[string]interface{}{
+		"kid": id,
+	})
+	return nil
+}
+
+// Load a PEM private key (PKCS#8, PKCS#1 or SEC 1), a PEM public key that only
+// verifies, or an HS256 secret from a file
+func loadKey(id, path string) (signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("error al leer la clave %s: %w", id, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := strings.TrimSpace(string(data))
+		if len(secret) < minSecretLength {
+			return signingKey{}, fmt.Errorf("la clave %s no es PEM ni un secreto de al menos %d caracteres", id, minSecretLength)
+		}
+		return signingKey{id: id, method: jwt.SigningMethodHS256, signer: []byte(secret), public: []byte(secret)}, nil
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = errors.New("tipo PEM no soportado: " + block.Type)
+	}
+	if err != nil {
+		return signingKey{}, fmt.Errorf("error al leer la clave %s: %w", id, err)
+	}
+
+	key := signingKey{id: id}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.signer = signer
+		parsed = signer.Public()
+	}
+
+	switch public := parsed.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return signingKey{}, fmt.Errorf("la clave RSA %s debe tener al menos 2048 bits", id)
+		}
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return signingKey{}, fmt.Errorf("la clave EC %s debe usar la curva P-256", id)
+		}
+		key.method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+		if private, ok := key.signer.(ed25519.PrivateKey); ok {
+			key.signer = private
+		}
+	default:
+		return signingKey{}, fmt.Errorf("tipo de clave no soportado en %s", id)
+	}
+	key.public = parsed
+	return key, nil
+}
+
+// Key that verifies a token: the one named by its kid, and only with the
+// algorithm of that key
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("algoritmo de firma inesperado: " + token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// Sign claims with the active key, naming it in the kid header and the kind
+// of token in the typ header
+func signToken(claims jwt.Claims, typ string) (string, error) {
+	token := jwt.NewWithClaims(activeKey.method, claims)
+	token.Header["kid"] = activeKey.id
+	token.Header["typ"] = typ
+	return token.SignedString(activeKey.signer)
+}
+
+// Asymmetric keys sorted by kid; secrets are never published
+func publicKeys() []signingKey {
+	published := []signingKey{}
+	for _, key := range keys {
+		if key.method != jwt.SigningMethodHS256 {
+			published = append(published, key)
+		}
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].id < published[j].id })
+	return published
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write a PEM block to a temporary file and return its path
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func pkcs8(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func sec1(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestConfigureKeys(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	smallEC, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	publicDER, _ := x509.MarshalPKIXPublicKey(edKey.Public())
+
+	edPath := writePEM(t, "PRIVATE KEY", pkcs8(t, edKey))
+	ecPath := writePEM(t, "EC PRIVATE KEY", sec1(t, ecKey))
+	rsaPath := writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	publicPath := writePEM(t, "PUBLIC KEY", publicDER)
+	smallPath := writePEM(t, "PRIVATE KEY", pkcs8(t, smallEC))
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretPath, []byte(strings.Repeat("s", 40)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	secret := strings.Repeat("k", 64)
+
+	tests := []struct {
+		name     string
+		keyFiles map[string]string
+		secret   string
+		secretID string
+		activeID string
+		wantAlg  string
+		wantErr  bool
+	}{
+		{name: "secret", secret: secret, secretID: "hs", wantAlg: "HS256"},
+		{name: "ed25519", keyFiles: map[string]string{"ed": edPath}, wantAlg: "EdDSA"},
+		{name: "p-256", keyFiles: map[string]string{"ec": ecPath}, wantAlg: "ES256"},
+		{name: "rsa", keyFiles: map[string]string{"rsa": rsaPath}, wantAlg: "RS256"},
+		{name: "secret file", keyFiles: map[string]string{"file": secretPath}, wantAlg: "HS256"},
+		{name: "active among several", keyFiles: map[string]string{"ed": edPath, "ec": ecPath}, activeID: "ec", wantAlg: "ES256"},
+		{name: "several without active", keyFiles: map[string]string{"ed": edPath, "ec": ecPath}, wantErr: true},
+		{name: "unknown active", keyFiles: map[string]string{"ed": edPath}, activeID: "otra", wantErr: true},
+		{name: "public key active", keyFiles: map[string]string{"pub": publicPath}, wantErr: true},
+		{name: "short secret", secret: "corto", secretID: "hs", wantErr: true},
+		{name: "repeated kid", keyFiles: map[string]string{"hs": edPath}, secret: secret, secretID: "hs", activeID: "hs", wantErr: true},
+		{name: "other curve", keyFiles: map[string]string{"ec": smallPath}, wantErr: true},
+		{name: "missing file", keyFiles: map[string]string{"ed": filepath.Join(t.TempDir(), "nada.pem")}, wantErr: true},
+		{name: "no keys", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupAuth(t)
+			err := ConfigureKeys(tt.keyFiles, tt.secret, tt.secretID, tt.activeID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigureKeys() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				// Una configuración inválida conserva las claves anteriores
+				if activeKey.id != "test" {
+					t.Errorf("active key = %s, want the previous one", activeKey.id)
+				}
+				return
+			}
+
+			pair, err := StartSession("user-1", nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ValidateToken(pair.AccessToken); err != nil || activeKey.method.Alg() != tt.wantAlg {
+				t.Errorf("ValidateToken() = %v with %s, want %s", err, activeKey.method.Alg(), tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	setupAuth(t)
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldPath := writePEM(t, "PRIVATE KEY", pkcs8(t, oldKey))
+	newPath := writePEM(t, "PRIVATE KEY", pkcs8(t, newKey))
+
+	if err := ConfigureKeys(map[string]string{"2025-01": oldPath}, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := StartSession("user-1", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// La clave retirada sigue verificando los tokens que firmó
+	if err := ConfigureKeys(map[string]string{"2025-01": oldPath, "2025-02": newPath}, "", "", "2025-02"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(pair.AccessToken); err != nil {
+		t.Errorf("ValidateToken(retired key) = %v", err)
+	}
+
+	// Sin ella, el kid ya no se reconoce
+	if err := ConfigureKeys(map[string]string{"2025-02": newPath}, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(pair.AccessToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("ValidateToken(removed key) = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestTokenKinds(t *testing.T) {
+	setupAuth(t)
+	pair, err := StartSession("user-1", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	action, err := IssueActionToken(PurposeVerifyEmail, "user-1", "ana@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ambos se firman con la misma clave, pero ninguno sirve por el otro
+	if _, err := ValidateToken(action); err == nil {
+		t.Error("ValidateToken() accepted an action token")
+	}
+	if _, err := ParseActionToken(pair.AccessToken, PurposeVerifyEmail); !errors.Is(err, ErrInvalidActionToken) {
+		t.Errorf("ParseActionToken(access token) = %v, want ErrInvalidActionToken", err)
+	}
+
+	// Un token sin firma no se acepta aunque nombre una clave conocida
+	parts := strings.Split(pair.AccessToken, ".")
+	unsigned := encodeSegment([]byte(`{"alg":"none","kid":"test","typ":"at+jwt"}`)) + "." + parts[1] + "."
+	if _, err := ValidateToken(unsigned); err == nil {
+		t.Error("ValidateToken() accepted an unsigned token")
+	}
+}
+
+func TestHandleJWKS(t *testing.T) {
+	setupAuth(t)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPath := writePEM(t, "PRIVATE KEY", pkcs8(t, edKey))
+	ecPath := writePEM(t, "PRIVATE KEY", pkcs8(t, ecKey))
+	if err := ConfigureKeys(map[string]string{"ed": edPath, "ec": ecPath}, strings.Repeat("k", 64), "hs", "ed"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	HandleJWKS(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(w.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	// Los secretos nunca se publican y las claves salen ordenadas por kid
+	if len(set.Keys) != 2 || set.Keys[0].KeyID != "ec" || set.Keys[1].KeyID != "ed" {
+		t.Fatalf("keys = %+v", set.Keys)
+	}
+	if ec := set.Keys[0]; ec.KeyType != "EC" || ec.Curve != "P-256" || ec.Algorithm != "ES256" || ec.X == "" || ec.Y == "" {
+		t.Errorf("EC key = %+v", ec)
+	}
+	if ed := set.Keys[1]; ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.X != encodeSegment(edKey.Public().(ed25519.PublicKey)) {
+		t.Errorf("Ed25519 key = %+v", ed)
+	}
+
+	w = httptest.NewRecorder()
+	HandleJWKS(w, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", w.Code)
+	}
+}
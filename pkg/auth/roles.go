@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Role of a user. A user may hold several; staff accounts usually keep
+// RoleRider too so they can ride
+type Role = string
+
+// Roles
+const (
+	RoleRider      Role = "rider"
+	RoleOperator   Role = "operator"
+	RoleFleetAdmin Role = "fleet-admin"
+	RoleFinance    Role = "finance"
+	RoleSupport    Role = "support"
+)
+
+// Permission required by a route
+type Permission string
+
+// Permissions
+const (
+	PermRide          Permission = "ride"               // Viajes, reservas, wallet y reportes propios
+	PermFleetRead     Permission = "fleet:read"         // Ver toda la flota
+	PermFleetOperate  Permission = "fleet:operate"      // Cambiar estados y enviar comandos a los candados
+	PermFleetManage   Permission = "fleet:manage"       // Registrar bicicletas, claves de dispositivo y zonas
+	PermMaintenance   Permission = "maintenance:manage" // Reglas y órdenes de trabajo
+	PermIssuesManage  Permission = "issues:manage"      // Revisar, vincular y cerrar reportes
+	PermRidesRead     Permission = "rides:read"         // Ver viajes de cualquier usuario
+	PermRidesReview   Permission = "rides:review"       // Revisar viajes finalizados por el sistema
+	PermPricingManage Permission = "pricing:manage"     // Publicar tarifas
+	PermLedger        Permission = "wallet:ledger"      // Verificar y reconstruir el libro mayor
+	PermUsersManage   Permission = "users:manage"       // Asignar roles
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleRider: {PermRide},
+	RoleOperator: {
+		PermFleetRead, PermFleetOperate, PermMaintenance, PermIssuesManage, PermRidesRead,
+	},
+	RoleFleetAdmin: {
+		PermFleetRead, PermFleetOperate, PermFleetManage, PermMaintenance, PermIssuesManage,
+		PermRidesRead, PermRidesReview, PermPricingManage, PermUsersManage,
+	},
+	RoleFinance: {PermRidesRead, PermRidesReview, PermPricingManage, PermLedger},
+	RoleSupport: {PermFleetRead, PermIssuesManage, PermRidesRead, PermRidesReview},
+}
+
+// Roles whose permissions only apply to sessions opened with a second factor
+var mfaRoles = map[Role]bool{}
+
+// Require MFA for the given roles
+func ConfigureMFARoles(roles []string) error {
+	configured := map[Role]bool{}
+	for _, role := range roles {
+		if !ValidRole(role) {
+			return errors.New("rol desconocido en MFA_REQUIRED_ROLES: " + role)
+		}
+		configured[role] = true
+	}
+	mfaRoles = configured
+	return nil
+}
+
+// Read the roles that require MFA from MFA_REQUIRED_ROLES (comma separated)
+func ConfigureMFAFromEnv() error {
+	roles := []string{}
+	for _, role := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return ConfigureMFARoles(roles)
+}
+
+// Whether any of the roles requires MFA
+func RequiresMFA(roles []string) bool {
+	for _, role := range roles {
+		if mfaRoles[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether role is a known role
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Roles of the claims. Tokens issued before roles existed belong to riders
+func (c *Claims) RoleList() []Role {
+	if len(c.Roles) == 0 {
+		return []Role{RoleRider}
+	}
+	return c.Roles
+}
+
+// Whether any role of the claims grants permission. Roles that require MFA
+// grant nothing to sessions opened with the password alone
+func (c *Claims) Can(permission Permission) bool {
+	for _, role := range c.RoleList() {
+		if grants(role, permission) && (c.MFA || !mfaRoles[role]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether permission is only missing because the session has no second factor
+func (c *Claims) NeedsMFA(permission Permission) bool {
+	if c.MFA {
+		return false
+	}
+	for _, role := range c.RoleList() {
+		if grants(role, permission) && mfaRoles[role] {
+			return true
+		}
+	}
+	return false
+}
+
+func grants(role Role, permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the user of the request token has permission
+func HasPermission(r *http.Request, permission Permission) bool {
+	claims, err := GetAuthenticatedClaims(r)
+	return err == nil && claims.Can(permission)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCan(t *testing.T) {
+	if err := ConfigureMFARoles([]string{RoleFinance}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ConfigureMFARoles(nil) })
+
+	tests := []struct {
+		name         string
+		claims       Claims
+		permission   Permission
+		wantCan      bool
+		wantNeedsMFA bool
+	}{
+		{name: "rider rides", claims: Claims{Roles: []string{RoleRider}}, permission: PermRide, wantCan: true},
+		{name: "token without roles", claims: Claims{}, permission: PermRide, wantCan: true},
+		{name: "rider without fleet", claims: Claims{Roles: []string{RoleRider}}, permission: PermFleetRead},
+		{name: "any role grants", claims: Claims{Roles: []string{RoleRider, RoleOperator}}, permission: PermFleetOperate, wantCan: true},
+		{name: "unknown role", claims: Claims{Roles: []string{"root"}}, permission: PermUsersManage},
+		{name: "role without second factor", claims: Claims{Roles: []string{RoleFinance}}, permission: PermLedger, wantNeedsMFA: true},
+		{name: "role with second factor", claims: Claims{Roles: []string{RoleFinance}, MFA: true}, permission: PermLedger, wantCan: true},
+		{name: "other role grants without second factor", claims: Claims{Roles: []string{RoleFinance, RoleSupport}}, permission: PermRidesReview, wantCan: true, wantNeedsMFA: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if can := tt.claims.Can(tt.permission); can != tt.wantCan {
+				t.Errorf("Can(%s) = %v, want %v", tt.permission, can, tt.wantCan)
+			}
+			if needsMFA := tt.claims.NeedsMFA(tt.permission); needsMFA != tt.wantNeedsMFA {
+				t.Errorf("NeedsMFA(%s) = %v, want %v", tt.permission, needsMFA, tt.wantNeedsMFA)
+			}
+		})
+	}
+}
+
+func TestConfigureMFAFromEnv(t *testing.T) {
+	t.Cleanup(func() { ConfigureMFARoles(nil) })
+
+	t.Setenv("MFA_REQUIRED_ROLES", " finance, fleet-admin ,")
+	if err := ConfigureMFAFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if !RequiresMFA([]string{RoleRider, RoleFleetAdmin}) || RequiresMFA([]string{RoleRider, RoleOperator}) {
+		t.Errorf("MFA roles = %v", mfaRoles)
+	}
+
+	// Un rol desconocido no cambia la configuración
+	t.Setenv("MFA_REQUIRED_ROLES", "finanzas")
+	if err := ConfigureMFAFromEnv(); err == nil {
+		t.Error("ConfigureMFAFromEnv() accepted an unknown role")
+	}
+	if !RequiresMFA([]string{RoleFinance}) {
+		t.Error("an invalid configuration replaced the MFA roles")
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	setupAuth(t)
+	pair, err := StartSession("user-1", []string{RoleSupport}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		permission Permission
+		want       bool
+	}{
+		{name: "granted", header: "Bearer " + pair.AccessToken, permission: PermIssuesManage, want: true},
+		{name: "not granted", header: "Bearer " + pair.AccessToken, permission: PermLedger},
+		{name: "without token", permission: PermIssuesManage},
+		{name: "other scheme", header: "Basic " + pair.AccessToken, permission: PermIssuesManage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/issues", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := HasPermission(r, tt.permission); got != tt.want {
+				t.Errorf("HasPermission(%s) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("token de renovación inválido o expirado")
+	ErrRefreshTokenReused  = errors.New("token de renovación reutilizado: la sesión fue cerrada")
+)
+
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour // Sin renovar en este plazo la sesión vence
+)
+
+// TokenPair is what a client receives on sign in and on every refresh
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Segundos de vida del token de acceso
+}
+
+// Set the lifetime of access tokens and of idle sessions
+func ConfigureTokens(accessTTL, refreshTTL time.Duration) {
+	accessTokenTTL = accessTTL
+	refreshTokenTTL = refreshTTL
+}
+
+// Configure token lifetimes from ACCESS_TOKEN_MINUTES and REFRESH_TOKEN_DAYS,
+// keeping the defaults for the unset ones
+func ConfigureTokensFromEnv() error {
+	accessTTL, refreshTTL := accessTokenTTL, refreshTokenTTL
+
+	if value := os.Getenv("ACCESS_TOKEN_MINUTES"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			return errors.New("ACCESS_TOKEN_MINUTES debe ser un número de minutos positivo")
+		}
+		accessTTL = time.Duration(minutes) * time.Minute
+	}
+
+	if value := os.Getenv("REFRESH_TOKEN_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			return errors.New("REFRESH_TOKEN_DAYS debe ser un número de días positivo")
+		}
+		refreshTTL = time.Duration(days) * 24 * time.Hour
+	}
+
+	if refreshTTL <= accessTTL {
+		return errors.New("REFRESH_TOKEN_DAYS debe superar la duración del token de acceso")
+	}
+	ConfigureTokens(accessTTL, refreshTTL)
+	return nil
+}
+
+// Open a session for a user and issue its first tokens. mfa tells whether the
+// user passed a second factor; the session keeps it across refreshes
+func StartSession(userID string, roles []string, mfa bool) (TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	session := Session{
+		ID:         randomID(),
+		UserID:     userID,
+		MFA:        mfa,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTokenTTL),
+	}
+	if err := store.InsertSession(ctx, session); err != nil {
+		return TokenPair{}, errors.New("error al guardar la sesión: " + err.Error())
+	}
+
+	return issueTokens(ctx, session, roles, now)
+}
+
+// Exchange a refresh token for new tokens. Each refresh token works once; a
+// second use means it was stolen, so the whole session is closed. roles
+// returns the current roles of the user, so role changes apply on refresh
+func RefreshSession(refreshToken string, roles func(userID string) ([]string, error)) (TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	token, err := store.UseRefreshToken(ctx, hashToken(refreshToken), now)
+	if errors.Is(err, ErrRefreshTokenUsed) {
+		revokeSession(ctx, token.SessionID, now)
+		logger.Error("RefreshSession - Token de renovación reutilizado, sesión cerrada", map[string]interface{}{
+			"session_id": token.SessionID,
+			"user_id":    token.UserID,
+		})
+		return TokenPair{}, ErrRefreshTokenReused
+	} else if errors.Is(err, ErrRefreshTokenNotFound) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return TokenPair{}, err
+	}
+
+	if now.After(token.ExpiresAt) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	session, err := store.FindSession(ctx, token.SessionID)
+	if errors.Is(err, ErrSessionNotFound) || (err == nil && session.RevokedAt != nil) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	} else if err != nil {
+		return TokenPair{}, err
+	}
+
+	userRoles, err := roles(session.UserID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	session.ExpiresAt = now.Add(refreshTokenTTL)
+	if err := store.TouchSession(ctx, session.ID, now, session.ExpiresAt); err != nil {
+		return TokenPair{}, err
+	}
+	return issueTokens(ctx, session, userRoles, now)
+}
+
+// Close one session: its refresh token stops working and its access tokens
+// are rejected from now on
+func EndSession(sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return revokeSession(ctx, sessionID, time.Now())
+}
+
+// Close every open session of a user (log out on all devices). Returns how
+// many were closed
+func EndAllSessions(userID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := store.FindSessionsByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	closed := 0
+	for _, session := range sessions {
+		if session.RevokedAt != nil {
+			continue
+		}
+		if err := revokeSession(ctx, session.ID, now); err != nil {
+			return closed, err
+		}
+		closed++
+	}
+	return closed, nil
+}
+
+func issueTokens(ctx context.Context, session Session, roles []string, now time.Time) (TokenPair, error) {
+	accessToken, err := generateAccessToken(session, roles, now)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := store.InsertRefreshToken(ctx, RefreshToken{
+		Hash:      hashToken(refreshToken),
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}); err != nil {
+		return TokenPair{}, errors.New("error al guardar el token de renovación: " + err.Error())
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL / time.Second),
+	}, nil
+}
+
+// Revoke the session and list it so its access tokens are rejected until
+// they expire
+func revokeSession(ctx context.Context, sessionID string, now time.Time) error {
+	if err := store.AddRevocation(ctx, sessionID, now.Add(accessTokenTTL)); err != nil {
+		return err
+	}
+	if err := store.RevokeSession(ctx, sessionID, now); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	return nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
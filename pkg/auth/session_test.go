@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fresh session store, an HS256 signing key and the default token lifetimes
+func setupAuth(t *testing.T) {
+	t.Helper()
+	if err := ConfigureKeys(nil, strings.Repeat("k", 64), "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	SetStore(NewMemoryStore())
+
+	accessTTL, refreshTTL := accessTokenTTL, refreshTokenTTL
+	t.Cleanup(func() { ConfigureTokens(accessTTL, refreshTTL) })
+}
+
+func riderRoles(userID string) ([]string, error) {
+	return []string{RoleRider}, nil
+}
+
+func TestStartSession(t *testing.T) {
+	setupAuth(t)
+
+	pair, err := StartSession("user-1", []string{RoleOperator}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.TokenType != "Bearer" || pair.ExpiresIn != int(accessTokenTTL/time.Second) || pair.RefreshToken == "" {
+		t.Errorf("pair = %+v", pair)
+	}
+
+	claims, err := ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "user-1" || !claims.MFA || len(claims.Roles) != 1 || claims.Roles[0] != RoleOperator || claims.SessionID == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err := ValidateToken(pair.RefreshToken); err == nil {
+		t.Error("ValidateToken() accepted a refresh token")
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	setupAuth(t)
+	first, err := StartSession("user-1", []string{RoleOperator}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Los roles se leen de nuevo y el segundo factor se conserva
+	second, err := RefreshSession(first.RefreshToken, riderRoles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("RefreshSession() did not rotate the refresh token")
+	}
+	claims, err := ValidateToken(second.AccessToken)
+	if err != nil || len(claims.Roles) != 1 || claims.Roles[0] != RoleRider || !claims.MFA {
+		t.Fatalf("refreshed claims = %+v, %v", claims, err)
+	}
+
+	if _, err := RefreshSession("otro", riderRoles); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession(unknown) = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := RefreshSession(second.RefreshToken, func(string) ([]string, error) {
+		return nil, errors.New("usuario no encontrado")
+	}); err == nil {
+		t.Error("RefreshSession() ignored the roles error")
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	setupAuth(t)
+	first, err := StartSession("user-1", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := RefreshSession(first.RefreshToken, riderRoles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reusar un token de renovación cierra toda la sesión
+	if _, err := RefreshSession(first.RefreshToken, riderRoles); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("RefreshSession(reused) = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := RefreshSession(second.RefreshToken, riderRoles); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession(after reuse) = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := ValidateToken(second.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("ValidateToken(after reuse) = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestRefreshSessionExpired(t *testing.T) {
+	setupAuth(t)
+	ConfigureTokens(time.Minute, time.Nanosecond)
+
+	pair, err := StartSession("user-1", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := RefreshSession(pair.RefreshToken, riderRoles); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession(expired) = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestEndSession(t *testing.T) {
+	setupAuth(t)
+	pair, err := StartSession("user-1", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EndSession(claims.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("ValidateToken(after logout) = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := RefreshSession(pair.RefreshToken, riderRoles); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshSession(after logout) = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestEndAllSessions(t *testing.T) {
+	setupAuth(t)
+	pairs := []TokenPair{}
+	for _, userID := range []string{"user-1", "user-1", "user-1", "user-2"} {
+		pair, err := StartSession(userID, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs = append(pairs, pair)
+	}
+	claims, _ := ValidateToken(pairs[0].AccessToken)
+	if err := EndSession(claims.SessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Las sesiones ya cerradas no se cuentan
+	closed, err := EndAllSessions("user-1")
+	if err != nil || closed != 2 {
+		t.Fatalf("EndAllSessions() = %d, %v; want 2", closed, err)
+	}
+	for i, pair := range pairs {
+		_, err := ValidateToken(pair.AccessToken)
+		if wantRevoked := i < 3; errors.Is(err, ErrTokenRevoked) != wantRevoked {
+			t.Errorf("ValidateToken(session %d) = %v, want revoked %v", i, err, wantRevoked)
+		}
+	}
+}
+
+func TestConfigureTokensFromEnv(t *testing.T) {
+	tests := []struct {
+		name           string
+		minutes, days  string
+		wantErr        bool
+		wantAccessTTL  time.Duration
+		wantRefreshTTL time.Duration
+	}{
+		{name: "defaults", wantAccessTTL: 15 * time.Minute, wantRefreshTTL: 30 * 24 * time.Hour},
+		{name: "both", minutes: "5", days: "7", wantAccessTTL: 5 * time.Minute, wantRefreshTTL: 7 * 24 * time.Hour},
+		{name: "not a number", minutes: "cinco", wantErr: true},
+		{name: "zero days", days: "0", wantErr: true},
+		{name: "access outlives refresh", minutes: "2880", days: "1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigureTokens(15*time.Minute, 30*24*time.Hour)
+			t.Cleanup(func() { ConfigureTokens(15*time.Minute, 30*24*time.Hour) })
+			t.Setenv("ACCESS_TOKEN_MINUTES", tt.minutes)
+			t.Setenv("REFRESH_TOKEN_DAYS", tt.days)
+
+			err := ConfigureTokensFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigureTokensFromEnv() = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (accessTokenTTL != tt.wantAccessTTL || refreshTokenTTL != tt.wantRefreshTTL) {
+				t.Errorf("lifetimes = %v and %v", accessTokenTTL, refreshTokenTTL)
+			}
+		})
+	}
+}
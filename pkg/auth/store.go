@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrSessionNotFound      = errors.New("sesión no encontrada")
+	ErrRefreshTokenNotFound = errors.New("token de renovación no encontrado")
+	ErrRefreshTokenUsed     = errors.New("token de renovación ya utilizado")
+	ErrActionTokenUsed      = errors.New("enlace ya utilizado")
+)
+
+// Session is one sign-in on one device: the family of refresh tokens issued
+// by rotation from the first one
+type Session struct {
+	ID         string     `bson:"_id" json:"id"`
+	UserID     string     `bson:"user_id" json:"user_id"`
+	MFA        bool       `bson:"mfa,omitempty" json:"mfa"`
+	RevokedAt  *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	LastUsedAt time.Time  `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt  time.Time  `bson:"expires_at" json:"expires_at"` // Vence si no se renueva antes
+}
+
+// RefreshToken is a link of a session. Only the SHA-256 of the token is stored
+type RefreshToken struct {
+	Hash      string     `bson:"_id"`
+	SessionID string     `bson:"session_id"`
+	UserID    string     `bson:"user_id"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+}
+
+// SessionStore persists sessions, their refresh tokens, the list of revoked
+// sessions checked on every request and the action tokens already used
+type SessionStore interface {
+	InsertSession(ctx context.Context, session Session) error
+	FindSession(ctx context.Context, id string) (Session, error)
+	FindSessionsByUser(ctx context.Context, userID string) ([]Session, error)
+	// Mark the session revoked, keeping the first revocation time
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	TouchSession(ctx context.Context, id string, usedAt, expiresAt time.Time) error
+
+	InsertRefreshToken(ctx context.Context, token RefreshToken) error
+	// Mark the token used and return it. A token used before returns
+	// ErrRefreshTokenUsed along with the token
+	UseRefreshToken(ctx context.Context, hash string, at time.Time) (RefreshToken, error)
+
+	// Revocations only need to outlive the access tokens of the session
+	AddRevocation(ctx context.Context, sessionID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, sessionID string) (bool, error)
+
+	// Record the action token as used until it expires. A token used before
+	// returns ErrActionTokenUsed
+	UseActionToken(ctx context.Context, id string, expiresAt time.Time) error
+}
+
+var store SessionStore
+
+// Inject the store of sessions and revocations
+func SetStore(s SessionStore) {
+	store = s
+}
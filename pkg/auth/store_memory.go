@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in memory, for tests and local demos
+type MemoryStore struct {
+	mu          sync.Mutex
+	sessions    map[string]Session
+	tokens      map[string]RefreshToken
+	revocations map[string]time.Time
+	usedActions map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:    make(map[string]Session),
+		tokens:      make(map[string]RefreshToken),
+		revocations: make(map[string]time.Time),
+		usedActions: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) InsertSession(ctx context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *MemoryStore) FindSession(ctx context.Context, id string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *MemoryStore) FindSessionsByUser(ctx context.Context, userID string) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *MemoryStore) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt == nil {
+		session.RevokedAt = &at
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *MemoryStore) TouchSession(ctx context.Context, id string, usedAt, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session.LastUsedAt = usedAt
+	session.ExpiresAt = expiresAt
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *MemoryStore) InsertRefreshToken(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token.Hash] = token
+	return nil
+}
+
+func (s *MemoryStore) UseRefreshToken(ctx context.Context, hash string, at time.Time) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if token.UsedAt != nil {
+		return token, ErrRefreshTokenUsed
+	}
+	token.UsedAt = &at
+	s.tokens[hash] = token
+	return token, nil
+}
+
+func (s *MemoryStore) AddRevocation(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revocations[sessionID] = expiresAt
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.revocations[sessionID]
+	if ok && time.Now().After(expiresAt) {
+		delete(s.revocations, sessionID)
+		return false, nil
+	}
+	return ok, nil
+}
+
+func (s *MemoryStore) UseActionToken(ctx context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if until, ok := s.usedActions[id]; ok && time.Now().Before(until) {
+		return ErrActionTokenUsed
+	}
+	s.usedActions[id] = expiresAt
+	return nil
+}
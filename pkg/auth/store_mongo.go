@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists sessions, refresh tokens, revocations and used action
+// tokens in four MongoDB collections
+type MongoStore struct {
+	sessions    *mongo.Collection
+	tokens      *mongo.Collection
+	revocations *mongo.Collection
+	usedActions *mongo.Collection
+}
+
+func NewMongoStore(sessions, tokens, revocations, usedActions *mongo.Collection) *MongoStore {
+	return &MongoStore{sessions: sessions, tokens: tokens, revocations: revocations, usedActions: usedActions}
+}
+
+// Create the indexes to find the sessions of a user and the TTL indexes that
+// purge expired sessions, tokens, revocations and used action tokens
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	if _, err := s.sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}); err != nil {
+		return err
+	}
+
+	for _, collection := range []*mongo.Collection{s.tokens, s.revocations, s.usedActions} {
+		if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MongoStore) InsertSession(ctx context.Context, session Session) error {
+	_, err := s.sessions.InsertOne(ctx, session)
+	return err
+}
+
+func (s *MongoStore) FindSession(ctx context.Context, id string) (Session, error) {
+	var session Session
+	err := s.sessions.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return session, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (s *MongoStore) FindSessionsByUser(ctx context.Context, userID string) ([]Session, error) {
+	cursor, err := s.sessions.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *MongoStore) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	result, err := s.sessions.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$min": bson.M{"revoked_at": at}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) TouchSession(ctx context.Context, id string, usedAt, expiresAt time.Time) error {
+	result, err := s.sessions.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"last_used_at": usedAt, "expires_at": expiresAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) InsertRefreshToken(ctx context.Context, token RefreshToken) error {
+	_, err := s.tokens.InsertOne(ctx, token)
+	return err
+}
+
+func (s *MongoStore) UseRefreshToken(ctx context.Context, hash string, at time.Time) (RefreshToken, error) {
+	var token RefreshToken
+	err := s.tokens.FindOneAndUpdate(ctx,
+		bson.M{"_id": hash, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": at}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&token)
+	if err == nil {
+		return token, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return token, err
+	}
+
+	// No estaba libre: o no existe o ya se usó
+	err = s.tokens.FindOne(ctx, bson.M{"_id": hash}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return token, ErrRefreshTokenNotFound
+	} else if err != nil {
+		return token, err
+	}
+	return token, ErrRefreshTokenUsed
+}
+
+func (s *MongoStore) AddRevocation(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	_, err := s.revocations.UpdateOne(ctx,
+		bson.M{"_id": sessionID},
+		bson.M{"$max": bson.M{"expires_at": expiresAt}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoStore) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	// El índice TTL purga con retraso, así que se filtra por vencimiento
+	count, err := s.revocations.CountDocuments(ctx, bson.M{"_id": sessionID, "expires_at": bson.M{"$gt": time.Now()}})
+	return count > 0, err
+}
+
+func (s *MongoStore) UseActionToken(ctx context.Context, id string, expiresAt time.Time) error {
+	// El _id único hace que solo la primera inserción de un token gane
+	_, err := s.usedActions.InsertOne(ctx, bson.M{"_id": id, "expires_at": expiresAt})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrActionTokenUsed
+	}
+	return err
+}
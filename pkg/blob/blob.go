@@ -0,0 +1,54 @@
+// Package blob stores binary objects such as photos, on the local disk or in
+// an S3 compatible object storage
+package blob
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+var ErrNotFound = errors.New("objeto no encontrado")
+
+// Object is a stored blob with its content type
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// Store abstracts where blobs are kept. Keys are slash separated paths
+type Store interface {
+	Put(ctx context.Context, key string, object Object) error
+	Get(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Storage backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Create the store selected by BLOB_BACKEND: a directory (BLOB_DIR, ./data/blobs
+// by default) or a bucket (S3_ENDPOINT, S3_BUCKET, S3_REGION, S3_ACCESS_KEY and
+// S3_SECRET_KEY)
+func NewFromEnv() (Store, error) {
+	switch backend := os.Getenv("BLOB_BACKEND"); backend {
+	case "", BackendLocal:
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return NewLocalStore(dir), nil
+	case BackendS3:
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, errors.New("BLOB_BACKEND no soportado: " + backend)
+	}
+}
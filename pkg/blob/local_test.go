@@ -0,0 +1,48 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocalStore(t.TempDir())
+
+	if err := s.Put(ctx, "issues/a.png", Object{Data: []byte("png"), ContentType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+	object, err := s.Get(ctx, "issues/a.png")
+	if err != nil || string(object.Data) != "png" || object.ContentType != "image/png" {
+		t.Errorf("Get() = %+v, %v", object, err)
+	}
+
+	// Sin extensión conocida el tipo es genérico
+	if err := s.Put(ctx, "raw/b", Object{Data: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	if object, err := s.Get(ctx, "raw/b"); err != nil || object.ContentType != "application/octet-stream" {
+		t.Errorf("Get(no extension) = %+v, %v", object, err)
+	}
+
+	if err := s.Delete(ctx, "issues/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "issues/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(deleted) = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "issues/a.png"); err != nil {
+		t.Errorf("Delete(missing) = %v", err)
+	}
+}
+
+func TestLocalStoreRejectsKeysOutsideDir(t *testing.T) {
+	s := NewLocalStore(t.TempDir())
+
+	for _, key := range []string{"", "/", "../secret", "issues/../../secret"} {
+		if err := s.Put(context.Background(), key, Object{Data: []byte("x")}); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Mean Earth radius in meters
+const earthRadiusMeters = 6371008.8
+
+// Haversine returns the great-circle distance in meters between two points
+// given in decimal degrees
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+
+	return 2 * earthRadiusMeters * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// Distance in meters between two [lat, lon] pairs, 0 if either is incomplete
+func DistanceCoords(from, to []float64) float64 {
+	if len(from) != 2 || len(to) != 2 {
+		return 0
+	}
+	return Haversine(from[0], from[1], to[0], to[1])
+}
+
+// GeoJSONPoint is a GeoJSON Point geometry, the shape MongoDB 2dsphere
+// indexes expect. Coordinates are [lon, lat]
+type GeoJSONPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func NewGeoJSONPoint(lat, lon float64) *GeoJSONPoint {
+	return &GeoJSONPoint{Type: "Point", Coordinates: []float64{lon, lat}}
+}
+
+// BoundingBox delimits an area by its south-west and north-east corners
+type BoundingBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// ParseBoundingBox reads "minLon,minLat,maxLon,maxLat" (GeoJSON bbox order)
+func ParseBoundingBox(s string) (BoundingBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, errors.New("bbox debe tener 4 valores: minLon,minLat,maxLon,maxLat")
+	}
+
+	values := make([]float64, 4)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, errors.New("bbox contiene un valor inválido")
+		}
+		values[i] = value
+	}
+
+	box := BoundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if box.MinLat > box.MaxLat || box.MinLon > box.MaxLon || !ValidCoords(box.MinLat, box.MinLon) || !ValidCoords(box.MaxLat, box.MaxLon) {
+		return BoundingBox{}, errors.New("bbox fuera de rango")
+	}
+	return box, nil
+}
+
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+func (b BoundingBox) Center() (float64, float64) {
+	return (b.MinLat + b.MaxLat) / 2, (b.MinLon + b.MaxLon) / 2
+}
+
+// Closed GeoJSON ring of the box, [lon, lat] pairs
+func (b BoundingBox) Ring() [][]float64 {
+	return [][]float64{
+		{b.MinLon, b.MinLat},
+		{b.MaxLon, b.MinLat},
+		{b.MaxLon, b.MaxLat},
+		{b.MinLon, b.MaxLat},
+		{b.MinLon, b.MinLat},
+	}
+}
+
+// Latitude and longitude within their valid ranges
+func ValidCoords(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
@@ -0,0 +1,126 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversine(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64 // Metros
+		tolerance              float64
+	}{
+		{name: "same point", lat1: -33.45, lon1: -70.66, lat2: -33.45, lon2: -70.66, want: 0, tolerance: 1e-9},
+		{name: "one degree of latitude", lat1: 0, lon1: 0, lat2: 1, lon2: 0, want: 111195.08, tolerance: 0.01},
+		{name: "one degree of longitude at the equator", lat1: 0, lon1: 0, lat2: 0, lon2: 1, want: 111195.08, tolerance: 0.01},
+		{name: "antipodes", lat1: 0, lon1: 0, lat2: 0, lon2: 180, want: math.Pi * earthRadiusMeters, tolerance: 0.01},
+		{name: "Paris to London", lat1: 48.8566, lon1: 2.3522, lat2: 51.5074, lon2: -0.1278, want: 343550, tolerance: 500},
+		{name: "across the antimeridian", lat1: 0, lon1: 179.5, lat2: 0, lon2: -179.5, want: 111195.08, tolerance: 0.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Haversine(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			if math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("Haversine() = %.2f, want %.2f", got, tt.want)
+			}
+			if back := Haversine(tt.lat2, tt.lon2, tt.lat1, tt.lon1); math.Abs(back-got) > 1e-6 {
+				t.Errorf("Haversine() is not symmetric: %.6f and %.6f", got, back)
+			}
+		})
+	}
+}
+
+func TestDistanceCoords(t *testing.T) {
+	if got := DistanceCoords([]float64{0, 0}, []float64{1, 0}); math.Abs(got-111195.08) > 0.01 {
+		t.Errorf("DistanceCoords() = %.2f", got)
+	}
+	if got := DistanceCoords([]float64{0}, []float64{1, 0}); got != 0 {
+		t.Errorf("DistanceCoords() with an incomplete pair = %v, want 0", got)
+	}
+}
+
+func TestNewGeoJSONPoint(t *testing.T) {
+	point := NewGeoJSONPoint(-33.45, -70.66)
+	if point.Type != "Point" || point.Coordinates[0] != -70.66 || point.Coordinates[1] != -33.45 {
+		t.Errorf("NewGeoJSONPoint() = %+v, want [lon, lat]", point)
+	}
+}
+
+func TestParseBoundingBox(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    BoundingBox
+		wantErr bool
+	}{
+		{input: "-70.7,-33.5,-70.6,-33.4", want: BoundingBox{MinLon: -70.7, MinLat: -33.5, MaxLon: -70.6, MaxLat: -33.4}},
+		{input: " -70.7 , -33.5 , -70.6 , -33.4 ", want: BoundingBox{MinLon: -70.7, MinLat: -33.5, MaxLon: -70.6, MaxLat: -33.4}},
+		{input: "-70.7,-33.5,-70.6", wantErr: true},
+		{input: "-70.7,-33.5,-70.6,x", wantErr: true},
+		{input: "-70.6,-33.5,-70.7,-33.4", wantErr: true}, // Esquinas invertidas
+		{input: "-70.7,-33.4,-70.6,-33.5", wantErr: true},
+		{input: "-190,-33.5,-70.6,-33.4", wantErr: true},
+		{input: "-70.7,-95,-70.6,-33.4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBoundingBox(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseBoundingBox(%q) = %+v, %v", tt.input, got, err)
+		}
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	box := BoundingBox{MinLat: -33.5, MinLon: -70.7, MaxLat: -33.4, MaxLon: -70.6}
+
+	tests := []struct {
+		lat, lon float64
+		want     bool
+	}{
+		{-33.45, -70.65, true},
+		{-33.5, -70.7, true}, // Los bordes cuentan
+		{-33.55, -70.65, false},
+		{-33.45, -70.55, false},
+	}
+	for _, tt := range tests {
+		if got := box.Contains(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+		}
+	}
+
+	if lat, lon := box.Center(); math.Abs(lat+33.45) > 1e-9 || math.Abs(lon+70.65) > 1e-9 {
+		t.Errorf("Center() = %v, %v", lat, lon)
+	}
+
+	ring := box.Ring()
+	polygon := GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{ring}}
+	if err := polygon.Validate(); err != nil {
+		t.Errorf("Ring() is not a valid polygon: %v", err)
+	}
+	if !polygon.Contains(-33.45, -70.65) {
+		t.Error("Ring() does not contain the center of the box")
+	}
+}
+
+func TestValidCoords(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		want     bool
+	}{
+		{0, 0, true},
+		{90, 180, true},
+		{-90, -180, true},
+		{90.1, 0, false},
+		{0, -180.1, false},
+		{math.NaN(), 0, false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidCoords(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("ValidCoords(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}
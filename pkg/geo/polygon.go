@@ -0,0 +1,67 @@
+package geo
+
+import "errors"
+
+var ErrInvalidPolygon = errors.New("polígono inválido")
+
+// GeoJSONPolygon is a GeoJSON Polygon geometry: an outer ring followed by
+// optional holes, each a closed list of [lon, lat] positions
+type GeoJSONPolygon struct {
+	Type        string        `bson:"type" json:"type"`
+	Coordinates [][][]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// Validate checks the polygon follows RFC 7946: closed rings of at least four
+// positions with valid coordinates
+func (p GeoJSONPolygon) Validate() error {
+	if p.Type != "Polygon" {
+		return errors.New("la geometría debe ser de tipo Polygon")
+	}
+	if len(p.Coordinates) == 0 {
+		return ErrInvalidPolygon
+	}
+
+	for _, ring := range p.Coordinates {
+		if len(ring) < 4 {
+			return errors.New("cada anillo del polígono necesita al menos 4 posiciones")
+		}
+		for _, position := range ring {
+			if len(position) < 2 || !ValidCoords(position[1], position[0]) {
+				return errors.New("el polígono contiene coordenadas inválidas")
+			}
+		}
+		first, last := ring[0], ring[len(ring)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			return errors.New("los anillos del polígono deben estar cerrados")
+		}
+	}
+	return nil
+}
+
+// Contains reports whether the point lies inside the outer ring and outside
+// every hole
+func (p GeoJSONPolygon) Contains(lat, lon float64) bool {
+	if len(p.Coordinates) == 0 || !ringContains(p.Coordinates[0], lat, lon) {
+		return false
+	}
+	for _, hole := range p.Coordinates[1:] {
+		if ringContains(hole, lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ray casting on the ring, treating lon/lat as planar coordinates (fine for
+// city-sized areas that do not cross the antimeridian)
+func ringContains(ring [][]float64, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
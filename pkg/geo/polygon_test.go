@@ -0,0 +1,75 @@
+package geo
+
+import (
+	"errors"
+	"testing"
+)
+
+// Square of 0.1° around Santiago with a hole in its north-east quarter, [lon, lat]
+var square = GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{
+	{{-70.7, -33.5}, {-70.6, -33.5}, {-70.6, -33.4}, {-70.7, -33.4}, {-70.7, -33.5}},
+	{{-70.64, -33.44}, {-70.61, -33.44}, {-70.61, -33.41}, {-70.64, -33.41}, {-70.64, -33.44}},
+}}
+
+func TestPolygonValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon GeoJSONPolygon
+		wantErr bool
+	}{
+		{name: "valid", polygon: square},
+		{name: "other type", polygon: GeoJSONPolygon{Type: "Point", Coordinates: square.Coordinates}, wantErr: true},
+		{name: "no rings", polygon: GeoJSONPolygon{Type: "Polygon"}, wantErr: true},
+		{name: "too few positions", polygon: GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{
+			{{0, 0}, {1, 0}, {0, 0}},
+		}}, wantErr: true},
+		{name: "open ring", polygon: GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{
+			{{0, 0}, {1, 0}, {1, 1}, {0, 1}},
+		}}, wantErr: true},
+		{name: "latitude out of range", polygon: GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{
+			{{0, 0}, {1, 0}, {1, 91}, {0, 0}},
+		}}, wantErr: true},
+		{name: "incomplete position", polygon: GeoJSONPolygon{Type: "Polygon", Coordinates: [][][]float64{
+			{{0, 0}, {1}, {1, 1}, {0, 0}},
+		}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.polygon.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (GeoJSONPolygon{Type: "Polygon"}).Validate(); !errors.Is(err, ErrInvalidPolygon) {
+		t.Errorf("Validate() of an empty polygon = %v, want ErrInvalidPolygon", err)
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{name: "inside", lat: -33.48, lon: -70.68, want: true},
+		{name: "in the hole", lat: -33.42, lon: -70.62, want: false},
+		{name: "between the hole and the edge", lat: -33.405, lon: -70.605, want: true},
+		{name: "north", lat: -33.3, lon: -70.65, want: false},
+		{name: "west", lat: -33.45, lon: -70.8, want: false},
+		{name: "swapped coordinates", lat: -70.65, lon: -33.45, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := square.Contains(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+
+	if (GeoJSONPolygon{Type: "Polygon"}).Contains(0, 0) {
+		t.Error("an empty polygon contains a point")
+	}
+}
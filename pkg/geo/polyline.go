@@ -0,0 +1,108 @@
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+// Point in decimal degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Length in meters of the path through the points
+func PathLength(points []Point) float64 {
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		total += Haversine(points[i-1].Lat, points[i-1].Lon, points[i].Lat, points[i].Lon)
+	}
+	return total
+}
+
+// Simplify reduces a path with the Douglas-Peucker algorithm, dropping points
+// closer than toleranceMeters to the simplified line. First and last are kept
+func Simplify(points []Point, toleranceMeters float64) []Point {
+	if len(points) < 3 {
+		return append([]Point(nil), points...)
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	simplifySegment(points, 0, len(points)-1, toleranceMeters, keep)
+
+	simplified := make([]Point, 0, len(points))
+	for i, point := range points {
+		if keep[i] {
+			simplified = append(simplified, point)
+		}
+	}
+	return simplified
+}
+
+func simplifySegment(points []Point, first, last int, tolerance float64, keep []bool) {
+	maxDistance, index := 0.0, 0
+	for i := first + 1; i < last; i++ {
+		if d := crossTrackDistance(points[i], points[first], points[last]); d > maxDistance {
+			maxDistance, index = d, i
+		}
+	}
+
+	if maxDistance > tolerance {
+		keep[index] = true
+		simplifySegment(points, first, index, tolerance, keep)
+		simplifySegment(points, index, last, tolerance, keep)
+	}
+}
+
+// Distance in meters from p to the segment a-b, on a local flat projection
+// (good enough for the few kilometers of a ride)
+func crossTrackDistance(p, a, b Point) float64 {
+	cosLat := math.Cos(a.Lat * math.Pi / 180)
+	toMeters := func(q Point) (float64, float64) {
+		x := (q.Lon - a.Lon) * math.Pi / 180 * earthRadiusMeters * cosLat
+		y := (q.Lat - a.Lat) * math.Pi / 180 * earthRadiusMeters
+		return x, y
+	}
+
+	px, py := toMeters(p)
+	bx, by := toMeters(b)
+
+	lengthSquared := bx*bx + by*by
+	if lengthSquared == 0 {
+		return math.Hypot(px, py)
+	}
+
+	t := math.Max(0, math.Min(1, (px*bx+py*by)/lengthSquared))
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// EncodePolyline encodes the points with the Google encoded polyline
+// algorithm (precision 5), as used by most map SDKs
+func EncodePolyline(points []Point) string {
+	var b strings.Builder
+	prevLat, prevLon := int64(0), int64(0)
+
+	for _, point := range points {
+		lat := int64(math.Round(point.Lat * 1e5))
+		lon := int64(math.Round(point.Lon * 1e5))
+		encodeValue(&b, lat-prevLat)
+		encodeValue(&b, lon-prevLon)
+		prevLat, prevLon = lat, lon
+	}
+
+	return b.String()
+}
+
+func encodeValue(b *strings.Builder, value int64) {
+	shifted := value << 1
+	if value < 0 {
+		shifted = ^shifted
+	}
+
+	for shifted >= 0x20 {
+		b.WriteByte(byte((0x20 | (shifted & 0x1f)) + 63))
+		shifted >>= 5
+	}
+	b.WriteByte(byte(shifted + 63))
+}
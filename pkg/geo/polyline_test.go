@@ -0,0 +1,79 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodePolyline(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+		want   string
+	}{
+		// Ejemplo de la documentación del algoritmo de Google
+		{name: "reference", points: []Point{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, want: "_p~iF~ps|U_ulLnnqC_mqNvxq`@"},
+		{name: "empty", points: nil, want: ""},
+		{name: "origin", points: []Point{{0, 0}}, want: "??"},
+		{name: "rounding", points: []Point{{0.000004, -0.000006}}, want: "?@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EncodePolyline(tt.points); got != tt.want {
+				t.Errorf("EncodePolyline() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+		want   float64
+	}{
+		{name: "empty", points: nil, want: 0},
+		{name: "single point", points: []Point{{0, 0}}, want: 0},
+		{name: "there and back", points: []Point{{0, 0}, {1, 0}, {0, 0}}, want: 2 * 111195.08},
+		{name: "two legs", points: []Point{{0, 0}, {0, 1}, {1, 1}}, want: 111195.08 + Haversine(0, 1, 1, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PathLength(tt.points); math.Abs(got-tt.want) > 0.05 {
+				t.Errorf("PathLength() = %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	// Unos 11 m por cada 0.0001° de latitud
+	tests := []struct {
+		name      string
+		points    []Point
+		tolerance float64
+		want      []Point
+	}{
+		{name: "short path is kept", points: []Point{{0, 0}, {0.001, 0}}, tolerance: 5, want: []Point{{0, 0}, {0.001, 0}}},
+		{name: "collinear points are dropped", points: []Point{{0, 0}, {0.001, 0}, {0.002, 0}, {0.003, 0}}, tolerance: 5, want: []Point{{0, 0}, {0.003, 0}}},
+		{name: "small jitter is dropped", points: []Point{{0, 0}, {0.001, 0.00002}, {0.002, 0}}, tolerance: 5, want: []Point{{0, 0}, {0.002, 0}}},
+		{name: "corner is kept", points: []Point{{0, 0}, {0.001, 0}, {0.001, 0.001}}, tolerance: 5, want: []Point{{0, 0}, {0.001, 0}, {0.001, 0.001}}},
+		{name: "detour over the tolerance is kept", points: []Point{{0, 0}, {0.001, 0.0001}, {0.002, 0}}, tolerance: 5, want: []Point{{0, 0}, {0.001, 0.0001}, {0.002, 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Simplify(tt.points, tt.tolerance)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Simplify() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Simplify() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/auth"
+	httpresponse "github.com/clementeaf/bike-tracker/pkg/http"
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+// How long a stored response can be replayed
+const TTL = 24 * time.Hour
+
+// How long a request keeps its key while processing. Twice the longest a
+// handler may run (saga recovery takes over ride starts pending for a minute),
+// so a record left by a crashed instance can be taken over by a retry
+const Lease = 2 * time.Minute
+
+var (
+	ErrKeyExists   = errors.New("la clave de idempotencia ya existe")
+	ErrKeyNotFound = errors.New("clave de idempotencia no encontrada")
+	ErrLeaseLost   = errors.New("otra solicitud tomó la clave de idempotencia")
+)
+
+// Record states
+const (
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+)
+
+// Record stores the fingerprint of a request and the response it produced
+type Record struct {
+	Key         string    `bson:"_id" json:"key"`
+	Fingerprint string    `bson:"fingerprint" json:"fingerprint"`
+	Status      string    `bson:"status" json:"status"`
+	LeasedUntil time.Time `bson:"leased_until" json:"leased_until"`
+	StatusCode  int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	ContentType string    `bson:"content_type,omitempty" json:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty" json:"body,omitempty"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// Store persists idempotency records
+type Store interface {
+	// Reserve inserts a new record, failing with ErrKeyExists if the key is taken
+	Reserve(ctx context.Context, record Record) error
+	Find(ctx context.Context, key string) (Record, error)
+	// Takeover replaces a processing record whose lease ended before now,
+	// failing with ErrKeyExists if it is completed or still leased
+	Takeover(ctx context.Context, record Record, now time.Time) error
+	// Complete and Release only apply while the record still holds the lease
+	// it was stored with, failing with ErrLeaseLost otherwise
+	Complete(ctx context.Context, record Record) error
+	Release(ctx context.Context, record Record) error
+}
+
+var store Store
+
+// Inject the store used by the middleware
+func SetStore(s Store) {
+	store = s
+}
+
+// Middleware honors the Idempotency-Key header: the first request with a key
+// is executed and its response stored; retries with the same key and body get
+// the stored response, and a different body with the same key is rejected
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			httpresponse.SendJSONResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "No se pudo leer la solicitud",
+			})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Las claves son por usuario y por endpoint
+		userID, _ := auth.GetAuthenticatedUserID(r)
+		scopedKey := userID + ":" + r.Method + ":" + r.URL.Path + ":" + key
+		fingerprint := Fingerprint(r.Method, r.URL.Path, body)
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		// Mongo guarda las fechas en milisegundos y el lease se compara exacto
+		now := time.Now().Truncate(time.Millisecond)
+		record := Record{
+			Key:         scopedKey,
+			Fingerprint: fingerprint,
+			Status:      StatusProcessing,
+			LeasedUntil: now.Add(Lease),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(TTL),
+		}
+
+		err = store.Reserve(ctx, record)
+		if errors.Is(err, ErrKeyExists) {
+			if !replay(ctx, w, record, now) {
+				return
+			}
+		} else if err != nil {
+			httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "Error al registrar la clave de idempotencia",
+			})
+			logger.Error("Idempotency - Error al reservar clave", map[string]interface{}{
+				"key":   scopedKey,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Los errores del servidor no se guardan: el cliente puede reintentar.
+		// El defer también libera la clave si el handler entra en pánico, que
+		// sigue su curso hacia el middleware de recuperación
+		completed := false
+		defer func() {
+			if !completed {
+				release(record)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.statusCode >= http.StatusInternalServerError {
+			return
+		}
+		completed = true
+
+		record.Status = StatusCompleted
+		record.StatusCode = recorder.statusCode
+		record.ContentType = recorder.Header().Get("Content-Type")
+		record.Body = recorder.body.Bytes()
+		if err := store.Complete(context.Background(), record); err != nil {
+			logger.Error("Idempotency - Error al guardar respuesta", map[string]interface{}{
+				"key":   scopedKey,
+				"error": err.Error(),
+			})
+		}
+	})
+}
+
+// Drop the record of a request that did not complete, so it can be retried
+func release(record Record) {
+	if err := store.Release(context.Background(), record); err != nil {
+		logger.Error("Idempotency - Error al liberar clave", map[string]interface{}{
+			"key":   record.Key,
+			"error": err.Error(),
+		})
+	}
+}
+
+// Answer a repeated key with the stored response. Returns true when the
+// original request was abandoned and this one took over its key, so it must
+// run the handler itself
+func replay(ctx context.Context, w http.ResponseWriter, retry Record, now time.Time) bool {
+	key := retry.Key
+	record, err := store.Find(ctx, key)
+	if err != nil {
+		httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "Error al consultar la clave de idempotencia",
+		})
+		return false
+	}
+
+	if record.Fingerprint != retry.Fingerprint {
+		httpresponse.SendJSONResponse(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": "La clave de idempotencia ya se usó con otra solicitud",
+		})
+		logger.Error("Idempotency - Clave reutilizada con otro cuerpo", map[string]interface{}{
+			"key": key,
+		})
+		return false
+	}
+
+	if record.Status != StatusCompleted {
+		// La instancia que la procesaba pudo caerse sin liberar la clave
+		if now.After(record.LeasedUntil) {
+			err := store.Takeover(ctx, retry, now)
+			if err == nil {
+				logger.Info("Idempotency - Clave abandonada retomada", map[string]interface{}{
+					"key":          key,
+					"leased_until": record.LeasedUntil,
+				})
+				return true
+			}
+			if !errors.Is(err, ErrKeyExists) {
+				httpresponse.SendJSONResponse(w, http.StatusInternalServerError, map[string]string{
+					"error": "Error al registrar la clave de idempotencia",
+				})
+				logger.Error("Idempotency - Error al retomar clave", map[string]interface{}{
+					"key":   key,
+					"error": err.Error(),
+				})
+				return false
+			}
+		}
+		httpresponse.SendJSONResponse(w, http.StatusConflict, map[string]string{
+			"error": "La solicitud original aún está en proceso",
+		})
+		return false
+	}
+
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+
+	logger.Info("Idempotency - Respuesta repetida", map[string]interface{}{
+		"key":         key,
+		"status_code": record.StatusCode,
+	})
+	return false
+}
+
+// Fingerprint of a request: method, path and body. JSON bodies are hashed in
+// canonical form, so a retry that reorders keys or changes whitespace matches
+func Fingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(canonicalJSON(body))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Re-encode a JSON body with sorted keys and no whitespace. Numbers keep their
+// literal text. Bodies that are not JSON are returned as they are
+func canonicalJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return body
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,206 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Handler answering with status, counting its calls
+func counting(status int, calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ok":true}`))
+	})
+}
+
+func send(handler http.Handler, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/rides/start", strings.NewReader(body))
+	r.Header.Set(HeaderKey, key)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		second     string // Cuerpo del reintento
+		wantStatus int
+		wantCalls  int
+		replayed   bool
+	}{
+		{name: "retry is replayed", status: http.StatusCreated, second: `{"a":1}`, wantStatus: http.StatusCreated, wantCalls: 1, replayed: true},
+		{name: "client errors are replayed", status: http.StatusBadRequest, second: `{"a":1}`, wantStatus: http.StatusBadRequest, wantCalls: 1, replayed: true},
+		{name: "other body is rejected", status: http.StatusCreated, second: `{"a":2}`, wantStatus: http.StatusUnprocessableEntity, wantCalls: 1},
+		{name: "server errors are retried", status: http.StatusInternalServerError, second: `{"a":1}`, wantStatus: http.StatusInternalServerError, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStore(NewMemoryStore())
+			calls := 0
+			handler := Middleware(counting(tt.status, &calls))
+
+			send(handler, "k1", `{"a":1}`)
+			w := send(handler, "k1", tt.second)
+
+			if w.Code != tt.wantStatus || calls != tt.wantCalls {
+				t.Errorf("status = %d, calls = %d; want %d, %d", w.Code, calls, tt.wantStatus, tt.wantCalls)
+			}
+			if replayed := w.Header().Get(HeaderReplayed) == "true"; replayed != tt.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithoutKey(t *testing.T) {
+	SetStore(NewMemoryStore())
+	calls := 0
+	handler := Middleware(counting(http.StatusCreated, &calls))
+
+	send(handler, "", `{}`)
+	send(handler, "", `{}`)
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestMiddlewareReleasesKeyOnPanic(t *testing.T) {
+	SetStore(NewMemoryStore())
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic did not reach the caller")
+			}
+		}()
+		send(handler, "k1", `{}`)
+	}()
+
+	if _, err := store.Find(context.Background(), ":POST:/rides/start:k1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("key still stored after the panic: %v", err)
+	}
+
+	calls := 0
+	if w := send(Middleware(counting(http.StatusCreated, &calls)), "k1", `{}`); w.Code != http.StatusCreated || calls != 1 {
+		t.Errorf("retry after panic: status = %d, calls = %d", w.Code, calls)
+	}
+}
+
+func TestMiddlewareTakesOverAbandonedKey(t *testing.T) {
+	key := ":POST:/rides/start:k1"
+	body := `{"a":1}`
+
+	tests := []struct {
+		name       string
+		leased     time.Duration // Lease restante de la solicitud original
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "lease ended", leased: -time.Second, wantStatus: http.StatusCreated, wantCalls: 1},
+		{name: "still processing", leased: time.Minute, wantStatus: http.StatusConflict},
+		{name: "record without lease", wantStatus: http.StatusCreated, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStore(NewMemoryStore())
+			now := time.Now()
+			abandoned := Record{
+				Key:         key,
+				Fingerprint: Fingerprint(http.MethodPost, "/rides/start", []byte(body)),
+				Status:      StatusProcessing,
+				CreatedAt:   now.Add(-time.Hour),
+				ExpiresAt:   now.Add(TTL),
+			}
+			if tt.leased != 0 {
+				abandoned.LeasedUntil = now.Add(tt.leased)
+			}
+			if err := store.Reserve(context.Background(), abandoned); err != nil {
+				t.Fatal(err)
+			}
+
+			calls := 0
+			w := send(Middleware(counting(http.StatusCreated, &calls)), "k1", body)
+			if w.Code != tt.wantStatus || calls != tt.wantCalls {
+				t.Fatalf("status = %d, calls = %d; want %d, %d", w.Code, calls, tt.wantStatus, tt.wantCalls)
+			}
+
+			// La respuesta de quien retomó la clave queda guardada
+			if tt.wantCalls > 0 {
+				if record, err := store.Find(context.Background(), key); err != nil || record.Status != StatusCompleted {
+					t.Errorf("record = %+v, %v; want completed", record, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLateOriginalAfterTakeover(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryStore()
+	now := time.Now()
+
+	original := Record{Key: "k", Status: StatusProcessing, LeasedUntil: now.Add(-time.Second), ExpiresAt: now.Add(TTL)}
+	if err := memory.Reserve(ctx, original); err != nil {
+		t.Fatal(err)
+	}
+	retry := original
+	retry.LeasedUntil = now.Add(Lease)
+	if err := memory.Takeover(ctx, retry, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.Takeover(ctx, retry, now); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("second Takeover() = %v, want ErrKeyExists", err)
+	}
+
+	// La solicitud original termina tarde y ya no es dueña de la clave
+	late := original
+	late.Status = StatusCompleted
+	if err := memory.Complete(ctx, late); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Complete(original) = %v, want ErrLeaseLost", err)
+	}
+	if err := memory.Release(ctx, original); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Release(original) = %v, want ErrLeaseLost", err)
+	}
+	if record, err := memory.Find(ctx, "k"); err != nil || record.Status != StatusProcessing || !record.LeasedUntil.Equal(retry.LeasedUntil) {
+		t.Errorf("record = %+v, %v; want the retry", record, err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint(http.MethodPost, "/rides/start", []byte(`{"bike_id":"b1","lat":1.5,"tags":["x","y"]}`))
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		same bool
+	}{
+		{name: "reordered keys and whitespace", path: "/rides/start", body: "{\n  \"tags\": [\"x\", \"y\"],\n  \"lat\": 1.5,\n  \"bike_id\": \"b1\"\n}", same: true},
+		{name: "other value", path: "/rides/start", body: `{"bike_id":"b2","lat":1.5,"tags":["x","y"]}`},
+		{name: "reordered array", path: "/rides/start", body: `{"bike_id":"b1","lat":1.5,"tags":["y","x"]}`},
+		{name: "other path", path: "/rides/end", body: `{"bike_id":"b1","lat":1.5,"tags":["x","y"]}`},
+		{name: "not JSON", path: "/rides/start", body: `bike_id=b1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fingerprint(http.MethodPost, tt.path, []byte(tt.body)); (got == base) != tt.same {
+				t.Errorf("same fingerprint = %v, want %v", got == base, tt.same)
+			}
+		})
+	}
+}
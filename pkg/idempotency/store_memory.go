@@ -0,0 +1,80 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps idempotency records in memory, for tests and local demos
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[record.Key]; ok && time.Now().Before(existing.ExpiresAt) {
+		return ErrKeyExists
+	}
+	s.records[record.Key] = record
+	return nil
+}
+
+func (s *MemoryStore) Find(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || time.Now().After(record.ExpiresAt) {
+		delete(s.records, key)
+		return Record{}, ErrKeyNotFound
+	}
+	return record, nil
+}
+
+func (s *MemoryStore) Takeover(ctx context.Context, record Record, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.records[record.Key]
+	if ok && (existing.Status != StatusProcessing || !now.After(existing.LeasedUntil)) {
+		return ErrKeyExists
+	}
+	s.records[record.Key] = record
+	return nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.leased(record) {
+		return ErrLeaseLost
+	}
+	s.records[record.Key] = record
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.leased(record) {
+		return ErrLeaseLost
+	}
+	delete(s.records, record.Key)
+	return nil
+}
+
+// Whether the stored record is still processing under the lease of record
+func (s *MemoryStore) leased(record Record) bool {
+	existing, ok := s.records[record.Key]
+	return ok && existing.Status == StatusProcessing && existing.LeasedUntil.Equal(record.LeasedUntil)
+}
@@ -0,0 +1,92 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore persists idempotency records in a MongoDB collection, keyed by _id
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+// Create the TTL index that purges expired records
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoStore) Reserve(ctx context.Context, record Record) error {
+	_, err := s.collection.InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrKeyExists
+	}
+	return err
+}
+
+func (s *MongoStore) Find(ctx context.Context, key string) (Record, error) {
+	var record Record
+	err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return record, ErrKeyNotFound
+	}
+	return record, err
+}
+
+func (s *MongoStore) Takeover(ctx context.Context, record Record, now time.Time) error {
+	// Registros anteriores al lease no tienen leased_until
+	result, err := s.collection.ReplaceOne(ctx, bson.M{
+		"_id":    record.Key,
+		"status": StatusProcessing,
+		"$or": bson.A{
+			bson.M{"leased_until": bson.M{"$lt": now}},
+			bson.M{"leased_until": bson.M{"$exists": false}},
+		},
+	}, record)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrKeyExists
+	}
+	return nil
+}
+
+func (s *MongoStore) Complete(ctx context.Context, record Record) error {
+	result, err := s.collection.ReplaceOne(ctx, leased(record), record)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *MongoStore) Release(ctx context.Context, record Record) error {
+	result, err := s.collection.DeleteOne(ctx, leased(record))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Filter matching the record while it is still processing under its lease
+func leased(record Record) bson.M {
+	return bson.M{"_id": record.Key, "status": StatusProcessing, "leased_until": record.LeasedUntil}
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/clementeaf/bike-tracker/pkg/logger"
+)
+
+// LogSender writes every email as an .eml file under a directory and logs
+// it, so development needs no mail server
+type LogSender struct {
+	dir  string
+	from string
+}
+
+func NewLogSender(dir, from string) *LogSender {
+	return &LogSender{dir: dir, from: from}
+}
+
+func (s *LogSender) Send(ctx context.Context, message Message) error {
+	now := time.Now()
+	data, err := compose(s.from, message, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	file := filepath.Join(s.dir, now.UTC().Format("20060102T150405.000000000")+"-"+messageID()[:8]+".eml")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return err
+	}
+
+	logger.Info("Correo guardado (MAIL_BACKEND=log)", map[string]interface{}{
+		"to":      message.To,
+		"subject": message.Subject,
+		"file":    file,
+		"body":    message.Body,
+	})
+	return nil
+}
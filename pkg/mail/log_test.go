@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "correo")
+	sender := NewLogSender(dir, "no-reply@bike.example")
+
+	for _, to := range []string{"ana@example.com", "luis@example.com"} {
+		if err := sender.Send(context.Background(), Message{To: to, Subject: "Restablece tu contraseña", Body: "Abre el enlace"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Cada correo queda en su propio archivo .eml
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("files = %v, %v; want 2", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "From: no-reply@bike.example\r\n") || !strings.Contains(string(data), "Abre el enlace") {
+		t.Errorf("email = %q", data)
+	}
+
+	if err := sender.Send(context.Background(), Message{To: "ana@example.com\nBcc: otro@example.com"}); err == nil {
+		t.Error("Send() accepted a line break in the recipient")
+	}
+}
@@ -0,0 +1,111 @@
+// Package mail sends plain text emails through an SMTP server, or writes them
+// to disk during development
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"mime/quotedprintable"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender abstracts how emails leave the service
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Mail backends
+const (
+	BackendLog  = "log"
+	BackendSMTP = "smtp"
+)
+
+// Create the sender selected by MAIL_BACKEND: files under a directory
+// (MAIL_DIR, ./data/mail by default) or an SMTP server (SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME and SMTP_PASSWORD). MAIL_FROM is the sender address
+func NewFromEnv() (Sender, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@bike-tracker.local"
+	}
+
+	switch backend := os.Getenv("MAIL_BACKEND"); backend {
+	case "", BackendLog:
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "data/mail"
+		}
+		return NewLogSender(dir, from), nil
+	case BackendSMTP:
+		port := 587
+		if value := os.Getenv("SMTP_PORT"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				return nil, errors.New("SMTP_PORT debe ser un número de puerto")
+			}
+			port = parsed
+		}
+		return NewSMTPSender(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	default:
+		return nil, errors.New("MAIL_BACKEND no soportado: " + backend)
+	}
+}
+
+// Encode the message as RFC 5322 with a quoted-printable UTF-8 body
+func compose(from string, message Message, now time.Time) ([]byte, error) {
+	if strings.ContainsAny(message.To+message.Subject+from, "\r\n") {
+		return nil, errors.New("cabecera de correo inválida")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + message.To + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	buf.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("Message-ID: <" + messageID() + "@" + domain(from) + ">\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(message.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func messageID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domain(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return strings.Trim(address[at+1:], "> ")
+	}
+	return "localhost"
+}
@@ -0,0 +1,98 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompose(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	message := Message{To: "ana@example.com", Subject: "Verifica tu correo", Body: "Hola Ana,\nconfirma tu dirección."}
+
+	data, err := compose("Bike Tracker <no-reply@bike.example>", message, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if parsed.Header.Get("To") != message.To || subject != message.Subject || parsed.Header.Get("Date") != now.Format(time.RFC1123Z) {
+		t.Errorf("headers = %v", parsed.Header)
+	}
+	if id := parsed.Header.Get("Message-ID"); !strings.HasSuffix(id, "@bike.example>") {
+		t.Errorf("Message-ID = %s", id)
+	}
+
+	// El cuerpo viaja en quoted-printable con saltos de línea CRLF
+	body, err := io.ReadAll(parsed.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "direcci=C3=B3n") || !strings.Contains(string(body), "Hola Ana,\r\n") {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestComposeRejectsHeaderInjection(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		message Message
+	}{
+		{name: "recipient", from: "no-reply@bike.example", message: Message{To: "ana@example.com\r\nBcc: otro@example.com"}},
+		{name: "subject", from: "no-reply@bike.example", message: Message{To: "ana@example.com", Subject: "Hola\nBcc: otro@example.com"}},
+		{name: "sender", from: "no-reply@bike.example\r\nBcc: otro@example.com", message: Message{To: "ana@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compose(tt.from, tt.message, time.Now()); err == nil {
+				t.Error("compose() accepted a line break in a header")
+			}
+		})
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantSMTP bool
+		wantErr  bool
+	}{
+		{name: "default", env: map[string]string{}},
+		{name: "log", env: map[string]string{"MAIL_BACKEND": BackendLog, "MAIL_DIR": "correo"}},
+		{name: "smtp", env: map[string]string{"MAIL_BACKEND": BackendSMTP, "SMTP_HOST": "smtp.example.com", "SMTP_PORT": "465"}, wantSMTP: true},
+		{name: "smtp without host", env: map[string]string{"MAIL_BACKEND": BackendSMTP}, wantErr: true},
+		{name: "bad port", env: map[string]string{"MAIL_BACKEND": BackendSMTP, "SMTP_HOST": "smtp.example.com", "SMTP_PORT": "smtp"}, wantErr: true},
+		{name: "bad sender", env: map[string]string{"MAIL_BACKEND": BackendSMTP, "SMTP_HOST": "smtp.example.com", "MAIL_FROM": "no es correo"}, wantErr: true},
+		{name: "unknown backend", env: map[string]string{"MAIL_BACKEND": "paloma"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"MAIL_BACKEND", "MAIL_DIR", "MAIL_FROM", "SMTP_HOST", "SMTP_PORT"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			sender, err := NewFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFromEnv() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if _, isSMTP := sender.(*SMTPSender); isSMTP != tt.wantSMTP {
+				t.Errorf("sender = %T", sender)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Minimal SMTP server without TLS nor authentication. It accepts one
+// message and sends the commands and data it received on the channel
+func fakeSMTPServer(t *testing.T) (int, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+
+		lines := []string{}
+		text.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+			switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 Continúa")
+				data, _ := text.ReadDotLines()
+				lines = append(lines, data...)
+				text.PrintfLine("250 OK")
+			case "QUIT":
+				text.PrintfLine("221 Adiós")
+				received <- lines
+				return
+			default:
+				text.PrintfLine("502 No implementado")
+			}
+		}
+		received <- lines
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPSender(t *testing.T) {
+	port, received := fakeSMTPServer(t)
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: port, From: "Bike Tracker <no-reply@bike.example>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sender.Send(ctx, Message{To: "ana@example.com", Subject: "Hola", Body: "Bienvenida"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Join(<-received, "\n")
+	// El sobre usa solo la dirección, sin el nombre visible
+	for _, want := range []string{"MAIL FROM:<no-reply@bike.example>", "RCPT TO:<ana@example.com>", "To: ana@example.com", "Bienvenida"} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("session is missing %q:\n%s", want, lines)
+		}
+	}
+}
+
+func TestSMTPSenderUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: port, From: "no-reply@bike.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(context.Background(), Message{To: "ana@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "servidor SMTP") {
+		t.Errorf("Send() = %v, want a connection error", err)
+	}
+}
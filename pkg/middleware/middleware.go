@@ -38,6 +38,64 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// RequirePermission lets through signed-in users whose roles grant permission
+func RequirePermission(permission auth.Permission, next http.Handler) http.Handler {
+	return RequireAnyPermission([]auth.Permission{permission}, next)
+}
+
+// RequireAnyPermission lets through signed-in users whose roles grant one of
+// the permissions; the handler narrows what each of them may reach
+func RequireAnyPermission(permissions []auth.Permission, next http.Handler) http.Handler {
+	names := make([]string, len(permissions))
+	for i, permission := range permissions {
+		names[i] = string(permission)
+	}
+	required := strings.Join(names, "|")
+
+	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetAuthenticatedClaims(r)
+		granted, needsMFA := false, false
+		if err == nil {
+			for _, permission := range permissions {
+				granted = granted || claims.Can(permission)
+				needsMFA = needsMFA || claims.NeedsMFA(permission)
+			}
+		}
+
+		if err == nil && !granted && needsMFA {
+			http.Error(w, "Prohibido: su rol requiere iniciar sesión con un segundo factor (MFA)", http.StatusForbidden)
+			logger.Error("Solicitud rechazada: sesión sin MFA", map[string]interface{}{
+				"path":       r.URL.Path,
+				"permission": required,
+				"user_id":    claims.UserID,
+			})
+			return
+		}
+		if !granted {
+			http.Error(w, "Prohibido: permisos insuficientes", http.StatusForbidden)
+			logger.Error("Solicitud rechazada: permisos insuficientes", map[string]interface{}{
+				"path":       r.URL.Path,
+				"permission": required,
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// Authenticated lets through any signed-in user; the handler only touches
+// resources of that user
+func Authenticated(next http.Handler) http.Handler {
+	return AuthMiddleware(next)
+}
+
+// Public marks a route that needs no user token, either open to anyone or
+// authenticated by the handler itself (device keys)
+func Public(next http.Handler) http.Handler {
+	return next
+}
+
 func ApplyMiddlewares(handler http.Handler) http.Handler {
 	return ErrorMiddleware(handler)
 }
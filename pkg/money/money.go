@@ -0,0 +1,305 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var (
+	ErrInvalidAmount    = errors.New("monto inválido")
+	ErrCurrencyMismatch = errors.New("monedas distintas")
+)
+
+// Currency used when an amount does not carry one (legacy data, plain JSON numbers)
+var DefaultCurrency = "USD"
+
+// Number of decimals (minor unit exponent) by ISO 4217 currency
+var minorDigits = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"CLP": 0,
+	"JPY": 0,
+}
+
+// Money is an exact amount expressed in minor units (cents) of an ISO currency
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Amount in minor units of the given currency
+func New(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: strings.ToUpper(currency)}
+}
+
+// Amount in minor units of the default currency
+func FromMinor(minor int64) Money {
+	return New(minor, DefaultCurrency)
+}
+
+// Convert a float amount in major units, rounding half away from zero.
+// Only meant for legacy data and for rates applied to measured quantities
+func FromFloat(amount float64, currency string) Money {
+	scale := math.Pow10(digits(currency))
+	return New(int64(math.Round(amount*scale)), currency)
+}
+
+// Parse an exact decimal amount in major units ("12.5", "-3.05")
+func Parse(s string, currency string) (Money, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits(currency))), nil))
+	rat.Mul(rat, scale)
+	if !rat.IsInt() {
+		return Money{}, fmt.Errorf("%w: %q tiene más decimales de los permitidos", ErrInvalidAmount, s)
+	}
+	if !rat.Num().IsInt64() {
+		return Money{}, fmt.Errorf("%w: %q fuera de rango", ErrInvalidAmount, s)
+	}
+
+	return New(rat.Num().Int64(), currency), nil
+}
+
+func digits(currency string) int {
+	if d, ok := minorDigits[strings.ToUpper(currency)]; ok {
+		return d
+	}
+	return 2
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// Check that two amounts can be added or compared. Amounts that come from
+// requests or storage must go through here (or Sum, Compare) first
+func (m Money) SameCurrency(o Money) error {
+	if m.currency() != o.currency() {
+		return fmt.Errorf("%w: %s y %s", ErrCurrencyMismatch, m.currency(), o.currency())
+	}
+	return nil
+}
+
+// Add, Sub and Cmp only see amounts already checked: requests and tariffs are
+// validated on the way in, and the server refuses to start when stored amounts
+// are in another currency than DefaultCurrency. A mismatch there is a
+// programming error
+func (m Money) sameCurrency(o Money) {
+	if err := m.SameCurrency(o); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Total of the amounts in their common currency. Zero of the default
+// currency when there are none
+func Sum(amounts ...Money) (Money, error) {
+	if len(amounts) == 0 {
+		return FromMinor(0), nil
+	}
+
+	total := New(0, amounts[0].currency())
+	for _, amount := range amounts {
+		if err := total.SameCurrency(amount); err != nil {
+			return Money{}, err
+		}
+		total.Amount += amount.Amount
+	}
+	return total, nil
+}
+
+// Cmp returning ErrCurrencyMismatch instead of panicking
+func (m Money) Compare(o Money) (int, error) {
+	if err := m.SameCurrency(o); err != nil {
+		return 0, err
+	}
+	return m.Cmp(o), nil
+}
+
+func (m Money) Add(o Money) Money {
+	m.sameCurrency(o)
+	return New(m.Amount+o.Amount, m.currency())
+}
+
+func (m Money) Sub(o Money) Money {
+	m.sameCurrency(o)
+	return New(m.Amount-o.Amount, m.currency())
+}
+
+func (m Money) Neg() Money {
+	return New(-m.Amount, m.currency())
+}
+
+func (m Money) Abs() Money {
+	if m.Amount < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Multiply by a factor (per-minute rates, multipliers), rounding half away from zero
+func (m Money) Mul(factor float64) Money {
+	return New(int64(math.Round(float64(m.Amount)*factor)), m.currency())
+}
+
+// Compare two amounts: -1, 0 or 1
+func (m Money) Cmp(o Money) int {
+	m.sameCurrency(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) LessThan(o Money) bool {
+	return m.Cmp(o) < 0
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Smallest of two amounts
+func Min(a, b Money) Money {
+	if b.LessThan(a) {
+		return b
+	}
+	return a
+}
+
+// Largest of two amounts
+func Max(a, b Money) Money {
+	if a.LessThan(b) {
+		return b
+	}
+	return a
+}
+
+// Decimal representation in major units ("12.50")
+func (m Money) String() string {
+	d := digits(m.currency())
+	if d == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := int64(math.Pow10(d))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, d, amount%scale)
+}
+
+// Approximate float value, only for logs and display
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / math.Pow10(digits(m.currency()))
+}
+
+// MarshalJSON encodes the amount as a plain decimal number (e.g. 12.50) so
+// clients that used to receive float64 values keep working
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a number, a numeric string or {"amount", "currency"},
+// always in major units like MarshalJSON produces. Only the default currency
+// is accepted, so amounts from clients can always be added to stored ones
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if text == "null" {
+		return nil
+	}
+
+	if strings.HasPrefix(text, "{") {
+		var raw struct {
+			Amount   json.RawMessage `json:"amount"`
+			Currency string          `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		if raw.Currency != "" && !strings.EqualFold(raw.Currency, DefaultCurrency) {
+			return fmt.Errorf("%w: se esperaba %s y se recibió %s", ErrCurrencyMismatch, DefaultCurrency, raw.Currency)
+		}
+		text = strings.TrimSpace(string(raw.Amount))
+	}
+
+	parsed, err := Parse(strings.Trim(text, `"`), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+type bsonMoney struct {
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+// MarshalBSONValue stores the amount as {amount: int64 minor units, currency}
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(bsonMoney{Amount: m.Amount, Currency: m.currency()})
+}
+
+// UnmarshalBSONValue reads the current format as well as legacy numeric values
+// (doubles in major units of the default currency)
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var doc bsonMoney
+		if err := raw.Unmarshal(&doc); err != nil {
+			return err
+		}
+		if doc.Currency == "" {
+			doc.Currency = DefaultCurrency
+		}
+		*m = New(doc.Amount, doc.Currency)
+	case bsontype.Double:
+		*m = FromFloat(raw.Double(), DefaultCurrency)
+	case bsontype.Int32:
+		*m = FromFloat(float64(raw.Int32()), DefaultCurrency)
+	case bsontype.Int64:
+		*m = FromFloat(float64(raw.Int64()), DefaultCurrency)
+	case bsontype.Decimal128:
+		parsed, err := Parse(raw.Decimal128().String(), DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+	default:
+		return fmt.Errorf("%w: tipo BSON %s", ErrInvalidAmount, t)
+	}
+
+	return nil
+}
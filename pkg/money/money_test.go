@@ -0,0 +1,258 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{input: "12.5", currency: "USD", want: 1250},
+		{input: "-3.05", currency: "USD", want: -305},
+		{input: " 0.10 ", currency: "USD", want: 10},
+		{input: "7", currency: "usd", want: 700},
+		{input: "1500", currency: "CLP", want: 1500},
+		{input: "0.001", currency: "USD", wantErr: true},
+		{input: "1.5", currency: "CLP", wantErr: true},
+		{input: "abc", currency: "USD", wantErr: true},
+		{input: "", currency: "USD", wantErr: true},
+		{input: "100000000000000000000", currency: "USD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.input, tt.currency)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Parse(%q, %s) error = %v, want ErrInvalidAmount", tt.input, tt.currency, err)
+			}
+			continue
+		}
+		if err != nil || got.Amount != tt.want {
+			t.Errorf("Parse(%q, %s) = %d, %v; want %d", tt.input, tt.currency, got.Amount, err, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Money
+		want   string
+	}{
+		{FromMinor(1250), "12.50"},
+		{FromMinor(5), "0.05"},
+		{FromMinor(-305), "-3.05"},
+		{FromMinor(-5), "-0.05"},
+		{FromMinor(0), "0.00"},
+		{New(1500, "CLP"), "1500"},
+		{Money{Amount: 100}, "1.00"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   int64
+	}{
+		{12.5, 1250},
+		{0.125, 13},
+		{-0.125, -13},
+		{0.1 + 0.2, 30},
+	}
+
+	for _, tt := range tests {
+		if got := FromFloat(tt.amount, "USD"); got.Amount != tt.want {
+			t.Errorf("FromFloat(%v) = %d, want %d", tt.amount, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		amount int64
+		factor float64
+		want   int64
+	}{
+		{15, 3, 45},
+		{25, 1.5, 38},
+		{-25, 1.5, -38},
+		{333, 0.5, 167},
+	}
+
+	for _, tt := range tests {
+		if got := FromMinor(tt.amount).Mul(tt.factor); got.Amount != tt.want {
+			t.Errorf("%d * %v = %d, want %d", tt.amount, tt.factor, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []Money
+		want    Money
+		wantErr bool
+	}{
+		{name: "none", want: FromMinor(0)},
+		{name: "same currency", amounts: []Money{FromMinor(100), FromMinor(-30), FromMinor(5)}, want: FromMinor(75)},
+		{name: "legacy without currency", amounts: []Money{{Amount: 100}, FromMinor(50)}, want: FromMinor(150)},
+		{name: "other currency", amounts: []Money{New(1000, "CLP"), New(500, "CLP")}, want: New(1500, "CLP")},
+		{name: "mixed currencies", amounts: []Money{FromMinor(100), New(100, "EUR")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sum(tt.amounts...)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCurrencyMismatch) {
+					t.Errorf("error = %v, want ErrCurrencyMismatch", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Sum() = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b    Money
+		want    int
+		wantErr bool
+	}{
+		{a: FromMinor(1), b: FromMinor(2), want: -1},
+		{a: FromMinor(2), b: FromMinor(2), want: 0},
+		{a: FromMinor(3), b: FromMinor(2), want: 1},
+		{a: FromMinor(3), b: New(2, "EUR"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.a.Compare(tt.b)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%+v.Compare(%+v) = %d, %v", tt.a, tt.b, got, err)
+		}
+		if tt.wantErr && !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("error = %v, want ErrCurrencyMismatch", err)
+		}
+	}
+}
+
+func TestArithmeticPanicsOnMismatch(t *testing.T) {
+	// Los montos llegan ya validados; mezclar monedas es un error de programación
+	tests := []struct {
+		name string
+		op   func()
+	}{
+		{name: "Add", op: func() { FromMinor(1).Add(New(1, "EUR")) }},
+		{name: "Sub", op: func() { FromMinor(1).Sub(New(1, "EUR")) }},
+		{name: "Cmp", op: func() { FromMinor(1).Cmp(New(1, "EUR")) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s() of different currencies did not panic", tt.name)
+				}
+			}()
+			tt.op()
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr error
+	}{
+		{input: `12.5`, want: FromMinor(1250)},
+		{input: `"3.05"`, want: FromMinor(305)},
+		{input: `{"amount": 12.5, "currency": "usd"}`, want: FromMinor(1250)},
+		{input: `{"amount": "3.05"}`, want: FromMinor(305)},
+		{input: `{"amount": 125}`, want: FromMinor(12500)},
+		{input: `{"amount": 125, "currency": "EUR"}`, wantErr: ErrCurrencyMismatch},
+		{input: `{"currency": "USD"}`, wantErr: ErrInvalidAmount},
+		{input: `1.001`, wantErr: ErrInvalidAmount},
+		{input: `"x"`, wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.input), &got)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Unmarshal(%s) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, %v; want %+v", tt.input, got, err, tt.want)
+		}
+	}
+
+	encoded, err := json.Marshal(map[string]Money{"cost": FromMinor(1250)})
+	if err != nil || string(encoded) != `{"cost":12.50}` {
+		t.Errorf("Marshal() = %s, %v", encoded, err)
+	}
+
+	// Lo que se codifica se vuelve a leer en la misma unidad
+	var back Money
+	if err := json.Unmarshal(encoded[len(`{"cost":`):len(encoded)-1], &back); err != nil || back != FromMinor(1250) {
+		t.Errorf("round trip = %+v, %v", back, err)
+	}
+}
+
+func TestBSON(t *testing.T) {
+	type doc struct {
+		Balance Money `bson:"balance"`
+	}
+
+	tests := []struct {
+		name  string
+		input interface{}
+		want  Money
+	}{
+		{name: "current format", input: bson.M{"balance": bson.M{"amount": int64(1250), "currency": "USD"}}, want: FromMinor(1250)},
+		{name: "legacy double", input: bson.M{"balance": 12.5}, want: FromMinor(1250)},
+		{name: "legacy int32", input: bson.M{"balance": int32(12)}, want: FromMinor(1200)},
+		{name: "legacy int64", input: bson.M{"balance": int64(12)}, want: FromMinor(1200)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got doc
+			if err := bson.Unmarshal(data, &got); err != nil || got.Balance != tt.want {
+				t.Errorf("Unmarshal() = %+v, %v; want %+v", got.Balance, err, tt.want)
+			}
+		})
+	}
+
+	data, err := bson.Marshal(doc{Balance: FromMinor(305)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back doc
+	if err := bson.Unmarshal(data, &back); err != nil || back.Balance != FromMinor(305) {
+		t.Errorf("round trip = %+v, %v", back.Balance, err)
+	}
+}
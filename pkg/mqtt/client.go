@@ -0,0 +1,289 @@
+// Package mqtt is a minimal MQTT 3.1.1 subscriber: it connects to a broker,
+// subscribes to a topic filter and delivers QoS 0 and 1 messages. Enough to
+// consume device telemetry without pulling a full client library
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Packet types
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	maxRemainingBytes = 268435455
+)
+
+var ErrConnectionRefused = errors.New("el broker MQTT rechazó la conexión")
+
+// Message is a publication received from the broker
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+type Options struct {
+	Broker    string // tcp://host:port
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+// Subscribe connects to the broker and calls handler for every message on
+// topics matching filter, until ctx is cancelled or the connection drops
+func Subscribe(ctx context.Context, opts Options, filter string, handler func(Message)) error {
+	address, err := brokerAddress(opts.Broker)
+	if err != nil {
+		return err
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 60 * time.Second
+	}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	c := &client{conn: conn, reader: bufio.NewReader(conn), keepAlive: opts.KeepAlive}
+	if err := c.connect(opts); err != nil {
+		return err
+	}
+	if err := c.subscribe(filter); err != nil {
+		return err
+	}
+
+	// Cerrar la conexión al cancelar para desbloquear la lectura
+	done := make(chan struct{})
+	defer close(done)
+	go c.keepAliveLoop(ctx, done)
+
+	for {
+		packetType, flags, body, err := c.readPacket()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		switch packetType {
+		case packetPublish:
+			message, packetID, err := parsePublish(flags, body)
+			if err != nil {
+				return err
+			}
+			if packetID != 0 {
+				if err := c.write(packetPuback<<4, uint16Bytes(packetID)); err != nil {
+					return err
+				}
+			}
+			handler(message)
+		case packetPingresp, packetSuback:
+		default:
+			return fmt.Errorf("paquete MQTT inesperado: %d", packetType)
+		}
+	}
+}
+
+type client struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	keepAlive time.Duration
+	mu        sync.Mutex // Serializa escrituras del lector y del keepalive
+}
+
+func (c *client) connect(opts Options) error {
+	flags := byte(0x02) // Sesión limpia
+	payload := encodeString(opts.ClientID)
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = append(payload, encodeString(opts.Username)...)
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+		payload = append(payload, encodeString(opts.Password)...)
+	}
+
+	body := append(encodeString("MQTT"), 4, flags)
+	body = append(body, uint16Bytes(uint16(opts.KeepAlive/time.Second))...)
+	body = append(body, payload...)
+	if err := c.write(packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	packetType, _, response, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if packetType != packetConnack || len(response) != 2 {
+		return errors.New("respuesta CONNACK inválida")
+	}
+	if response[1] != 0 {
+		return fmt.Errorf("%w (código %d)", ErrConnectionRefused, response[1])
+	}
+	return nil
+}
+
+func (c *client) subscribe(filter string) error {
+	body := uint16Bytes(1)
+	body = append(body, encodeString(filter)...)
+	body = append(body, 1) // QoS máxima 1
+	if err := c.write(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+
+	packetType, _, response, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if packetType != packetSuback || len(response) < 3 || response[2] == 0x80 {
+		return errors.New("el broker rechazó la suscripción a " + filter)
+	}
+	return nil
+}
+
+func (c *client) keepAliveLoop(ctx context.Context, done chan struct{}) {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = c.write(packetDisconnect<<4, nil)
+			c.conn.Close()
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.write(packetPingreq<<4, nil); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *client) write(header byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	packet := append([]byte{header}, encodeLength(len(body))...)
+	packet = append(packet, body...)
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// Read a whole packet. Without traffic for 1.5 keepalive periods the broker
+// is considered gone
+func (c *client) readPacket() (byte, byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if length > maxRemainingBytes {
+			return 0, 0, nil, errors.New("longitud de paquete MQTT inválida")
+		}
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0f, body, nil
+}
+
+func parsePublish(flags byte, body []byte) (Message, uint16, error) {
+	if len(body) < 2 {
+		return Message{}, 0, errors.New("PUBLISH inválido")
+	}
+	topicLength := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+topicLength {
+		return Message{}, 0, errors.New("PUBLISH inválido")
+	}
+	message := Message{Topic: string(body[2 : 2+topicLength])}
+	rest := body[2+topicLength:]
+
+	var packetID uint16
+	if qos := (flags >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, errors.New("PUBLISH inválido")
+		}
+		packetID = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+
+	message.Payload = rest
+	return message, packetID, nil
+}
+
+func brokerAddress(broker string) (string, error) {
+	parsed, err := url.Parse(broker)
+	if err != nil || parsed.Host == "" {
+		return "", errors.New("dirección de broker MQTT inválida: " + broker)
+	}
+	if parsed.Scheme != "tcp" && parsed.Scheme != "mqtt" {
+		return "", errors.New("esquema de broker MQTT no soportado: " + parsed.Scheme)
+	}
+	if parsed.Port() == "" {
+		return net.JoinHostPort(parsed.Hostname(), "1883"), nil
+	}
+	return parsed.Host, nil
+}
+
+func encodeString(s string) []byte {
+	return append(uint16Bytes(uint16(len(s))), s...)
+}
+
+func uint16Bytes(v uint16) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func encodeLength(length int) []byte {
+	var encoded []byte
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		encoded = append(encoded, b)
+		if length == 0 {
+			return encoded
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEncodeLength(t *testing.T) {
+	// Ejemplos de la sección 2.2.3 de MQTT 3.1.1
+	tests := []struct {
+		length  int
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{maxRemainingBytes, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+
+	for _, tt := range tests {
+		if got := encodeLength(tt.length); !bytes.Equal(got, tt.encoded) {
+			t.Errorf("encodeLength(%d) = %x, want %x", tt.length, got, tt.encoded)
+		}
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	body := bytes.Repeat([]byte{0xab}, 300)
+	packet := append([]byte{packetPublish<<4 | 0x02}, encodeLength(len(body))...)
+	packet = append(packet, body...)
+
+	c := pipeClient(t, packet)
+	packetType, flags, got, err := c.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packetType != packetPublish || flags != 0x02 || !bytes.Equal(got, body) {
+		t.Errorf("readPacket() = %d, %x, %d bytes", packetType, flags, len(got))
+	}
+}
+
+func TestReadPacketRejectsOversizedLength(t *testing.T) {
+	c := pipeClient(t, []byte{packetPublish << 4, 0xff, 0xff, 0xff, 0xff, 0x01})
+	if _, _, _, err := c.readPacket(); err == nil {
+		t.Error("readPacket() accepted a length over the maximum")
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    byte
+		body     []byte
+		topic    string
+		payload  string
+		packetID uint16
+		wantErr  bool
+	}{
+		{name: "qos 0", flags: 0x00, body: append(encodeString("bikes/1/telemetry"), "{}"...), topic: "bikes/1/telemetry", payload: "{}"},
+		{name: "qos 1", flags: 0x02, body: append(append(encodeString("a/b"), 0x12, 0x34), "x"...), topic: "a/b", payload: "x", packetID: 0x1234},
+		{name: "empty payload", flags: 0x00, body: encodeString("a"), topic: "a", payload: ""},
+		{name: "no topic length", flags: 0x00, body: []byte{0x00}, wantErr: true},
+		{name: "short topic", flags: 0x00, body: []byte{0x00, 0x05, 'a'}, wantErr: true},
+		{name: "qos 1 without id", flags: 0x02, body: append(encodeString("a"), 0x01), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, packetID, err := parsePublish(tt.flags, tt.body)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.Topic != tt.topic || string(message.Payload) != tt.payload || packetID != tt.packetID {
+				t.Errorf("parsePublish() = %q, %q, %d", message.Topic, message.Payload, packetID)
+			}
+		})
+	}
+}
+
+func TestBrokerAddress(t *testing.T) {
+	tests := []struct {
+		broker  string
+		address string
+		wantErr bool
+	}{
+		{broker: "tcp://localhost:1884", address: "localhost:1884"},
+		{broker: "mqtt://broker.local", address: "broker.local:1883"},
+		{broker: "ssl://broker.local:8883", wantErr: true},
+		{broker: "localhost:1883", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		address, err := brokerAddress(tt.broker)
+		if (err != nil) != tt.wantErr || address != tt.address {
+			t.Errorf("brokerAddress(%q) = %q, %v", tt.broker, address, err)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	broker := startBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages := make(chan Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		opts := Options{Broker: broker.url, ClientID: "api", Username: "user", Password: "secret", KeepAlive: time.Minute}
+		done <- Subscribe(ctx, opts, "bikes/+/telemetry", func(m Message) { messages <- m })
+	}()
+
+	conn := broker.accept()
+
+	packetType, _, body := conn.read()
+	if packetType != packetConnect {
+		t.Fatalf("first packet = %d, want CONNECT", packetType)
+	}
+	want := append(encodeString("MQTT"), 4, 0xc2, 0x00, 0x3c)
+	want = append(want, encodeString("api")...)
+	want = append(want, encodeString("user")...)
+	want = append(want, encodeString("secret")...)
+	if !bytes.Equal(body, want) {
+		t.Fatalf("CONNECT = %x, want %x", body, want)
+	}
+	conn.write(packetConnack<<4, []byte{0, 0})
+
+	packetType, flags, body := conn.read()
+	if packetType != packetSubscribe || flags != 0x02 {
+		t.Fatalf("second packet = %d/%x, want SUBSCRIBE", packetType, flags)
+	}
+	if want := append(append(uint16Bytes(1), encodeString("bikes/+/telemetry")...), 1); !bytes.Equal(body, want) {
+		t.Fatalf("SUBSCRIBE = %x, want %x", body, want)
+	}
+	conn.write(packetSuback<<4, []byte{0, 1, 1})
+
+	conn.write(packetPublish<<4|0x02, append(append(encodeString("bikes/42/telemetry"), 0, 7), `{"ts":1}`...))
+	if packetType, _, body := conn.read(); packetType != packetPuback || !bytes.Equal(body, []byte{0, 7}) {
+		t.Fatalf("after PUBLISH got %d %x, want PUBACK 7", packetType, body)
+	}
+	select {
+	case m := <-messages:
+		if m.Topic != "bikes/42/telemetry" || string(m.Payload) != `{"ts":1}` {
+			t.Errorf("message = %q %q", m.Topic, m.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+
+	cancel()
+	if packetType, _, _ := conn.read(); packetType != packetDisconnect {
+		t.Errorf("on cancel got %d, want DISCONNECT", packetType)
+	}
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Subscribe() = %v, want context.Canceled", err)
+	}
+}
+
+func TestSubscribeConnectionRefused(t *testing.T) {
+	broker := startBroker(t)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Subscribe(context.Background(), Options{Broker: broker.url, ClientID: "api"}, "#", func(Message) {})
+	}()
+
+	conn := broker.accept()
+	conn.read()
+	conn.write(packetConnack<<4, []byte{0, 5}) // No autorizado
+
+	if err := <-done; !errors.Is(err, ErrConnectionRefused) {
+		t.Errorf("Subscribe() = %v, want ErrConnectionRefused", err)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	broker := startBroker(t)
+	keepAlive := 400 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Subscribe(context.Background(), Options{Broker: broker.url, ClientID: "api", KeepAlive: keepAlive}, "#", func(Message) {})
+	}()
+
+	conn := broker.handshake()
+
+	// El cliente pide PINGREQ cada medio período y sigue vivo mientras hay respuesta
+	for i := 0; i < 2; i++ {
+		if packetType, _, _ := conn.read(); packetType != packetPingreq {
+			t.Fatalf("got %d, want PINGREQ", packetType)
+		}
+		conn.write(packetPingresp<<4, nil)
+	}
+
+	// Sin respuestas del broker la conexión se da por perdida
+	start := time.Now()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Subscribe() returned nil")
+		}
+		if elapsed := time.Since(start); elapsed > 2*keepAlive {
+			t.Errorf("dead broker detected after %v", elapsed)
+		}
+	case <-time.After(5 * keepAlive):
+		t.Fatal("Subscribe() did not notice the broker stopped answering")
+	}
+}
+
+func TestReconnectAfterBrokerDrop(t *testing.T) {
+	broker := startBroker(t)
+	opts := Options{Broker: broker.url, ClientID: "api", KeepAlive: time.Minute}
+
+	// La primera conexión se corta: Subscribe vuelve con error para que el
+	// llamador reconecte
+	done := make(chan error, 1)
+	go func() { done <- Subscribe(context.Background(), opts, "#", func(Message) {}) }()
+	broker.handshake().conn.Close()
+	if err := <-done; err == nil {
+		t.Fatal("Subscribe() returned nil after the broker closed the connection")
+	}
+
+	messages := make(chan Message, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { done <- Subscribe(ctx, opts, "#", func(m Message) { messages <- m }) }()
+
+	conn := broker.handshake()
+	conn.write(packetPublish<<4, append(encodeString("t"), "again"...))
+	select {
+	case m := <-messages:
+		if string(m.Payload) != "again" {
+			t.Errorf("payload = %q", m.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message after reconnecting")
+	}
+}
+
+// Client reading packets from data
+func pipeClient(t *testing.T, data []byte) *client {
+	t.Helper()
+	local, remote := net.Pipe()
+	t.Cleanup(func() { local.Close(); remote.Close() })
+	go remote.Write(data)
+	return &client{conn: local, reader: bufio.NewReader(local), keepAlive: time.Second}
+}
+
+type testBroker struct {
+	t        *testing.T
+	listener net.Listener
+	url      string
+}
+
+type brokerConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func startBroker(t *testing.T) *testBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return &testBroker{t: t, listener: listener, url: "tcp://" + listener.Addr().String()}
+}
+
+func (b *testBroker) accept() *brokerConn {
+	b.t.Helper()
+	conn, err := b.listener.Accept()
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	b.t.Cleanup(func() { conn.Close() })
+	return &brokerConn{t: b.t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// Accept a connection and answer its CONNECT and SUBSCRIBE
+func (b *testBroker) handshake() *brokerConn {
+	b.t.Helper()
+	conn := b.accept()
+	conn.read()
+	conn.write(packetConnack<<4, []byte{0, 0})
+	conn.read()
+	conn.write(packetSuback<<4, []byte{0, 1, 1})
+	return conn
+}
+
+func (c *brokerConn) read() (byte, byte, []byte) {
+	c.t.Helper()
+	reader := &client{conn: c.conn, reader: c.reader, keepAlive: 2 * time.Second}
+	packetType, flags, body, err := reader.readPacket()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return packetType, flags, body
+}
+
+func (c *brokerConn) write(header byte, body []byte) {
+	c.t.Helper()
+	writer := &client{conn: c.conn}
+	if err := writer.write(header, body); err != nil {
+		c.t.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package password hashes user passwords with argon2id and verifies them in
+// constant time. Hashes use the PHC string format, so they carry their own
+// parameters and can be upgraded when the configured cost changes
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const prefix = "$argon2id$"
+
+var ErrInvalidHash = errors.New("hash de contraseña inválido")
+
+// Params are the argon2id cost parameters
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Defaults follow the OWASP recommendation for argon2id
+var params = Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+// Set the cost of new hashes. Hashes with other parameters are reported as
+// needing a rehash
+func Configure(p Params) error {
+	if p.Memory < 8*uint32(p.Parallelism) || p.Iterations == 0 || p.Parallelism == 0 || p.SaltLength < 8 || p.KeyLength < 16 {
+		return errors.New("parámetros de argon2id inválidos")
+	}
+	params = p
+	return nil
+}
+
+// Configure the cost from PASSWORD_MEMORY_KB, PASSWORD_ITERATIONS and
+// PASSWORD_PARALLELISM, keeping the defaults for the unset ones
+func ConfigureFromEnv() error {
+	p := params
+
+	for name, target := range map[string]*uint32{
+		"PASSWORD_MEMORY_KB":  &p.Memory,
+		"PASSWORD_ITERATIONS": &p.Iterations,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || parsed == 0 {
+				return errors.New(name + " debe ser un entero positivo")
+			}
+			*target = uint32(parsed)
+		}
+	}
+
+	if value := os.Getenv("PASSWORD_PARALLELISM"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || parsed == 0 {
+			return errors.New("PASSWORD_PARALLELISM debe ser un entero entre 1 y 255")
+		}
+		p.Parallelism = uint8(parsed)
+	}
+
+	return Configure(p)
+}
+
+// Hash a password with a random salt and the configured parameters
+func Hash(plain string) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(plain), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", prefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify a password against a hash. needsRehash reports a hash made with
+// other parameters than the configured ones
+func Verify(plain, encoded string) (ok bool, needsRehash bool, err error) {
+	p, salt, key, err := decode(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	candidate := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+
+	return true, p != params, nil
+}
+
+// Whether stored is a hash made by this package, as opposed to a legacy
+// plaintext password
+func IsHash(stored string) bool {
+	return strings.HasPrefix(stored, prefix)
+}
+
+func decode(encoded string) (Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var p Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
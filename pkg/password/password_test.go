@@ -0,0 +1,149 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters so the tests run fast, restoring the defaults afterwards
+func useTestParams(t *testing.T) Params {
+	t.Helper()
+	previous := params
+	t.Cleanup(func() { params = previous })
+
+	p := Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	if err := Configure(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestHashAndVerify(t *testing.T) {
+	useTestParams(t)
+
+	hash, err := Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") || !IsHash(hash) {
+		t.Fatalf("Hash() = %q", hash)
+	}
+	if other, _ := Hash("correct horse"); other == hash {
+		t.Error("two hashes of the same password share the salt")
+	}
+
+	tests := []struct {
+		plain string
+		ok    bool
+	}{
+		{"correct horse", true},
+		{"correct horse ", false},
+		{"Correct horse", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		ok, needsRehash, err := Verify(tt.plain, hash)
+		if err != nil || ok != tt.ok || needsRehash {
+			t.Errorf("Verify(%q) = %v, %v, %v; want %v", tt.plain, ok, needsRehash, err, tt.ok)
+		}
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	useTestParams(t)
+	hash, err := Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Configure(Params{Memory: 128, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}); err != nil {
+		t.Fatal(err)
+	}
+	ok, needsRehash, err := Verify("secret", hash)
+	if err != nil || !ok || !needsRehash {
+		t.Errorf("Verify() = %v, %v, %v; want a match that needs a rehash", ok, needsRehash, err)
+	}
+
+	// Una contraseña incorrecta nunca pide rehash
+	if ok, needsRehash, _ := Verify("other", hash); ok || needsRehash {
+		t.Errorf("Verify(wrong) = %v, %v", ok, needsRehash)
+	}
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "plaintext", hash: "secret"},
+		{name: "empty", hash: ""},
+		{name: "other algorithm", hash: "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"},
+		{name: "other version", hash: "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"},
+		{name: "bad params", hash: "$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"},
+		{name: "zero cost", hash: "$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5"},
+		{name: "bad salt", hash: "$argon2id$v=19$m=64,t=1,p=1$***$a2V5a2V5a2V5a2V5"},
+		{name: "empty key", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$"},
+		{name: "missing part", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, _, err := Verify("secret", tt.hash); ok || !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("Verify() = %v, %v; want ErrInvalidHash", ok, err)
+			}
+		})
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	useTestParams(t)
+
+	tests := []struct {
+		name    string
+		params  Params
+		wantErr bool
+	}{
+		{name: "defaults", params: Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}},
+		{name: "memory below 8 KiB per lane", params: Params{Memory: 15, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32}, wantErr: true},
+		{name: "no iterations", params: Params{Memory: 64, Iterations: 0, Parallelism: 1, SaltLength: 16, KeyLength: 32}, wantErr: true},
+		{name: "no parallelism", params: Params{Memory: 64, Iterations: 1, Parallelism: 0, SaltLength: 16, KeyLength: 32}, wantErr: true},
+		{name: "short salt", params: Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 4, KeyLength: 32}, wantErr: true},
+		{name: "short key", params: Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 8}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Configure(tt.params); (err != nil) != tt.wantErr {
+				t.Errorf("Configure() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigureFromEnv(t *testing.T) {
+	p := useTestParams(t)
+
+	t.Setenv("PASSWORD_ITERATIONS", "4")
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	p.Iterations = 4
+	if params != p {
+		t.Errorf("params = %+v, want %+v", params, p)
+	}
+
+	for name, value := range map[string]string{
+		"PASSWORD_MEMORY_KB":   "-1",
+		"PASSWORD_ITERATIONS":  "0",
+		"PASSWORD_PARALLELISM": "300",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if err := ConfigureFromEnv(); err == nil {
+				t.Errorf("%s=%s accepted", name, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package totp
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secret of the SHA-1 test vectors of RFC 6238 ("12345678901234567890"), base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// Apéndice B de RFC 6238. Los vectores tienen 8 dígitos y los códigos de
+	// 6 dígitos son sus últimos 6
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		got, err := Code(rfcSecret, Step(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want[len(tt.want)-Digits:]; got != want {
+			t.Errorf("Code(T=%d) = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestCodeSecretFormats(t *testing.T) {
+	want, _ := Code(rfcSecret, 1)
+
+	for _, secret := range []string{strings.ToLower(rfcSecret), rfcSecret + "===="} {
+		if got, err := Code(secret, 1); err != nil || got != want {
+			t.Errorf("Code(%q) = %s, %v; want %s", secret, got, err, want)
+		}
+	}
+	for _, secret := range []string{"", "not base32!", "1"} {
+		if _, err := Code(secret, 1); !errors.Is(err, ErrInvalidSecret) {
+			t.Errorf("Code(%q) error = %v, want ErrInvalidSecret", secret, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	current := Step(at)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current", code: "050471", skew: 0, wantStep: current, wantOK: true},
+		{name: "surrounding spaces", code: " 050471 ", skew: 0, wantStep: current, wantOK: true},
+		{name: "previous step within skew", code: code(current - 1), skew: 1, wantStep: current - 1, wantOK: true},
+		{name: "next step within skew", code: code(current + 1), skew: 1, wantStep: current + 1, wantOK: true},
+		{name: "previous step without skew", code: code(current - 1), skew: 0},
+		{name: "two steps away", code: code(current - 2), skew: 1},
+		{name: "eight digits", code: "14050471", skew: 1},
+		{name: "wrong code", code: "000000", skew: 1},
+		{name: "empty", code: "", skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, at, tt.skew)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate() = %d, %v; want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := Validate("not base32!", "050471", at, 1); ok {
+		t.Error("Validate() accepted a code for an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != secretSize || strings.Contains(secret, "=") {
+		t.Errorf("GenerateSecret() = %q, %v", secret, err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("GenerateSecret() repeated a secret")
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Code() with a generated secret: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Bike Tracker", "ana@example.com", rfcSecret)
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Bike Tracker:ana@example.com" {
+		t.Errorf("URI() = %q", uri)
+	}
+	if strings.Contains(uri, "+") {
+		t.Errorf("URI() = %q encodes spaces as +", uri)
+	}
+
+	query := parsed.Query()
+	want := map[string]string{"secret": rfcSecret, "issuer": "Bike Tracker", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}